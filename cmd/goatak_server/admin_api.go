@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -19,6 +20,9 @@ import (
 
 	"github.com/kdudkov/goatak/cmd/goatak_server/tak_ws"
 	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/internal/federation"
+	"github.com/kdudkov/goatak/internal/filter"
+	"github.com/kdudkov/goatak/internal/webhook"
 	"github.com/kdudkov/goatak/internal/wshandler"
 	"github.com/kdudkov/goatak/pkg/cot"
 	"github.com/kdudkov/goatak/pkg/log"
@@ -40,17 +44,23 @@ func (h *HttpServer) NewAdminAPI(app *App, addr string, webtakRoot string) *Admi
 
 	engine.Delims("[[", "]]")
 
-	api.f = fiber.New(fiber.Config{EnablePrintRoutes: false, DisableStartupMessage: true, Views: engine})
+	api.f = fiber.New(fiber.Config{EnablePrintRoutes: false, DisableStartupMessage: true, CaseSensitive: true, Views: engine})
 
 	api.f.Use(log.NewFiberLogger(&log.LoggerConfig{Name: "admin_api", Level: slog.LevelDebug, UserGetter: Username}))
 	api.f.Use(h.CookieAuth)
+	api.f.Use(AdminRoleCheck)
 
 	staticfiles.Embed(api.f)
 
 	api.f.Get("/login", h.getAdminLoginHandler(app.config.Bool("delay")))
 	api.f.Post("/login", h.getAdminLoginHandler(app.config.Bool("delay")))
 	api.f.Post("/token", h.getAdminTokenHandler())
-	api.f.Get("/logout", logoutHandler)
+	api.f.Get("/logout", h.logoutHandler)
+
+	if h.oidc != nil {
+		api.f.Get("/oidc/login", h.getOidcLoginHandler())
+		api.f.Get("/oidc/callback", h.getOidcCallbackHandler(app))
+	}
 
 	api.f.Get("/", getIndexHandler())
 	api.f.Get("/units", getUnitsHandler())
@@ -61,13 +71,21 @@ func (h *HttpServer) NewAdminAPI(app *App, addr string, webtakRoot string) *Admi
 	api.f.Get("/devices", getDevicesPage())
 	api.f.Get("/profiles", getProfilesPage())
 	api.f.Get("/feeds", getFeedsPage())
+	api.f.Get("/federates", getFederatesPage())
+	api.f.Get("/audit", getAuditPage())
 
 	api.f.Get("/api/config", getConfigHandler(app))
 	api.f.Get("/api/connections", getApiConnHandler(app))
 
 	api.f.Get("/api/unit", getApiUnitsHandler(app))
 	api.f.Get("/api/unit/:uid/track", getApiUnitTrackHandler(app))
+	api.f.Get("/api/track", getApiTrackHandler(app))
+	api.f.Get("/api/track/at", getApiTrackAtHandler(app))
 	api.f.Delete("/api/unit/:uid", deleteItemHandler(app))
+	api.f.Get("/api/export/items", getApiExportItemsHandler(app))
+	api.f.Get("/api/export/track/:uid", getApiExportTrackHandler(app))
+	api.f.Get("/api/export/mission/:id", getApiExportMissionHandler(app))
+	api.f.Post("/api/import", getApiImportHandler(app))
 
 	api.f.Get("/ws", getWsHandler(app))
 	api.f.Get("/takproto/1", getTakWsHandler(app))
@@ -83,7 +101,15 @@ func (h *HttpServer) NewAdminAPI(app *App, addr string, webtakRoot string) *Admi
 	api.f.Get("/api/device", getApiDevicesHandler(app))
 	api.f.Post("/api/device", getApiDevicePostHandler(app))
 	api.f.Put("/api/device/:id", getApiDevicePutHandler(app))
+	api.f.Get("/api/device/:id/token", getApiTokensHandler(app))
+	api.f.Post("/api/device/:id/token", getApiTokenPostHandler(app))
+	api.f.Delete("/api/device/:id/token/:tid", getApiTokenRevokeHandler(app))
+	api.f.Get("/api/enrollment", getApiEnrollmentsHandler(app))
+	api.f.Post("/api/enrollment", getApiEnrollmentPostHandler(app))
+	api.f.Delete("/api/enrollment/:id", getApiEnrollmentDeleteHandler(app))
 	api.f.Get("/api/cert", getApiCertsHandler(app))
+	api.f.Get("/api/cert/crl", getApiCrlHandler(app))
+	api.f.Post("/api/cert/:serial/revoke", getApiCertRevokeHandler(app))
 	api.f.Get("/api/profile", getApiProfilesHandler(app))
 	api.f.Post("/api/profile", getApiProfilePostHandler(app))
 	api.f.Put("/api/profile/:login/:uid", getApiProfilePutHandler(app))
@@ -94,9 +120,39 @@ func (h *HttpServer) NewAdminAPI(app *App, addr string, webtakRoot string) *Admi
 	api.f.Put("/api/feed/:uid", getApiFeedPutHandler(app))
 	api.f.Delete("/api/feed/:uid", getApiFeedDeleteHandler(app))
 
+	api.f.Get("/api/federate", getApiFederatesHandler(app))
+
+	api.f.Get("/api/chat", getApiChatHandler(app))
+
+	api.f.Get("/api/geofence", getApiGeofencesHandler(app))
+	api.f.Post("/api/geofence", getApiGeofencePostHandler(app))
+	api.f.Put("/api/geofence/:uid", getApiGeofencePutHandler(app))
+	api.f.Delete("/api/geofence/:uid", getApiGeofenceDeleteHandler(app))
+	api.f.Get("/api/geofence/event", getApiGeofenceEventsHandler(app))
+
+	api.f.Get("/api/filter", getApiFiltersHandler(app))
+	api.f.Post("/api/filter", getApiFilterPostHandler(app))
+	api.f.Put("/api/filter/:name", getApiFilterPutHandler(app))
+	api.f.Delete("/api/filter/:name", getApiFilterDeleteHandler(app))
+
+	api.f.Get("/api/webhook", getApiWebhooksHandler(app))
+
+	api.f.Get("/api/emergency", getApiEmergenciesHandler(app))
+	api.f.Get("/api/emergency/:uid/log", getApiEmergencyLogHandler(app))
+	api.f.Post("/api/emergency/:uid/ack", getApiEmergencyAckHandler(app))
+	api.f.Post("/api/emergency/:uid/cancel", getApiEmergencyCancelHandler(app))
+
+	api.f.Get("/api/ban", getApiBansHandler(app))
+	api.f.Delete("/api/ban", getApiBanDeleteHandler(app))
+	api.f.Delete("/api/ban/:key", getApiBanDeleteHandler(app))
+
 	api.f.Get("/api/mission", getApiAllMissionHandler(app))
 	api.f.Get("/api/mission/:id/changes", getApiAllMissionChangesHandler(app))
 
+	api.f.Get("/api/audit", getApiAuditHandler(app))
+	api.f.Get("/api/audit/export", getApiAuditExportHandler(app))
+	api.f.Get("/api/audit/verify", getApiAuditVerifyHandler(app))
+
 	if webtakRoot != "" {
 		api.f.Static("/webtak", webtakRoot)
 		api.f.Get("/webtak-plugins/webtak-manifest.json", getPluginsManifestHandler(app))
@@ -119,16 +175,18 @@ func (h *HttpServer) getAdminLoginHandler(delay bool) func(c *fiber.Ctx) error {
 		login := c.FormValue("login")
 
 		if login == "" {
-			return c.Render("templates/login", nil)
+			return c.Render("templates/login", fiber.Map{"oidc": h.oidc != nil})
 		}
 
-		if user := h.userManager.Get(login); user.CanLogIn() && user.CheckPassword(c.FormValue("password")) {
+		if user := h.userManager.Get(login); user.CanLogIn() && h.userManager.CheckAuth(login, c.FormValue("password")) {
 			token, err := generateToken(login, h.tokenKey, h.tokenMaxAge)
 
 			if err != nil {
 				return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 			}
 
+			h.dbm.Audit(login, model.AUDIT_LOGIN, login, c.IP(), nil, nil)
+
 			cookie := &fiber.Cookie{Name: cookieName,
 				Value: token, Secure: false, HTTPOnly: true, Expires: time.Now().Add(h.tokenMaxAge)}
 			c.Cookie(cookie)
@@ -137,12 +195,13 @@ func (h *HttpServer) getAdminLoginHandler(delay bool) func(c *fiber.Ctx) error {
 		}
 
 		h.log.Warn("invalid login", "user", login)
+		h.dbm.Audit(login, model.AUDIT_LOGIN_FAILED, login, c.IP(), nil, nil)
 
 		if delay {
 			time.Sleep(time.Second * time.Duration(1+rand.Intn(5)))
 		}
 
-		return c.Render("templates/login", fiber.Map{"login": login, "error": "bad login or password"})
+		return c.Render("templates/login", fiber.Map{"login": login, "error": "bad login or password", "oidc": h.oidc != nil})
 	}
 }
 
@@ -156,7 +215,7 @@ func (h *HttpServer) getAdminTokenHandler() func(c *fiber.Ctx) error {
 
 		if login := m["login"]; login != "" {
 			if user := h.userManager.Get(login); user != nil {
-				if user.CanLogIn() && user.CheckPassword(m["password"]) {
+				if user.CanLogIn() && h.userManager.CheckAuth(login, m["password"]) {
 					token, err := generateToken(login, h.tokenKey, h.tokenMaxAge)
 
 					if err != nil {
@@ -164,20 +223,29 @@ func (h *HttpServer) getAdminTokenHandler() func(c *fiber.Ctx) error {
 						return err
 					}
 
+					h.dbm.Audit(login, model.AUDIT_LOGIN, login, c.IP(), nil, nil)
+
 					return c.JSON(fiber.Map{"token": token})
 				}
 			}
 
 			h.log.Warn("invalid login", "user", login)
+			h.dbm.Audit(login, model.AUDIT_LOGIN_FAILED, login, c.IP(), nil, nil)
 		}
 
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 }
 
-func logoutHandler(c *fiber.Ctx) error {
+func (h *HttpServer) logoutHandler(c *fiber.Ctx) error {
 	c.ClearCookie(cookieName)
 
+	if h.oidc != nil {
+		if u := h.oidc.LogoutURL(); u != "" {
+			return c.Redirect(u)
+		}
+	}
+
 	return c.Redirect("/")
 }
 
@@ -288,6 +356,18 @@ func getFeedsPage() fiber.Handler {
 	}
 }
 
+func getFederatesPage() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := map[string]any{
+			"theme": "auto",
+			"page":  " federates",
+			"js":    []string{"federates.js"},
+		}
+
+		return ctx.Render("templates/federates", data, "templates/menu", "templates/header")
+	}
+}
+
 func getConfigHandler(app *App) fiber.Handler {
 	m := make(map[string]any, 0)
 	m["lat"] = app.lat
@@ -309,7 +389,7 @@ func getConfigHandler(app *App) fiber.Handler {
 
 func getApiUnitsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		return ctx.JSON(getUnits(app))
+		return ctx.JSON(getUnits(app, AdminUser(ctx)))
 	}
 }
 
@@ -322,17 +402,55 @@ func getApiUnitTrackHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
-		return ctx.JSON(item.GetTrack())
+		if !AdminUser(ctx).CanManageScope(item.GetScope()) {
+			return sendForbidden(ctx)
+		}
+
+		p, err := parseTrackParams(ctx)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		var track []*model.Pos
+
+		if app.tracks != nil && !p.from.IsZero() {
+			// stored history is longer than the track in memory
+			recs, _ := loadTrack(app.dbm.PositionQuery().UID(uid).From(p.from).To(p.to))
+			for _, r := range recs {
+				track = append(track, r.Pos())
+			}
+		} else {
+			for _, pos := range item.GetTrack() {
+				if p.inRange(pos.Time) {
+					track = append(track, pos)
+				}
+			}
+		}
+
+		if track == nil {
+			track = make([]*model.Pos, 0)
+		}
+
+		track, _ = p.decimate(track)
+
+		return ctx.JSON(track)
 	}
 }
 
 func deleteItemHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		uid := ctx.Params("uid")
+		u := AdminUser(ctx)
+
+		if item := app.items.Get(uid); item != nil && !u.CanManageScope(item.GetScope()) {
+			return sendForbidden(ctx)
+		}
+
 		app.items.Remove(uid)
+		app.auditCtx(ctx, model.AUDIT_UNIT_DELETE, uid, nil, nil)
 
 		r := make(map[string]any, 0)
-		r["units"] = getUnits(app)
+		r["units"] = getUnits(app, u)
 		r["messages"] = app.messages
 
 		return ctx.JSON(r)
@@ -342,8 +460,13 @@ func deleteItemHandler(app *App) fiber.Handler {
 func getApiConnHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		conn := make([]*Connection, 0)
+		u := AdminUser(ctx)
 
 		app.ForAllClients(func(ch client.ClientHandler) bool {
+			if !u.CanManageScope(ch.GetDevice().GetScope()) {
+				return true
+			}
+
 			c := &Connection{
 				Uids:     ch.GetUids(),
 				User:     ch.GetDevice().GetLogin(),
@@ -352,6 +475,12 @@ func getApiConnHandler(app *App) fiber.Handler {
 				Scope:    ch.GetDevice().GetScope(),
 				LastSeen: ch.GetLastSeen(),
 			}
+
+			if q, ok := ch.(interface{ QueueStats() client.QueueStats }); ok {
+				st := q.QueueStats()
+				c.Queue = &st
+			}
+
 			conn = append(conn, c)
 
 			return true
@@ -369,6 +498,10 @@ func getCotXMLPostHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		scope := ctx.Query("scope", "test")
 
+		if !AdminUser(ctx).CanManageScope(scope) {
+			return sendForbidden(ctx)
+		}
+
 		ev := new(cot.Event)
 
 		if err := xml.Unmarshal(ctx.Body(), &ev); err != nil {
@@ -393,7 +526,7 @@ func getCotXMLPostHandler(app *App) fiber.Handler {
 
 func getApiAllMissionHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.MissionQuery().Full().Get()
+		data := filterScope(AdminUser(ctx), app.dbm.MissionQuery().Full().Get(), func(m *model.Mission) string { return m.Scope })
 
 		result := make([]*model.MissionDTO, len(data))
 
@@ -414,6 +547,14 @@ func getApiAllMissionChangesHandler(app *App) fiber.Handler {
 
 		m := app.dbm.MissionQuery().Id(uint(id)).One()
 
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if !AdminUser(ctx).CanManageScope(m.Scope) {
+			return sendForbidden(ctx)
+		}
+
 		ch := app.dbm.GetChanges(m.ID, time.Now().Add(-time.Hour*24*365), false)
 
 		return ctx.JSON(model.MissionDTOList(m.Name, ch))
@@ -422,7 +563,8 @@ func getApiAllMissionChangesHandler(app *App) fiber.Handler {
 
 func getApiFilesHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.ResourceQuery().Order("scope, created_at DESC").Get()
+		data := filterScope(AdminUser(ctx), app.dbm.ResourceQuery().Order("scope, created_at DESC").Get(),
+			func(r *model.Resource) string { return r.Scope })
 
 		return ctx.JSON(data)
 	}
@@ -446,6 +588,10 @@ func getApiFileHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !AdminUser(ctx).CanManageScope(pi.Scope) {
+			return sendForbidden(ctx)
+		}
+
 		f, err := app.files.GetFile(pi.Hash, pi.Scope)
 
 		if err != nil {
@@ -493,6 +639,10 @@ func getApiZipFileHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !AdminUser(ctx).CanManageScope(pi.Scope) {
+			return sendForbidden(ctx)
+		}
+
 		if pi.MIMEType != "application/x-zip-compressed" {
 			return ctx.SendStatus(fiber.StatusBadRequest)
 		}
@@ -540,9 +690,14 @@ func getApiFileDeleteHandler(app *App) fiber.Handler {
 		if pi == nil {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
+
+		if !AdminUser(ctx).CanManageScope(pi.Scope) {
+			return sendForbidden(ctx)
+		}
 		
 		app.dbm.ResourceQuery().Id(uint(id)).Delete()
 		app.files.Delete(pi.Hash, pi.Scope)
+		app.auditCtx(ctx, model.AUDIT_FILE_DELETE, strconv.Itoa(id), pi, nil)
 		
 		return ctx.RedirectToRoute("admin_files", nil)
 	}
@@ -550,20 +705,68 @@ func getApiFileDeleteHandler(app *App) fiber.Handler {
 
 func getApiPointsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.PointQuery().Order("created_at DESC").Get()
+		data := filterScope(AdminUser(ctx), app.dbm.PointQuery().Order("created_at DESC").Get(),
+			func(p *model.Point) string { return p.Scope })
 
 		return ctx.JSON(data)
 	}
 }
 
-func getApiDevicesHandler(app *App) fiber.Handler {
+func getApiChatHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.DeviceQuery().Full().Get()
+		q := app.dbm.ChatQuery().
+			Chatroom(ctx.Query("chatroom")).
+			Participant(ctx.Query("uid")).
+			From(ctx.Query("from")).
+			To(ctx.Query("to")).
+			Scope(ctx.Query("scope")).
+			ReadScope(AdminUser(ctx).AdminScopes()).
+			Limit(ctx.QueryInt("limit", 100)).
+			Offset(ctx.QueryInt("offset", 0))
+
+		if d := ctx.Query("direct"); d != "" {
+			q.Direct(ctx.QueryBool("direct"))
+		}
+
+		if s := ctx.Query("after"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return SendError(ctx, "bad time "+s)
+			}
 
-		devices := make([]*model.DeviceDTO, len(data))
+			q.After(t)
+		}
 
-		for i, d := range data {
-			devices[i] = d.DTO()
+		if s := ctx.Query("before"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return SendError(ctx, "bad time "+s)
+			}
+
+			q.Before(t)
+		}
+
+		data := q.Get()
+
+		res := make([]*model.ChatRecordDTO, len(data))
+
+		for i, c := range data {
+			res[i] = c.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiDevicesHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		u := AdminUser(ctx)
+		devices := make([]*model.DeviceDTO, 0)
+
+		for _, d := range app.dbm.DeviceQuery().Full().Get() {
+			if canSeeDevice(u, d) {
+				devices = append(devices, d.DTO())
+			}
 		}
 
 		return ctx.JSON(devices)
@@ -590,9 +793,18 @@ func getApiDevicePostHandler(app *App) fiber.Handler {
 			return SendError(ctx, "empty scope")
 		}
 
+		if !model.IsValidRole(m.Role) {
+			return SendError(ctx, "bad role "+m.Role)
+		}
+
+		if !canSetDevice(AdminUser(ctx), &m.DevicePutDTO) {
+			return sendForbidden(ctx)
+		}
+
 		d := &model.Device{
 			Login:     m.Login,
 			Admin:     m.Admin,
+			Role:      m.Role,
 			Disabled:  m.Disabled,
 			Scope:     m.Scope,
 			ReadScope: m.ReadScope,
@@ -606,13 +818,22 @@ func getApiDevicePostHandler(app *App) fiber.Handler {
 			return SendError(ctx, err.Error())
 		}
 
+		if err := app.updateDeviceGroups(d, m.GroupList()); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.auditCtx(ctx, model.AUDIT_DEVICE_CREATE, d.Login, nil, d.DTO())
+
 		return ctx.JSON(d.DTO())
 	}
 }
 
 func getApiCertsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.CertsQuery().Get()
+		u := AdminUser(ctx)
+		scopes := app.loginScopes()
+
+		data := filterScope(u, app.dbm.CertsQuery().Get(), func(c *model.Certificate) string { return scopes[c.Login] })
 
 		certs := make([]*model.CertificateDTO, len(data))
 
@@ -624,9 +845,50 @@ func getApiCertsHandler(app *App) fiber.Handler {
 	}
 }
 
+func getApiCertRevokeHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+
+		if len(ctx.Body()) > 0 {
+			if err := ctx.BodyParser(&req); err != nil {
+				return SendError(ctx, err.Error())
+			}
+		}
+
+		if c := app.dbm.CertsQuery().SN(ctx.Params("serial")).One(); c != nil && !app.canManageLogin(AdminUser(ctx), c.Login) {
+			return sendForbidden(ctx)
+		}
+
+		if err := app.revokeCert(ctx.Params("serial"), Username(ctx), req.Reason); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.auditCtx(ctx, model.AUDIT_CERT_REVOKE, ctx.Params("serial"), nil, req)
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func getApiCrlHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		crl, err := app.makeCRL()
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		ctx.Attachment("goatak.crl")
+		ctx.Set(fiber.HeaderContentType, "application/pkix-crl")
+
+		return ctx.Send(crl)
+	}
+}
+
 func getApiDevicePutHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		login := ctx.Params("id")
+		u := AdminUser(ctx)
 
 		d := app.dbm.DeviceQuery().Login(login).One()
 
@@ -634,37 +896,76 @@ func getApiDevicePutHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !canManageDevice(u, d) {
+			return sendForbidden(ctx)
+		}
+
 		var m *model.DevicePutDTO
 
 		if err := ctx.BodyParser(&m); err != nil {
 			return err
 		}
 
+		before := d.DTO()
+
+		if !model.IsValidRole(m.Role) {
+			return SendError(ctx, "bad role "+m.Role)
+		}
+
+		if !canSetDevice(u, m) {
+			return sendForbidden(ctx)
+		}
+
 		if m.Password != "" {
 			if err := d.SetPassword(m.Password); err != nil {
 				return err
 			}
 		}
 
+		// groups made from scope follow scope change, custom groups are changed only with groups in request
+		scopeGroups := isScopeGroups(d)
+
 		d.Scope = m.Scope
 		d.ReadScope = m.ReadScope
 		//d.Admin = m.Admin
 		d.Disabled = m.Disabled
 
+		if m.Role != "" {
+			d.Role = m.Role
+		}
+
 		app.dbm.Save(d)
 
-		return ctx.JSON(d.DTO())
+		if m.Groups != nil || scopeGroups {
+			if err := app.updateDeviceGroups(d, m.GroupList()); err != nil {
+				return SendError(ctx, err.Error())
+			}
+		}
+
+		after := d.DTO()
+
+		if m.Password != "" {
+			app.auditCtx(ctx, model.AUDIT_DEVICE_UPDATE, d.Login, before, fiber.Map{"device": after, "password_changed": true})
+		} else {
+			app.auditCtx(ctx, model.AUDIT_DEVICE_UPDATE, d.Login, before, after)
+		}
+
+		return ctx.JSON(after)
 	}
 }
 
 func getApiProfilesHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.ProfileQuery().Get()
+		u := AdminUser(ctx)
+		scopes := app.loginScopes()
 
-		profiles := make([]*model.ProfileDTO, len(data))
+		profiles := make([]*model.ProfileDTO, 0)
 
-		for i, p := range data {
-			profiles[i] = p.DTO()
+		for _, p := range app.dbm.ProfileQuery().Get() {
+			// default profiles are visible to all admins
+			if p.Login == "*" || u.CanManageScope(scopes[p.Login]) {
+				profiles = append(profiles, p.DTO())
+			}
 		}
 
 		return ctx.JSON(profiles)
@@ -697,10 +998,16 @@ func getApiProfilePostHandler(app *App) fiber.Handler {
 			p.UID = "*"
 		}
 
+		if !app.canManageProfile(AdminUser(ctx), p.Login) {
+			return sendForbidden(ctx)
+		}
+
 		if err := app.dbm.Create(p); err != nil {
 			return SendError(ctx, err.Error())
 		}
 
+		app.auditCtx(ctx, model.AUDIT_PROFILE_CREATE, p.Login+"/"+p.UID, nil, p.DTO())
+
 		return ctx.JSON(p.DTO())
 	}
 }
@@ -716,12 +1023,18 @@ func getApiProfilePutHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		if !app.canManageProfile(AdminUser(ctx), p.Login) {
+			return sendForbidden(ctx)
+		}
+
 		var m *model.ProfilePutDTO
 
 		if err := ctx.BodyParser(&m); err != nil {
 			return err
 		}
 
+		before := p.DTO()
+
 		p.Callsign = m.Callsign
 		p.Team = m.Team
 		p.Role = m.Role
@@ -732,6 +1045,8 @@ func getApiProfilePutHandler(app *App) fiber.Handler {
 			return SendError(ctx, err.Error())
 		}
 
+		app.auditCtx(ctx, model.AUDIT_PROFILE_UPDATE, p.Login+"/"+p.UID, before, p.DTO())
+
 		return ctx.JSON(p.DTO())
 	}
 }
@@ -741,17 +1056,27 @@ func getApiProfileDeleteHandler(app *App) fiber.Handler {
 		login := ctx.Params("login")
 		uid := ctx.Params("uid")
 
+		if !app.canManageProfile(AdminUser(ctx), login) {
+			return sendForbidden(ctx)
+		}
+
+		before := app.dbm.ProfileQuery().Login(login).UID(uid).One()
+
 		if err := app.dbm.ProfileQuery().Login(login).UID(uid).Delete(); err != nil {
 			return SendError(ctx, err.Error())
 		}
 
+		if before != nil {
+			app.auditCtx(ctx, model.AUDIT_PROFILE_DELETE, login+"/"+uid, before.DTO(), nil)
+		}
+
 		return ctx.JSON(fiber.Map{"status": "ok"})
 	}
 }
 
 func getApiFeedsHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		data := app.dbm.FeedQuery().All(true).Get()
+		data := filterScope(AdminUser(ctx), app.dbm.FeedQuery().All(true).Get(), func(f *model.Feed2) string { return f.Scope })
 
 		feeds := make([]*model.Feed2DTO, len(data))
 
@@ -775,6 +1100,10 @@ func getApiFeedPostHandler(app *App) fiber.Handler {
 			m.UID = uuid.NewString()
 		}
 
+		if !AdminUser(ctx).CanManageScope(m.Scope) {
+			return sendForbidden(ctx)
+		}
+
 		f := &model.Feed2{
 			UID:       m.UID,
 			Active:    m.Active,
@@ -793,6 +1122,8 @@ func getApiFeedPostHandler(app *App) fiber.Handler {
 			return SendError(ctx, err.Error())
 		}
 
+		app.auditCtx(ctx, model.AUDIT_FEED_CREATE, f.UID, nil, f.DTO(true))
+
 		return ctx.JSON(f.DTO(true))
 	}
 }
@@ -813,6 +1144,12 @@ func getApiFeedPutHandler(app *App) fiber.Handler {
 			return err
 		}
 
+		if !AdminUser(ctx).CanManageScopes(f.Scope, m.Scope) {
+			return sendForbidden(ctx)
+		}
+
+		before := f.DTO(true)
+
 		f.Active = m.Active
 		f.Alias = m.Alias
 		f.URL = m.URL
@@ -827,6 +1164,8 @@ func getApiFeedPutHandler(app *App) fiber.Handler {
 			return SendError(ctx, err.Error())
 		}
 
+		app.auditCtx(ctx, model.AUDIT_FEED_UPDATE, f.UID, before, f.DTO(true))
+
 		return ctx.JSON(f.DTO(true))
 	}
 }
@@ -835,10 +1174,383 @@ func getApiFeedDeleteHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		uid := ctx.Params("uid")
 
+		f := app.dbm.FeedQuery().UID(uid).All(true).One()
+
+		if f != nil && !AdminUser(ctx).CanManageScope(f.Scope) {
+			return sendForbidden(ctx)
+		}
+
 		if err := app.dbm.FeedQuery().UID(uid).Delete(); err != nil {
 			return SendError(ctx, err.Error())
 		}
 
+		if f != nil {
+			app.auditCtx(ctx, model.AUDIT_FEED_DELETE, uid, f.DTO(true), nil)
+		}
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func getApiFederatesHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		peers := app.federation.Peers()
+		res := make([]*federation.PeerDTO, len(peers))
+
+		for i, p := range peers {
+			res[i] = p.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiGeofencesHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := filterScope(AdminUser(ctx), app.dbm.GeofenceQuery().Scope(ctx.Query("scope")).Get(),
+			func(f *model.Geofence) string { return f.Scope })
+
+		res := make([]*model.GeofenceDTO, len(data))
+
+		for i, f := range data {
+			res[i] = f.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiGeofencePostHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var m *model.GeofencePostDTO
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return err
+		}
+
+		if !AdminUser(ctx).CanManageScope(m.Scope) {
+			return sendForbidden(ctx)
+		}
+
+		f, err := app.newGeofence("", m)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if err := app.dbm.Create(f); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.geofences.Set(f)
+		app.auditCtx(ctx, model.AUDIT_FENCE_CREATE, f.UID, nil, f.DTO())
+
+		return ctx.JSON(f.DTO())
+	}
+}
+
+func getApiGeofencePutHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		uid := ctx.Params("uid")
+
+		old := app.dbm.GeofenceQuery().UID(uid).One()
+
+		if old == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		var m *model.GeofencePostDTO
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return err
+		}
+
+		if !AdminUser(ctx).CanManageScopes(old.Scope, m.Scope) {
+			return sendForbidden(ctx)
+		}
+
+		f, err := app.newGeofence(uid, m)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		f.CreatedAt = old.CreatedAt
+
+		if err := app.dbm.Save(f); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.geofences.Set(f)
+		app.auditCtx(ctx, model.AUDIT_FENCE_UPDATE, f.UID, old.DTO(), f.DTO())
+
+		return ctx.JSON(f.DTO())
+	}
+}
+
+func getApiGeofenceDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		uid := ctx.Params("uid")
+
+		f := app.dbm.GeofenceQuery().UID(uid).One()
+
+		if f != nil && !AdminUser(ctx).CanManageScope(f.Scope) {
+			return sendForbidden(ctx)
+		}
+
+		if err := app.dbm.GeofenceQuery().UID(uid).Delete(); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.geofences.Remove(uid)
+
+		if f != nil {
+			app.auditCtx(ctx, model.AUDIT_FENCE_DELETE, uid, f.DTO(), nil)
+		}
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func getApiGeofenceEventsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		q := app.dbm.GeofenceEventQuery().
+			Fence(ctx.Query("fence")).
+			UID(ctx.Query("uid")).
+			Limit(ctx.QueryInt("limit", 100)).
+			Offset(ctx.QueryInt("offset", 0))
+
+		if s := ctx.Query("after"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return SendError(ctx, "bad time "+s)
+			}
+
+			q.After(t)
+		}
+
+		if s := ctx.Query("before"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return SendError(ctx, "bad time "+s)
+			}
+
+			q.Before(t)
+		}
+
+		u := AdminUser(ctx)
+		fences := make(map[string]string)
+
+		for _, f := range app.dbm.GeofenceQuery().Get() {
+			fences[f.UID] = f.Scope
+		}
+
+		data := filterScope(u, q.Get(), func(e *model.GeofenceEvent) string { return fences[e.FenceUID] })
+
+		res := make([]*model.GeofenceEventDTO, len(data))
+
+		for i, e := range data {
+			res[i] = e.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiFiltersHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		rules := app.filters.Rules()
+		res := make([]*filter.RuleDTO, len(rules))
+
+		for i, r := range rules {
+			res[i] = r.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiFilterPostHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var m *filter.RuleConfig
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return err
+		}
+
+		if err := app.filters.Add(m); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if err := app.saveFilterRules(); err != nil {
+			return err
+		}
+
+		app.auditCtx(ctx, model.AUDIT_FILTER_CREATE, m.Name, nil, m)
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func getApiFilterPutHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var m *filter.RuleConfig
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return err
+		}
+
+		if err := app.filters.Update(ctx.Params("name"), m); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if err := app.saveFilterRules(); err != nil {
+			return err
+		}
+
+		app.auditCtx(ctx, model.AUDIT_FILTER_UPDATE, ctx.Params("name"), nil, m)
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func getApiFilterDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if !app.filters.Remove(ctx.Params("name")) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if err := app.saveFilterRules(); err != nil {
+			return err
+		}
+
+		app.auditCtx(ctx, model.AUDIT_FILTER_DELETE, ctx.Params("name"), nil, nil)
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func getApiWebhooksHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		hooks := app.webhooks.Hooks()
+		res := make([]*webhook.HookDTO, len(hooks))
+
+		for i, h := range hooks {
+			res[i] = h.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiEmergenciesHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := app.dbm.EmergencyQuery().
+			Status(ctx.Query("status")).
+			Scope(ctx.Query("scope")).
+			ReadScope(AdminUser(ctx).AdminScopes()).
+			Contact(ctx.Query("contact")).
+			Active(ctx.QueryBool("active")).
+			Limit(ctx.QueryInt("limit", 100)).
+			Offset(ctx.QueryInt("offset", 0)).
+			Get()
+
+		res := make([]*model.EmergencyDTO, len(data))
+
+		for i, e := range data {
+			res[i] = e.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiEmergencyLogHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if !app.canManageEmergency(AdminUser(ctx), ctx.Params("uid")) {
+			return sendForbidden(ctx)
+		}
+
+		data := app.dbm.EmergencyLogQuery().
+			Emergency(ctx.Params("uid")).
+			Order("created_at").
+			Limit(ctx.QueryInt("limit", 100)).
+			Offset(ctx.QueryInt("offset", 0)).
+			Get()
+
+		res := make([]*model.EmergencyLogDTO, len(data))
+
+		for i, l := range data {
+			res[i] = l.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiEmergencyAckHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if !app.canManageEmergency(AdminUser(ctx), ctx.Params("uid")) {
+			return sendForbidden(ctx)
+		}
+
+		e, err := app.ackEmergency(ctx.Params("uid"), Username(ctx))
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		return ctx.JSON(e.DTO())
+	}
+}
+
+func getApiEmergencyCancelHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if !app.canManageEmergency(AdminUser(ctx), ctx.Params("uid")) {
+			return sendForbidden(ctx)
+		}
+
+		e, err := app.cancelEmergency(ctx.Params("uid"), Username(ctx))
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		// remove alert from devices
+		if msg, err := cot.CotFromProto(e.CancelMsg(), "", e.Scope); err == nil {
+			app.sendEmergency(msg)
+		}
+
+		return ctx.JSON(e.DTO())
+	}
+}
+
+func getApiBansHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		return ctx.JSON(app.limits.Bans())
+	}
+}
+
+func getApiBanDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		key, err := url.PathUnescape(ctx.Params("key"))
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if key == "" {
+			if !ctx.QueryBool("all") {
+				return SendError(ctx, "empty key, use all=true to remove all bans")
+			}
+
+			app.limits.UnbanAll()
+			app.auditCtx(ctx, model.AUDIT_UNBAN, "*", nil, nil)
+
+			return ctx.JSON(fiber.Map{"status": "ok"})
+		}
+
+		if !app.limits.Unban(key) {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		app.auditCtx(ctx, model.AUDIT_UNBAN, key, nil, nil)
+
 		return ctx.JSON(fiber.Map{"status": "ok"})
 	}
 }
@@ -854,10 +1566,24 @@ func getWsHandler(app *App) fiber.Handler {
 		name := uuid.NewString()
 
 		h := wshandler.NewHandler(app.logger, name, ws)
+		u := User(ws)
 
 		app.logger.Debug("ws listener connected")
-		app.items.ChangeCallback().SubscribeNamed(name, h.SendItem)
+		app.items.ChangeCallback().SubscribeNamed(name, func(item *model.Item) bool {
+			if !u.CanManageScope(item.GetScope()) {
+				return true
+			}
+
+			return h.SendItem(item)
+		})
 		app.items.DeleteCallback().SubscribeNamed(name, h.DeleteItem)
+		app.emergencyCb.SubscribeNamed(name, func(e *model.EmergencyDTO) bool {
+			if !u.CanManageScope(e.Scope) {
+				return true
+			}
+
+			return h.SendEmergency(e)
+		})
 		h.Listen()
 		app.logger.Debug("ws listener disconnected")
 	})
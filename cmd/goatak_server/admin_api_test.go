@@ -41,8 +41,13 @@ func NewTestApp() *TestApp {
 	cfg.Set("db", ":memory:")
 	cfg.Set("delay", false)
 
+	a, err := NewApp(cfg)
+	if err != nil {
+		panic(err)
+	}
+
 	app := &TestApp{
-		App: NewApp(cfg),
+		App: a,
 	}
 
 	if err := app.items.Start(); err != nil {
@@ -62,6 +67,7 @@ func NewTestApp() *TestApp {
 		log:         app.logger.With("logger", "http"),
 		listeners:   make(map[string]Listener),
 		userManager: app.users,
+		dbm:         app.dbm,
 		tokenKey:    []byte("111"),
 		tokenMaxAge: time.Hour,
 		loginUrl:    "/login",
@@ -110,6 +116,34 @@ func (app *TestApp) PostJSON(url, token string, obj any) (*http.Response, error)
 	return app.api.f.Test(req, 3000)
 }
 
+func (app *TestApp) SendJSON(method, url, token string, obj any) (*http.Response, error) {
+	d, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(d))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	return app.api.f.Test(req, 3000)
+}
+
+func adminToken(t *testing.T, app *TestApp, login, psw string) string {
+	resp, err := app.PostJSON("/token", "", fiber.Map{"login": login, "password": psw})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	m := make(map[string]string)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+
+	return m["token"]
+}
+
 func TestLogin(t *testing.T) {
 	app := NewTestApp()
 
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// superAdminPaths are server wide settings, only super admin can see and change them.
+var superAdminPaths = []string{"/api/filter", "/api/ban", "/api/federate", "/api/webhook", "/api/audit"}
+
+// sendPaths send messages to clients, read-only operators can't use them with any method.
+var sendPaths = []string{"/cot", "/cot_xml", "/takproto/1"}
+
+// AdminRoleCheck denies changes for read-only operators and server wide settings for not super admins.
+// Scope of the objects is checked by handlers.
+func AdminRoleCheck(c *fiber.Ctx) error {
+	// routing is case sensitive, but path is normalized too to be safe with non strict routing
+	path := strings.TrimSuffix(strings.ToLower(c.Path()), "/") + "/"
+	send := slices.ContainsFunc(sendPaths, func(p string) bool { return path == p+"/" })
+
+	if !strings.HasPrefix(path, "/api/") && !send {
+		return c.Next()
+	}
+
+	u := AdminUser(c)
+
+	if u.AdminRole() == "" {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if !u.CanWrite() && (send || c.Method() != fiber.MethodGet || strings.HasPrefix(path, "/api/file/delete/")) {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if !u.IsSuperAdmin() {
+		for _, p := range superAdminPaths {
+			if strings.HasPrefix(path, p+"/") {
+				return c.SendStatus(fiber.StatusForbidden)
+			}
+		}
+	}
+
+	return c.Next()
+}
+
+// canSeeDevice checks if admin can see the device in lists.
+func canSeeDevice(u, d *model.Device) bool {
+	return u.IsSuperAdmin() || u.CanManageScope(d.Scope) || u.GetLogin() == d.Login
+}
+
+// canManageDevice checks if admin can change the device. Only super admin can change other admins.
+func canManageDevice(u, d *model.Device) bool {
+	if u.IsSuperAdmin() {
+		return true
+	}
+
+	return u.CanWrite() && !d.Admin && u.CanManageScopes(append([]string{d.Scope}, d.ReadScope...)...)
+}
+
+// canManageLogin checks if admin can change objects of the login, like profiles and certificates.
+func (app *App) canManageLogin(u *model.Device, login string) bool {
+	if u.IsSuperAdmin() {
+		return true
+	}
+
+	d := app.dbm.DeviceQuery().Login(login).One()
+
+	return d != nil && canManageDevice(u, d)
+}
+
+// loginScopes returns map login -> scope for all devices.
+func (app *App) loginScopes() map[string]string {
+	res := make(map[string]string)
+
+	for _, d := range app.dbm.DeviceQuery().Get() {
+		res[d.Login] = d.Scope
+	}
+
+	return res
+}
+
+// filterScope leaves only objects of the scopes admin can see.
+func filterScope[T any](u *model.Device, data []T, scope func(T) string) []T {
+	if u.AdminScopes() == nil {
+		return data
+	}
+
+	res := make([]T, 0, len(data))
+
+	for _, d := range data {
+		if u.CanManageScope(scope(d)) {
+			res = append(res, d)
+		}
+	}
+
+	return res
+}
+
+func sendForbidden(ctx *fiber.Ctx) error {
+	return ctx.SendStatus(fiber.StatusForbidden)
+}
+
+// canSetDevice checks if admin can give the device admin role, scopes and groups.
+func canSetDevice(u *model.Device, m *model.DevicePutDTO) bool {
+	if u.IsSuperAdmin() {
+		return true
+	}
+
+	if m.Admin || m.Role != "" {
+		return false
+	}
+
+	scopes := append([]string{m.Scope}, m.ReadScope...)
+
+	for _, g := range m.GroupList() {
+		scopes = append(scopes, g.Name)
+	}
+
+	return u.CanManageScopes(scopes...)
+}
+
+// canManageProfile checks login of the profile, default profiles (login *) are for super admin only.
+func (app *App) canManageProfile(u *model.Device, login string) bool {
+	if login == "*" {
+		return u.IsSuperAdmin()
+	}
+
+	return app.canManageLogin(u, login)
+}
+
+func (app *App) canManageEmergency(u *model.Device, uid string) bool {
+	e := app.dbm.EmergencyQuery().UID(uid).One()
+
+	return e == nil || u.CanManageScope(e.Scope)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func scopedDevice(login, pass, scope, role string) *model.Device {
+	d := Device(login, pass, role != "", false)
+	d.Scope = scope
+	d.Role = role
+
+	return d
+}
+
+const cotXML = `<event version="2.0" uid="test1" type="a-f-G" how="m-g" time="2024-01-01T00:00:00Z" start="2024-01-01T00:00:00Z" stale="2034-01-01T00:00:00Z"><point lat="1" lon="2" hae="0" ce="10" le="10"/></event>`
+
+func TestAdminRoles(t *testing.T) {
+	app := NewTestApp()
+
+	app.dbm.Save(scopedDevice("blue_adm", "b", "blue", model.RoleScopeAdmin))
+	app.dbm.Save(scopedDevice("blue_op", "o", "blue", model.RoleOperator))
+	app.dbm.Save(&model.Device{Login: "blue1", Scope: "blue"})
+	app.dbm.Save(&model.Device{Login: "red1", Scope: "red"})
+
+	require.NoError(t, app.dbm.Create(&model.Feed2{UID: "f1", Scope: "blue"}))
+	require.NoError(t, app.dbm.Create(&model.Feed2{UID: "f2", Scope: "red"}))
+
+	super := adminToken(t, app, "adm1", "111")
+	scopeAdm := adminToken(t, app, "blue_adm", "b")
+	op := adminToken(t, app, "blue_op", "o")
+
+	logins := func(token string) []string {
+		resp, err := app.Req("GET", "/api/device", token, nil)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var devices []*model.DeviceDTO
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&devices))
+
+		res := make([]string, len(devices))
+		for i, d := range devices {
+			res[i] = d.Login
+		}
+
+		return res
+	}
+
+	assert.ElementsMatch(t, []string{"blue_adm", "blue_op", "blue1"}, logins(scopeAdm))
+	assert.Contains(t, logins(super), "red1")
+
+	t.Run("scope_admin", func(t *testing.T) {
+		resp, err := app.SendJSON("PUT", "/api/device/red1", scopeAdm, fiber.Map{"scope": "red"})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.SendJSON("PUT", "/api/device/blue1", scopeAdm, fiber.Map{"scope": "red"})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.SendJSON("PUT", "/api/device/blue1", scopeAdm, fiber.Map{"scope": "blue", "disabled": true})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.True(t, app.dbm.DeviceQuery().Login("blue1").One().Disabled)
+
+		// can't make admins and can't change other admins
+		resp, err = app.SendJSON("PUT", "/api/device/blue1", scopeAdm, fiber.Map{"scope": "blue", "role": model.RoleSuperAdmin})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.SendJSON("PUT", "/api/device/blue_op", scopeAdm, fiber.Map{"scope": "blue"})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.SendJSON("DELETE", "/api/feed/f2", scopeAdm, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.SendJSON("DELETE", "/api/feed/f1", scopeAdm, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		resp, err = app.Req("GET", "/api/filter", scopeAdm, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.Req("POST", "/cot_xml?scope=red", scopeAdm, strings.NewReader(cotXML))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.Req("POST", "/cot_xml?scope=blue", scopeAdm, strings.NewReader(cotXML))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("operator", func(t *testing.T) {
+		resp, err := app.Req("GET", "/api/feed", op, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		resp, err = app.SendJSON("PUT", "/api/device/blue1", op, fiber.Map{"scope": "blue"})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.Req("POST", "/cot_xml?scope=blue", op, strings.NewReader(cotXML))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+		resp, err = app.Req("GET", "/takproto/1", op, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("super_admin", func(t *testing.T) {
+		resp, err := app.SendJSON("PUT", "/api/device/blue_op", super, fiber.Map{"scope": "blue", "role": model.RoleScopeAdmin})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, model.RoleScopeAdmin, app.dbm.DeviceQuery().Login("blue_op").One().Role)
+
+		resp, err = app.SendJSON("PUT", "/api/device/blue_op", super, fiber.Map{"scope": "blue", "role": "root"})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotAcceptable, resp.StatusCode)
+
+		resp, err = app.Req("GET", "/api/filter", super, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestAdminRolesPathCase(t *testing.T) {
+	app := NewTestApp()
+
+	app.dbm.Save(scopedDevice("blue_adm", "b", "blue", model.RoleScopeAdmin))
+	app.dbm.Save(scopedDevice("blue_op", "o", "blue", model.RoleOperator))
+
+	super := adminToken(t, app, "adm1", "111")
+	scopeAdm := adminToken(t, app, "blue_adm", "b")
+	op := adminToken(t, app, "blue_op", "o")
+
+	for _, tc := range []struct {
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{scopeAdm, "GET", "/API/ban", fiber.StatusForbidden},
+		{scopeAdm, "GET", "/API/audit", fiber.StatusForbidden},
+		{scopeAdm, "GET", "/Api/Filter", fiber.StatusForbidden},
+		{scopeAdm, "GET", "/api/filter/", fiber.StatusForbidden},
+		{scopeAdm, "GET", "/api/ban/", fiber.StatusForbidden},
+		{op, "DELETE", "/API/ban?all=true", fiber.StatusForbidden},
+		{op, "DELETE", "/api/ban/?all=true", fiber.StatusForbidden},
+		{op, "POST", "/COT_XML", fiber.StatusForbidden},
+		{op, "POST", "/cot_xml/", fiber.StatusForbidden},
+		// routes are case sensitive
+		{super, "GET", "/API/filter", fiber.StatusNotFound},
+		{super, "GET", "/api/filter/", fiber.StatusOK},
+	} {
+		resp, err := app.Req(tc.method, tc.path, tc.token, nil)
+		require.NoError(t, err)
+		assert.Equal(t, tc.status, resp.StatusCode, tc.method+" "+tc.path)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// tokenDevice returns device from the path if logged in admin can manage its tokens.
+// Tokens can't be managed with api token.
+func tokenDevice(app *App, ctx *fiber.Ctx) (*model.Device, error) {
+	if ctx.Locals(ApiTokenKey) != nil {
+		return nil, fiber.ErrForbidden
+	}
+
+	d := app.dbm.DeviceQuery().Login(ctx.Params("id")).One()
+	if d == nil {
+		return nil, fiber.ErrNotFound
+	}
+
+	if u := AdminUser(ctx); u.GetLogin() != d.Login && !canManageDevice(u, d) {
+		return nil, fiber.ErrForbidden
+	}
+
+	return d, nil
+}
+
+func getApiTokensHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		d, err := tokenDevice(app, ctx)
+		if err != nil {
+			return err
+		}
+
+		data := app.dbm.ApiTokenQuery().Login(d.Login).Limit(0).Get()
+
+		res := make([]*model.ApiTokenDTO, len(data))
+
+		for i, t := range data {
+			res[i] = t.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiTokenPostHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		d, err := tokenDevice(app, ctx)
+		if err != nil {
+			return err
+		}
+
+		var m *model.ApiTokenPostDTO
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if m.Name == "" {
+			return SendError(ctx, "empty name")
+		}
+
+		for _, p := range m.Paths {
+			if !strings.HasPrefix(p, "/") {
+				return SendError(ctx, "bad path "+p)
+			}
+		}
+
+		t, token, err := model.NewApiToken(d.Login)
+		if err != nil {
+			return err
+		}
+
+		t.Name = m.Name
+		t.Write = m.Write
+		t.Paths = m.Paths
+		t.CreatedBy = Username(ctx)
+
+		if m.Days > 0 {
+			exp := time.Now().Add(time.Hour * 24 * time.Duration(m.Days))
+			t.ExpiresAt = &exp
+		}
+
+		if err := app.dbm.Create(t); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		dto := t.DTO()
+		app.auditCtx(ctx, model.AUDIT_TOKEN_CREATE, d.Login, nil, dto)
+
+		dto.Token = token
+
+		return ctx.JSON(dto)
+	}
+}
+
+func getApiTokenRevokeHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		d, err := tokenDevice(app, ctx)
+		if err != nil {
+			return err
+		}
+
+		id, err := ctx.ParamsInt("tid")
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		t := app.dbm.ApiTokenQuery().Login(d.Login).Id(uint(id)).One()
+		if t == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if t.RevokedAt == nil {
+			if err := app.dbm.ApiTokenQuery().Id(t.ID).Update(map[string]any{"revoked_at": time.Now()}); err != nil {
+				return SendError(ctx, err.Error())
+			}
+
+			app.auditCtx(ctx, model.AUDIT_TOKEN_REVOKE, d.Login, t.DTO(), nil)
+		}
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func newApiToken(t *testing.T, app *TestApp, token, login string, m *model.ApiTokenPostDTO) *model.ApiTokenDTO {
+	resp, err := app.PostJSON("/api/device/"+login+"/token", token, m)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	dto := new(model.ApiTokenDTO)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(dto))
+	require.NotEmpty(t, dto.Token)
+
+	return dto
+}
+
+func TestApiTokens(t *testing.T) {
+	app := NewTestApp()
+
+	admin := adminToken(t, app, "adm1", "111")
+
+	ro := newApiToken(t, app, admin, "adm1", &model.ApiTokenPostDTO{Name: "ro", Paths: []string{"/api/unit"}})
+	rw := newApiToken(t, app, admin, "adm1", &model.ApiTokenPostDTO{Name: "rw", Write: true, Paths: []string{"/api/unit", "/cot"}})
+
+	for _, d := range []struct {
+		method string
+		url    string
+		token  string
+		status int
+	}{
+		{"GET", "/api/unit", ro.Token, fiber.StatusOK},
+		{"GET", "/api/device", ro.Token, fiber.StatusForbidden},
+		{"DELETE", "/api/unit/111", ro.Token, fiber.StatusForbidden},
+		{"DELETE", "/api/unit/111", rw.Token, fiber.StatusOK},
+		{"GET", "/api/device", rw.Token, fiber.StatusForbidden},
+		{"GET", "/api/unit", "gat_bad", fiber.StatusUnauthorized},
+	} {
+		resp, err := app.Req(d.method, d.url, d.token, nil)
+		require.NoError(t, err)
+		assert.Equal(t, d.status, resp.StatusCode, d.method+" "+d.url)
+	}
+
+	tok := app.dbm.ApiTokenQuery().Token(ro.Token).One()
+	require.NotNil(t, tok)
+	assert.NotNil(t, tok.LastUsed)
+	assert.Equal(t, "adm1", tok.CreatedBy)
+
+	// api token can't make new tokens
+	all := newApiToken(t, app, admin, "adm1", &model.ApiTokenPostDTO{Name: "all", Write: true})
+	resp, err := app.PostJSON("/api/device/adm1/token", all.Token, &model.ApiTokenPostDTO{Name: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.Req("DELETE", "/api/device/adm1/token/"+strconv.Itoa(int(ro.ID)), admin, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/unit", ro.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	// token works with device rights
+	app.dbm.Save(Device("usr3", "3", false, false))
+	usr := newApiToken(t, app, admin, "usr3", &model.ApiTokenPostDTO{Name: "usr"})
+
+	resp, err = app.Req("GET", "/api/unit", usr.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+}
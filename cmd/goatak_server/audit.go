@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const auditExportBatch = 1000
+
+// auditCtx stores audit event made by logged in admin.
+func (app *App) auditCtx(ctx *fiber.Ctx, action, object string, before, after any) {
+	app.dbm.Audit(Username(ctx), action, object, ctx.IP(), before, after)
+}
+
+// certRejectedError is returned from tls connection check, so rejected connection can be logged with the address.
+type certRejectedError struct {
+	user   string
+	serial string
+	reason string
+}
+
+func (e *certRejectedError) Error() string {
+	return e.reason
+}
+
+func auditQuery(app *App, ctx *fiber.Ctx) (*database.AuditQuery, error) {
+	q := app.dbm.AuditQuery().
+		Actor(ctx.Query("actor")).
+		Action(ctx.Query("action")).
+		Object(ctx.Query("object")).
+		IP(ctx.Query("ip"))
+
+	if s := ctx.Query("after"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, err
+		}
+
+		q.After(t)
+	}
+
+	if s := ctx.Query("before"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Before(t)
+	}
+
+	return q, nil
+}
+
+func getAuditPage() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := map[string]any{
+			"theme": "auto",
+			"page":  " audit",
+			"js":    []string{"audit.js"},
+		}
+
+		return ctx.Render("templates/audit", data, "templates/menu", "templates/header")
+	}
+}
+
+func getApiAuditHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		q, err := auditQuery(app, ctx)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		data := q.Limit(ctx.QueryInt("limit", 100)).Offset(ctx.QueryInt("offset", 0)).Get()
+
+		res := make([]*model.AuditEventDTO, len(data))
+
+		for i, e := range data {
+			res[i] = e.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+// getApiAuditExportHandler sends events as json lines, oldest first.
+func getApiAuditExportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if _, err := auditQuery(app, ctx); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		ctx.Attachment("audit.jsonl")
+		ctx.Set(fiber.HeaderContentType, "application/x-ndjson")
+
+		w := bufio.NewWriter(ctx.Response().BodyWriter())
+		enc := json.NewEncoder(w)
+
+		for offset := 0; ; offset += auditExportBatch {
+			q, _ := auditQuery(app, ctx)
+			data := q.Order("id").Limit(auditExportBatch).Offset(offset).Get()
+
+			for _, e := range data {
+				if err := enc.Encode(e.DTO()); err != nil {
+					return err
+				}
+			}
+
+			if len(data) < auditExportBatch {
+				break
+			}
+		}
+
+		return w.Flush()
+	}
+}
+
+func getApiAuditVerifyHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		n, err := app.dbm.VerifyAudit()
+		if err != nil {
+			app.logger.Error("audit log check failed", slog.Any("error", err))
+
+			return ctx.JSON(fiber.Map{"status": "error", "checked": n, "error": err.Error()})
+		}
+
+		return ctx.JSON(fiber.Map{"status": "ok", "checked": n})
+	}
+}
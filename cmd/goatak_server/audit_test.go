@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestAuditApi(t *testing.T) {
+	app := NewTestApp()
+
+	resp, err := app.PostJSON("/token", "", fiber.Map{"login": "adm1", "password": "bad"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	token := adminToken(t, app, "adm1", "111")
+
+	resp, err = app.PostJSON("/api/device", token, fiber.Map{"login": "user1", "password": "1", "scope": "blue"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.SendJSON("PUT", "/api/device/user1", token, fiber.Map{"scope": "red"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/audit?object=user1", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var events []*model.AuditEventDTO
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&events))
+	require.Len(t, events, 2)
+
+	assert.Equal(t, model.AUDIT_DEVICE_UPDATE, events[0].Action)
+	assert.Equal(t, "adm1", events[0].Actor)
+	assert.Contains(t, string(events[0].Before), `"scope":"blue"`)
+	assert.Contains(t, string(events[0].After), `"scope":"red"`)
+	assert.NotContains(t, string(events[1].After), "password")
+
+	resp, err = app.Req("GET", "/api/audit/export", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	actions := make([]string, 0)
+	sc := bufio.NewScanner(resp.Body)
+
+	for sc.Scan() {
+		e := new(model.AuditEventDTO)
+		require.NoError(t, json.Unmarshal(sc.Bytes(), e))
+		actions = append(actions, e.Action)
+	}
+
+	assert.Equal(t, []string{model.AUDIT_LOGIN_FAILED, model.AUDIT_LOGIN, model.AUDIT_DEVICE_CREATE, model.AUDIT_DEVICE_UPDATE}, actions)
+
+	resp, err = app.Req("GET", "/api/audit/verify", token, nil)
+	require.NoError(t, err)
+
+	m := make(map[string]any)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	assert.Equal(t, "ok", m["status"])
+}
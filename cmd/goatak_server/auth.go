@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"math/rand"
+	"slices"
 	"strings"
 	"time"
 
@@ -21,18 +22,28 @@ const (
 	cookieName  = "token"
 	bearer      = "Bearer"
 	UsernameKey = "username"
+	PasswordKey = "password"
 	UserKey     = "user"
 	SerialKey   = "sn"
+	ApiTokenKey = "api_token"
+
+	// last used time of api token is saved not more often than this
+	tokenUsedInterval = time.Minute
 )
 
 var (
 	noTokenErr = errors.New("api token required")
 	badToken   = errors.New("bad token")
 	badUser    = errors.New("invalid user")
+	badPath    = errors.New("token is not allowed here")
 )
 
 func (h *HttpServer) HeaderAuth(c *fiber.Ctx) error {
-	user, err := h.checkToken(getToken(c))
+	user, err := h.authenticate(c)
+
+	if errors.Is(err, badPath) {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
 
 	if err != nil {
 		c.ClearCookie(cookieName)
@@ -57,9 +68,18 @@ func (h *HttpServer) CookieAuth(c *fiber.Ctx) error {
 		}
 	}
 
-	user, err := h.checkToken(getToken(c))
+	user, err := h.authenticate(c)
+
+	if errors.Is(err, badPath) {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	}
 
 	if err != nil {
+		// scripts get error, not the login page
+		if isApiToken(getToken(c)) {
+			return c.Status(fiber.StatusUnauthorized).SendString(err.Error())
+		}
+
 		c.ClearCookie(cookieName)
 		return c.Redirect(h.loginUrl)
 	}
@@ -70,6 +90,55 @@ func (h *HttpServer) CookieAuth(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// authenticate checks jwt or personal api token. Api token is also checked for request method and path.
+func (h *HttpServer) authenticate(c *fiber.Ctx) (*model.Device, error) {
+	tokenStr := getToken(c)
+
+	if !isApiToken(tokenStr) {
+		return h.checkToken(tokenStr)
+	}
+
+	user, tok, err := h.checkApiToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tok.Allows(c.Method(), c.Path()) {
+		return nil, badPath
+	}
+
+	c.Locals(ApiTokenKey, tok)
+
+	return user, nil
+}
+
+func (h *HttpServer) checkApiToken(tokenStr string) (*model.Device, *model.ApiToken, error) {
+	tok := h.dbm.ApiTokenQuery().Token(tokenStr).One()
+
+	now := time.Now()
+
+	if !tok.IsActive(now) {
+		return nil, nil, badToken
+	}
+
+	u := h.userManager.Get(tok.Login)
+	if !u.CanLogIn() {
+		return nil, nil, badUser
+	}
+
+	if tok.LastUsed == nil || now.Sub(*tok.LastUsed) > tokenUsedInterval {
+		if err := h.dbm.ApiTokenQuery().Id(tok.ID).Update(map[string]any{"last_used": now}); err != nil {
+			h.log.Warn("token update error", slog.Any("error", err))
+		}
+	}
+
+	return u, tok, nil
+}
+
+func isApiToken(s string) bool {
+	return strings.HasPrefix(s, model.ApiTokenPrefix)
+}
+
 func (h *HttpServer) checkToken(tokenStr string) (*model.Device, error) {
 	if tokenStr == "" {
 		return nil, noTokenErr
@@ -102,11 +171,38 @@ func (h *HttpServer) checkToken(tokenStr string) (*model.Device, error) {
 	return nil, badUser
 }
 
-func (h *HttpServer) DeviceAuthHandler() fiber.Handler {
-	return basicauth.New(basicauth.Config{
+// DeviceAuthHandler checks device login and password. Token of the enrollment invitation is accepted instead of the password
+// only on enrollment paths and only if the device is not disabled.
+func (h *HttpServer) DeviceAuthHandler(enrollPaths ...string) fiber.Handler {
+	device := basicauth.New(basicauth.Config{
 		Authorizer:      h.userManager.CheckAuth,
 		ContextUsername: UsernameKey,
+		ContextPassword: PasswordKey,
+	})
+
+	enroll := basicauth.New(basicauth.Config{
+		Authorizer: func(username, password string) bool {
+			if e := h.dbm.EnrollmentQuery().Login(username).Token(password).One(); e != nil {
+				if d := h.dbm.DeviceQuery().Login(username).One(); d != nil && d.Disabled {
+					return false
+				}
+
+				return e.IsValid(time.Now())
+			}
+
+			return h.userManager.CheckAuth(username, password)
+		},
+		ContextUsername: UsernameKey,
+		ContextPassword: PasswordKey,
 	})
+
+	return func(c *fiber.Ctx) error {
+		if slices.Contains(enrollPaths, c.Path()) {
+			return enroll(c)
+		}
+
+		return device(c)
+	}
 }
 
 func SSLCheckHandler(app *App) fiber.Handler {
@@ -122,6 +218,7 @@ func SSLCheckHandler(app *App) fiber.Handler {
 				}
 
 				app.logger.Warn(fmt.Sprintf("invalid user %s serial %s", username, serial))
+				app.dbm.Audit(username, model.AUDIT_TLS_REJECTED, serial, ctx.IP(), nil, fiber.Map{"reason": "bad user"})
 			}
 		}
 
@@ -141,6 +238,15 @@ func Username(c *fiber.Ctx) string {
 	return u.(string)
 }
 
+// AdminUser returns device of the logged in admin.
+func AdminUser(c *fiber.Ctx) *model.Device {
+	if u, ok := c.Locals(UserKey).(*model.Device); ok {
+		return u
+	}
+
+	return nil
+}
+
 func User(c *websocket.Conn) *model.Device {
 	val := c.Locals(UserKey)
 
@@ -19,6 +19,7 @@ import (
 	"github.com/kdudkov/goatak/pkg/log"
 
 	"github.com/kdudkov/goatak/cmd/goatak_server/mp"
+	"github.com/kdudkov/goatak/pkg/model"
 	"github.com/kdudkov/goatak/pkg/tlsutil"
 )
 
@@ -26,6 +27,14 @@ const (
 	p12Password = "atakatak"
 )
 
+// enrollPaths accept token of the enrollment invitation instead of the password.
+var enrollPaths = []string{
+	"/Marti/api/tls/config",
+	"/Marti/api/tls/signClient",
+	"/Marti/api/tls/signClient/v2",
+	"/Marti/api/tls/profile/enrollment",
+}
+
 type CertAPI struct {
 	f    *fiber.App
 	addr string
@@ -44,7 +53,7 @@ func (h *HttpServer) NewCertAPI(app *App, addr string) *CertAPI {
 	api.f.Use(NewMetricHandler("cert_api"))
 	api.f.Use(log.NewFiberLogger(&log.LoggerConfig{Name: "cert_api", UserGetter: Username}))
 
-	api.f.Use(h.DeviceAuthHandler())
+	api.f.Use(h.DeviceAuthHandler(enrollPaths...))
 
 	if app.config.EnrollSSL() {
 		api.tls = true
@@ -129,10 +138,6 @@ func (app *App) processSignRequest(ctx *fiber.Ctx) (*x509.Certificate, error) {
 
 	app.logger.Info(fmt.Sprintf("cert sign req from %s %s ver %s", username, uid, ver))
 
-	if !app.users.IsValid(username, "") {
-		return nil, fmt.Errorf("bad user")
-	}
-
 	clientCSR, err := tlsutil.ParseCsr(ctx.Body())
 	if err != nil {
 		return nil, fmt.Errorf("empty csr block")
@@ -142,6 +147,16 @@ func (app *App) processSignRequest(ctx *fiber.Ctx) (*x509.Certificate, error) {
 		return nil, fmt.Errorf("bad user in csr")
 	}
 
+	d, err := app.useEnrollment(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// device made by the invitation can be not in users cache yet
+	if !d.IsGood() && !app.users.IsValid(username, "") {
+		return nil, fmt.Errorf("bad user")
+	}
+
 	till := time.Now().Add(time.Duration(app.config.CertTTLDays()*24) * time.Hour)
 	signedCert, err := signClientCert(uid, clientCSR,
 		app.config.ServerCert, app.config.TlsCert.PrivateKey, till)
@@ -151,6 +166,7 @@ func (app *App) processSignRequest(ctx *fiber.Ctx) (*x509.Certificate, error) {
 
 	serial := hex.EncodeToString(signedCert.SerialNumber.Bytes())
 	app.users.SaveSignInfo(username, uid, serial, till)
+	app.dbm.Audit(username, model.AUDIT_CERT_SIGN, serial, ctx.IP(), nil, fiber.Map{"uid": uid, "till": till, "version": ver})
 	app.logger.Info(fmt.Sprintf("new cert signed for user %s uid %s ver %s serial %s", username, uid, ver, serial))
 
 	return signedCert, nil
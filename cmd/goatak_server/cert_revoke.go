@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+const crlNextUpdate = time.Hour * 24
+
+func (app *App) isCertRevoked(sn string) bool {
+	if sn == "" {
+		return false
+	}
+
+	return app.dbm.CertsQuery().SN(sn).Revoked(true).Count() > 0
+}
+
+// revokeCert marks certificate as revoked and disconnects all clients using it.
+func (app *App) revokeCert(sn, user, reason string) error {
+	cert := app.dbm.CertsQuery().SN(sn).One()
+
+	if cert == nil {
+		return fmt.Errorf("certificate %s not found", sn)
+	}
+
+	if cert.IsRevoked() {
+		return fmt.Errorf("certificate %s is already revoked", sn)
+	}
+
+	err := app.dbm.CertsQuery().SN(sn).Update(map[string]any{
+		"revoked_at": time.Now(),
+		"revoked_by": user,
+		"reason":     reason,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	app.logger.Warn(fmt.Sprintf("certificate %s of %s revoked by %s: %s", sn, cert.Login, user, reason))
+
+	app.ForAllClients(func(ch client.ClientHandler) bool {
+		if ch.GetSerial() == sn {
+			app.logger.Info(fmt.Sprintf("disconnect %s, certificate is revoked", ch.GetName()))
+			ch.Stop()
+		}
+
+		return true
+	})
+
+	return nil
+}
+
+// makeCRL returns DER encoded CRL with all revoked certificates, signed by the server certificate.
+func (app *App) makeCRL() ([]byte, error) {
+	if app.config.ServerCert == nil || app.config.TlsCert == nil {
+		return nil, fmt.Errorf("no server certificate")
+	}
+
+	certs := app.dbm.CertsQuery().Revoked(true).Limit(0).Get()
+	revoked := make([]tlsutil.Revoked, 0, len(certs))
+
+	for _, c := range certs {
+		revoked = append(revoked, tlsutil.Revoked{Serial: c.Serial, Time: *c.RevokedAt})
+	}
+
+	return tlsutil.MakeCRL(app.config.ServerCert, app.config.TlsCert.PrivateKey, revoked, crlNextUpdate)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/repository"
+)
+
+func TestRevokeCert(t *testing.T) {
+	app, clients := newPipelineApp(1, 2)
+	clients[0].serial = "0a0b"
+	clients[1].serial = "0c0d"
+
+	users := repository.NewUserDbRepository("", app.dbm)
+
+	users.SaveSignInfo("user0", "uid0", "0a0b", time.Now().Add(time.Hour))
+	users.SaveSignInfo("user1", "uid1", "0c0d", time.Now().Add(time.Hour))
+
+	require.Error(t, app.revokeCert("ffff", "admin", ""))
+
+	require.NoError(t, app.revokeCert("0a0b", "admin", "lost"))
+	require.Error(t, app.revokeCert("0a0b", "admin", "lost"))
+
+	assert.True(t, clients[0].stopped.Load())
+	assert.False(t, clients[1].stopped.Load())
+
+	assert.True(t, app.isCertRevoked("0a0b"))
+	assert.False(t, app.isCertRevoked("0c0d"))
+	assert.False(t, app.isCertRevoked(""))
+
+	c := app.dbm.CertsQuery().SN("0a0b").One()
+	require.NotNil(t, c)
+	assert.Equal(t, "admin", c.RevokedBy)
+	assert.Equal(t, "lost", c.Reason)
+
+	// new cert for the same device must keep the revoked one
+	users.SaveSignInfo("user0", "uid0", "0e0f", time.Now().Add(time.Hour))
+	assert.True(t, app.isCertRevoked("0a0b"))
+	assert.Equal(t, int64(2), app.dbm.CertsQuery().Login("user0").Count())
+
+	revoked := app.dbm.CertsQuery().Revoked(true).Get()
+	require.Len(t, revoked, 1)
+	assert.Equal(t, "0a0b", revoked[0].DTO().Serial)
+	assert.NotNil(t, revoked[0].DTO().RevokedAt)
+}
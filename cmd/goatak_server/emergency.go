@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/chat"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	EMERGENCY_FROM_UID      = "EMERGENCY_UID"
+	EMERGENCY_FROM_CALLSIGN = "Emergency"
+
+	emergencyEvent = "emergency"
+)
+
+// emergencyProcessor tracks alerts from devices. Alerts are not stored as map items,
+// they are sent to the sender scope and to all scopes from emergency.scopes config.
+func (app *App) emergencyProcessor(msg *cot.CotMessage) bool {
+	user := msg.GetCallsign()
+	if d := app.msgDevice(msg); d != nil {
+		user = d.GetLogin()
+	}
+
+	if model.IsEmergencyCancel(msg) {
+		if _, err := app.cancelEmergency(msg.GetUID(), user); err != nil {
+			app.logger.Debug(fmt.Sprintf("emergency %s cancel: %s", msg.GetUID(), err.Error()))
+		}
+	} else {
+		app.updateEmergency(msg, user)
+	}
+
+	app.sendEmergency(msg)
+
+	return false
+}
+
+func (app *App) updateEmergency(msg *cot.CotMessage, user string) {
+	e := model.EmergencyFromMsg(msg)
+
+	if old := app.dbm.EmergencyQuery().UID(e.UID).One(); old.IsActive() {
+		old.Lat, old.Lon = e.Lat, e.Lon
+
+		if old.Type != e.Type {
+			app.emergencyLog(old.UID, "update", user, fmt.Sprintf("%s -> %s", old.Kind, e.Kind))
+			old.Type, old.Kind = e.Type, e.Kind
+			old.Status = model.EMERGENCY_ACTIVE
+		}
+
+		if err := app.dbm.Save(old); err != nil {
+			app.logger.Error("error saving emergency", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	e.CreatedAt = time.Now()
+
+	if err := app.dbm.Save(e); err != nil {
+		app.logger.Error("error saving emergency", slog.Any("error", err))
+	}
+
+	app.logger.Warn(fmt.Sprintf("emergency %s from %s (%s)", e.Kind, e.Callsign, e.ContactUID))
+	app.emergencyLog(e.UID, "start", user, fmt.Sprintf("%s from %s", e.Kind, e.Callsign))
+	app.notifyEmergency(e)
+}
+
+func (app *App) ackEmergency(uid, user string) (*model.Emergency, error) {
+	e := app.dbm.EmergencyQuery().UID(uid).One()
+	if !e.IsActive() {
+		return nil, fmt.Errorf("no active emergency %s", uid)
+	}
+
+	now := time.Now()
+	e.Status, e.AckBy, e.AckAt = model.EMERGENCY_ACKNOWLEDGED, user, &now
+
+	if err := app.dbm.Save(e); err != nil {
+		return nil, err
+	}
+
+	app.emergencyLog(e.UID, "ack", user, "")
+	app.notifyEmergency(e)
+
+	if e.ContactUID != "" {
+		text := fmt.Sprintf("%s is acknowledged by %s", e.Kind, user)
+		msg := chat.MakeChatMessage(e.ContactUID, EMERGENCY_FROM_UID, e.Callsign, EMERGENCY_FROM_CALLSIGN, "RootContactGroup", text)
+		app.sendToUID(e.ContactUID, cot.LocalCotMessage(msg))
+	}
+
+	return e, nil
+}
+
+func (app *App) cancelEmergency(uid, user string) (*model.Emergency, error) {
+	e := app.dbm.EmergencyQuery().UID(uid).One()
+	if !e.IsActive() {
+		return nil, fmt.Errorf("no active emergency %s", uid)
+	}
+
+	now := time.Now()
+	e.Status, e.CancelledBy, e.CancelledAt = model.EMERGENCY_CANCELLED, user, &now
+
+	if err := app.dbm.Save(e); err != nil {
+		return nil, err
+	}
+
+	app.logger.Info(fmt.Sprintf("emergency %s from %s is cancelled by %s", e.Kind, e.Callsign, user))
+	app.emergencyLog(e.UID, "cancel", user, "")
+	app.notifyEmergency(e)
+
+	return e, nil
+}
+
+// sendEmergency sends alert to every client that can see alert scope or one of emergency scopes.
+func (app *App) sendEmergency(msg *cot.CotMessage) {
+	scopes := append([]string{msg.Scope}, app.config.EmergencyScopes()...)
+	from := app.msgDevice(msg)
+
+	app.ForAllClients(func(ch client.ClientHandler) bool {
+		if ch.GetName() == msg.From {
+			return true
+		}
+
+		m := msg
+
+		for _, s := range scopes {
+			if ch.GetDevice().CanSeeScope(s) {
+				m = &cot.CotMessage{From: msg.From, Scope: s, TakMessage: msg.TakMessage, Detail: msg.Detail}
+
+				break
+			}
+		}
+
+		if err := app.sendTo(ch, m, from); err != nil {
+			app.logger.Error("send error", slog.Any("error", err))
+		}
+
+		return true
+	})
+}
+
+func (app *App) notifyEmergency(e *model.Emergency) {
+	dto := e.DTO()
+
+	app.emergencyCb.AddMessage(dto)
+	app.webhooks.PublishEvent(emergencyEvent, dto)
+}
+
+func (app *App) emergencyLog(uid, action, user, text string) {
+	l := &model.EmergencyLog{EmergencyUID: uid, Action: action, User: user, Text: text}
+
+	if err := app.dbm.Create(l); err != nil {
+		app.logger.Error("error saving emergency log", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func alertMsg(c *simClient, typ string) *cot.CotMessage {
+	msg := cot.BasicMsg(typ, c.uid+"-9-1-1", time.Minute)
+
+	xd := cot.NewXMLDetails()
+	xd.AddPpLink(c.uid, "a-f-G-U-C", "")
+
+	if typ == model.EMERGENCY_CANCEL_TYPE {
+		xd.AddChild("emergency", map[string]string{"cancel": "true"}, c.uid)
+	} else {
+		xd.AddChild("emergency", map[string]string{"type": "911 Alert"}, c.uid)
+	}
+
+	msg.CotEvent.Detail = &cotproto.Detail{XmlDetail: xd.AsXMLString()}
+
+	m, _ := cot.CotFromProto(msg, c.name, c.device.GetScope())
+
+	return m
+}
+
+func TestEmergency(t *testing.T) {
+	app, clients := newPipelineApp(1, 4)
+	require.NoError(t, app.config.Set("emergency.scopes", []string{"dispatch"}))
+
+	for i, s := range []string{"blue", "blue", "red", "dispatch"} {
+		clients[i].device.Scope = s
+	}
+
+	app.processMessage(alertMsg(clients[0], "b-a-o-tbl"))
+
+	assert.Equal(t, int64(0), clients[0].got.Load())
+	assert.Equal(t, int64(1), clients[1].got.Load())
+	assert.Equal(t, int64(0), clients[2].got.Load())
+	assert.Equal(t, int64(1), clients[3].got.Load())
+
+	// alert is not a map item
+	assert.Nil(t, app.items.Get(clients[0].uid+"-9-1-1"))
+
+	e := app.dbm.EmergencyQuery().UID(clients[0].uid + "-9-1-1").One()
+	require.NotNil(t, e)
+	assert.Equal(t, model.EMERGENCY_ACTIVE, e.Status)
+	assert.Equal(t, "911 Alert", e.Kind)
+
+	// repeated alert does not make new log record
+	app.processMessage(alertMsg(clients[0], "b-a-o-tbl"))
+
+	_, err := app.ackEmergency(e.UID, "admin")
+	require.NoError(t, err)
+
+	app.processMessage(alertMsg(clients[0], model.EMERGENCY_CANCEL_TYPE))
+
+	e = app.dbm.EmergencyQuery().UID(e.UID).One()
+	assert.Equal(t, model.EMERGENCY_CANCELLED, e.Status)
+	assert.Equal(t, "admin", e.AckBy)
+	assert.Equal(t, clients[0].device.Login, e.CancelledBy)
+
+	_, err = app.ackEmergency(e.UID, "admin")
+	require.Error(t, err)
+
+	var actions []string
+
+	for _, l := range app.dbm.EmergencyLogQuery().Emergency(e.UID).Order("id").Get() {
+		actions = append(actions, l.Action)
+	}
+
+	assert.Equal(t, []string{"start", "ack", "cancel"}, actions)
+}
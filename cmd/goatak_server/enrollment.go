@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/base64"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	enrollmentDefaultHours = 24
+	qrSize                 = 320
+)
+
+// enrollHost returns host name for the invitation link, host of the admin page by default.
+func (app *App) enrollHost(ctx *fiber.Ctx) string {
+	if h := app.config.EnrollHost(); h != "" {
+		return h
+	}
+
+	if h, _, err := net.SplitHostPort(ctx.Hostname()); err == nil {
+		return h
+	}
+
+	return ctx.Hostname()
+}
+
+// useEnrollment checks if device is authorized with the invitation token and counts the use.
+func (app *App) useEnrollment(ctx *fiber.Ctx) (*model.Device, error) {
+	username := Username(ctx)
+
+	pass, _ := ctx.Locals(PasswordKey).(string)
+	if pass == "" {
+		return nil, nil
+	}
+
+	e := app.dbm.EnrollmentQuery().Login(username).Token(pass).One()
+	if e == nil {
+		return nil, nil
+	}
+
+	d, created, err := app.dbm.UseEnrollment(e)
+	if err != nil {
+		return nil, err
+	}
+
+	app.dbm.Audit(username, model.AUDIT_ENROLL_USE, strconv.Itoa(int(e.ID)), ctx.IP(), nil, fiber.Map{"device_created": created})
+
+	if created {
+		app.dbm.Audit(e.CreatedBy, model.AUDIT_DEVICE_CREATE, d.Login, ctx.IP(), nil, d.DTO())
+	}
+
+	return d, nil
+}
+
+func getApiEnrollmentsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		data := filterScope(AdminUser(ctx), app.dbm.EnrollmentQuery().Limit(0).Get(),
+			func(e *model.Enrollment) string { return e.Scope })
+
+		res := make([]*model.EnrollmentDTO, len(data))
+
+		for i, e := range data {
+			res[i] = e.DTO()
+		}
+
+		return ctx.JSON(res)
+	}
+}
+
+func getApiEnrollmentPostHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var m *model.EnrollmentPostDTO
+
+		if err := ctx.BodyParser(&m); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		if m.Login == "" {
+			return SendError(ctx, "empty login")
+		}
+
+		u := AdminUser(ctx)
+
+		if d := app.dbm.DeviceQuery().Login(m.Login).One(); d != nil {
+			// new certificate for existing device
+			if !canManageDevice(u, d) {
+				return sendForbidden(ctx)
+			}
+
+			m.Scope = d.Scope
+		}
+
+		if m.Scope == "" {
+			return SendError(ctx, "empty scope")
+		}
+
+		if !u.CanManageScope(m.Scope) {
+			return sendForbidden(ctx)
+		}
+
+		if m.Hours <= 0 {
+			m.Hours = enrollmentDefaultHours
+		}
+
+		if m.MaxUses <= 0 {
+			m.MaxUses = 1
+		}
+
+		e, token, err := model.NewEnrollment(m.Login, m.Scope, time.Hour*time.Duration(m.Hours), m.MaxUses)
+		if err != nil {
+			return err
+		}
+
+		e.Profile = m.Profile
+		e.CreatedBy = Username(ctx)
+
+		if err := app.dbm.Create(e); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		dto := e.DTO()
+		app.auditCtx(ctx, model.AUDIT_ENROLL_CREATE, e.Login, nil, dto)
+
+		dto.Token = token
+		dto.Link = model.EnrollmentLink(app.enrollHost(ctx), e.Login, token)
+
+		png, err := qrcode.Encode(dto.Link, qrcode.Medium, qrSize)
+		if err != nil {
+			return err
+		}
+
+		dto.QR = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+
+		return ctx.JSON(dto)
+	}
+}
+
+func getApiEnrollmentDeleteHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		e := app.dbm.EnrollmentQuery().Id(uint(id)).One()
+		if e == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if !AdminUser(ctx).CanManageScope(e.Scope) {
+			return sendForbidden(ctx)
+		}
+
+		if err := app.dbm.EnrollmentQuery().Id(e.ID).Delete(); err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		app.auditCtx(ctx, model.AUDIT_ENROLL_DELETE, e.Login, e.DTO(), nil)
+
+		return ctx.JSON(fiber.Map{"status": "ok"})
+	}
+}
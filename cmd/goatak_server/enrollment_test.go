@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestEnrollment(t *testing.T) {
+	app := NewTestApp()
+	app.dbm.Save(scopedDevice("blue_adm", "b", "blue", model.RoleScopeAdmin))
+
+	admin := adminToken(t, app, "adm1", "111")
+	blue := adminToken(t, app, "blue_adm", "b")
+
+	// scope admin can't invite to other scope
+	resp, err := app.PostJSON("/api/enrollment", blue, &model.EnrollmentPostDTO{Login: "new1", Scope: "red"})
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.PostJSON("/api/enrollment", blue, &model.EnrollmentPostDTO{
+		Login:   "new1",
+		Scope:   "blue",
+		Profile: &model.ProfilePutDTO{Callsign: "Blue 1", Team: "Cyan"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	e := new(model.EnrollmentDTO)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(e))
+
+	assert.Equal(t, 1, e.MaxUses)
+	assert.Equal(t, "blue_adm", e.CreatedBy)
+	assert.NotEmpty(t, e.Token)
+	assert.True(t, strings.HasPrefix(e.Link, "tak://com.atakmap.app/enroll?host="))
+	assert.Contains(t, e.Link, "username=new1")
+	assert.True(t, strings.HasPrefix(e.QR, "data:image/png;base64,"))
+
+	resp, err = app.PostJSON("/api/enrollment", admin, &model.EnrollmentPostDTO{Login: "new2", Scope: "red"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/enrollment", blue, nil)
+	require.NoError(t, err)
+
+	var list []*model.EnrollmentDTO
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.Empty(t, list[0].Token)
+
+	// cert api with the invitation token
+	srv := &HttpServer{userManager: app.users, dbm: app.dbm}
+	f := fiber.New()
+	f.Use(srv.DeviceAuthHandler("/sign"))
+	f.Post("/sign", func(ctx *fiber.Ctx) error {
+		d, err := app.useEnrollment(ctx)
+		if err != nil {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		return ctx.JSON(d.DTO())
+	})
+	f.Post("/other", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	req := func(path, login, pass string) int {
+		req, _ := http.NewRequest(http.MethodPost, path, nil)
+		req.SetBasicAuth(login, pass)
+
+		r, err := f.Test(req)
+		require.NoError(t, err)
+
+		return r.StatusCode
+	}
+
+	sign := func(login, pass string) int {
+		return req("/sign", login, pass)
+	}
+
+	// token is accepted only on enrollment paths
+	assert.Equal(t, fiber.StatusUnauthorized, req("/other", "new1", e.Token))
+
+	assert.Equal(t, fiber.StatusUnauthorized, sign("new1", "bad"))
+	assert.Equal(t, fiber.StatusUnauthorized, sign("new2", e.Token))
+	assert.Equal(t, fiber.StatusOK, sign("new1", e.Token))
+	// the only use is spent
+	assert.Equal(t, fiber.StatusForbidden, sign("new1", e.Token))
+
+	d := app.dbm.DeviceQuery().Login("new1").One()
+	require.NotNil(t, d)
+	assert.Equal(t, "blue", d.Scope)
+	assert.False(t, d.Admin)
+	assert.NotEmpty(t, d.Groups)
+
+	p := app.dbm.ProfileQuery().Login("new1").UID("*").One()
+	require.NotNil(t, p)
+	assert.Equal(t, "Blue 1", p.Callsign)
+
+	// invitation of the disabled device is not accepted
+	resp, err = app.PostJSON("/api/enrollment", admin, &model.EnrollmentPostDTO{Login: "new3", Scope: "red", MaxUses: 2})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	e3 := new(model.EnrollmentDTO)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(e3))
+	assert.Equal(t, fiber.StatusOK, sign("new3", e3.Token))
+
+	require.NoError(t, app.dbm.DeviceQuery().Login("new3").Update(map[string]any{"disabled": true}))
+	assert.Equal(t, fiber.StatusUnauthorized, sign("new3", e3.Token))
+
+	resp, err = app.Req("DELETE", "/api/enrollment/"+strconv.Itoa(int(e.ID)), blue, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(2), app.dbm.EnrollmentQuery().Count())
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/internal/federation"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+func (app *App) startFederation(ctx context.Context) {
+	if addr := app.config.String("federation.addr"); addr != "" && app.config.TlsCert != nil {
+		go func() {
+			if err := app.listenFederation(ctx, addr); err != nil {
+				app.logger.Error("federation listener error", slog.Any("error", err))
+			}
+		}()
+	}
+
+	for _, p := range app.federation.Peers() {
+		if p.IsOutgoing() {
+			app.logger.Info(fmt.Sprintf("start federate connection to %s (%s)", p.Name(), p.Addr()))
+			go app.connectFederate(ctx, p)
+		}
+	}
+}
+
+func (app *App) listenFederation(ctx context.Context, addr string) error {
+	app.logger.Info("listening federation at " + addr)
+
+	// federates are verified with their own CA, device CA must not be trusted here
+	name := app.config.String("federation.ca")
+	if name == "" {
+		return errors.New("federation.ca is not set")
+	}
+
+	certs, err := loadCerts(name)
+	if err != nil {
+		return err
+	}
+
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificates in %s", name)
+	}
+
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{*app.config.TlsCert},
+		ClientCAs:    tlsutil.MakeCertPool(certs...),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	listener, err := tls.Listen("tcp", addr, tlsCfg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	var delay time.Duration
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+				return nil
+			}
+
+			// temporary error, like too many open files
+			delay = min(max(delay*2, time.Millisecond*5), time.Second)
+			app.logger.Error("Unable to accept connections", slog.Any("error", err))
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+
+			continue
+		}
+
+		delay = 0
+
+		go app.processFederateConn(ctx, conn.(*tls.Conn))
+	}
+}
+
+func (app *App) processFederateConn(ctx context.Context, conn *tls.Conn) {
+	ctx1, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
+
+	if err := conn.HandshakeContext(ctx1); err != nil {
+		app.logger.Debug("federate handshake error", slog.Any("error", err))
+		_ = conn.Close()
+
+		return
+	}
+
+	st := conn.ConnectionState()
+	cn, sn := getCertUser(&st)
+
+	p := app.federation.PeerByCN(cn)
+	if p == nil {
+		app.logger.Warn(fmt.Sprintf("unknown federate %s, sn %s", cn, sn))
+		_ = conn.Close()
+
+		return
+	}
+
+	if err := p.CheckCert(getCert(&st)); err != nil {
+		app.logger.Warn("federate cert check failed", slog.Any("error", err))
+		_ = conn.Close()
+
+		return
+	}
+
+	app.logger.Info(fmt.Sprintf("federate %s connected from %s", p.Name(), conn.RemoteAddr()))
+
+	h := app.federation.NewHandler(p, "fed:"+p.Name()+":"+conn.RemoteAddr().String(), conn, &client.HandlerConfig{
+		Serial:      sn,
+		MessageCb:   app.NewCotMessage,
+		RemoveCb:    app.federateRemoveCb(p),
+		DropMetric:  dropMetric,
+		QueueMetric: queueMetric,
+		QueueSize:   app.config.Int("queue_size"),
+		UidChecker:  app.checkUID,
+	})
+
+	p.SetConnected(true)
+	app.AddClientHandler(h)
+	h.Start()
+}
+
+func (app *App) connectFederate(ctx context.Context, p *federation.Peer) {
+	for ctx.Err() == nil {
+		conn, err := app.dialFederate(p)
+		if err != nil {
+			app.logger.Error("federate connect error", slog.String("federate", p.Name()), slog.Any("error", err))
+			p.SetError(err)
+			time.Sleep(time.Second * 5)
+
+			continue
+		}
+
+		app.logger.Info("connected to federate " + p.Name())
+
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		removeCb := app.federateRemoveCb(p)
+
+		h := app.federation.NewHandler(p, "fed:"+p.Name(), conn, &client.HandlerConfig{
+			MessageCb: app.NewCotMessage,
+			RemoveCb: func(ch client.ClientHandler) {
+				removeCb(ch)
+				wg.Done()
+			},
+			IsClient:    true,
+			UID:         app.uid,
+			DropMetric:  dropMetric,
+			QueueMetric: queueMetric,
+			QueueSize:   app.config.Int("queue_size"),
+			UidChecker:  app.checkUID,
+		})
+
+		p.SetConnected(true)
+		go h.Start()
+		app.AddClientHandler(h)
+
+		wg.Wait()
+	}
+}
+
+func (app *App) dialFederate(p *federation.Peer) (net.Conn, error) {
+	tlsCfg, err := app.federateTLSConfig(p)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: time.Second * 5}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", p.Addr(), tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Handshake(); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	tlsutil.LogCerts(app.logger.With("federate", p.Name()), conn.ConnectionState().PeerCertificates...)
+
+	return conn, nil
+}
+
+func (app *App) federateTLSConfig(p *federation.Peer) (*tls.Config, error) {
+	conf := p.Config()
+	tlsCfg := new(tls.Config)
+
+	if conf.Cert != "" {
+		cert, err := loadP12Cert(conf.Cert, conf.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsCfg.Certificates = []tls.Certificate{*cert}
+	} else if app.config.TlsCert != nil {
+		tlsCfg.Certificates = []tls.Certificate{*app.config.TlsCert}
+	}
+
+	if conf.CA != "" {
+		certs, err := loadCerts(conf.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsCfg.RootCAs = tlsutil.MakeCertPool(certs...)
+	} else {
+		// no peer CA, trust system roots and server CA
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		for _, c := range app.config.CA {
+			pool.AddCert(c)
+		}
+
+		tlsCfg.RootCAs = pool
+	}
+
+	if conf.Fingerprint != "" {
+		tlsCfg.VerifyConnection = func(st tls.ConnectionState) error {
+			if len(st.PeerCertificates) == 0 {
+				return errors.New("no server certificate")
+			}
+
+			return p.CheckCert(st.PeerCertificates[0])
+		}
+	}
+
+	return tlsCfg, nil
+}
+
+func (app *App) federateRemoveCb(p *federation.Peer) func(ch client.ClientHandler) {
+	return func(ch client.ClientHandler) {
+		app.RemoveClientHandler(ch.GetName())
+		p.SetConnected(false)
+		app.logger.Info("federate disconnected: " + p.Name())
+
+		for uid := range ch.GetUids() {
+			c := app.items.Get(uid)
+			if c == nil {
+				continue
+			}
+
+			c.SetOffline()
+
+			app.NewCotMessage(&cot.CotMessage{
+				From:       ch.GetName(),
+				Scope:      c.GetScope(),
+				TakMessage: cot.MakeOfflineMsg(uid, ""),
+			})
+		}
+	}
+}
+
+func loadCerts(name string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return tlsutil.DecodeAllCerts(b)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/federation"
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+func TestFederateTLSConfig(t *testing.T) {
+	app := NewTestApp()
+
+	p := federation.NewPeer(&federation.PeerConfig{Name: "remote", Addr: "remote:9001"})
+
+	cfg, err := app.federateTLSConfig(p)
+	require.NoError(t, err)
+	assert.False(t, cfg.InsecureSkipVerify)
+	assert.NotNil(t, cfg.RootCAs)
+	assert.Nil(t, cfg.VerifyConnection)
+
+	cert := &x509.Certificate{Raw: []byte("cert")}
+	p = federation.NewPeer(&federation.PeerConfig{Name: "remote", Addr: "remote:9001", Fingerprint: tlsutil.Fingerprint(cert)})
+
+	cfg, err = app.federateTLSConfig(p)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.VerifyConnection)
+	assert.NoError(t, cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}))
+	assert.Error(t, cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Raw: []byte("other")}}}))
+	assert.Error(t, cfg.VerifyConnection(tls.ConnectionState{}))
+}
+
+func TestListenFederationNoCA(t *testing.T) {
+	app := NewTestApp()
+
+	require.Error(t, app.listenFederation(context.Background(), "127.0.0.1:0"))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kdudkov/goatak/internal/filter"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// filterRules returns rules stored in database. Rules from config are used only if rules were never stored,
+// so changes made with admin api, including removal of all rules, are not lost on restart.
+// The flag is true if rules are from config and must be stored.
+func (app *App) filterRules() ([]*filter.RuleConfig, bool, error) {
+	recs, ok, err := app.dbm.FilterRules()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ok {
+		rules, err := app.config.Filters()
+
+		return rules, true, err
+	}
+
+	res := make([]*filter.RuleConfig, 0, len(recs))
+
+	for _, r := range recs {
+		c := new(filter.RuleConfig)
+
+		if err := json.Unmarshal(r.Rule, c); err != nil {
+			return nil, false, fmt.Errorf("bad stored filter rule %s: %w", r.Name, err)
+		}
+
+		res = append(res, c)
+	}
+
+	app.logger.Info(fmt.Sprintf("loaded %d filter rules from database", len(res)))
+
+	return res, false, nil
+}
+
+// saveFilterRules stores current rules to database.
+func (app *App) saveFilterRules() error {
+	rules := app.filters.Rules()
+	recs := make([]*model.FilterRecord, 0, len(rules))
+
+	for i, r := range rules {
+		b, err := json.Marshal(r.Config())
+		if err != nil {
+			return err
+		}
+
+		recs = append(recs, &model.FilterRecord{Name: r.Name(), Position: i, Rule: b})
+	}
+
+	return app.dbm.SaveFilterRules(recs)
+}
+
+// egressEvent checks event given to the device by Marti api. Returns event to send (original or rewritten) or nil.
+func (app *App) egressEvent(evt *cotproto.CotEvent, scope string, to *model.Device) *cotproto.CotEvent {
+	if evt == nil || app.filters.Len() == 0 {
+		return evt
+	}
+
+	msg, err := cot.CotFromProto(&cotproto.TakMessage{CotEvent: evt}, "", scope)
+	if err != nil {
+		return nil
+	}
+
+	return app.filters.Egress(msg, nil, to).GetTakMessage().GetCotEvent()
+}
+
+// egressMission removes mission points dropped by egress filter for the device.
+func (app *App) egressMission(m *model.Mission, to *model.Device) {
+	if m == nil || app.filters.Len() == 0 {
+		return
+	}
+
+	points := make([]*model.Point, 0, len(m.Points))
+
+	for _, p := range m.Points {
+		if app.egressEvent(p.GetEvent(), m.Scope, to) != nil {
+			points = append(points, p)
+		}
+	}
+
+	m.Points = points
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/internal/filter"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestFilterRulesStored(t *testing.T) {
+	app := NewTestApp()
+	token := adminToken(t, app, "adm1", "111")
+
+	resp, err := app.PostJSON("/api/filter", token, fiber.Map{"name": "r1", "direction": "out", "action": "drop", "types": []string{"b-m-p-"}})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.PostJSON("/api/filter", token, fiber.Map{"name": "r2", "action": "allow"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.SendJSON("PUT", "/api/filter/r2", token, fiber.Map{"name": "r3", "action": "allow", "logins": []string{"u1"}})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	rules, seed, err := app.filterRules()
+	require.NoError(t, err)
+	require.False(t, seed)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "r1", rules[0].Name)
+	assert.Equal(t, "r3", rules[1].Name)
+	assert.Equal(t, []string{"u1"}, rules[1].Logins)
+
+	resp, err = app.Req("DELETE", "/api/filter/r1", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	rules, _, err = app.filterRules()
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+
+	// empty set is kept, config rules are not used again
+	resp, err = app.Req("DELETE", "/api/filter/r3", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	require.NoError(t, app.config.Set("filters", []map[string]any{{"name": "cfg", "action": "drop"}}))
+
+	rules, seed, err = app.filterRules()
+	require.NoError(t, err)
+	require.False(t, seed)
+	require.Empty(t, rules)
+}
+
+func TestFilterRulesSeed(t *testing.T) {
+	cfg := config.NewAppConfig()
+	require.NoError(t, cfg.Set("db", ":memory:"))
+	require.NoError(t, cfg.Set("filters", []map[string]any{{"name": "cfg", "action": "drop", "types": []string{"b-"}}}))
+
+	app, err := NewApp(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, app.filters.Len())
+
+	recs, ok, err := app.dbm.FilterRules()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, recs, 1)
+	assert.Equal(t, "cfg", recs[0].Name)
+}
+
+func TestFilterMission(t *testing.T) {
+	app := NewTestApp()
+	require.NoError(t, app.filters.Add(&filter.RuleConfig{Name: "r1", Direction: "out", Action: "drop", Types: []string{"b-m-p-"}, ToScopes: []string{"guest"}}))
+
+	m := &model.Mission{Name: "m1", Scope: "guest"}
+	require.NoError(t, app.dbm.CreateMission(m))
+
+	for _, typ := range []string{"b-m-p-s-m", "a-f-G"} {
+		msg := cot.BasicMsg(typ, typ, time.Minute)
+		msg.CotEvent.Lat, msg.CotEvent.Lon = 10, 20
+
+		cm, err := cot.CotFromProto(msg, "", "guest")
+		require.NoError(t, err)
+
+		_, err = app.dbm.AddMissionPoint(m, cm)
+		require.NoError(t, err)
+	}
+
+	guest := &model.Device{Login: "g1", Scope: "guest"}
+	other := &model.Device{Login: "o1", Scope: "other"}
+
+	m1 := app.dbm.MissionQuery().Name("m1").Full().One()
+	require.Len(t, m1.Points, 2)
+
+	app.egressMission(m1, other)
+	assert.Len(t, m1.Points, 2)
+
+	app.egressMission(m1, guest)
+	require.Len(t, m1.Points, 1)
+	assert.Equal(t, "a-f-G", m1.Points[0].UID)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/kdudkov/goatak/internal/geofence"
+	"github.com/kdudkov/goatak/pkg/chat"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	GEOFENCE_FROM_UID      = "GEOFENCE_UID"
+	GEOFENCE_FROM_CALLSIGN = "Geofence"
+	allChatRooms           = "All Chat Rooms"
+)
+
+func (app *App) startGeofences() {
+	fences := app.dbm.GeofenceQuery().Get()
+
+	for _, f := range fences {
+		app.geofences.Set(f)
+	}
+
+	app.logger.Info(fmt.Sprintf("loaded %d geofences", len(fences)))
+
+	app.items.DeleteCallback().SubscribeNamed("geofence", func(uid string) bool {
+		app.geofences.Forget(uid)
+
+		return true
+	})
+}
+
+func (app *App) geofenceProcessor(msg *cot.CotMessage) bool {
+	if strings.HasPrefix(msg.GetType(), "u-") {
+		app.updateShapeFences(msg)
+
+		return true
+	}
+
+	if model.GetClass(msg) != model.CONTACT {
+		return true
+	}
+
+	item := app.items.Get(msg.GetUID())
+	if item == nil {
+		return true
+	}
+
+	for _, t := range app.geofences.Check(msg.GetUID(), msg.Scope, msg.GetLat(), msg.GetLon()) {
+		app.processGeofenceTransition(t, item)
+	}
+
+	return true
+}
+
+// updateShapeFences changes geometry of fences made from the drawn shape.
+func (app *App) updateShapeFences(msg *cot.CotMessage) {
+	for _, f := range app.geofences.ByShape(msg.GetUID()) {
+		shape, points, radius := model.ShapeFromMsg(msg)
+
+		// shapes are resent periodically, most of the time without changes
+		if f.SameGeometry(shape, points, radius) {
+			continue
+		}
+
+		f1 := *f
+		f1.Shape, f1.Points, f1.Radius = shape, points, radius
+
+		if !f1.IsValid() {
+			app.logger.Warn(fmt.Sprintf("invalid shape %s for geofence %s", msg.GetUID(), f.Name))
+
+			continue
+		}
+
+		if err := app.dbm.Save(&f1); err != nil {
+			app.logger.Error("geofence save error", slog.Any("error", err))
+
+			continue
+		}
+
+		app.geofences.Update(&f1)
+	}
+}
+
+// newGeofence makes fence from post data. If shape_uid is set, geometry is taken from the drawn shape item.
+func (app *App) newGeofence(uid string, m *model.GeofencePostDTO) (*model.Geofence, error) {
+	f := &model.Geofence{
+		UID:          uid,
+		Name:         m.Name,
+		Scope:        m.Scope,
+		Shape:        m.Shape,
+		Points:       m.Points,
+		Radius:       m.Radius,
+		ShapeUID:     m.ShapeUID,
+		NotifyUIDs:   m.NotifyUIDs,
+		NotifyScopes: m.NotifyScopes,
+		Disabled:     m.Disabled,
+	}
+
+	if f.UID == "" {
+		f.UID = uuid.NewString()
+	}
+
+	if f.ShapeUID != "" {
+		item := app.items.Get(f.ShapeUID)
+		if item == nil {
+			return nil, fmt.Errorf("shape %s not found", f.ShapeUID)
+		}
+
+		f.Shape, f.Points, f.Radius = model.ShapeFromMsg(item.GetMsg())
+
+		if f.Name == "" {
+			f.Name = item.GetCallsign()
+		}
+
+		if f.Scope == "" {
+			f.Scope = item.GetScope()
+		}
+	}
+
+	if f.Name == "" {
+		return nil, fmt.Errorf("empty name")
+	}
+
+	if !f.IsValid() {
+		return nil, fmt.Errorf("invalid geometry")
+	}
+
+	return f, nil
+}
+
+func (app *App) processGeofenceTransition(t *geofence.Transition, item *model.Item) {
+	text := t.Text(item.GetCallsign())
+	app.logger.Info("geofence: " + text)
+
+	lat, lon := item.GetLanLon()
+
+	evt := &model.GeofenceEvent{
+		FenceUID:  t.Fence.UID,
+		FenceName: t.Fence.Name,
+		UID:       item.GetUID(),
+		Callsign:  item.GetCallsign(),
+		Event:     t.Event,
+		Lat:       lat,
+		Lon:       lon,
+	}
+
+	if err := app.dbm.Create(evt); err != nil {
+		app.logger.Error("error saving geofence event", slog.Any("error", err))
+	}
+
+	alert := t.AlertMsg(item)
+
+	for _, uid := range t.Fence.NotifyUIDs {
+		app.sendToUID(uid, cot.LocalCotMessage(alert))
+
+		msg := chat.MakeChatMessage(uid, GEOFENCE_FROM_UID, app.items.GetCallsign(uid), GEOFENCE_FROM_CALLSIGN, "RootContactGroup", text)
+		app.sendToUID(uid, cot.LocalCotMessage(msg))
+	}
+
+	for _, scope := range t.Fence.NotifyScopes {
+		if m, err := cot.CotFromProto(alert, "", scope); err == nil {
+			app.sendBroadcast(m)
+		}
+
+		msg := chat.MakeChatMessage(allChatRooms, GEOFENCE_FROM_UID, allChatRooms, GEOFENCE_FROM_CALLSIGN, "RootContactGroup", text)
+
+		if m, err := cot.CotFromProto(msg, "", scope); err == nil {
+			app.sendBroadcast(m)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	groupDirectionIn  = "IN"
+	groupDirectionOut = "OUT"
+	anonGroup         = "__ANON__"
+)
+
+// TakGroup is the group as TAK clients see it, every direction is a separate record.
+type TakGroup struct {
+	Name        string `json:"name"`
+	Direction   string `json:"direction"`
+	Created     string `json:"created"`
+	Type        string `json:"type"`
+	BitPos      int    `json:"bitpos"`
+	Active      bool   `json:"active"`
+	Description string `json:"description,omitempty"`
+}
+
+// deviceSetter is the handler that can change device of the live connection.
+type deviceSetter interface {
+	SetDevice(d *model.Device)
+}
+
+func deviceGroups(d *model.Device) []*model.DeviceGroup {
+	if len(d.Groups) > 0 {
+		return d.Groups
+	}
+
+	return model.ScopeGroups(d.Login, d.Scope, d.ReadScope)
+}
+
+func (app *App) takGroups(d *model.Device) []*TakGroup {
+	if d == nil {
+		return []*TakGroup{{Name: anonGroup, Direction: groupDirectionOut, Created: "2023-01-01", Type: "SYSTEM", BitPos: 2, Active: true}}
+	}
+
+	names := app.dbm.GroupNames()
+	res := make([]*TakGroup, 0)
+
+	for _, g := range deviceGroups(d) {
+		bitpos := slices.Index(names, g.Name)
+		if bitpos < 0 {
+			bitpos = len(names)
+			names = append(names, g.Name)
+		}
+
+		created := g.CreatedAt.Format("2006-01-02")
+
+		if g.In {
+			res = append(res, &TakGroup{Name: g.Name, Direction: groupDirectionIn, Created: created, Type: "SYSTEM", BitPos: bitpos, Active: g.Active})
+		}
+
+		if g.Out {
+			res = append(res, &TakGroup{Name: g.Name, Direction: groupDirectionOut, Created: created, Type: "SYSTEM", BitPos: bitpos, Active: g.Active})
+		}
+	}
+
+	return res
+}
+
+// setActiveGroups switches device groups on and off. Unknown groups are ignored.
+func (app *App) setActiveGroups(login string, groups []*TakGroup) error {
+	d := app.dbm.DeviceQuery().Login(login).One()
+	if d == nil {
+		return fmt.Errorf("device %s not found", login)
+	}
+
+	if len(d.Groups) == 0 {
+		if err := app.dbm.SetDeviceGroups(login, deviceGroups(d)); err != nil {
+			return err
+		}
+
+		d = app.dbm.DeviceQuery().Login(login).One()
+	}
+
+	active := make(map[string]bool)
+
+	for _, g := range groups {
+		if slices.ContainsFunc(d.Groups, func(dg *model.DeviceGroup) bool { return dg.Name == g.Name }) {
+			active[g.Name] = active[g.Name] || g.Active
+		}
+	}
+
+	if err := app.dbm.SetGroupsActive(login, active); err != nil {
+		return err
+	}
+
+	app.refreshDevice(login)
+
+	return nil
+}
+
+// updateDeviceGroups sets device groups from dto or from device scope and read scope if there are no groups in dto.
+func (app *App) updateDeviceGroups(d *model.Device, groups []*model.DeviceGroupDTO) error {
+	var gr []*model.DeviceGroup
+
+	if groups != nil {
+		gr = make([]*model.DeviceGroup, len(groups))
+		for i, g := range groups {
+			gr[i] = g.Group(d.Login)
+		}
+	} else {
+		gr = model.ScopeGroups(d.Login, d.Scope, d.ReadScope)
+	}
+
+	if err := app.dbm.SetDeviceGroups(d.Login, gr); err != nil {
+		return err
+	}
+
+	if d1 := app.dbm.DeviceQuery().Login(d.Login).One(); d1 != nil {
+		d.Groups = d1.Groups
+	}
+
+	app.refreshDevice(d.Login)
+
+	return nil
+}
+
+// isScopeGroups checks if device has no groups or groups made from its scope and read scope.
+// Active flag is not checked, it is switched by the client.
+func isScopeGroups(d *model.Device) bool {
+	sg := model.ScopeGroups(d.Login, d.Scope, d.ReadScope)
+
+	if len(d.Groups) == 0 {
+		return true
+	}
+
+	if len(d.Groups) != len(sg) {
+		return false
+	}
+
+	for _, g := range d.Groups {
+		if !slices.ContainsFunc(sg, func(g1 *model.DeviceGroup) bool {
+			return g1.Name == g.Name && g1.In == g.In && g1.Out == g.Out
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// refreshDevice reloads device of all live connections of the login.
+func (app *App) refreshDevice(login string) {
+	d := app.dbm.DeviceQuery().Login(login).One()
+	if d == nil {
+		return
+	}
+
+	app.ForAllClients(func(ch client.ClientHandler) bool {
+		if ch.GetDevice().GetLogin() != login {
+			return true
+		}
+
+		if s, ok := ch.(deviceSetter); ok {
+			app.logger.Debug(fmt.Sprintf("groups of %s are changed", ch.GetName()))
+			s.SetDevice(d)
+		}
+
+		return true
+	})
+}
+
+func getAllGroupsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var d *model.Device
+
+		if username := Username(ctx); username != "" {
+			d = app.users.Get(username)
+		}
+
+		return ctx.JSON(makeAnswer("com.bbn.marti.remote.groups.Group", app.takGroups(d)))
+	}
+}
+
+func getActiveGroupsPutHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		username := Username(ctx)
+		if username == "" {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
+		var groups []*TakGroup
+
+		if err := ctx.BodyParser(&groups); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+
+		if err := app.setActiveGroups(username, groups); err != nil {
+			app.logger.Warn("active groups update error", slog.Any("error", err))
+
+			return ctx.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+
+		app.logger.Info(fmt.Sprintf("active groups of %s (%s) are changed", username, queryIgnoreCase(ctx, "clientUid")))
+
+		return ctx.SendStatus(fiber.StatusOK)
+	}
+}
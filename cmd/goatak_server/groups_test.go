@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestGroupsRouting(t *testing.T) {
+	app, clients := newPipelineApp(1, 3)
+
+	for i, c := range clients {
+		c.device.Scope = "blue"
+		require.NoError(t, app.dbm.Create(c.device))
+		require.NoError(t, app.updateDeviceGroups(c.device, nil))
+
+		assert.Equal(t, []string{"blue"}, clients[i].device.OutGroups())
+	}
+
+	// client0 sends to blue and red, client2 gets red only
+	require.NoError(t, app.updateDeviceGroups(clients[0].device, []*model.DeviceGroupDTO{
+		{Name: "blue", In: true, Out: true, Active: true},
+		{Name: "red", Out: true, Active: true},
+	}))
+	require.NoError(t, app.updateDeviceGroups(clients[2].device, []*model.DeviceGroupDTO{
+		{Name: "red", In: true, Out: true, Active: true},
+	}))
+
+	msg := pliMsg(clients[0], 1)
+	msg.Scope, msg.Groups = "blue", clients[0].device.OutGroups()
+	app.processMessage(msg)
+
+	assert.Equal(t, int64(1), clients[1].got.Load())
+	assert.Equal(t, int64(1), clients[2].got.Load())
+
+	// client2 switches red off
+	require.NoError(t, app.setActiveGroups("user2", []*TakGroup{
+		{Name: "red", Direction: groupDirectionIn, Active: false},
+		{Name: "unknown", Direction: groupDirectionIn, Active: true},
+	}))
+
+	assert.Empty(t, clients[2].device.InGroups())
+
+	msg = pliMsg(clients[0], 2)
+	msg.Scope, msg.Groups = "blue", clients[0].device.OutGroups()
+	app.processMessage(msg)
+
+	assert.Equal(t, int64(2), clients[1].got.Load())
+	assert.Equal(t, int64(1), clients[2].got.Load())
+
+	groups := app.takGroups(clients[0].device)
+	require.Len(t, groups, 3)
+	assert.Equal(t, "blue", groups[0].Name)
+	assert.Equal(t, groupDirectionIn, groups[0].Direction)
+	assert.Equal(t, groups[0].BitPos, groups[1].BitPos)
+	assert.Equal(t, "red", groups[2].Name)
+	assert.Equal(t, groupDirectionOut, groups[2].Direction)
+
+	// changed scope makes new groups, active flag is kept
+	clients[2].device.Scope = "red"
+	clients[2].device.ReadScope = []string{"blue"}
+	require.NoError(t, app.updateDeviceGroups(clients[2].device, nil))
+	assert.Equal(t, []string{"blue"}, clients[2].device.InGroups())
+	assert.Empty(t, clients[2].device.OutGroups())
+}
+
+func TestMigrateScopes(t *testing.T) {
+	app, _ := newPipelineApp(1, 0)
+
+	require.NoError(t, app.dbm.Create(&model.Device{Login: "old", Scope: "blue", ReadScope: []string{"red", "blue"}}))
+	require.NoError(t, app.dbm.MigrateScopes())
+
+	d := app.dbm.DeviceQuery().Login("old").One()
+	require.NotNil(t, d)
+	require.Len(t, d.Groups, 2)
+	assert.Equal(t, []string{"blue", "red"}, d.InGroups())
+	assert.Equal(t, []string{"blue"}, d.OutGroups())
+	assert.True(t, d.CanSeeScope("red"))
+	assert.False(t, d.CanSeeScope("green"))
+}
+
+func TestDevicePutGroups(t *testing.T) {
+	app := NewTestApp()
+
+	app.dbm.Save(&model.Device{Login: "blue1", Scope: "blue"})
+	token := adminToken(t, app, "adm1", "111")
+
+	// groups are made from scope and follow its change
+	resp, err := app.SendJSON("PUT", "/api/device/blue1", token, fiber.Map{"scope": "blue"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.SendJSON("PUT", "/api/device/blue1", token, fiber.Map{"scope": "red"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"red"}, app.dbm.DeviceQuery().Login("blue1").One().OutGroups())
+
+	resp, err = app.SendJSON("PUT", "/api/device/blue1", token, fiber.Map{"scope": "red",
+		"groups": []fiber.Map{{"name": "g1", "in": true, "out": true, "active": true}}})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"g1"}, app.dbm.DeviceQuery().Login("blue1").One().OutGroups())
+
+	// edit without groups keeps custom groups
+	resp, err = app.SendJSON("PUT", "/api/device/blue1", token, fiber.Map{"scope": "blue", "disabled": true})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	d := app.dbm.DeviceQuery().Login("blue1").One()
+	assert.True(t, d.Disabled)
+	assert.Equal(t, []string{"g1"}, d.OutGroups())
+}
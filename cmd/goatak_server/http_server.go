@@ -8,6 +8,9 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/internal/oidc"
 	"github.com/kdudkov/goatak/internal/repository"
 	"github.com/kdudkov/goatak/pkg/model"
 )
@@ -16,12 +19,13 @@ import (
 var templates embed.FS
 
 type Connection struct {
-	Addr     string            `json:"addr"`
-	User     string            `json:"user"`
-	Ver      int32             `json:"ver"`
-	Scope    string            `json:"scope"`
-	Uids     map[string]string `json:"uids"`
-	LastSeen *time.Time        `json:"last_seen"`
+	Addr     string             `json:"addr"`
+	User     string             `json:"user"`
+	Ver      int32              `json:"ver"`
+	Scope    string             `json:"scope"`
+	Uids     map[string]string  `json:"uids"`
+	LastSeen *time.Time         `json:"last_seen"`
+	Queue    *client.QueueStats `json:"queue,omitempty"`
 }
 
 type Listener interface {
@@ -33,10 +37,12 @@ type HttpServer struct {
 	log         *slog.Logger
 	listeners   map[string]Listener
 	userManager repository.AuthRepository
+	dbm         *database.DatabaseManager
 	tokenKey    []byte
 	tokenMaxAge time.Duration
 	loginUrl    string
 	noAuth      []string
+	oidc        *oidc.Provider
 }
 
 func NewHttp(app *App) *HttpServer {
@@ -46,10 +52,24 @@ func NewHttp(app *App) *HttpServer {
 		log:         app.logger.With("logger", "http"),
 		listeners:   make(map[string]Listener),
 		userManager: app.users,
+		dbm:         app.dbm,
 		tokenKey:    mac.Sum(nil),
 		tokenMaxAge: time.Hour * 48,
 		loginUrl:    "/login",
-		noAuth:      []string{"/cot_xml"},
+		noAuth:      nil,
+	}
+
+	oidcConf, err := app.config.Oidc()
+	if err != nil {
+		panic(err)
+	}
+
+	if oidcConf != nil {
+		if srv.oidc, err = oidc.New(oidcConf); err != nil {
+			panic(err)
+		}
+
+		srv.noAuth = append(srv.noAuth, "/oidc/")
 	}
 
 	if addr := app.config.String("admin_addr"); addr != "" {
@@ -79,11 +99,13 @@ func (h *HttpServer) Start() {
 	}
 }
 
-func getUnits(app *App) []*model.WebUnit {
+func getUnits(app *App, u *model.Device) []*model.WebUnit {
 	units := make([]*model.WebUnit, 0)
 
 	app.items.ForEach(func(item *model.Item) bool {
-		units = append(units, item.ToWeb())
+		if u.CanManageScope(item.GetScope()) {
+			units = append(units, item.ToWeb())
+		}
 
 		return true
 	})
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/kml"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	iconBase = "http://maps.google.com/mapfiles/kml/"
+
+	// resource files bigger than this are not put in kmz
+	kmzMaxFile = 50 << 20
+
+	circlePoints = 36
+)
+
+// affiliationColors are kml (aabbggrr) colors of the affiliation letter of unit type.
+var affiliationColors = map[string]string{
+	"f": "ffffff00",
+	"a": "ffffff00",
+	"h": "ff0000ff",
+	"s": "ff0000ff",
+	"j": "ff0000ff",
+	"k": "ff0000ff",
+	"n": "ff00ff00",
+	"u": "ff00ffff",
+	"p": "ff00ffff",
+}
+
+// kmlStyle returns style url for the object class, cot type and atak color.
+func kmlStyle(doc *kml.Document, class, typ, argb string) string {
+	color := "ffffffff"
+
+	if c, err := kml.ArgbToColor(argb); argb != "" && err == nil {
+		color = c
+	} else if strings.HasPrefix(typ, "a-") && len(typ) > 2 {
+		if c, ok := affiliationColors[typ[2:3]]; ok {
+			color = c
+		}
+	}
+
+	icon := "shapes/placemark_circle.png"
+
+	switch class {
+	case model.CONTACT:
+		icon = "shapes/man.png"
+	case model.POINT:
+		icon = "pushpin/wht-pushpin.png"
+	}
+
+	return doc.AddStyle(&kml.Style{
+		ID:        fmt.Sprintf("%s-%s", class, color),
+		IconStyle: &kml.IconStyle{Color: color, Icon: &kml.Icon{Href: iconBase + icon}},
+		LineStyle: &kml.LineStyle{Color: color, Width: 2},
+		PolyStyle: &kml.PolyStyle{Color: "40" + color[2:]},
+	})
+}
+
+// msgPlacemark makes placemark from cot message. Drawn shapes are exported as lines and polygons.
+func msgPlacemark(doc *kml.Document, class string, msg *cot.CotMessage) *kml.Placemark {
+	p := &kml.Placemark{
+		Name:        msg.GetCallsign(),
+		Description: html.EscapeString(msg.GetDetail().GetFirst("remarks").GetText()),
+		TimeStamp:   kml.NewTimeStamp(msg.GetSendTime()),
+		StyleURL:    kmlStyle(doc, class, msg.GetType(), msg.GetColor()),
+	}
+
+	p.AddData("uid", msg.GetUID())
+	p.AddData("type", msg.GetType())
+	p.AddData("scope", msg.Scope)
+	p.AddData("team", msg.GetTeam())
+	p.AddData("role", msg.GetRole())
+
+	evt := msg.GetTakMessage().GetCotEvent()
+	pos := kml.Coord{Lat: evt.GetLat(), Lon: evt.GetLon(), Alt: cleanAlt(evt.GetHae())}
+
+	if !strings.HasPrefix(msg.GetType(), "u-d-") {
+		p.Point = kml.NewPoint(pos)
+
+		return p
+	}
+
+	kind, points, r := model.ShapeFromMsg(msg)
+
+	if kind == model.FENCE_CIRCLE {
+		p.Polygon = kml.NewPolygon(circle(pos, r)...)
+
+		return p
+	}
+
+	coords := make([]kml.Coord, len(points))
+	for i, pt := range points {
+		coords[i] = kml.Coord{Lat: pt.Lat, Lon: pt.Lon}
+	}
+
+	switch {
+	case len(coords) < 2:
+		p.Point = kml.NewPoint(pos)
+	case cot.MatchPattern(msg.GetType(), "u-d-r") || (len(coords) > 3 && coords[0] == coords[len(coords)-1]):
+		if coords[0] != coords[len(coords)-1] {
+			coords = append(coords, coords[0])
+		}
+
+		p.Polygon = kml.NewPolygon(coords...)
+	default:
+		p.LineString = kml.NewLineString(coords...)
+	}
+
+	return p
+}
+
+func circle(c kml.Coord, r float64) []kml.Coord {
+	res := make([]kml.Coord, circlePoints+1)
+
+	for i := range circlePoints {
+		lat, lon := model.DestPoint(c.Lat, c.Lon, r, float64(i*360/circlePoints))
+		res[i] = kml.Coord{Lat: lat, Lon: lon}
+	}
+
+	res[circlePoints] = res[0]
+
+	return res
+}
+
+// cleanAlt removes unknown altitude value.
+func cleanAlt(hae float64) float64 {
+	if hae >= cot.NotNum {
+		return 0
+	}
+
+	return hae
+}
+
+func trackPlacemark(doc *kml.Document, item *model.Item) *kml.Placemark {
+	track := item.GetTrack()
+	if len(track) < 2 {
+		return nil
+	}
+
+	coords := make([]kml.Coord, len(track))
+	for i, pos := range track {
+		coords[i] = kml.Coord{Lat: pos.GetLat(), Lon: pos.GetLon(), Alt: cleanAlt(pos.GetAlt())}
+	}
+
+	msg := item.GetMsg()
+
+	return &kml.Placemark{
+		Name:       item.GetCallsign() + " track",
+		TimeSpan:   kml.NewTimeSpan(track[0].Time, track[len(track)-1].Time),
+		StyleURL:   kmlStyle(doc, item.GetClass(), item.GetType(), msg.GetColor()),
+		LineString: kml.NewLineString(coords...),
+	}
+}
+
+// pointPlacemark makes placemark from mission point, stored event is used if there is one.
+func pointPlacemark(doc *kml.Document, p *model.Point) *kml.Placemark {
+	if evt := p.GetEvent(); evt.GetUid() != "" {
+		msg, err := cot.CotFromProto(&cotproto.TakMessage{CotEvent: evt}, "", p.Scope)
+		if err == nil {
+			return msgPlacemark(doc, model.POINT, msg)
+		}
+	}
+
+	pm := &kml.Placemark{
+		Name:     p.Callsign,
+		StyleURL: kmlStyle(doc, model.POINT, p.Type, p.Color),
+		Point:    kml.NewPoint(kml.Coord{Lat: p.Lat, Lon: p.Lon}),
+	}
+
+	pm.AddData("uid", p.UID)
+	pm.AddData("type", p.Type)
+	pm.AddData("scope", p.Scope)
+
+	return pm
+}
+
+// sendKML sends document as kml or kmz, depending on format query parameter.
+func sendKML(ctx *fiber.Ctx, name string, doc *kml.Document, files map[string]kml.KMZFile) error {
+	switch ctx.Query("format", "kml") {
+	case "kml":
+		ctx.Attachment(name + ".kml")
+		ctx.Set(fiber.HeaderContentType, kml.ContentTypeKML)
+
+		return kml.Write(ctx.Response().BodyWriter(), doc)
+	case "kmz":
+		ctx.Attachment(name + ".kmz")
+		ctx.Set(fiber.HeaderContentType, kml.ContentTypeKMZ)
+
+		// resource files can be big, archive is written to the client as it goes
+		ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			if err := kml.WriteKMZ(w, doc, files); err != nil {
+				slog.Error("kmz write error", slog.String("name", name), slog.Any("error", err))
+			}
+		})
+
+		return nil
+	default:
+		return SendError(ctx, "bad format")
+	}
+}
+
+func splitQuery(ctx *fiber.Ctx, name string) []string {
+	var res []string
+
+	for _, s := range strings.Split(ctx.Query(name), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// getApiExportItemsHandler exports live items, with optional scope, class and cot type mask filters.
+// Tracks of units are added with track=1.
+func getApiExportItemsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		u := AdminUser(ctx)
+		scopes := splitQuery(ctx, "scope")
+		classes := splitQuery(ctx, "class")
+		types := splitQuery(ctx, "type")
+		withTracks := ctx.QueryBool("track")
+
+		doc := kml.NewDocument("goatak")
+		folders := make(map[string]*kml.Folder)
+
+		app.items.ForEach(func(item *model.Item) bool {
+			switch {
+			case !u.CanManageScope(item.GetScope()):
+			case len(scopes) > 0 && !slices.Contains(scopes, item.GetScope()):
+			case len(classes) > 0 && !slices.Contains(classes, item.GetClass()):
+			case len(types) > 0 && !cot.MatchAnyPattern(item.GetType(), types...):
+			default:
+				f := folders[item.GetClass()]
+				if f == nil {
+					f = &kml.Folder{Name: item.GetClass()}
+					folders[item.GetClass()] = f
+					doc.Folders = append(doc.Folders, f)
+				}
+
+				f.Placemarks = append(f.Placemarks, msgPlacemark(doc, item.GetClass(), item.GetMsg()))
+
+				if withTracks {
+					if p := trackPlacemark(doc, item); p != nil {
+						f.Placemarks = append(f.Placemarks, p)
+					}
+				}
+			}
+
+			return true
+		})
+
+		return sendKML(ctx, "items", doc, nil)
+	}
+}
+
+func getApiExportTrackHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		item := app.items.Get(ctx.Params("uid"))
+		if item == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if !AdminUser(ctx).CanManageScope(item.GetScope()) {
+			return sendForbidden(ctx)
+		}
+
+		doc := kml.NewDocument(item.GetCallsign())
+		doc.Placemarks = append(doc.Placemarks, msgPlacemark(doc, item.GetClass(), item.GetMsg()))
+
+		if p := trackPlacemark(doc, item); p != nil {
+			doc.Placemarks = append(doc.Placemarks, p)
+		}
+
+		return sendKML(ctx, "track_"+item.GetUID(), doc, nil)
+	}
+}
+
+// getApiExportMissionHandler exports mission points, resource files are put in kmz.
+func getApiExportMissionHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		m := app.dbm.MissionQuery().Id(uint(id)).Full().One()
+		if m == nil {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+
+		if !AdminUser(ctx).CanManageScope(m.Scope) {
+			return sendForbidden(ctx)
+		}
+
+		kmz := ctx.Query("format") == "kmz"
+
+		doc := kml.NewDocument(m.Name)
+		doc.Description = html.EscapeString(m.Description)
+
+		points := &kml.Folder{Name: "Points"}
+		for _, p := range m.Points {
+			points.Placemarks = append(points.Placemarks, pointPlacemark(doc, p))
+		}
+
+		resources := &kml.Folder{Name: "Resources"}
+		files := make(map[string]kml.KMZFile)
+
+		for _, r := range m.Resources {
+			p := &kml.Placemark{Name: r.Name}
+			p.AddData("uid", r.UID)
+			p.AddData("hash", r.Hash)
+			p.AddData("filename", r.FileName)
+			p.AddData("mime", r.MIMEType)
+			p.AddData("creator", r.SubmissionUser)
+
+			if kmz && r.Size <= kmzMaxFile {
+				name := path.Join("files", safeName(r.Hash), safeName(r.FileName))
+
+				if _, err := app.files.GetFileStat(r.Scope, r.Hash); err == nil {
+					files[name] = app.resourceOpener(r)
+					p.Description = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(name), html.EscapeString(r.FileName))
+				} else {
+					app.logger.Warn("resource read error", slog.String("hash", r.Hash), slog.Any("error", err))
+				}
+			}
+
+			resources.Placemarks = append(resources.Placemarks, p)
+		}
+
+		doc.Folders = append(doc.Folders, points, resources)
+
+		return sendKML(ctx, "mission_"+m.Name, doc, files)
+	}
+}
+
+func (app *App) resourceOpener(r *model.Resource) kml.KMZFile {
+	return func() (io.ReadCloser, error) {
+		return app.files.GetFile(r.Hash, r.Scope)
+	}
+}
+
+// safeName makes file name without path to use in archive.
+func safeName(s string) string {
+	s = path.Base(strings.ReplaceAll(s, "\\", "/"))
+
+	if s == "." || s == ".." || s == "/" {
+		return "file"
+	}
+
+	return s
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/pm"
+	"github.com/kdudkov/goatak/pkg/kml"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestKmlExport(t *testing.T) {
+	app := NewTestApp()
+	app.dbm.Save(scopedDevice("blue_adm", "b", "blue", model.RoleScopeAdmin))
+
+	storeItem(app.App, "a-f-G-U-C", "blue1", "blue", 60, 30, time.Minute)
+	storeItem(app.App, "a-h-G", "blue2", "blue", 60.1, 30.1, time.Minute)
+	storeItem(app.App, "b-m-p-s-m", "blue3", "blue", 60.2, 30.2, time.Minute)
+	storeItem(app.App, "a-f-G-U-C", "red1", "red", 60, 30, time.Minute)
+
+	blue := adminToken(t, app, "blue_adm", "b")
+
+	get := func(url string) *kml.KML {
+		resp, err := app.Req("GET", url, blue, nil)
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, kml.ContentTypeKML, resp.Header.Get(fiber.HeaderContentType))
+
+		k := new(kml.KML)
+		require.NoError(t, xml.NewDecoder(resp.Body).Decode(k))
+
+		return k
+	}
+
+	count := func(k *kml.KML) int {
+		n := 0
+		for _, f := range k.Document.Folders {
+			n += len(f.Placemarks)
+		}
+
+		return n
+	}
+
+	assert.Equal(t, 3, count(get("/api/export/items")))
+	assert.Equal(t, 2, count(get("/api/export/items?class=unit")))
+	assert.Equal(t, 1, count(get("/api/export/items?type=a-h-")))
+
+	k := get("/api/export/items?type=a-f-")
+	require.Len(t, k.Document.Folders, 1)
+	p := k.Document.Folders[0].Placemarks[0]
+	assert.Equal(t, "30,60", p.Point.Coordinates)
+	assert.Equal(t, "#unit-ffffff00", p.StyleURL)
+
+	resp, err := app.Req("GET", "/api/export/track/red1", blue, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.Req("GET", "/api/export/items?format=kmz", blue, nil)
+	require.NoError(t, err)
+	assert.Equal(t, kml.ContentTypeKMZ, resp.Header.Get(fiber.HeaderContentType))
+}
+
+func TestKmzMissionExport(t *testing.T) {
+	app := NewTestApp()
+	app.files = pm.NewBlobManages(t.TempDir())
+
+	hash, n, err := app.files.PutFile("blue", "", strings.NewReader("file content"))
+	require.NoError(t, err)
+
+	m := &model.Mission{Name: "m1", Scope: "blue"}
+	require.NoError(t, app.dbm.CreateMission(m))
+	require.NoError(t, app.dbm.Create(&model.Resource{Scope: "blue", Hash: hash, UID: "r1", Name: "r1",
+		FileName: "../../etc/passwd", Size: int(n)}))
+	app.dbm.AddMissionResource(m, hash, "")
+
+	token := adminToken(t, app, "adm1", "111")
+
+	resp, err := app.Req("GET", "/api/export/mission/"+strconv.Itoa(int(m.ID))+"?format=kmz", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, "files/"+hash+"/passwd", zr.File[1].Name)
+
+	f, err := zr.File[1].Open()
+	require.NoError(t, err)
+
+	dat, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "file content", string(dat))
+
+	// file name is escaped in html description
+	require.NoError(t, app.dbm.ResourceQuery().Hash(hash).Update(map[string]any{"file_name": `a"><script>.txt`}))
+
+	resp, err = app.Req("GET", "/api/export/mission/"+strconv.Itoa(int(m.ID))+"?format=kmz", token, nil)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	b, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	zr, err = zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+
+	f, err = zr.File[0].Open()
+	require.NoError(t, err)
+
+	var k kml.KML
+	require.NoError(t, xml.NewDecoder(f).Decode(&k))
+
+	var desc string
+
+	for _, fl := range k.Document.Folders {
+		for _, p := range fl.Placemarks {
+			if p.Name == "r1" {
+				desc = p.Description
+			}
+		}
+	}
+
+	assert.Equal(t, `<a href="files/`+hash+`/a&#34;&gt;&lt;script&gt;.txt">a&#34;&gt;&lt;script&gt;.txt</a>`, desc)
+}
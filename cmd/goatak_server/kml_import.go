@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/gpx"
+	"github.com/kdudkov/goatak/pkg/kml"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	importStale = time.Hour * 24 * 365
+
+	importPoint = "b-m-p-s-m"
+	importShape = "u-d-f"
+	importRoute = "b-m-r"
+
+	defaultImportColor = "-1"
+)
+
+// importFeature is the placemark, waypoint, route or track to be converted to cot message.
+type importFeature struct {
+	typ    string
+	name   string
+	desc   string
+	color  string
+	uid    string
+	coords []kml.Coord
+}
+
+// readImportFile parses kml, kmz or gpx file, the format is taken from file name.
+func readImportFile(name string, data []byte) ([]*importFeature, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".kml":
+		k, err := kml.Read(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		return kmlFeatures(k), nil
+	case ".kmz":
+		k, err := kml.ReadKMZ(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return kmlFeatures(k), nil
+	case ".gpx":
+		g, err := gpx.Read(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		return gpxFeatures(g), nil
+	default:
+		return nil, fmt.Errorf("unsupported file type %s", name)
+	}
+}
+
+func kmlFeatures(k *kml.KML) []*importFeature {
+	var res []*importFeature
+
+	for _, p := range k.AllPlacemarks() {
+		style := k.PlacemarkStyle(p)
+
+		add := func(typ string, coords string, closed bool) {
+			c, err := kml.Coords(coords)
+			if err != nil || len(c) == 0 {
+				return
+			}
+
+			if closed && c[0] != c[len(c)-1] {
+				c = append(c, c[0])
+			}
+
+			res = append(res, &importFeature{
+				typ:    typ,
+				name:   p.Name,
+				desc:   p.Description,
+				color:  styleColor(style, typ == importPoint),
+				uid:    p.ID,
+				coords: c,
+			})
+		}
+
+		var addGeometry func(points []*kml.Point, lines []*kml.LineString, polygons []*kml.Polygon, multi []*kml.MultiGeometry)
+
+		addGeometry = func(points []*kml.Point, lines []*kml.LineString, polygons []*kml.Polygon, multi []*kml.MultiGeometry) {
+			for _, pt := range points {
+				add(importPoint, pt.Coordinates, false)
+			}
+
+			for _, l := range lines {
+				add(importShape, l.Coordinates, false)
+			}
+
+			for _, pg := range polygons {
+				if pg.OuterBoundaryIs != nil && pg.OuterBoundaryIs.LinearRing != nil {
+					add(importShape, pg.OuterBoundaryIs.LinearRing.Coordinates, true)
+				}
+			}
+
+			for _, m := range multi {
+				addGeometry(m.Points, m.LineStrings, m.Polygons, m.MultiGeometrys)
+			}
+		}
+
+		var multi []*kml.MultiGeometry
+		if p.MultiGeometry != nil {
+			multi = append(multi, p.MultiGeometry)
+		}
+
+		addGeometry(nonNil(p.Point), nonNil(p.LineString), nonNil(p.Polygon), multi)
+	}
+
+	return res
+}
+
+func nonNil[T any](v *T) []*T {
+	if v == nil {
+		return nil
+	}
+
+	return []*T{v}
+}
+
+// styleColor returns atak color of icon style for points and line style for shapes.
+func styleColor(s *kml.Style, icon bool) string {
+	var color string
+
+	switch {
+	case s == nil:
+		return ""
+	case icon && s.IconStyle != nil:
+		color = s.IconStyle.Color
+	case !icon && s.LineStyle != nil:
+		color = s.LineStyle.Color
+	default:
+		return ""
+	}
+
+	if argb, err := kml.ColorToArgb(color); err == nil {
+		return argb
+	}
+
+	return ""
+}
+
+func gpxFeatures(g *gpx.GPX) []*importFeature {
+	var res []*importFeature
+
+	coords := func(points []*gpx.Point) []kml.Coord {
+		c := make([]kml.Coord, len(points))
+
+		for i, p := range points {
+			c[i] = kml.Coord{Lat: p.Lat, Lon: p.Lon, Alt: p.Ele}
+		}
+
+		return c
+	}
+
+	for _, w := range g.Waypoints {
+		res = append(res, &importFeature{typ: importPoint, name: w.Name, desc: w.Description(), coords: coords([]*gpx.Point{w})})
+	}
+
+	for _, r := range g.Routes {
+		if len(r.Points) > 0 {
+			res = append(res, &importFeature{typ: importRoute, name: r.Name, desc: r.Desc, coords: coords(r.Points)})
+		}
+	}
+
+	for _, t := range g.Tracks {
+		for _, s := range t.Segments {
+			if len(s.Points) > 0 {
+				res = append(res, &importFeature{typ: importShape, name: t.Name, desc: t.Desc, coords: coords(s.Points)})
+			}
+		}
+	}
+
+	return res
+}
+
+// importUID makes uid of the imported object from the scope and the feature id, or the file name and number of the feature
+// if feature has no id, so repeated import updates the same objects. Id from the file is never used as is.
+func (f *importFeature) importUID(fileName string, n int, scope string) string {
+	key := "import/" + scope + "/" + fileName + "/" + strconv.Itoa(n)
+
+	if f.uid != "" {
+		key = "import/" + scope + "/id/" + f.uid
+	}
+
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(key)).String()
+}
+
+// toMsg makes cot message from the feature.
+func (f *importFeature) toMsg(fileName string, n int, scope string) (*cot.CotMessage, error) {
+	uid := f.importUID(fileName, n, scope)
+
+	name := f.name
+	if name == "" {
+		name = fmt.Sprintf("%s %d", strings.TrimSuffix(fileName, filepath.Ext(fileName)), n+1)
+	}
+
+	color := f.color
+	if color == "" {
+		color = defaultImportColor
+	}
+
+	typ := f.typ
+	if typ == importShape && len(f.coords) < 2 {
+		typ = importPoint
+	}
+
+	msg := cot.BasicMsg(typ, uid, importStale)
+	msg.CotEvent.How = "h-g-i-g-o"
+	msg.CotEvent.Lat = f.coords[0].Lat
+	msg.CotEvent.Lon = f.coords[0].Lon
+
+	if f.coords[0].Alt != 0 {
+		msg.CotEvent.Hae = f.coords[0].Alt
+	}
+
+	xd := cot.NewXMLDetails()
+
+	switch typ {
+	case importPoint:
+		xd.AddChild("color", map[string]string{"argb": color}, "")
+		xd.AddChild("usericon", map[string]string{"iconsetpath": "COT_MAPPING_SPOTMAP/" + importPoint + "/" + color}, "")
+	case importShape:
+		for _, c := range f.coords {
+			xd.AddChild("link", map[string]string{"point": linkPoint(c)}, "")
+		}
+
+		xd.AddChild("strokeColor", map[string]string{"value": color}, "")
+		xd.AddChild("strokeWeight", map[string]string{"value": "3.0"}, "")
+		xd.AddChild("labels_on", map[string]string{"value": "false"}, "")
+	case importRoute:
+		for i, c := range f.coords {
+			xd.AddChild("link", map[string]string{
+				"uid":      fmt.Sprintf("%s-%d", uid, i),
+				"callsign": fmt.Sprintf("CP%d", i+1),
+				"type":     "b-m-p-w",
+				"point":    linkPoint(c),
+				"relation": "c",
+			}, "")
+		}
+
+		xd.AddChild("link_attr", map[string]string{
+			"color":     color,
+			"method":    "Walking",
+			"prefix":    "CP",
+			"direction": "Infil",
+			"routetype": "Primary",
+			"order":     "Ascending Check Points",
+		}, "")
+	}
+
+	if f.desc != "" {
+		xd.AddChild("remarks", nil, f.desc)
+	}
+
+	msg.CotEvent.Detail = &cotproto.Detail{
+		XmlDetail: xd.AsXMLString(),
+		Contact:   &cotproto.Contact{Callsign: name},
+	}
+
+	return cot.CotFromProto(msg, cot.LocalFrom, scope)
+}
+
+func linkPoint(c kml.Coord) string {
+	s := strconv.FormatFloat(c.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(c.Lon, 'f', -1, 64)
+
+	if c.Alt != 0 {
+		s += "," + strconv.FormatFloat(c.Alt, 'f', -1, 64)
+	}
+
+	return s
+}
+
+// getApiImportHandler imports kml, kmz or gpx file to the scope, or to the mission if mission name is set.
+func getApiImportHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		scope := ctx.FormValue("scope")
+		missionName := ctx.FormValue("mission")
+
+		if scope == "" {
+			return SendError(ctx, "empty scope")
+		}
+
+		if !AdminUser(ctx).CanManageScope(scope) {
+			return sendForbidden(ctx)
+		}
+
+		var mission *model.Mission
+
+		if missionName != "" {
+			if mission = app.dbm.MissionQuery().Scope(scope).Name(missionName).Full().One(); mission == nil {
+				return SendError(ctx, "no mission "+missionName)
+			}
+		}
+
+		fh, err := ctx.FormFile("file")
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+
+		features, err := readImportFile(fh.Filename, data)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		count := 0
+
+		for i, feature := range features {
+			msg, err := feature.toMsg(fh.Filename, i, scope)
+			if err != nil {
+				return SendError(ctx, err.Error())
+			}
+
+			// import can't change contacts
+			if item := app.items.Get(msg.GetUID()); item != nil && item.GetClass() == model.CONTACT {
+				app.logger.Warn("import uid is used by contact - skipped", slog.String("uid", msg.GetUID()))
+
+				continue
+			}
+
+			count++
+
+			if mission == nil {
+				app.NewCotMessage(msg)
+
+				continue
+			}
+
+			change, err := app.dbm.AddMissionPoint(mission, msg)
+			if err != nil {
+				app.logger.Error("error adding point to mission", slog.Any("error", err))
+
+				return SendError(ctx, err.Error())
+			}
+
+			app.notifyMissionSubscribers(mission, change)
+		}
+
+		app.auditCtx(ctx, model.AUDIT_IMPORT, fh.Filename, nil, fiber.Map{"scope": scope, "mission": missionName, "count": count})
+
+		return ctx.JSON(fiber.Map{"status": "ok", "count": count})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const importKml = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+ <Style id="red"><IconStyle><color>ff0000ff</color></IconStyle></Style>
+ <Placemark id="pt1"><name>point</name><description>remark</description><styleUrl>#red</styleUrl>
+  <Point><coordinates>30.5,60.25</coordinates></Point></Placemark>
+ <Placemark><name>area</name>
+  <Polygon><outerBoundaryIs><LinearRing><coordinates>30,60 30.1,60 30.1,60.1</coordinates></LinearRing></outerBoundaryIs></Polygon>
+ </Placemark>
+ <Placemark><name>multi</name>
+  <MultiGeometry><Point><coordinates>31,61</coordinates></Point><LineString><coordinates>31,61 31.1,61.1</coordinates></LineString></MultiGeometry>
+ </Placemark>
+</Document>
+</kml>`
+
+const importGpx = `<?xml version="1.0"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+ <wpt lat="60.25" lon="30.5"><name>wp1</name></wpt>
+ <rte><name>route1</name><rtept lat="60" lon="30"/><rtept lat="60.1" lon="30.1"/></rte>
+ <trk><name>track1</name><trkseg><trkpt lat="60" lon="30"/><trkpt lat="60.2" lon="30.2"/></trkseg></trk>
+</gpx>`
+
+func (app *TestApp) PostFile(url, token, name string, data []byte, fields map[string]string) (*http.Response, error) {
+	var buf bytes.Buffer
+
+	w := multipart.NewWriter(&buf)
+
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", url, &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add(fiber.HeaderContentType, w.FormDataContentType())
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	return app.api.f.Test(req, 3000)
+}
+
+func TestImportFeatures(t *testing.T) {
+	features, err := readImportFile("test.kml", []byte(importKml))
+	require.NoError(t, err)
+	require.Len(t, features, 4)
+
+	msg, err := features[0].toMsg("test.kml", 0, "blue")
+	require.NoError(t, err)
+	// id from the file is not used as uid
+	assert.NotEqual(t, "pt1", msg.GetUID())
+	assert.Equal(t, features[0].importUID("other.kml", 5, "blue"), msg.GetUID())
+	assert.NotEqual(t, features[0].importUID("test.kml", 0, "red"), msg.GetUID())
+	assert.Equal(t, "b-m-p-s-m", msg.GetType())
+	assert.Equal(t, "point", msg.GetCallsign())
+	assert.Equal(t, "-65536", msg.GetColor())
+	assert.Equal(t, "remark", msg.GetDetail().GetFirst("remarks").GetText())
+	assert.Equal(t, "blue", msg.Scope)
+
+	msg, err = features[1].toMsg("test.kml", 1, "blue")
+	require.NoError(t, err)
+	assert.Equal(t, "u-d-f", msg.GetType())
+
+	kind, points, _ := model.ShapeFromMsg(msg)
+	assert.Equal(t, model.FENCE_POLYGON, kind)
+	assert.Len(t, points, 4)
+
+	// uid of feature without id is the same on reimport
+	msg2, err := features[1].toMsg("test.kml", 1, "blue")
+	require.NoError(t, err)
+	assert.Equal(t, msg.GetUID(), msg2.GetUID())
+
+	features, err = readImportFile("test.GPX", []byte(importGpx))
+	require.NoError(t, err)
+	require.Len(t, features, 3)
+
+	msg, err = features[1].toMsg("test.gpx", 1, "blue")
+	require.NoError(t, err)
+	assert.Equal(t, "b-m-r", msg.GetType())
+	assert.Len(t, msg.GetDetail().GetAll("link"), 2)
+
+	_, err = readImportFile("test.txt", []byte(importKml))
+	assert.Error(t, err)
+}
+
+func TestImportApi(t *testing.T) {
+	app := NewTestApp()
+	app.dbm.Save(scopedDevice("blue_adm", "b", "blue", model.RoleScopeAdmin))
+	require.NoError(t, app.dbm.CreateMission(&model.Mission{Name: "m1", Scope: "blue"}))
+
+	blue := adminToken(t, app, "blue_adm", "b")
+
+	resp, err := app.PostFile("/api/import", blue, "test.kml", []byte(importKml), map[string]string{"scope": "red"})
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, err = app.PostFile("/api/import", blue, "test.kml", []byte(importKml), map[string]string{"scope": "blue", "mission": "m2"})
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotAcceptable, resp.StatusCode)
+
+	// contact with uid of the first feature is not changed
+	features, err := readImportFile("test.gpx", []byte(importGpx))
+	require.NoError(t, err)
+
+	contact := cot.BasicMsg("a-f-G-U-C", features[0].importUID("test.gpx", 0, "blue"), time.Minute)
+	contact.CotEvent.Detail = &cotproto.Detail{Contact: &cotproto.Contact{Callsign: "c1", Endpoint: "*:-1:stcp"}}
+	cm, _ := cot.CotFromProto(contact, "", "blue")
+	app.items.Store(model.FromMsg(cm))
+
+	resp, err = app.PostFile("/api/import", blue, "test.gpx", []byte(importGpx), map[string]string{"scope": "blue"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var res map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.EqualValues(t, 2, res["count"])
+	assert.Equal(t, "c1", app.items.Get(cm.GetUID()).GetCallsign())
+
+	resp, err = app.PostFile("/api/import", blue, "test.kml", []byte(importKml), map[string]string{"scope": "blue", "mission": "m1"})
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	m := app.dbm.MissionQuery().Scope("blue").Name("m1").Full().One()
+	require.NotNil(t, m)
+	assert.Len(t, m.Points, 4)
+
+	assert.EqualValues(t, 2, app.dbm.AuditQuery().Action(model.AUDIT_IMPORT).Count())
+}
@@ -55,6 +55,11 @@ func getCotPostHandler(app *App) fiber.Handler {
 			return err
 		}
 
+		// local api has no users, admin can send only to own scopes
+		if u := AdminUser(ctx); u != nil && !u.CanManageScope(c.Scope) {
+			return ctx.SendStatus(fiber.StatusForbidden)
+		}
+
 		app.NewCotMessage(c)
 
 		return nil
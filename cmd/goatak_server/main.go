@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -18,14 +19,21 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kdudkov/goutils/callback"
 	"github.com/prometheus/client_golang/prometheus"
 	"software.sslmate.com/src/go-pkcs12"
 
 	"github.com/kdudkov/goatak/internal/client"
 	"github.com/kdudkov/goatak/internal/config"
 	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/internal/federation"
+	"github.com/kdudkov/goatak/internal/filter"
+	"github.com/kdudkov/goatak/internal/geofence"
+	"github.com/kdudkov/goatak/internal/pipeline"
 	"github.com/kdudkov/goatak/internal/pm"
+	"github.com/kdudkov/goatak/internal/ratelimit"
 	"github.com/kdudkov/goatak/internal/repository"
+	"github.com/kdudkov/goatak/internal/webhook"
 	"github.com/kdudkov/goatak/pkg/chat"
 	"github.com/kdudkov/goatak/pkg/cot"
 	"github.com/kdudkov/goatak/pkg/model"
@@ -45,50 +53,136 @@ type App struct {
 	messages *chat.Storage
 	dbm      *database.DatabaseManager
 	users    repository.DeviceRepository
+	tracks   *repository.TrackHistory
+
+	federation *federation.Federation
+	geofences  *geofence.Engine
+	filters    *filter.Engine
+	limits     *ratelimit.Manager
+	webhooks   *webhook.Manager
+
+	emergencyCb *callback.Callback[*model.EmergencyDTO]
 
 	uid             string
-	ch              chan *cot.CotMessage
+	pipeline        *pipeline.Pipeline[*cot.CotMessage]
+	fanout          int
 	eventProcessors []*EventProcessor
 }
 
-func NewApp(config *config.AppConfig) *App {
+// NewApp creates the server, error is returned on bad config or database error.
+func NewApp(config *config.AppConfig) (*App, error) {
 	app := &App{
 		logger:          slog.Default(),
 		config:          config,
 		files:           pm.NewBlobManages(filepath.Join(config.DataDir(), "blob")),
-		ch:              make(chan *cot.CotMessage, 128),
 		handlers:        sync.Map{},
 		items:           repository.NewItemsMemoryRepo(),
 		messages:        chat.NewStorage(),
+		geofences:       geofence.NewEngine(),
+		emergencyCb:     callback.New[*model.EmergencyDTO](),
 		uid:             uuid.NewString(),
 		eventProcessors: make([]*EventProcessor, 0),
 	}
 
+	app.pipeline = pipeline.New(config.Int("pipeline.workers"), config.Int("pipeline.queue_size"), msgKey, app.processMessage)
+	app.fanout = app.pipeline.Workers()
+
 	db, err := database.GetDatabase(config.String("db"), false)
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	app.dbm = database.New(db)
 	if err := app.dbm.Migrate(); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	app.dbm.AddDefaults()
 
-	app.users = repository.NewUserDbRepository(config.UsersFile(), app.dbm)
+	localUsers := repository.NewUserDbRepository(config.UsersFile(), app.dbm)
+	app.users = localUsers
+
+	ldapConf, err := config.Ldap()
+	if err != nil {
+		return nil, err
+	}
+
+	if ldapConf != nil {
+		if app.users, err = repository.NewUserLdapRepository(ldapConf, localUsers); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.PersistItems() {
+		app.items = repository.NewItemsDbRepo(app.dbm, config.ItemsTrackPoints(), config.ItemsFlushInterval())
+	}
+
+	if config.TracksEnabled() {
+		app.tracks = repository.NewTrackHistory(app.dbm, config.TracksFlushInterval(), config.TracksRetention(), config.TracksScopeRetention())
+	}
+
+	peers, err := config.Federates()
+	if err != nil {
+		return nil, err
+	}
+
+	app.federation = federation.New(app.uid, config.FederationLoopWindow(), peers)
+
+	rules, seed, err := app.filterRules()
+	if err != nil {
+		return nil, err
+	}
+
+	if app.filters, err = filter.New(rules); err != nil {
+		return nil, err
+	}
+
+	// config rules are stored once, then database is the source of rules
+	if seed {
+		if err := app.saveFilterRules(); err != nil {
+			return nil, err
+		}
+	}
+
+	hooks, err := config.Webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	if app.webhooks, err = webhook.New(hooks); err != nil {
+		return nil, err
+	}
+
+	limits, err := config.RateLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	if app.limits, err = ratelimit.NewManager(limits); err != nil {
+		return nil, err
+	}
 
-	return app
+	return app, nil
 }
 
 func (app *App) Run() {
 	app.InitMessageProcessors()
 
+	if err := app.dbm.StartAudit(app.config.AuditHeadFile()); err != nil {
+		log.Fatal(err)
+	}
+
 	if err := app.items.Start(); err != nil {
 		log.Fatal(err)
 	}
 
+	if app.tracks != nil {
+		if err := app.tracks.Start(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if err := app.users.Start(); err != nil {
 		log.Fatal(err)
 	}
@@ -97,6 +191,8 @@ func (app *App) Run() {
 		log.Fatal(err)
 	}
 
+	app.startGeofences()
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	if addr := app.config.String("udp_addr"); addr != "" {
@@ -123,9 +219,15 @@ func (app *App) Run() {
 		}()
 	}
 
+	app.startMesh(ctx)
+
 	NewHttp(app).Start()
 
-	go app.messageProcessLoop()
+	app.webhooks.Start()
+	app.limits.Start()
+	app.pipeline.Start()
+
+	app.startFederation(ctx)
 
 	for _, c := range app.config.Connections() {
 		app.logger.Info("start external connection to " + c)
@@ -137,6 +239,16 @@ func (app *App) Run() {
 	<-c
 	app.logger.Info("exiting...")
 	cancel()
+	app.pipeline.Stop()
+	app.webhooks.Stop()
+	app.limits.Stop()
+	app.items.Stop()
+
+	if app.tracks != nil {
+		app.tracks.Stop()
+	}
+
+	app.dbm.StopAudit()
 }
 
 func (app *App) NewCotMessage(msg *cot.CotMessage) {
@@ -149,9 +261,7 @@ func (app *App) NewCotMessage(msg *cot.CotMessage) {
 
 		messagesMetric.With(prometheus.Labels{"scope": msg.Scope, "msg_type": t}).Inc()
 
-		select {
-		case app.ch <- msg:
-		default:
+		if !app.pipeline.Push(msg) {
 			dropMetric.With(prometheus.Labels{"scope": msg.Scope, "reason": "main_ch"}).Inc()
 		}
 	}
@@ -195,8 +305,12 @@ func (app *App) RemoveHandlerCb(cl client.ClientHandler) {
 	}
 }
 
-func (app *App) NewContactCb(uid, callsign string) {
-	app.logger.Info(fmt.Sprintf("new contact: %s %s", uid, callsign))
+func (app *App) NewContactCb(ch client.ClientHandler, msg *cot.CotMessage) {
+	app.logger.Info(fmt.Sprintf("new contact: %s %s", msg.GetUID(), msg.GetCallsign()))
+
+	if app.config.SnapshotEnabled() {
+		go app.sendSnapshot(ch, msg)
+	}
 }
 
 func (app *App) ConnectTo(ctx context.Context, addr string) {
@@ -223,8 +337,10 @@ func (app *App) ConnectTo(ctx context.Context, addr string) {
 				app.handlers.Delete(name)
 				app.logger.Info("disconnected")
 			},
-			IsClient: true,
-			UID:      app.uid,
+			IsClient:    true,
+			UID:         app.uid,
+			QueueMetric: queueMetric,
+			QueueSize:   app.config.Int("queue_size"),
 		})
 
 		go h.Start()
@@ -288,31 +404,31 @@ func (app *App) connect(connectStr string) (net.Conn, error) {
 }
 
 func (app *App) getTLSConfig() *tls.Config {
-	p12Data, err := os.ReadFile(app.config.String("ssl.cert"))
+	tlsCert, err := loadP12Cert(app.config.String("ssl.cert"), app.config.String("ssl.password"))
 	if err != nil {
 		app.logger.Error(err.Error())
 		panic(err)
 	}
 
-	key, cert, _, err := pkcs12.DecodeChain(p12Data, app.config.String("ssl.password"))
+	return &tls.Config{Certificates: []tls.Certificate{*tlsCert}, InsecureSkipVerify: true} //nolint:exhaustruct
+}
+
+func loadP12Cert(name, password string) (*tls.Certificate, error) {
+	p12Data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	key, cert, _, err := pkcs12.DecodeChain(p12Data, password)
 	if err != nil {
-		app.logger.Error(err.Error())
-		panic(err)
+		return nil, err
 	}
 
-	tlsCert := tls.Certificate{ //nolint:exhaustruct,typeassert
+	return &tls.Certificate{ //nolint:exhaustruct,typeassert
 		Certificate: [][]byte{cert.Raw},
 		PrivateKey:  key.(crypto.PrivateKey),
 		Leaf:        cert,
-	}
-
-	return &tls.Config{Certificates: []tls.Certificate{tlsCert}, InsecureSkipVerify: true} //nolint:exhaustruct
-}
-
-func (app *App) messageProcessLoop() {
-	for msg := range app.ch {
-		app.processMessage(msg)
-	}
+	}, nil
 }
 
 func (app *App) route(msg *cot.CotMessage) bool {
@@ -387,25 +503,35 @@ func (app *App) notifyMissionSubscribers(mission *model.Mission, c *model.Change
 }
 
 func (app *App) sendBroadcast(msg *cot.CotMessage) {
+	from := app.msgDevice(msg)
+
+	var clients []client.ClientHandler
+
 	app.ForAllClients(func(ch client.ClientHandler) bool {
 		if ch.GetName() != msg.From {
-			if err := ch.SendMsg(msg); err != nil {
-				app.logger.Error(fmt.Sprintf("error sending to %s: %v", ch.GetName(), err))
-			}
+			clients = append(clients, ch)
 		}
 
 		return true
 	})
+
+	pipeline.Parallel(clients, app.fanout, fanoutChunk, func(ch client.ClientHandler) {
+		if err := app.sendTo(ch, msg, from); err != nil {
+			app.logger.Error(fmt.Sprintf("error sending to %s: %v", ch.GetName(), err))
+		}
+	})
 }
 
 func (app *App) sendToCallsign(callsign string, msg *cot.CotMessage) {
 	var found bool
 
+	from := app.msgDevice(msg)
+
 	app.ForAllClients(func(ch client.ClientHandler) bool {
 		if ch.HasCallsign(callsign) {
 			found = true
 
-			if err := ch.SendMsg(msg); err != nil {
+			if err := app.sendTo(ch, msg, from); err != nil {
 				app.logger.Error("send error", slog.Any("error", err))
 			}
 		}
@@ -419,9 +545,11 @@ func (app *App) sendToCallsign(callsign string, msg *cot.CotMessage) {
 }
 
 func (app *App) sendToUID(uid string, msg *cot.CotMessage) {
+	from := app.msgDevice(msg)
+
 	app.ForAllClients(func(ch client.ClientHandler) bool {
 		if ch.HasUID(uid) {
-			if err := ch.SendMsg(msg); err != nil {
+			if err := app.sendTo(ch, msg, from); err != nil {
 				app.logger.Error("send error", slog.Any("error", err))
 			}
 		}
@@ -430,6 +558,33 @@ func (app *App) sendToUID(uid string, msg *cot.CotMessage) {
 	})
 }
 
+// sendTo sends message to client after egress filter check.
+func (app *App) sendTo(ch client.ClientHandler, msg *cot.CotMessage, from *model.Device) error {
+	m := app.filters.Egress(msg, from, ch.GetDevice())
+
+	if m == nil {
+		dropMetric.With(prometheus.Labels{"scope": msg.Scope, "reason": "filter_out"}).Inc()
+
+		return nil
+	}
+
+	// queue overflow is already counted by client metrics
+	if err := ch.SendMsg(m); err != nil && !errors.Is(err, client.ErrQueueFull) {
+		return err
+	}
+
+	return nil
+}
+
+// msgDevice returns device of the connection message came from.
+func (app *App) msgDevice(msg *cot.CotMessage) *model.Device {
+	if v, ok := app.handlers.Load(msg.From); ok {
+		return v.(client.ClientHandler).GetDevice()
+	}
+
+	return nil
+}
+
 func (app *App) checkUID(uid string) bool {
 	u := strings.ToLower(uid)
 	for _, s := range app.config.BlacklistedUID() {
@@ -467,7 +622,11 @@ func main() {
 		slog.Default().Error(err.Error())
 	}
 
-	app := NewApp(conf)
+	app, err := NewApp(conf)
+	if err != nil {
+		slog.Default().Error("can't start server", slog.Any("error", err))
+		os.Exit(1)
+	}
 
 	app.lat = conf.Float64("me.lat")
 	app.lon = conf.Float64("me.lon")
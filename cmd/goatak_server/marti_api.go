@@ -84,6 +84,8 @@ func addMartiRoutes(app *App, f fiber.Router) {
 	f.Get("/Marti/api/util/user/roles", getUserRolesHandler(app))
 
 	f.Get("/Marti/api/groups/all", getAllGroupsHandler(app))
+	f.Put("/Marti/api/groups/active", getActiveGroupsPutHandler(app))
+	f.Post("/Marti/api/groups/active", getActiveGroupsPutHandler(app))
 	f.Get("/Marti/api/groups/groupCacheEnabled", getAllGroupsCacheHandler(app))
 
 	f.Get("/Marti/api/cops/hierarchy", getCopHierarchyHandler(app))
@@ -106,6 +108,7 @@ func addMartiRoutes(app *App, f fiber.Router) {
 	f.Get("/Marti/api/video", getVideo2ListHandler(app))
 
 	addMissionApi(app, f)
+	addOgcApi(app, f)
 }
 
 func getVersionHandler(app *App) fiber.Handler {
@@ -489,22 +492,6 @@ func getUserRolesHandler(app *App) fiber.Handler {
 	}
 }
 
-func getAllGroupsHandler(app *App) fiber.Handler {
-	g := make(map[string]any)
-	g["name"] = "__ANON__"
-	g["direction"] = "OUT"
-	g["created"] = "2023-01-01"
-	g["type"] = "SYSTEM"
-	g["bitpos"] = 2
-	g["active"] = true
-
-	result := makeAnswer("com.bbn.marti.remote.groups.Group", []map[string]any{g})
-
-	return func(ctx *fiber.Ctx) error {
-		return ctx.JSON(result)
-	}
-}
-
 func getAllGroupsCacheHandler(_ *App) fiber.Handler {
 	result := makeAnswer("java.lang.Boolean", true)
 
@@ -632,13 +619,15 @@ func getXmlHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusBadRequest)
 		}
 
+		user := app.users.Get(Username(ctx))
+
 		var evt *cotproto.CotEvent
 		if item := app.items.Get(uid); item != nil {
-			evt = item.GetMsg().GetTakMessage().GetCotEvent()
+			evt = app.egressEvent(item.GetMsg().GetTakMessage().GetCotEvent(), item.GetScope(), user)
 		} else {
 			di := app.dbm.PointQuery().UID(uid).One()
 			if di != nil {
-				evt = di.GetEvent()
+				evt = app.egressEvent(di.GetEvent(), di.Scope, user)
 			}
 		}
 
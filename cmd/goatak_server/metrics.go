@@ -24,6 +24,12 @@ var (
 		Help:      "The total size of cots processed",
 	}, []string{"scope", "reason"})
 
+	queueMetric = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "goatak",
+		Name:      "client_queue",
+		Help:      "The number of queued and dropped messages per client",
+	}, []string{"client", "state"})
+
 	connectionsMetric = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "goatak",
 		Name:      "connections",
@@ -66,6 +66,7 @@ func getMissionsHandler(app *App) fiber.Handler {
 		app.logger.Info(fmt.Sprintf("got %d missions for scope %s", len(data), user.GetScope()))
 
 		for i, m := range data {
+			app.egressMission(m, user)
 			dto := model.ToMissionDTO(m, false)
 
 			if m.Scope != user.Scope {
@@ -89,6 +90,8 @@ func getMissionHandler(app *App) fiber.Handler {
 			return ctx.SendStatus(fiber.StatusNotFound)
 		}
 
+		app.egressMission(m, user)
+
 		return ctx.JSON(makeAnswer(missionType, []*model.MissionDTO{model.ToMissionDTO(m, false)}))
 	}
 }
@@ -347,7 +350,7 @@ func getMissionCotHandler(app *App) fiber.Handler {
 		enc := xml.NewEncoder(fb)
 
 		for _, item := range mission.Points {
-			evt := cot.CotToEvent(item.GetEvent())
+			evt := cot.CotToEvent(app.egressEvent(item.GetEvent(), mission.Scope, user))
 
 			if evt == nil {
 				continue
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/kml"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// OGC API - Features (part 1, core) read endpoint for live items and mission points.
+const (
+	ogcPrefix = "/ogc"
+
+	ogcMissionPrefix = "mission-"
+
+	ogcDefaultLimit = 100
+	ogcMaxLimit     = 10000
+
+	mimeGeoJSON = "application/geo+json"
+
+	crs84 = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+)
+
+var ogcConformance = []string{
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
+}
+
+// ogcClasses are collections of live items, collection id is the item class.
+var ogcClasses = []struct {
+	id    string
+	class string
+	title string
+}{
+	{"contacts", model.CONTACT, "Contacts"},
+	{"units", model.UNIT, "Units"},
+	{"points", model.POINT, "Points and drawings"},
+}
+
+type ogcLink struct {
+	Href  string `json:"href"`
+	Rel   string `json:"rel"`
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+type ogcCollection struct {
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	ItemType string     `json:"itemType"`
+	Crs      []string   `json:"crs"`
+	Links    []*ogcLink `json:"links"`
+}
+
+type ogcFeature struct {
+	*cot.Feature
+	Links []*ogcLink `json:"links,omitempty"`
+
+	time time.Time
+}
+
+type ogcFeatureCollection struct {
+	Type           string        `json:"type"`
+	Features       []*ogcFeature `json:"features"`
+	NumberMatched  int           `json:"numberMatched"`
+	NumberReturned int           `json:"numberReturned"`
+	TimeStamp      time.Time     `json:"timeStamp"`
+	Links          []*ogcLink    `json:"links"`
+}
+
+// ogcFilter is the bbox, datetime and cot type filter of items request.
+type ogcFilter struct {
+	bbox     []float64
+	from, to *time.Time
+	types    []string
+}
+
+func addOgcApi(app *App, f fiber.Router) {
+	g := f.Group(ogcPrefix)
+
+	g.Get("/", getOgcLandingHandler())
+	g.Get("/conformance", getOgcConformanceHandler())
+	g.Get("/collections", getOgcCollectionsHandler(app))
+	g.Get("/collections/:id", getOgcCollectionHandler(app))
+	g.Get("/collections/:id/items", getOgcItemsHandler(app))
+	g.Get("/collections/:id/items/:fid", getOgcItemHandler(app))
+}
+
+func ogcError(ctx *fiber.Ctx, status int, text string) error {
+	return ctx.Status(status).JSON(fiber.Map{"code": strconv.Itoa(status), "description": text})
+}
+
+func ogcUrl(ctx *fiber.Ctx, path string) string {
+	return ctx.BaseURL() + ogcPrefix + path
+}
+
+func getOgcLandingHandler() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		return ctx.JSON(fiber.Map{
+			"title":       "GoATAK server",
+			"description": "Live common operating picture",
+			"links": []*ogcLink{
+				{Href: ogcUrl(ctx, ""), Rel: "self", Type: fiber.MIMEApplicationJSON, Title: "this document"},
+				{Href: ogcUrl(ctx, "/conformance"), Rel: "conformance", Type: fiber.MIMEApplicationJSON, Title: "conformance classes"},
+				{Href: ogcUrl(ctx, "/collections"), Rel: "data", Type: fiber.MIMEApplicationJSON, Title: "collections"},
+			},
+		})
+	}
+}
+
+func getOgcConformanceHandler() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		return ctx.JSON(fiber.Map{"conformsTo": ogcConformance})
+	}
+}
+
+func newOgcCollection(ctx *fiber.Ctx, id, title string) *ogcCollection {
+	path := "/collections/" + url.PathEscape(id)
+
+	return &ogcCollection{
+		ID:       id,
+		Title:    title,
+		ItemType: "feature",
+		Crs:      []string{crs84},
+		Links: []*ogcLink{
+			{Href: ogcUrl(ctx, path), Rel: "self", Type: fiber.MIMEApplicationJSON},
+			{Href: ogcUrl(ctx, path+"/items"), Rel: "items", Type: mimeGeoJSON},
+		},
+	}
+}
+
+// ogcMissions returns missions from the groups the user can see, all of them if name is empty.
+func (app *App) ogcMissions(user *model.Device, name string, full bool) []*model.Mission {
+	q := app.dbm.MissionQuery().Scope(user.GetScope()).ReadScope(user.InGroups()).Name(name)
+	if full {
+		q = q.Full()
+	}
+
+	var res []*model.Mission
+
+	for _, m := range q.Get() {
+		if user.CanSeeScope(m.Scope) {
+			res = append(res, m)
+		}
+	}
+
+	return res
+}
+
+// ogcCollections returns collections available for the user, missions are from groups the user can see.
+func (app *App) ogcCollections(ctx *fiber.Ctx, user *model.Device) []*ogcCollection {
+	res := make([]*ogcCollection, 0, len(ogcClasses))
+
+	for _, c := range ogcClasses {
+		res = append(res, newOgcCollection(ctx, c.id, c.title))
+	}
+
+	for _, m := range app.ogcMissions(user, "", false) {
+		res = append(res, newOgcCollection(ctx, ogcMissionPrefix+m.Name, "Mission "+m.Name))
+	}
+
+	return res
+}
+
+func getOgcCollectionsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+
+		return ctx.JSON(fiber.Map{
+			"collections": app.ogcCollections(ctx, user),
+			"links": []*ogcLink{
+				{Href: ogcUrl(ctx, "/collections"), Rel: "self", Type: fiber.MIMEApplicationJSON},
+			},
+		})
+	}
+}
+
+func getOgcCollectionHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+		id, _ := url.PathUnescape(ctx.Params("id"))
+
+		for _, c := range app.ogcCollections(ctx, user) {
+			if c.ID == id {
+				return ctx.JSON(c)
+			}
+		}
+
+		return ogcError(ctx, fiber.StatusNotFound, "no collection "+id)
+	}
+}
+
+// ogcFeatures returns all features of the collection visible for the user, false if there is no such collection.
+func (app *App) ogcFeatures(user *model.Device, id string) ([]*ogcFeature, bool) {
+	if name, ok := strings.CutPrefix(id, ogcMissionPrefix); ok {
+		missions := app.ogcMissions(user, name, true)
+		if len(missions) == 0 {
+			return nil, false
+		}
+
+		m := missions[0]
+
+		res := make([]*ogcFeature, 0, len(m.Points))
+
+		for _, p := range m.Points {
+			f := pointFeature(p)
+			f.Properties["mission"] = m.Name
+			res = append(res, f)
+		}
+
+		return res, true
+	}
+
+	for _, c := range ogcClasses {
+		if c.id != id {
+			continue
+		}
+
+		var res []*ogcFeature
+
+		app.items.ForEach(func(item *model.Item) bool {
+			if item.GetClass() == c.class && user.CanSeeMsg(item.GetMsg()) {
+				res = append(res, itemFeature(item))
+			}
+
+			return true
+		})
+
+		// items are in random order, paging needs stable one
+		slices.SortFunc(res, func(a, b *ogcFeature) int { return strings.Compare(a.ID, b.ID) })
+
+		return res, true
+	}
+
+	return nil, false
+}
+
+func getOgcItemsHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+		id, _ := url.PathUnescape(ctx.Params("id"))
+
+		flt, err := parseOgcFilter(ctx)
+		if err != nil {
+			return ogcError(ctx, fiber.StatusBadRequest, err.Error())
+		}
+
+		limit := min(max(ctx.QueryInt("limit", ogcDefaultLimit), 1), ogcMaxLimit)
+		offset := max(ctx.QueryInt("offset", 0), 0)
+
+		features, ok := app.ogcFeatures(user, id)
+		if !ok {
+			return ogcError(ctx, fiber.StatusNotFound, "no collection "+id)
+		}
+
+		matched := make([]*ogcFeature, 0)
+
+		for _, f := range features {
+			if flt.match(f) {
+				matched = append(matched, f)
+			}
+		}
+
+		page := matched[min(offset, len(matched)):min(offset+limit, len(matched))]
+
+		for _, f := range page {
+			f.Links = []*ogcLink{{Href: ogcUrl(ctx, "/collections/"+url.PathEscape(id)+"/items/"+url.PathEscape(f.ID)), Rel: "self", Type: mimeGeoJSON}}
+		}
+
+		res := &ogcFeatureCollection{
+			Type:           "FeatureCollection",
+			Features:       page,
+			NumberMatched:  len(matched),
+			NumberReturned: len(page),
+			TimeStamp:      time.Now().UTC(),
+			Links: []*ogcLink{
+				{Href: ogcItemsUrl(ctx, id, offset, limit), Rel: "self", Type: mimeGeoJSON},
+				{Href: ogcUrl(ctx, "/collections/"+url.PathEscape(id)), Rel: "collection", Type: fiber.MIMEApplicationJSON},
+			},
+		}
+
+		if offset+limit < len(matched) {
+			res.Links = append(res.Links, &ogcLink{Href: ogcItemsUrl(ctx, id, offset+limit, limit), Rel: "next", Type: mimeGeoJSON})
+		}
+
+		if offset > 0 {
+			res.Links = append(res.Links, &ogcLink{Href: ogcItemsUrl(ctx, id, max(offset-limit, 0), limit), Rel: "prev", Type: mimeGeoJSON})
+		}
+
+		return ctx.JSON(res, mimeGeoJSON)
+	}
+}
+
+// ogcItemsUrl makes paging link with the same filter parameters.
+func ogcItemsUrl(ctx *fiber.Ctx, id string, offset, limit int) string {
+	q := url.Values{}
+
+	for _, k := range []string{"bbox", "datetime", "type"} {
+		if v := ctx.Query(k); v != "" {
+			q.Set(k, v)
+		}
+	}
+
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+
+	return ogcUrl(ctx, "/collections/"+url.PathEscape(id)+"/items?"+q.Encode())
+}
+
+func getOgcItemHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		user := app.users.Get(Username(ctx))
+		id, _ := url.PathUnescape(ctx.Params("id"))
+		fid, _ := url.PathUnescape(ctx.Params("fid"))
+
+		features, ok := app.ogcFeatures(user, id)
+		if !ok {
+			return ogcError(ctx, fiber.StatusNotFound, "no collection "+id)
+		}
+
+		for _, f := range features {
+			if f.ID == fid {
+				f.Links = []*ogcLink{
+					{Href: ogcUrl(ctx, "/collections/"+url.PathEscape(id)+"/items/"+url.PathEscape(fid)), Rel: "self", Type: mimeGeoJSON},
+					{Href: ogcUrl(ctx, "/collections/"+url.PathEscape(id)), Rel: "collection", Type: fiber.MIMEApplicationJSON},
+				}
+
+				return ctx.JSON(f, mimeGeoJSON)
+			}
+		}
+
+		return ogcError(ctx, fiber.StatusNotFound, "no feature "+fid)
+	}
+}
+
+// parseOgcFilter parses bbox (lon1,lat1,lon2,lat2), datetime (instant or interval with open ends) and cot type mask parameters.
+func parseOgcFilter(ctx *fiber.Ctx) (*ogcFilter, error) {
+	flt := &ogcFilter{types: splitQuery(ctx, "type")}
+
+	if s := ctx.Query("bbox"); s != "" {
+		parts := strings.Split(s, ",")
+
+		if len(parts) != 4 && len(parts) != 6 {
+			return nil, fmt.Errorf("bad bbox %s", s)
+		}
+
+		for _, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad bbox %s", s)
+			}
+
+			flt.bbox = append(flt.bbox, v)
+		}
+
+		// 3d bbox, height is ignored
+		if len(flt.bbox) == 6 {
+			flt.bbox = []float64{flt.bbox[0], flt.bbox[1], flt.bbox[3], flt.bbox[4]}
+		}
+	}
+
+	if s := ctx.Query("datetime"); s != "" {
+		start, end, interval := strings.Cut(s, "/")
+
+		from, err := parseOgcTime(start)
+		if err != nil {
+			return nil, err
+		}
+
+		to := from
+
+		if interval {
+			if to, err = parseOgcTime(end); err != nil {
+				return nil, err
+			}
+		}
+
+		flt.from, flt.to = from, to
+	}
+
+	return flt, nil
+}
+
+func parseOgcTime(s string) (*time.Time, error) {
+	if s == "" || s == ".." {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("bad datetime %s", s)
+	}
+
+	return &t, nil
+}
+
+func (flt *ogcFilter) match(f *ogcFeature) bool {
+	if len(flt.types) > 0 {
+		if typ, _ := f.Properties["type"].(string); !cot.MatchAnyPattern(typ, flt.types...) {
+			return false
+		}
+	}
+
+	if flt.from != nil && f.time.Before(*flt.from) {
+		return false
+	}
+
+	if flt.to != nil && f.time.After(*flt.to) {
+		return false
+	}
+
+	if len(flt.bbox) == 4 {
+		lat, lon, _ := f.Geometry.Position()
+
+		if lat < flt.bbox[1] || lat > flt.bbox[3] {
+			return false
+		}
+
+		// bbox can cross antimeridian
+		if flt.bbox[0] <= flt.bbox[2] {
+			return lon >= flt.bbox[0] && lon <= flt.bbox[2]
+		}
+
+		return lon >= flt.bbox[0] || lon <= flt.bbox[2]
+	}
+
+	return true
+}
+
+func itemFeature(item *model.Item) *ogcFeature {
+	f := msgFeature(item.GetMsg())
+	f.time = item.GetLastSeen()
+	f.Properties["class"] = item.GetClass()
+	f.Properties["time"] = f.time.UTC()
+
+	if item.GetClass() == model.CONTACT {
+		f.Properties["online"] = item.IsOnline()
+	}
+
+	return f
+}
+
+// pointFeature makes feature from mission point, stored event is used if there is one.
+func pointFeature(p *model.Point) *ogcFeature {
+	var f *ogcFeature
+
+	if evt := p.GetEvent(); evt.GetUid() != "" {
+		if msg, err := cot.CotFromProto(&cotproto.TakMessage{CotEvent: evt}, "", p.Scope); err == nil {
+			f = msgFeature(msg)
+		}
+	}
+
+	if f == nil {
+		f = &ogcFeature{Feature: &cot.Feature{
+			Type:     "Feature",
+			ID:       p.UID,
+			Geometry: &cot.Geometry{Type: cot.GeoPoint, Positions: [][]float64{{p.Lon, p.Lat}}},
+			Properties: map[string]any{
+				"type":     p.Type,
+				"callsign": p.Callsign,
+				"scope":    p.Scope,
+				"color":    p.Color,
+			},
+		}}
+	}
+
+	f.time = p.UpdatedAt
+	f.Properties["time"] = p.UpdatedAt.UTC()
+
+	return f
+}
+
+// msgFeature makes feature from cot message. Circles are polygons, as GeoJSON has no circles.
+func msgFeature(msg *cot.CotMessage) *ogcFeature {
+	f := cot.CotToFeature(msg)
+	f.Properties["scope"] = msg.Scope
+
+	if kind, _, r := model.ShapeFromMsg(msg); kind == model.FENCE_CIRCLE && r > 0 {
+		ring := circle(kml.Coord{Lat: msg.GetLat(), Lon: msg.GetLon()}, r)
+		positions := make([][]float64, len(ring))
+
+		for i, c := range ring {
+			positions[i] = []float64{c.Lon, c.Lat}
+		}
+
+		f.Geometry = &cot.Geometry{Type: cot.GeoPolygon, Positions: positions}
+	}
+
+	return &ogcFeature{Feature: f}
+}
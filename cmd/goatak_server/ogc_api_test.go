@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestOgcApi(t *testing.T) {
+	app := NewTestApp()
+	app.dbm.Save(&model.Device{Login: "blue1", Scope: "blue", ReadScope: []string{"green"}})
+
+	storeItem(app.App, "a-f-G-U-C", "blue1", "blue", 60, 30, time.Minute)
+	storeItem(app.App, "a-h-G", "blue2", "blue", 61, 31, time.Minute)
+	storeItem(app.App, "a-f-G", "green1", "green", 60.5, 30.5, time.Minute)
+	storeItem(app.App, "a-f-G", "red1", "red", 60, 30, time.Minute)
+	storeItem(app.App, "b-m-p-s-m", "point1", "blue", 60, 30, time.Minute)
+
+	m := &model.Mission{Name: "m 1", Scope: "blue"}
+	require.NoError(t, app.dbm.CreateMission(m))
+	require.NoError(t, app.dbm.CreateMission(&model.Mission{Name: "m2", Scope: "red"}))
+
+	msg := cot.BasicMsg("b-m-p-s-m", "mp1", time.Hour)
+	msg.CotEvent.Lat = 59
+	msg.CotEvent.Lon = 29
+	mp, _ := cot.CotFromProto(msg, "", "blue")
+	_, err := app.dbm.AddMissionPoint(m, mp)
+	require.NoError(t, err)
+
+	f := fiber.New()
+	f.Use(func(ctx *fiber.Ctx) error {
+		ctx.Locals(UsernameKey, "blue1")
+
+		return ctx.Next()
+	})
+	addOgcApi(app.App, f)
+
+	get := func(url string, status int) map[string]any {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+
+		resp, err := f.Test(req, 3000)
+		require.NoError(t, err)
+		require.Equal(t, status, resp.StatusCode, url)
+
+		res := make(map[string]any)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+
+		return res
+	}
+
+	ids := func(res map[string]any) []string {
+		var r []string
+		for _, f := range res["features"].([]any) {
+			r = append(r, f.(map[string]any)["id"].(string))
+		}
+
+		return r
+	}
+
+	colls := get("/ogc/collections", fiber.StatusOK)["collections"].([]any)
+	require.Len(t, colls, 4)
+	assert.Equal(t, "mission-m 1", colls[3].(map[string]any)["id"])
+
+	assert.Equal(t, []string{"blue1", "blue2", "green1"}, ids(get("/ogc/collections/units/items", fiber.StatusOK)))
+	assert.Equal(t, []string{"blue1", "green1"}, ids(get("/ogc/collections/units/items?bbox=29.9,59.9,30.6,60.6", fiber.StatusOK)))
+	assert.Equal(t, []string{"blue2"}, ids(get("/ogc/collections/units/items?type=a-h-", fiber.StatusOK)))
+	assert.Empty(t, ids(get("/ogc/collections/units/items?datetime=2020-01-01T00:00:00Z/2020-01-02T00:00:00Z", fiber.StatusOK)))
+	assert.Len(t, ids(get("/ogc/collections/units/items?datetime=2020-01-01T00:00:00Z/..", fiber.StatusOK)), 3)
+
+	page := get("/ogc/collections/units/items?limit=2", fiber.StatusOK)
+	assert.Equal(t, []string{"blue1", "blue2"}, ids(page))
+	assert.EqualValues(t, 3, page["numberMatched"])
+
+	page = get("/ogc/collections/units/items?limit=2&offset=2", fiber.StatusOK)
+	assert.Equal(t, []string{"green1"}, ids(page))
+
+	assert.Equal(t, []string{"point1"}, ids(get("/ogc/collections/points/items", fiber.StatusOK)))
+	assert.Equal(t, []string{"mp1"}, ids(get("/ogc/collections/mission-m%201/items", fiber.StatusOK)))
+
+	item := get("/ogc/collections/units/items/green1", fiber.StatusOK)
+	assert.Equal(t, "Point", item["geometry"].(map[string]any)["type"])
+	assert.Equal(t, []any{30.5, 60.5}, item["geometry"].(map[string]any)["coordinates"])
+
+	get("/ogc/collections/units/items/red1", fiber.StatusNotFound)
+	get("/ogc/collections/mission-m2/items", fiber.StatusNotFound)
+	get("/ogc/collections/units/items?bbox=1,2,3", fiber.StatusBadRequest)
+	get("/ogc/collections/units/items?datetime=yesterday", fiber.StatusBadRequest)
+}
+
+func TestOgcApiGroups(t *testing.T) {
+	app := NewTestApp()
+	d := &model.Device{Login: "user1", Scope: "blue"}
+	app.dbm.Save(d)
+	require.NoError(t, app.updateDeviceGroups(d, []*model.DeviceGroupDTO{
+		{Name: "blue", Out: true, Active: true},
+		{Name: "red", In: true, Active: true},
+	}))
+
+	storeItem(app.App, "a-f-G", "blue1", "blue", 60, 30, time.Minute)
+	storeItem(app.App, "a-f-G", "red1", "red", 60, 30, time.Minute)
+
+	msg, _ := cot.CotFromProto(cot.BasicMsg("a-f-G", "group1", time.Minute), "", "blue")
+	msg.Groups = []string{"red"}
+	app.items.Store(model.FromMsg(msg))
+
+	require.NoError(t, app.dbm.CreateMission(&model.Mission{Name: "m1", Scope: "blue"}))
+	require.NoError(t, app.dbm.CreateMission(&model.Mission{Name: "m2", Scope: "red"}))
+
+	user := app.users.Get("user1")
+
+	var ids []string
+
+	features, ok := app.ogcFeatures(user, "units")
+	require.True(t, ok)
+
+	for _, f := range features {
+		ids = append(ids, f.ID)
+	}
+
+	assert.Equal(t, []string{"group1", "red1"}, ids)
+
+	_, ok = app.ogcFeatures(user, "mission-m1")
+	assert.False(t, ok)
+
+	_, ok = app.ogcFeatures(user, "mission-m2")
+	assert.True(t, ok)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"github.com/kdudkov/goatak/internal/oidc"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	oidcCookieName = "oidc_state"
+	oidcAudience   = "oidc_state"
+	oidcStateTTL   = time.Minute * 10
+)
+
+// oidcState is kept in signed cookie between login redirect and callback.
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+func (h *HttpServer) getOidcLoginHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		st := &oidcState{
+			State:    randomString(32),
+			Nonce:    randomString(32),
+			Verifier: oauth2.GenerateVerifier(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{oidcAudience},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+			},
+		}
+
+		authURL, err := h.oidc.AuthURL(c.Context(), st.State, st.Nonce, st.Verifier)
+		if err != nil {
+			h.log.Error("oidc error", slog.Any("error", err))
+
+			return c.Render("templates/login", fiber.Map{"oidc": true, "error": "SSO provider is unavailable"})
+		}
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, st).SignedString(h.tokenKey)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+
+		c.Cookie(&fiber.Cookie{Name: oidcCookieName, Value: token, HTTPOnly: true, SameSite: fiber.CookieSameSiteLaxMode,
+			Expires: time.Now().Add(oidcStateTTL)})
+
+		return c.Redirect(authURL)
+	}
+}
+
+func (h *HttpServer) getOidcCallbackHandler(app *App) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		st, err := h.checkOidcState(c.Cookies(oidcCookieName), c.Query("state"))
+		c.ClearCookie(oidcCookieName)
+
+		if err == nil && c.Query("error") != "" {
+			err = fmt.Errorf("%s: %s", c.Query("error"), c.Query("error_description"))
+		}
+
+		var id *oidc.Identity
+
+		if err == nil {
+			id, err = h.oidc.Exchange(c.Context(), c.Query("code"), st.Nonce, st.Verifier)
+		}
+
+		var d *model.Device
+
+		if err == nil {
+			d, err = app.provisionOidcUser(id)
+		}
+
+		if err != nil {
+			h.log.Warn("oidc login error", slog.Any("error", err))
+
+			if id != nil {
+				h.dbm.Audit(id.Login, model.AUDIT_LOGIN_FAILED, id.Login, c.IP(), nil, fiber.Map{"sso": true, "error": err.Error()})
+			}
+
+			return c.Render("templates/login", fiber.Map{"oidc": true, "error": "SSO login failed"})
+		}
+
+		token, err := generateToken(d.Login, h.tokenKey, h.tokenMaxAge)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+
+		h.log.Info("oidc login", "user", d.Login)
+		h.dbm.Audit(d.Login, model.AUDIT_LOGIN, d.Login, c.IP(), nil, fiber.Map{"sso": true})
+
+		c.Cookie(&fiber.Cookie{Name: cookieName,
+			Value: token, Secure: false, HTTPOnly: true, Expires: time.Now().Add(h.tokenMaxAge)})
+
+		return c.Redirect("/")
+	}
+}
+
+func (h *HttpServer) checkOidcState(cookie, state string) (*oidcState, error) {
+	if cookie == "" {
+		return nil, errors.New("no state cookie")
+	}
+
+	st := new(oidcState)
+
+	_, err := jwt.ParseWithClaims(cookie, st, func(token *jwt.Token) (any, error) {
+		return h.tokenKey, nil
+	}, jwt.WithAudience(oidcAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if state == "" || st.State != state {
+		return nil, errors.New("bad state")
+	}
+
+	return st, nil
+}
+
+// provisionOidcUser creates or updates admin device for sso user.
+// Device is found by issuer and subject, login claim is used only for new device and can't take local device.
+func (app *App) provisionOidcUser(id *oidc.Identity) (*model.Device, error) {
+	if !id.Admin {
+		return nil, fmt.Errorf("user %s is not an admin", id.Login)
+	}
+
+	if id.Subject == "" {
+		return nil, fmt.Errorf("no subject for user %s", id.Login)
+	}
+
+	d := app.dbm.DeviceQuery().Sso(id.Issuer, id.Subject).One()
+
+	if d == nil {
+		if app.dbm.DeviceQuery().Login(id.Login).One() != nil {
+			return nil, fmt.Errorf("login %s is used by not sso device", id.Login)
+		}
+
+		d = &model.Device{Login: id.Login, SsoIssuer: id.Issuer, SsoSubject: id.Subject}
+		app.logger.Info("new sso admin " + id.Login)
+	}
+
+	if d.Disabled {
+		return nil, fmt.Errorf("user %s is disabled", d.Login)
+	}
+
+	d.Admin, d.Role, d.Scope, d.ReadScope = true, cmp.Or(id.AdminRole, model.RoleScopeAdmin), id.Scope, id.ReadScope
+
+	if err := app.dbm.Save(d); err != nil {
+		return nil, err
+	}
+
+	return d, app.updateDeviceGroups(d, nil)
+}
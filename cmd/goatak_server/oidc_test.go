@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/oidc"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestProvisionOidcUser(t *testing.T) {
+	app, _ := newPipelineApp(1, 0)
+
+	_, err := app.provisionOidcUser(&oidc.Identity{Issuer: "iss", Subject: "s1", Login: "john", Scope: "blue"})
+	require.Error(t, err)
+	assert.Nil(t, app.dbm.DeviceQuery().Login("john").One())
+
+	_, err = app.provisionOidcUser(&oidc.Identity{Issuer: "iss", Subject: "s1", Login: "john", Admin: true, Scope: "blue", ReadScope: []string{"red"}})
+	require.NoError(t, err)
+
+	d := app.dbm.DeviceQuery().Login("john").One()
+	require.NotNil(t, d)
+	assert.True(t, d.CanLogIn())
+	assert.Equal(t, "blue", d.Scope)
+	assert.Equal(t, []string{"red"}, d.ReadScope)
+	assert.Equal(t, model.RoleScopeAdmin, d.AdminRole())
+	assert.False(t, d.IsSuperAdmin())
+	// sso user can't log in with password
+	assert.False(t, d.CheckPassword(""))
+
+	// changed login claim doesn't change the device
+	d1, err := app.provisionOidcUser(&oidc.Identity{Issuer: "iss", Subject: "s1", Login: "john1", Admin: true, AdminRole: model.RoleOperator, Scope: "ops"})
+	require.NoError(t, err)
+	assert.Equal(t, "john", d1.Login)
+	assert.Equal(t, model.RoleOperator, d1.AdminRole())
+	assert.Equal(t, "ops", app.dbm.DeviceQuery().Login("john").One().Scope)
+	assert.Nil(t, app.dbm.DeviceQuery().Login("john1").One())
+
+	d.Disabled = true
+	require.NoError(t, app.dbm.Save(d))
+	_, err = app.provisionOidcUser(&oidc.Identity{Issuer: "iss", Subject: "s1", Login: "john", Admin: true, Scope: "ops"})
+	require.Error(t, err)
+}
+
+func TestProvisionOidcUserTakeover(t *testing.T) {
+	app, _ := newPipelineApp(1, 0)
+
+	require.NoError(t, app.dbm.Save(&model.Device{Login: "local", Scope: "blue"}))
+
+	// other subject with the same login claim
+	_, err := app.provisionOidcUser(&oidc.Identity{Issuer: "iss", Subject: "s1", Login: "john", Admin: true, Scope: "blue"})
+	require.NoError(t, err)
+	_, err = app.provisionOidcUser(&oidc.Identity{Issuer: "iss", Subject: "s2", Login: "john", Admin: true, Scope: "blue"})
+	require.Error(t, err)
+
+	// local device is not bound to sso user
+	_, err = app.provisionOidcUser(&oidc.Identity{Issuer: "iss", Subject: "s3", Login: "local", Admin: true, Scope: "blue"})
+	require.Error(t, err)
+	assert.False(t, app.dbm.DeviceQuery().Login("local").One().Admin)
+
+	_, err = app.provisionOidcUser(&oidc.Identity{Issuer: "iss", Login: "new", Admin: true, Scope: "blue"})
+	require.Error(t, err)
+}
+
+func TestOidcState(t *testing.T) {
+	h := &HttpServer{tokenKey: []byte("111")}
+
+	st := &oidcState{
+		State: "s1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, st).SignedString(h.tokenKey)
+	require.NoError(t, err)
+
+	_, err = h.checkOidcState(cookie, "s1")
+	require.NoError(t, err)
+
+	_, err = h.checkOidcState(cookie, "s2")
+	require.Error(t, err)
+
+	_, err = h.checkOidcState("", "s1")
+	require.Error(t, err)
+
+	// login token can't be used as state
+	token, err := generateToken("s1", h.tokenKey, time.Minute)
+	require.NoError(t, err)
+
+	_, err = h.checkOidcState(token, "s1")
+	require.Error(t, err)
+}
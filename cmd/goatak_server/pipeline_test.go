@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/internal/pipeline"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// simClient is a simulated connected client, it remembers the last position got for every uid.
+type simClient struct {
+	name    string
+	uid     string
+	device  *model.Device
+	serial  string
+	stopped atomic.Bool
+	got     atomic.Int64
+	mx      sync.Mutex
+	last    map[string]float64
+}
+
+func newSimClient(n int) *simClient {
+	return &simClient{
+		name:   fmt.Sprintf("client%d", n),
+		uid:    fmt.Sprintf("uid%d", n),
+		device: &model.Device{Login: fmt.Sprintf("user%d", n)},
+		last:   make(map[string]float64),
+	}
+}
+
+func (c *simClient) GetName() string                  { return c.name }
+func (c *simClient) HasUID(uid string) bool           { return uid == c.uid }
+func (c *simClient) HasCallsign(callsign string) bool { return callsign == c.uid }
+func (c *simClient) GetUids() map[string]string       { return map[string]string{c.uid: c.uid} }
+func (c *simClient) GetDevice() *model.Device         { return c.device }
+func (c *simClient) SetDevice(d *model.Device)        { c.device = d }
+func (c *simClient) GetSerial() string                { return c.serial }
+func (c *simClient) GetVersion() int32                { return 1 }
+func (c *simClient) GetLastSeen() *time.Time          { return nil }
+func (c *simClient) Stop()                            { c.stopped.Store(true) }
+
+func (c *simClient) SendMsg(msg *cot.CotMessage) error {
+	if !msg.IsLocal() && !c.GetDevice().CanSeeMsg(msg) {
+		return nil
+	}
+
+	c.got.Add(1)
+
+	c.mx.Lock()
+	c.last[msg.GetUID()] = msg.GetLat()
+	c.mx.Unlock()
+
+	return nil
+}
+
+func newPipelineApp(workers, clients int) (*App, []*simClient) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := config.NewAppConfig()
+	cfg.Set("db", ":memory:")
+
+	app, err := NewApp(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	app.logger = slog.Default()
+	app.InitMessageProcessors()
+	app.pipeline = pipeline.New(workers, 1024, msgKey, app.processMessage)
+	app.fanout = app.pipeline.Workers()
+
+	res := make([]*simClient, clients)
+
+	for i := range res {
+		res[i] = newSimClient(i)
+		app.AddClientHandler(res[i])
+	}
+
+	return app, res
+}
+
+func pliMsg(c *simClient, n int) *cot.CotMessage {
+	m := cot.BasicMsg("a-f-G-U-C", c.uid, time.Minute)
+	m.CotEvent.Lat = float64(n)
+
+	return &cot.CotMessage{From: c.name, TakMessage: m}
+}
+
+// push waits for the place in the queue instead of dropping the message.
+func push(app *App, msg *cot.CotMessage) {
+	for !app.pipeline.Push(msg) {
+		runtime.Gosched()
+	}
+}
+
+func TestPipelineOrder(t *testing.T) {
+	app, clients := newPipelineApp(4, 20)
+	app.pipeline.Start()
+
+	for n := range 50 {
+		for _, c := range clients {
+			push(app, pliMsg(c, n))
+		}
+	}
+
+	app.pipeline.Stop()
+
+	for _, c := range clients {
+		require.Equal(t, int64(50*(len(clients)-1)), c.got.Load())
+
+		for _, c1 := range clients {
+			if c1 != c {
+				assert.InDelta(t, 49, c.last[c1.uid], 0.0001)
+			}
+		}
+	}
+
+	for _, c := range clients {
+		item := app.items.Get(c.uid)
+		require.NotNil(t, item)
+
+		lat, _ := item.GetLanLon()
+		assert.InDelta(t, 49, lat, 0.0001)
+	}
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	workersList := []int{1, 4, runtime.NumCPU()}
+	slices.Sort(workersList)
+	workersList = slices.Compact(workersList)
+
+	for _, clients := range []int{10, 100, 500} {
+		for _, workers := range workersList {
+			b.Run(fmt.Sprintf("clients=%d/workers=%d", clients, workers), func(b *testing.B) {
+				app, sim := newPipelineApp(workers, clients)
+				msgs := make([]*cot.CotMessage, len(sim))
+
+				for i, c := range sim {
+					msgs[i] = pliMsg(c, i)
+				}
+
+				app.pipeline.Start()
+				b.ResetTimer()
+
+				for i := range b.N {
+					push(app, msgs[i%len(msgs)])
+				}
+
+				app.pipeline.Stop()
+				b.StopTimer()
+
+				var sent int64
+				for _, c := range sim {
+					sent += c.got.Load()
+				}
+
+				b.ReportMetric(float64(sent)/b.Elapsed().Seconds(), "sends/s")
+			})
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/kdudkov/goatak/pkg/chat"
@@ -15,7 +16,11 @@ import (
 	"github.com/kdudkov/goatak/pkg/model"
 )
 
-const WELCOME_MESSAGE_FROM_UID = "ADMIN_UID"
+const (
+	WELCOME_MESSAGE_FROM_UID = "ADMIN_UID"
+	// minimal number of clients for one fan-out goroutine
+	fanoutChunk = 64
+)
 
 type EventProcessor struct {
 	name    string
@@ -34,11 +39,16 @@ func (app *App) InitMessageProcessors() {
 		app.AddEventProcessor("file_logger", app.fileLoggerProcessor, ".-")
 	}
 
+	app.AddEventProcessor("filter", app.ruleFilterProcessor, ".-")
+	app.AddEventProcessor("webhook", app.webhookProcessor, ".-")
 	app.AddEventProcessor("metrics", app.metricsProcessor, "t-x-c-m")
 	app.AddEventProcessor("remove", app.removeItemProcessor, "t-x-d-d")
 	app.AddEventProcessor("chat", app.chatProcessor, "b-t-f", "b-t-f-", "b-f-t-")
+	app.AddEventProcessor("emergency", app.emergencyProcessor, "b-a-o-")
 	app.AddEventProcessor("items", app.saveItemProcessor, "a-", "b-", "u-")
+	app.AddEventProcessor("geofence", app.geofenceProcessor, "a-", "u-d-", "u-r-b-c-c")
 	app.AddEventProcessor("filter_control", filterProcessor, "t-")
+	app.AddEventProcessor("webhook_out", app.webhookPublishProcessor, ".-")
 
 	app.AddEventProcessor("router", app.route, ".-")
 }
@@ -57,6 +67,17 @@ func (app *App) processMessage(msg *cot.CotMessage) {
 	}
 }
 
+// msgKey returns the pipeline shard key, so all messages about one item are processed in order.
+func msgKey(msg *cot.CotMessage) string {
+	if msg.GetType() == "t-x-d-d" {
+		if uid := msg.GetFirstLink("p-p").GetAttr("uid"); uid != "" {
+			return uid
+		}
+	}
+
+	return msg.GetUID()
+}
+
 func (app *App) loggerProcessor(msg *cot.CotMessage) bool {
 	if !strings.HasPrefix(msg.GetType(), "a-") {
 		app.logger.Debug(fmt.Sprintf("%s %s", msg.GetType(), cot.GetMsgType(msg.GetType())))
@@ -98,8 +119,8 @@ func (app *App) chatProcessor(msg *cot.CotMessage) bool {
 		c := chat.FromCot(msg)
 		app.messages.Add(c)
 
-		if err := logChatMessage(c); err != nil {
-			app.logger.Warn("error logging chat", slog.Any("error", err))
+		if err := app.saveChatMessage(c); err != nil {
+			app.logger.Warn("error saving chat", slog.Any("error", err))
 		}
 	}
 
@@ -135,6 +156,10 @@ func (app *App) saveItemProcessor(msg *cot.CotMessage) bool {
 		}
 	}
 
+	if app.tracks != nil && (cl == model.UNIT || cl == model.CONTACT) {
+		app.tracks.Add(model.PositionFromMsg(msg))
+	}
+
 	return true
 }
 
@@ -148,6 +173,10 @@ func (app *App) processNewContact(item *model.Item, lastSeen time.Time) {
 
 	msgs := app.messages.GetFor(item, lastSeen)
 
+	if !lastSeen.IsZero() {
+		msgs = app.addMissedDirectMessages(msgs, item, lastSeen)
+	}
+
 	if len(msgs) > 0 {
 		app.logger.Info(fmt.Sprintf("got %d messages for %s %s", len(msgs), item.GetUID(), item.GetCallsign()))
 
@@ -196,6 +225,34 @@ func (app *App) metricsProcessor(msg *cot.CotMessage) bool {
 	return false
 }
 
+func (app *App) ruleFilterProcessor(msg *cot.CotMessage) bool {
+	if !app.filters.Ingress(msg, app.msgDevice(msg)) {
+		app.logger.Debug(fmt.Sprintf("msg %s %s is dropped by filter", msg.GetUID(), msg.GetType()))
+		dropMetric.With(prometheus.Labels{"scope": msg.Scope, "reason": "filter_in"}).Inc()
+
+		return false
+	}
+
+	return true
+}
+
+func (app *App) webhookProcessor(msg *cot.CotMessage) bool {
+	if !app.webhooks.Verdict(msg) {
+		app.logger.Debug(fmt.Sprintf("msg %s %s is dropped by webhook", msg.GetUID(), msg.GetType()))
+		dropMetric.With(prometheus.Labels{"scope": msg.Scope, "reason": "webhook"}).Inc()
+
+		return false
+	}
+
+	return true
+}
+
+func (app *App) webhookPublishProcessor(msg *cot.CotMessage) bool {
+	app.webhooks.Publish(msg)
+
+	return true
+}
+
 func filterProcessor(msg *cot.CotMessage) bool {
 	return !msg.IsControl()
 }
@@ -225,18 +282,41 @@ func logMessage(msg *cot.CotMessage, dir string) error {
 	return nil
 }
 
-func logChatMessage(c *chat.ChatMessage) error {
+func (app *App) saveChatMessage(c *chat.ChatMessage) error {
 	if c.GetUIDFrom() == WELCOME_MESSAGE_FROM_UID {
 		return nil
 	}
 
-	fd, err := os.OpenFile("msg.log", os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	rec, err := c.Record()
 	if err != nil {
-		return nil
+		return err
+	}
+
+	return app.dbm.SaveChat(rec)
+}
+
+// addMissedDirectMessages adds direct messages for item stored in database after lastSeen.
+func (app *App) addMissedDirectMessages(msgs []*cot.CotMessage, item *model.Item, lastSeen time.Time) []*cot.CotMessage {
+	uids := make(map[string]bool, len(msgs))
+
+	for _, m := range msgs {
+		uids[m.GetUID()] = true
 	}
 
-	defer fd.Close()
-	_, err = fmt.Fprintf(fd, "%s (%s) -> %s (%s) \"%s\"\n", c.GetUIDFrom(), c.GetCallsignFrom(), c.GetChatroom(), c.GetUIDTo(), c.GetText())
+	for _, rec := range app.dbm.ChatQuery().To(item.GetUID()).Direct(true).After(lastSeen).Order("created_at").Limit(0).Get() {
+		if uids[rec.UID] {
+			continue
+		}
+
+		c, err := chat.FromRecord(rec)
+		if err != nil {
+			app.logger.Warn("bad chat record "+rec.UID, slog.Any("error", err))
+
+			continue
+		}
+
+		msgs = append(msgs, c.GetMsg())
+	}
 
-	return err
+	return msgs
 }
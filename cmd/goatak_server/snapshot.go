@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// snapshotStallTimeout is the max time to wait for slow client queue, the rest of snapshot is dropped after it.
+var snapshotStallTimeout = time.Second * 30
+
+type queuedHandler interface {
+	IsActive() bool
+	QueueStats() client.QueueStats
+}
+
+type snapshotItem struct {
+	msg  *cot.CotMessage
+	dist float64
+}
+
+// snapshotItems returns messages of the current items the device can see, nearest first.
+// msg is the first position report of the client.
+func (app *App) snapshotItems(dev *model.Device, msg *cot.CotMessage) []*cot.CotMessage {
+	lat, lon := msg.GetLatLon()
+	hasPos := lat != 0 || lon != 0
+	maxDist := app.config.SnapshotDistance()
+	now := time.Now()
+
+	var items []*snapshotItem
+
+	app.items.ForEach(func(item *model.Item) bool {
+		m := item.GetMsg()
+
+		if m == nil || item.GetUID() == msg.GetUID() || !dev.CanSeeScope(item.GetScope()) {
+			return true
+		}
+
+		switch item.GetClass() {
+		case model.CONTACT:
+			if !item.IsOnline() {
+				return true
+			}
+		case model.UNIT, model.POINT:
+			if m.GetStaleTime().Before(now) {
+				return true
+			}
+		default:
+			return true
+		}
+
+		si := &snapshotItem{msg: m}
+
+		if hasPos {
+			ilat, ilon := item.GetLanLon()
+			si.dist, _ = model.DistBea(lat, lon, ilat, ilon)
+
+			if maxDist > 0 && si.dist > maxDist {
+				return true
+			}
+		}
+
+		items = append(items, si)
+
+		return true
+	})
+
+	slices.SortFunc(items, func(a, b *snapshotItem) int {
+		switch {
+		case a.dist < b.dist:
+			return -1
+		case a.dist > b.dist:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	res := make([]*cot.CotMessage, len(items))
+
+	for i, si := range items {
+		res[i] = si.msg
+	}
+
+	return res
+}
+
+// sendSnapshot sends current picture to the new client. Messages are paced with snapshot.rate
+// and wait while client queue is half full. Snapshot is dropped if the queue does not go down in snapshotStallTimeout.
+func (app *App) sendSnapshot(ch client.ClientHandler, msg *cot.CotMessage) {
+	msgs := app.snapshotItems(ch.GetDevice(), msg)
+
+	if len(msgs) == 0 {
+		return
+	}
+
+	app.logger.Info(fmt.Sprintf("sending %d items to %s", len(msgs), ch.GetName()))
+
+	interval := time.Second / time.Duration(max(app.config.SnapshotRate(), 1))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	q, _ := ch.(queuedHandler)
+
+	var stalled time.Time
+
+	for i := 0; i < len(msgs); {
+		<-ticker.C
+
+		if q != nil {
+			if !q.IsActive() {
+				return
+			}
+
+			if st := q.QueueStats(); st.Queued >= st.Size/2 {
+				if stalled.IsZero() {
+					stalled = time.Now()
+				} else if time.Since(stalled) > snapshotStallTimeout {
+					app.logger.Info(fmt.Sprintf("snapshot to %s is dropped, %d items are not sent", ch.GetName(), len(msgs)-i))
+
+					return
+				}
+
+				continue
+			}
+
+			stalled = time.Time{}
+		}
+
+		if err := app.sendTo(ch, msgs[i], nil); err != nil {
+			app.logger.Debug(fmt.Sprintf("snapshot to %s is stopped: %s", ch.GetName(), err.Error()))
+
+			return
+		}
+
+		i++
+	}
+}
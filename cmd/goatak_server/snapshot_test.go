@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func storeItem(app *App, typ, uid, scope string, lat, lon float64, stale time.Duration) {
+	msg := cot.BasicMsg(typ, uid, stale)
+	msg.CotEvent.Lat = lat
+	msg.CotEvent.Lon = lon
+
+	m, _ := cot.CotFromProto(msg, "", scope)
+	app.items.Store(model.FromMsg(m))
+}
+
+func TestSnapshot(t *testing.T) {
+	app, clients := newPipelineApp(1, 1)
+	require.NoError(t, app.config.Set("snapshot.distance", 100))
+	require.NoError(t, app.config.Set("snapshot.rate", 1000))
+
+	c := clients[0]
+	c.device.Scope = "blue"
+
+	storeItem(app, "a-f-G-U-C", c.uid, "blue", 60, 30, time.Minute)
+	storeItem(app, "a-f-G-U-C", "near", "blue", 60.1, 30, time.Minute)
+	storeItem(app, "a-h-G", "unit", "blue", 60.01, 30, time.Minute)
+	storeItem(app, "b-m-p-s-m", "stale", "blue", 60, 30, -time.Minute)
+	storeItem(app, "a-f-G-U-C", "far", "blue", 65, 30, time.Minute)
+	storeItem(app, "a-f-G-U-C", "red", "red", 60, 30, time.Minute)
+
+	msg := cot.BasicMsg("a-f-G-U-C", c.uid, time.Minute)
+	msg.CotEvent.Lat = 60
+	msg.CotEvent.Lon = 30
+	m, _ := cot.CotFromProto(msg, c.name, "blue")
+
+	var uids []string
+
+	for _, s := range app.snapshotItems(c.device, m) {
+		uids = append(uids, s.GetUID())
+	}
+
+	assert.Equal(t, []string{"unit", "near"}, uids)
+
+	app.sendSnapshot(c, m)
+	assert.Equal(t, int64(2), c.got.Load())
+}
+
+// slowClient never reads its queue.
+type slowClient struct {
+	*simClient
+}
+
+func (c *slowClient) IsActive() bool { return true }
+
+func (c *slowClient) QueueStats() client.QueueStats {
+	return client.QueueStats{Size: 10, Queued: 10}
+}
+
+func TestSnapshotSlowClient(t *testing.T) {
+	app, clients := newPipelineApp(1, 1)
+	require.NoError(t, app.config.Set("snapshot.rate", 1000))
+
+	old := snapshotStallTimeout
+	snapshotStallTimeout = time.Millisecond * 50
+
+	defer func() { snapshotStallTimeout = old }()
+
+	c := &slowClient{simClient: clients[0]}
+	storeItem(app, "a-f-G-U-C", "near", "", 60.1, 30, time.Minute)
+
+	msg := cot.BasicMsg("a-f-G-U-C", c.uid, time.Minute)
+	m, _ := cot.CotFromProto(msg, c.name, "")
+
+	done := make(chan struct{})
+
+	go func() {
+		app.sendSnapshot(c, m)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("snapshot is not dropped")
+	}
+
+	assert.Equal(t, int64(0), c.got.Load())
+}
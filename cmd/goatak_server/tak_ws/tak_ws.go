@@ -23,7 +23,7 @@ type MessageCb func(msg *cot.CotMessage)
 type WsClientHandler struct {
 	log       *slog.Logger
 	name      string
-	user      *model.Device
+	user      atomic.Pointer[model.Device]
 	ws        *websocket.Conn
 	ch        chan []byte
 	uids      sync.Map
@@ -32,16 +32,19 @@ type WsClientHandler struct {
 }
 
 func New(name string, user *model.Device, ws *websocket.Conn, mc MessageCb) *WsClientHandler {
-	return &WsClientHandler{
+	h := &WsClientHandler{
 		log:       slog.Default().With("logger", "tak_ws", "name", name, "user", user.GetLogin()),
 		name:      name,
-		user:      user,
 		ws:        ws,
 		uids:      sync.Map{},
 		ch:        make(chan []byte, 10),
 		active:    1,
 		messageCb: mc,
 	}
+
+	h.user.Store(user)
+
+	return h
 }
 
 func (w *WsClientHandler) GetName() string {
@@ -49,7 +52,11 @@ func (w *WsClientHandler) GetName() string {
 }
 
 func (w *WsClientHandler) GetDevice() *model.Device {
-	return w.user
+	return w.user.Load()
+}
+
+func (w *WsClientHandler) SetDevice(d *model.Device) {
+	w.user.Store(d)
 }
 
 func (w *WsClientHandler) GetSerial() string {
@@ -98,7 +105,7 @@ func (w *WsClientHandler) GetLastSeen() *time.Time {
 }
 
 func (w *WsClientHandler) SendMsg(msg *cot.CotMessage) error {
-	if msg.IsLocal() || w.user.CanSeeScope(msg.Scope) {
+	if msg.IsLocal() || w.GetDevice().CanSeeMsg(msg) {
 		return w.SendCot(msg.GetTakMessage())
 	}
 
@@ -192,6 +199,8 @@ func (w *WsClientHandler) parse(b []byte) error {
 		return fmt.Errorf("convert error %w", err)
 	}
 
+	cotmsg.Groups, cotmsg.HasGroups = w.GetDevice().OutGroups(), w.GetDevice().HasGroups()
+
 	if cotmsg.IsContact() {
 		uid := msg.GetCotEvent().GetUid()
 		uid = strings.TrimSuffix(uid, "-ping")
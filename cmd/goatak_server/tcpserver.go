@@ -5,12 +5,15 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"time"
 
 	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/internal/ratelimit"
+	"github.com/kdudkov/goatak/pkg/model"
 	"github.com/kdudkov/goatak/pkg/tlsutil"
 )
 
@@ -40,12 +43,25 @@ func (app *App) ListenTCP(ctx context.Context, addr string) (err error) {
 		}
 
 		app.logger.Info("TCP connection from" + conn.RemoteAddr().String())
+
+		ipKey := ratelimit.IPKey(remoteIP(conn))
+
+		if app.limits.IsBanned(ipKey) {
+			app.logger.Info("banned connection from " + conn.RemoteAddr().String())
+			_ = conn.Close()
+
+			continue
+		}
+
 		name := "tcp:" + conn.RemoteAddr().String()
 		h := client.NewConnClientHandler(name, conn, &client.HandlerConfig{
 			MessageCb:    app.NewCotMessage,
 			RemoveCb:     app.RemoveHandlerCb,
 			NewContactCb: app.NewContactCb,
 			DropMetric:   dropMetric,
+			QueueMetric:  queueMetric,
+			QueueSize:    app.config.Int("queue_size"),
+			Limiter:      app.connLimiter("", "", ipKey),
 			UidChecker:   app.checkUID,
 		})
 		app.AddClientHandler(h)
@@ -100,6 +116,11 @@ func (app *App) processTLSConn(ctx context.Context, conn *tls.Conn) {
 
 	if err := conn.HandshakeContext(ctx1); err != nil {
 		app.logger.Debug("Handshake error", slog.Any("error", err))
+
+		if e := new(certRejectedError); errors.As(err, &e) {
+			app.dbm.Audit(e.user, model.AUDIT_TLS_REJECTED, e.serial, remoteIP(conn), nil, map[string]string{"reason": e.reason})
+		}
+
 		_ = conn.Close()
 
 		return
@@ -113,16 +134,30 @@ func (app *App) processTLSConn(ctx context.Context, conn *tls.Conn) {
 		return
 	}
 
+	keys := []string{ratelimit.IPKey(remoteIP(conn)), ratelimit.CertKey(sn)}
+
+	if app.limits.IsBanned(keys...) {
+		app.logger.Info(fmt.Sprintf("banned connection from %s, user %s, sn %s", conn.RemoteAddr(), username, sn))
+		_ = conn.Close()
+
+		return
+	}
+
+	device := app.users.Get(username)
+
 	app.users.SaveConnectInfo(username, uid, sn)
 
 	name := "ssl:" + conn.RemoteAddr().String()
 	h := client.NewConnClientHandler(name, conn, &client.HandlerConfig{
-		Device:       app.users.Get(username),
+		Device:       device,
 		Serial:       sn,
 		MessageCb:    app.NewCotMessage,
 		RemoveCb:     app.RemoveHandlerCb,
 		NewContactCb: app.NewContactCb,
 		DropMetric:   dropMetric,
+		QueueMetric:  queueMetric,
+		QueueSize:    app.config.Int("queue_size"),
+		Limiter:      app.connLimiter(username, device.GetScope(), keys...),
 		UidChecker:   app.checkUID,
 	})
 	app.AddClientHandler(h)
@@ -136,7 +171,13 @@ func (app *App) verifyConnection(st tls.ConnectionState) error {
 	if !app.users.IsValid(user, sn) {
 		app.logger.Warn("bad user " + user)
 
-		return fmt.Errorf("bad user")
+		return &certRejectedError{user: user, serial: sn, reason: "bad user"}
+	}
+
+	if app.isCertRevoked(sn) {
+		app.logger.Warn(fmt.Sprintf("revoked certificate %s of user %s", sn, user))
+
+		return &certRejectedError{user: user, serial: sn, reason: "certificate is revoked"}
 	}
 
 	return nil
@@ -167,3 +208,20 @@ func getCertUID(st *tls.ConnectionState) string {
 
 	return ""
 }
+
+func (app *App) connLimiter(login, scope string, keys ...string) client.Limiter {
+	if l := app.limits.NewConn(login, scope, keys...); l != nil {
+		return l
+	}
+
+	return nil
+}
+
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+
+	return host
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// track points limits, max limit is also the number of positions loaded from database for one unit
+const (
+	trackDefaultLimit = 10000
+	trackMaxLimit     = 100000
+)
+
+// trackParams is the time range, decimation and points limit of track request.
+type trackParams struct {
+	from      time.Time
+	to        time.Time
+	tolerance float64
+	bucket    time.Duration
+	limit     int
+}
+
+// parseTrackParams parses from and to (RFC3339), tolerance in meters, bucket in seconds and limit of points in track.
+func parseTrackParams(ctx *fiber.Ctx) (*trackParams, error) {
+	p := &trackParams{limit: min(max(ctx.QueryInt("limit", trackDefaultLimit), 1), trackMaxLimit)}
+
+	for k, v := range map[string]*time.Time{"from": &p.from, "to": &p.to} {
+		if s := ctx.Query(k); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s: %w", k, err)
+			}
+
+			*v = t
+		}
+	}
+
+	if s := ctx.Query("tolerance"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("bad tolerance %s", s)
+		}
+
+		p.tolerance = f
+	}
+
+	if s := ctx.Query("bucket"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad bucket %s", s)
+		}
+
+		p.bucket = time.Second * time.Duration(n)
+	}
+
+	return p, nil
+}
+
+func (p *trackParams) inRange(t time.Time) bool {
+	return (p.from.IsZero() || !t.Before(p.from)) && (p.to.IsZero() || !t.After(p.to))
+}
+
+// decimate simplifies track and leaves limit newest points, true is returned if points were cut.
+func (p *trackParams) decimate(track []*model.Pos) ([]*model.Pos, bool) {
+	track = model.SimplifyTrack(model.BucketTrack(track, p.bucket), p.tolerance)
+
+	if len(track) > p.limit {
+		return track[len(track)-p.limit:], true
+	}
+
+	return track, false
+}
+
+// loadTrack returns time ordered positions of one unit, the newest trackMaxLimit only if there are more.
+func loadTrack(q *database.PositionQuery) ([]*model.PositionRecord, bool) {
+	recs := q.Order("time desc").Limit(trackMaxLimit + 1).Get()
+
+	truncated := len(recs) > trackMaxLimit
+	if truncated {
+		recs = recs[:trackMaxLimit]
+	}
+
+	slices.Reverse(recs)
+
+	return recs, truncated
+}
+
+// parseTrackBBox parses bbox lon1,lat1,lon2,lat2 to min lat, min lon, max lat, max lon.
+func parseTrackBBox(s string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bad bbox %s", s)
+	}
+
+	v := make([]float64, 4)
+
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad bbox %s", s)
+		}
+
+		v[i] = f
+	}
+
+	return []float64{min(v[1], v[3]), min(v[0], v[2]), max(v[1], v[3]), max(v[0], v[2])}, nil
+}
+
+// getApiTrackHandler returns stored tracks filtered by uid, callsign, scope, time range and bbox.
+// Limit is applied to every track after decimation, the newest points are kept and the track is marked as truncated.
+func getApiTrackHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		p, err := parseTrackParams(ctx)
+		if err != nil {
+			return SendError(ctx, err.Error())
+		}
+
+		scope := ctx.Query("scope")
+		if scope != "" && !AdminUser(ctx).CanManageScope(scope) {
+			return sendForbidden(ctx)
+		}
+
+		var bbox []float64
+
+		if s := ctx.Query("bbox"); s != "" {
+			if bbox, err = parseTrackBBox(s); err != nil {
+				return SendError(ctx, err.Error())
+			}
+		}
+
+		query := func() *database.PositionQuery {
+			q := app.dbm.PositionQuery().
+				Callsign(ctx.Query("callsign")).
+				Scope(AdminUser(ctx).AdminScopes()...).
+				From(p.from).
+				To(p.to)
+
+			if scope != "" {
+				q.Scope(scope)
+			}
+
+			if bbox != nil {
+				q.BBox(bbox[0], bbox[1], bbox[2], bbox[3])
+			}
+
+			return q
+		}
+
+		uids := []string{ctx.Query("uid")}
+		if uids[0] == "" {
+			uids = query().UIDs()
+			slices.Sort(uids)
+		}
+
+		tracks := make([]*model.TrackDTO, 0, len(uids))
+
+		for _, uid := range uids {
+			recs, truncated := loadTrack(query().UID(uid))
+
+			for _, t := range model.Tracks(recs) {
+				var cut bool
+
+				t.Points, cut = p.decimate(t.Points)
+				t.Truncated = truncated || cut
+				tracks = append(tracks, t)
+			}
+		}
+
+		return ctx.JSON(tracks)
+	}
+}
+
+// getApiTrackAtHandler returns the last known position of every unit with the callsign at the time.
+func getApiTrackAtHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		callsign := ctx.Query("callsign")
+		if callsign == "" {
+			return SendError(ctx, "empty callsign")
+		}
+
+		t := time.Now()
+
+		if s := ctx.Query("time"); s != "" {
+			var err error
+
+			if t, err = time.Parse(time.RFC3339, s); err != nil {
+				return SendError(ctx, "bad time: "+err.Error())
+			}
+		}
+
+		scopes := AdminUser(ctx).AdminScopes()
+		res := make([]*model.PositionDTO, 0)
+
+		// callsign can be used by several devices, so the last position is taken for every uid
+		for _, uid := range app.dbm.PositionQuery().Callsign(callsign).Scope(scopes...).To(t).UIDs() {
+			for _, r := range app.dbm.PositionQuery().UID(uid).Callsign(callsign).Scope(scopes...).To(t).Order("time desc").Limit(1).Get() {
+				res = append(res, r.DTO())
+			}
+		}
+
+		return ctx.JSON(res)
+	}
+}
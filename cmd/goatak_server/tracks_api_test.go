@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/repository"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestTracksApi(t *testing.T) {
+	app := NewTestApp()
+	app.dbm.Save(scopedDevice("blue_adm", "b", "blue", model.RoleScopeAdmin))
+
+	t0 := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	var recs []*model.PositionRecord
+
+	for i := range 10 {
+		tm := t0.Add(time.Minute * time.Duration(i))
+		recs = append(recs,
+			&model.PositionRecord{UID: "blue1", Callsign: "Alpha", Scope: "blue", Time: tm, Lat: 60 + float64(i)*0.01, Lon: 30},
+			&model.PositionRecord{UID: "red1", Callsign: "Alpha", Scope: "red", Time: tm, Lat: 50, Lon: 40 + float64(i)*0.01},
+		)
+	}
+
+	require.NoError(t, app.dbm.SavePositions(recs))
+
+	adm := adminToken(t, app, "adm1", "111")
+	blue := adminToken(t, app, "blue_adm", "b")
+
+	get := func(token, u string, res any) int {
+		resp, err := app.Req("GET", u, token, nil)
+		require.NoError(t, err)
+
+		if resp.StatusCode == fiber.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(res))
+		}
+
+		return resp.StatusCode
+	}
+
+	var tracks []*model.TrackDTO
+
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track", &tracks))
+	require.Len(t, tracks, 2)
+
+	require.Equal(t, fiber.StatusOK, get(blue, "/api/track", &tracks))
+	require.Len(t, tracks, 1)
+	assert.Equal(t, "blue1", tracks[0].UID)
+	assert.Len(t, tracks[0].Points, 10)
+
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track?uid=blue1&limit=3", &tracks))
+	require.Len(t, tracks, 1)
+	assert.Len(t, tracks[0].Points, 3)
+	assert.True(t, tracks[0].Truncated)
+
+	// limit is for every track, the newest points are kept
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track?limit=2", &tracks))
+	require.Len(t, tracks, 2)
+
+	for _, tr := range tracks {
+		require.Len(t, tr.Points, 2, tr.UID)
+		assert.True(t, tr.Truncated)
+		assert.Equal(t, t0.Add(time.Minute*9), tr.Points[1].Time.UTC())
+	}
+
+	// decimation is made before the limit
+	tracks = nil
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track?uid=blue1&bucket=300&limit=2", &tracks))
+	require.Len(t, tracks, 1)
+	assert.Len(t, tracks[0].Points, 2)
+	assert.False(t, tracks[0].Truncated)
+
+	q := url.Values{"from": {t0.Add(time.Minute * 2).Format(time.RFC3339)}, "to": {t0.Add(time.Minute * 5).Format(time.RFC3339)}}
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track?uid=blue1&"+q.Encode(), &tracks))
+	require.Len(t, tracks, 1)
+	assert.Len(t, tracks[0].Points, 4)
+
+	// straight line becomes two points
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track?uid=blue1&tolerance=10", &tracks))
+	assert.Len(t, tracks[0].Points, 2)
+
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track?uid=blue1&bucket=300", &tracks))
+	assert.Len(t, tracks[0].Points, 2)
+
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track?bbox=39.9,49.9,40.05,50.1", &tracks))
+	require.Len(t, tracks, 1)
+	assert.Equal(t, "red1", tracks[0].UID)
+	assert.Len(t, tracks[0].Points, 6)
+
+	assert.Equal(t, fiber.StatusForbidden, get(blue, "/api/track?scope=red", &tracks))
+	assert.Equal(t, 406, get(adm, "/api/track?from=yesterday", &tracks))
+	assert.Equal(t, 406, get(adm, "/api/track?bbox=1,2,3", &tracks))
+
+	var pos []*model.PositionDTO
+
+	q = url.Values{"callsign": {"Alpha"}, "time": {t0.Add(time.Minute*3 + time.Second*30).Format(time.RFC3339)}}
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track/at?"+q.Encode(), &pos))
+	require.Len(t, pos, 2)
+
+	require.Equal(t, fiber.StatusOK, get(blue, "/api/track/at?"+q.Encode(), &pos))
+	require.Len(t, pos, 1)
+	assert.Equal(t, "blue1", pos[0].UID)
+	assert.Equal(t, t0.Add(time.Minute*3), pos[0].Time.UTC())
+	assert.InDelta(t, 60.03, pos[0].Lat, 1e-9)
+
+	q.Set("time", t0.Add(-time.Minute).Format(time.RFC3339))
+	require.Equal(t, fiber.StatusOK, get(adm, "/api/track/at?"+q.Encode(), &pos))
+	assert.Empty(t, pos)
+
+	assert.Equal(t, 406, get(adm, "/api/track/at", &pos))
+}
+
+func TestTrackHistoryProcessor(t *testing.T) {
+	app := NewTestApp()
+	app.InitMessageProcessors()
+	app.tracks = repository.NewTrackHistory(app.dbm, time.Hour, 0, nil)
+	require.NoError(t, app.tracks.Start())
+
+	for _, typ := range []string{"a-f-G", "b-m-p-s-m"} {
+		msg := cot.BasicMsg(typ, typ, time.Minute)
+		msg.CotEvent.Lat, msg.CotEvent.Lon = 10, 20
+
+		m, err := cot.CotFromProto(msg, "", "blue")
+		require.NoError(t, err)
+
+		app.processMessage(m)
+	}
+
+	app.tracks.Stop()
+
+	// only units and contacts are stored
+	res := app.dbm.PositionQuery().Get()
+	require.Len(t, res, 1)
+	assert.Equal(t, "a-f-G", res[0].UID)
+	assert.Equal(t, "blue", res[0].Scope)
+}
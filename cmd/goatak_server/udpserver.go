@@ -2,19 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/xml"
+	"fmt"
 	"log/slog"
 	"net"
 
-	"google.golang.org/protobuf/proto"
-
+	"github.com/kdudkov/goatak/internal/mesh"
 	"github.com/kdudkov/goatak/pkg/cot"
-	"github.com/kdudkov/goatak/pkg/cotproto"
-)
-
-const (
-	magicByte      = 0xbf
-	scopeBroadcast = "broadcast"
 )
 
 func (app *App) ListenUDP(ctx context.Context, addr string) error {
@@ -41,58 +34,43 @@ func (app *App) ListenUDP(ctx context.Context, addr string) error {
 			continue
 		}
 
-		if buf[0] == magicByte && buf[2] == magicByte {
-			if buf[1] == 1 {
-				msg := new(cotproto.TakMessage)
-
-				err = proto.Unmarshal(buf[3:n], msg)
-				if err != nil {
-					app.logger.Error("protobuf decode error", slog.Any("error", err))
-
-					continue
-				}
+		c, err := mesh.Decode(buf[:n], "", cot.BroadcastScope)
+		if err != nil {
+			app.logger.Error("decode error", slog.Any("error", err))
 
-				c, err := cot.CotFromProto(msg, "", cot.BroadcastScope)
-				if err != nil {
-					app.logger.Error("protobuf detail extract error", slog.Any("error", err))
+			continue
+		}
 
-					continue
-				}
+		app.NewCotMessage(c)
+	}
 
-				app.NewCotMessage(c)
-			} else {
-				ev := &cot.Event{}
+	return nil
+}
 
-				err = xml.Unmarshal(buf[3:n], ev)
-				if err != nil {
-					app.logger.Error("xml decode error", slog.Any("error", err))
+// startMesh starts multicast gateways, they are added as client handlers.
+func (app *App) startMesh(ctx context.Context) {
+	confs, err := app.config.Meshes()
+	if err != nil {
+		app.logger.Error("invalid mesh config", slog.Any("error", err))
 
-					continue
-				}
+		return
+	}
 
-				c, err := cot.EventToProtoExt(ev, "", scopeBroadcast)
-				if err != nil {
-					app.logger.Error("error", slog.Any("error", err))
-				}
+	for _, c := range confs {
+		g, err := mesh.New(c, app.NewCotMessage)
+		if err != nil {
+			app.logger.Error("mesh error", slog.Any("error", err))
 
-				app.NewCotMessage(c)
-			}
-		} else {
-			ev := &cot.Event{}
-			if err := xml.Unmarshal(buf[:n], ev); err != nil {
-				app.logger.Error("decode error", slog.Any("error", err))
+			continue
+		}
 
-				continue
-			}
+		go func() {
+			app.AddClientHandler(g)
+			defer app.RemoveClientHandler(g.GetName())
 
-			c, err := cot.EventToProtoExt(ev, "", scopeBroadcast)
-			if err != nil {
-				app.logger.Error("error", slog.Any("error", err))
+			if err := g.Start(ctx); err != nil {
+				app.logger.Error(fmt.Sprintf("mesh %s error", c.Name), slog.Any("error", err))
 			}
-
-			app.NewCotMessage(c)
-		}
+		}()
 	}
-
-	return nil
 }
@@ -46,6 +46,8 @@ func NewHttp(app *App) *fiber.App {
 	srv.Get("/api/message", getMessagesHandler(app))
 	srv.Post("/api/message", addMessageHandler(app))
 	srv.Delete("/api/unit/:uid", deleteItemHandler(app))
+	srv.Get("/api/geojson", getGeoJSONHandler(app))
+	srv.Post("/api/geojson", addGeoJSONHandler(app))
 
 	srv.Get("/stack", getStackHandler())
 
@@ -68,6 +70,59 @@ func getUnitsHandler(app *App) fiber.Handler {
 	}
 }
 
+// getGeoJSONHandler returns all units and points as GeoJSON feature collection.
+func getGeoJSONHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var features []*cot.Feature
+
+		app.items.ForEach(func(item *model.Item) bool {
+			f := cot.CotToFeature(item.GetMsg())
+			f.Properties["class"] = item.GetClass()
+			features = append(features, f)
+
+			return true
+		})
+
+		return ctx.JSON(cot.NewFeatureCollection(features), "application/geo+json")
+	}
+}
+
+// addGeoJSONHandler adds points and shapes from GeoJSON feature collection, with send=1 they are sent to server.
+func addGeoJSONHandler(app *App) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		fc := new(cot.FeatureCollection)
+
+		if err := ctx.BodyParser(fc); err != nil {
+			return err
+		}
+
+		send := ctx.QueryBool("send")
+
+		for _, f := range fc.Features {
+			msg, err := cot.FeatureToCot(f, "", "")
+			if err != nil {
+				return ctx.Status(fiber.StatusBadRequest).SendString(err.Error())
+			}
+
+			if send {
+				app.SendMsg(msg.GetTakMessage())
+			}
+
+			if u := app.items.Get(msg.GetUID()); u != nil {
+				u.Update(msg)
+				u.SetSend(send)
+				app.items.Store(u)
+			} else if u = model.FromMsg(msg); u != nil {
+				u.SetLocal(true)
+				u.SetSend(send)
+				app.items.Store(u)
+			}
+		}
+
+		return ctx.JSON(fiber.Map{"status": "ok", "count": len(fc.Features)})
+	}
+}
+
 func getMessagesHandler(app *App) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		return ctx.JSON(app.chatMessages.Chats)
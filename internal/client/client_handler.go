@@ -25,6 +25,11 @@ const (
 	pingTimeout = time.Second * 15
 )
 
+var (
+	ErrClientOff = errors.New("client is off")
+	ErrQueueFull = errors.New("send queue is full")
+)
+
 type HandlerConfig struct {
 	Device       *model.Device
 	Serial       string
@@ -32,12 +37,21 @@ type HandlerConfig struct {
 	IsClient     bool
 	MessageCb    func(msg *cot.CotMessage)
 	RemoveCb     func(ch ClientHandler)
-	NewContactCb func(uid, callsign string)
+	NewContactCb func(ch ClientHandler, msg *cot.CotMessage)
 	Logger       *slog.Logger
 	DropMetric   *prometheus.CounterVec
+	QueueMetric  *prometheus.GaugeVec
+	QueueSize    int
+	Limiter      Limiter
 	UidChecker   func(uid string) bool
 }
 
+// Limiter checks rate of incoming messages.
+type Limiter interface {
+	// Take returns false if message must be dropped, error if connection must be closed.
+	Take(ctx context.Context) (bool, error)
+}
+
 type ClientHandler interface {
 	GetName() string
 	HasUID(uid string) bool
@@ -61,15 +75,17 @@ type ConnClientHandler struct {
 	uids         sync.Map
 	lastActivity atomic.Pointer[time.Time]
 	closeTimer   *time.Timer
-	sendChan     chan []byte
+	queue        *sendQueue
 	active       int32
-	device       *model.Device
+	device       atomic.Pointer[model.Device]
 	serial       string
 	messageCb    func(msg *cot.CotMessage)
 	removeCb     func(ch ClientHandler)
-	newContactCb func(uid, callsign string)
+	newContactCb func(ch ClientHandler, msg *cot.CotMessage)
 	logger       *slog.Logger
 	dropMetric   *prometheus.CounterVec
+	queueMetric  *prometheus.GaugeVec
+	limiter      Limiter
 	uidChecker   func(uid string) bool
 }
 
@@ -78,14 +94,13 @@ func NewConnClientHandler(name string, conn net.Conn, config *HandlerConfig) *Co
 		addr:         name,
 		conn:         conn,
 		ver:          0,
-		sendChan:     make(chan []byte, 50),
 		active:       1,
 		uids:         sync.Map{},
 		lastActivity: atomic.Pointer[time.Time]{},
 	}
 
 	if config != nil {
-		c.device = config.Device
+		c.device.Store(config.Device)
 		c.serial = config.Serial
 		c.localUID = config.UID
 		c.isClient = config.IsClient
@@ -93,6 +108,8 @@ func NewConnClientHandler(name string, conn net.Conn, config *HandlerConfig) *Co
 		c.removeCb = config.RemoveCb
 		c.newContactCb = config.NewContactCb
 		c.dropMetric = config.DropMetric
+		c.queueMetric = config.QueueMetric
+		c.limiter = config.Limiter
 		c.uidChecker = config.UidChecker
 
 		params := []any{"client", name}
@@ -112,6 +129,14 @@ func NewConnClientHandler(name string, conn net.Conn, config *HandlerConfig) *Co
 		}
 	}
 
+	size := 0
+	if config != nil {
+		size = config.QueueSize
+	}
+
+	c.queue = newSendQueue(size)
+	c.queue.onDrop = c.onDrop
+
 	c.setActivity()
 
 	return c
@@ -122,7 +147,12 @@ func (h *ConnClientHandler) GetName() string {
 }
 
 func (h *ConnClientHandler) GetDevice() *model.Device {
-	return h.device
+	return h.device.Load()
+}
+
+// SetDevice changes device of the live connection, i.e. when active groups are changed.
+func (h *ConnClientHandler) SetDevice(d *model.Device) {
+	h.device.Store(d)
 }
 
 func (h *ConnClientHandler) GetSerial() string {
@@ -249,8 +279,26 @@ func (h *ConnClientHandler) handleRead(ctx context.Context) {
 			continue
 		}
 
+		if h.limiter != nil {
+			ok, err := h.limiter.Take(ctx)
+			if err != nil {
+				h.logger.Warn("rate limit", slog.Any("error", err))
+
+				break
+			}
+
+			if !ok {
+				if h.dropMetric != nil {
+					h.dropMetric.With(prometheus.Labels{"scope": h.GetDevice().GetScope(), "reason": "rate_limit"}).Inc()
+				}
+
+				continue
+			}
+		}
+
 		msg.From = h.addr
 		msg.Scope = h.GetDevice().GetScope()
+		msg.Groups, msg.HasGroups = h.GetDevice().OutGroups(), h.GetDevice().HasGroups()
 
 		// add new contact uid
 		if msg.IsContact() {
@@ -263,7 +311,7 @@ func (h *ConnClientHandler) handleRead(ctx context.Context) {
 
 			if _, present := h.uids.Swap(uid, msg.GetCallsign()); !present {
 				if h.newContactCb != nil {
-					h.newContactCb(uid, msg.GetCallsign())
+					h.newContactCb(h, msg)
 				}
 			}
 		}
@@ -425,7 +473,14 @@ func (h *ConnClientHandler) handleWrite() {
 		}
 	}()
 
-	for msg := range h.sendChan {
+	for {
+		msg, ok := h.queue.Pop()
+		if !ok {
+			break
+		}
+
+		h.updateQueueMetric()
+
 		if _, err := h.conn.Write(msg); err != nil {
 			h.logger.Debug(fmt.Sprintf("client %s write error %v", h.addr, err))
 			h.Stop()
@@ -440,7 +495,11 @@ func (h *ConnClientHandler) Stop() {
 		h.logger.Info("stopping")
 		h.cancel()
 
-		close(h.sendChan)
+		h.queue.Close()
+
+		if h.queueMetric != nil {
+			h.queueMetric.DeletePartialMatch(prometheus.Labels{"client": h.addr})
+		}
 
 		if h.conn != nil {
 			_ = h.conn.Close()
@@ -494,15 +553,11 @@ func (h *ConnClientHandler) sendEvent(evt *cot.Event) error {
 
 	h.logger.Debug("sending " + string(msg))
 
-	if h.tryAddPacket(msg) {
-		return nil
-	}
-
-	return fmt.Errorf("client is off")
+	return h.tryAddPacket(msg, PriorityNormal, "")
 }
 
 func (h *ConnClientHandler) SendMsg(msg *cot.CotMessage) error {
-	if msg.IsLocal() || h.device.CanSeeScope(msg.Scope) {
+	if msg.IsLocal() || h.GetDevice().CanSeeMsg(msg) {
 		return h.SendCot(msg.GetTakMessage())
 	}
 
@@ -510,6 +565,8 @@ func (h *ConnClientHandler) SendMsg(msg *cot.CotMessage) error {
 }
 
 func (h *ConnClientHandler) SendCot(msg *cotproto.TakMessage) error {
+	prio, key := MsgPriority(msg)
+
 	switch h.GetVersion() {
 	case 0:
 		buf, err := xml.Marshal(cot.ProtoToEvent(msg))
@@ -517,34 +574,55 @@ func (h *ConnClientHandler) SendCot(msg *cotproto.TakMessage) error {
 			return err
 		}
 
-		if h.tryAddPacket(buf) {
-			return nil
-		}
+		return h.tryAddPacket(buf, prio, key)
 	case 1:
 		buf, err := cot.MakeProtoPacket(msg)
 		if err != nil {
 			return err
 		}
 
-		if h.tryAddPacket(buf) {
-			return nil
-		}
+		return h.tryAddPacket(buf, prio, key)
 	}
 
-	return fmt.Errorf("client is off")
+	return ErrClientOff
 }
 
-func (h *ConnClientHandler) tryAddPacket(msg []byte) bool {
+func (h *ConnClientHandler) tryAddPacket(msg []byte, prio Priority, key string) error {
 	if !h.IsActive() {
-		return false
+		return ErrClientOff
 	}
-	select {
-	case h.sendChan <- msg:
-	default:
-		if h.dropMetric != nil {
-			h.dropMetric.WithLabelValues("reason", "client_handler").Inc()
-		}
+
+	// position updates are coalesced only within one protocol version
+	if key != "" {
+		key = fmt.Sprintf("%d:%s", h.GetVersion(), key)
+	}
+
+	ok := h.queue.Push(msg, prio, key)
+	h.updateQueueMetric()
+
+	if !ok {
+		return ErrQueueFull
 	}
 
-	return true
+	return nil
+}
+
+func (h *ConnClientHandler) onDrop() {
+	if h.dropMetric != nil {
+		h.dropMetric.With(prometheus.Labels{"scope": h.GetDevice().GetScope(), "reason": "client_queue"}).Inc()
+	}
+}
+
+func (h *ConnClientHandler) updateQueueMetric() {
+	if h.queueMetric == nil {
+		return
+	}
+
+	st := h.queue.Stats()
+	h.queueMetric.With(prometheus.Labels{"client": h.addr, "state": "queued"}).Set(float64(st.Queued))
+	h.queueMetric.With(prometheus.Labels{"client": h.addr, "state": "dropped"}).Set(float64(st.Dropped))
+}
+
+func (h *ConnClientHandler) QueueStats() QueueStats {
+	return h.queue.Stats()
 }
@@ -19,7 +19,7 @@ import (
 func TestRoute(t *testing.T) {
 	h := NewConnClientHandler("test", nil, &HandlerConfig{UID: "111", IsClient: true})
 	h.ver = 1
-	h.device = &model.Device{Scope: "aaa", ReadScope: []string{"ccc", "ddd"}}
+	h.SetDevice(&model.Device{Scope: "aaa", ReadScope: []string{"ccc", "ddd"}})
 
 	var msg *cot.CotMessage
 
@@ -48,7 +48,7 @@ func TestRoute(t *testing.T) {
 func TestRouteChat(t *testing.T) {
 	h := NewConnClientHandler("test", nil, &HandlerConfig{UID: "111", IsClient: true})
 	h.ver = 1
-	h.device = &model.Device{Scope: "aaa"}
+	h.SetDevice(&model.Device{Scope: "aaa"})
 
 	var msg *cot.CotMessage
 
@@ -74,37 +74,63 @@ func TestRouteChat(t *testing.T) {
 	assert.Nil(t, c)
 }
 
+func TestRouteGroups(t *testing.T) {
+	h := NewConnClientHandler("test", nil, &HandlerConfig{UID: "111", IsClient: true})
+	h.ver = 1
+	h.SetDevice(&model.Device{Scope: "aaa", Groups: []*model.DeviceGroup{
+		{Name: "aaa", In: true, Out: true, Active: true},
+		{Name: "bbb", In: true, Active: false},
+		{Name: "ccc", Out: true, Active: true},
+	}})
+
+	for _, d := range []struct {
+		scope  string
+		groups []string
+		ok     bool
+	}{
+		{"aaa", nil, true},
+		{"bbb", nil, false},
+		{"ccc", nil, false},
+		{"zzz", []string{"zzz", "aaa"}, true},
+		{"aaa", []string{"bbb", "ccc"}, false},
+	} {
+		c, err := passMsg(h, &cot.CotMessage{TakMessage: cot.MakePing("123"), Scope: d.scope, Groups: d.groups})
+		require.NoError(t, err)
+		assert.Equal(t, d.ok, c != nil, "%s %v", d.scope, d.groups)
+	}
+}
+
 func passMsg(h *ConnClientHandler, msg *cot.CotMessage) (*cotproto.TakMessage, error) {
 	if err := h.SendMsg(msg); err != nil {
 		return nil, err
 	}
 
-	select {
-	case dat := <-h.sendChan:
-		bb := bytes.NewBuffer(dat)
-
-		_, err := bb.ReadByte()
-		if err != nil {
-			return nil, err
-		}
+	if h.queue.Stats().Queued == 0 {
+		return nil, nil
+	}
 
-		size, err := binary.ReadUvarint(bb)
-		if err != nil {
-			return nil, err
-		}
+	dat, _ := h.queue.Pop()
+	bb := bytes.NewBuffer(dat)
 
-		buf := make([]byte, size)
-		_, err = io.ReadFull(bb, buf)
+	_, err := bb.ReadByte()
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	size, err := binary.ReadUvarint(bb)
+	if err != nil {
+		return nil, err
+	}
 
-		msg := new(cotproto.TakMessage)
-		err = proto.Unmarshal(buf, msg)
+	buf := make([]byte, size)
+	_, err = io.ReadFull(bb, buf)
 
-		return msg, err
-	default:
-		return nil, nil
+	if err != nil {
+		return nil, err
 	}
+
+	msg1 := new(cotproto.TakMessage)
+	err = proto.Unmarshal(buf, msg1)
+
+	return msg1, err
 }
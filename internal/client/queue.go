@@ -0,0 +1,192 @@
+package client
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	priorities = 3
+
+	DefaultQueueSize = 50
+)
+
+type QueueStats struct {
+	Size      int    `json:"size"`
+	Queued    int    `json:"queued"`
+	Dropped   uint64 `json:"dropped"`
+	Coalesced uint64 `json:"coalesced"`
+}
+
+type packet struct {
+	data []byte
+	key  string
+}
+
+// sendQueue is a bounded outbound queue with priorities.
+// Packets with the same key are coalesced, so only the latest one is sent.
+// When the queue is full, the oldest packet with lower priority is dropped to make room.
+type sendQueue struct {
+	mx        sync.Mutex
+	cond      *sync.Cond
+	size      int
+	len       int
+	queues    [priorities][]*packet
+	keys      map[string]*packet
+	closed    bool
+	dropped   uint64
+	coalesced uint64
+	onDrop    func()
+}
+
+func newSendQueue(size int) *sendQueue {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+
+	q := &sendQueue{
+		size: size,
+		keys: make(map[string]*packet),
+	}
+
+	q.cond = sync.NewCond(&q.mx)
+
+	return q
+}
+
+// Push adds packet to the queue. Returns false if queue is closed or packet is dropped.
+func (q *sendQueue) Push(data []byte, prio Priority, key string) bool {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	if key != "" {
+		if p, ok := q.keys[key]; ok {
+			p.data = data
+			q.coalesced++
+
+			return true
+		}
+	}
+
+	if q.len >= q.size && !q.evict(prio) {
+		q.drop()
+
+		return false
+	}
+
+	p := &packet{data: data, key: key}
+	q.queues[prio] = append(q.queues[prio], p)
+	q.len++
+
+	if key != "" {
+		q.keys[key] = p
+	}
+
+	q.cond.Signal()
+
+	return true
+}
+
+// evict drops the oldest packet with priority lower than prio.
+func (q *sendQueue) evict(prio Priority) bool {
+	for i := PriorityLow; i < prio; i++ {
+		if len(q.queues[i]) > 0 {
+			q.remove(i)
+			q.drop()
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (q *sendQueue) drop() {
+	q.dropped++
+
+	if q.onDrop != nil {
+		q.onDrop()
+	}
+}
+
+func (q *sendQueue) remove(prio Priority) *packet {
+	p := q.queues[prio][0]
+	q.queues[prio][0] = nil
+	q.queues[prio] = q.queues[prio][1:]
+	q.len--
+
+	if p.key != "" {
+		delete(q.keys, p.key)
+	}
+
+	return p
+}
+
+// Pop waits for packet with the highest priority. Returns false when queue is closed.
+func (q *sendQueue) Pop() ([]byte, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	for q.len == 0 && !q.closed {
+		q.cond.Wait()
+	}
+
+	if q.closed {
+		return nil, false
+	}
+
+	for i := PriorityHigh; i >= PriorityLow; i-- {
+		if len(q.queues[i]) > 0 {
+			return q.remove(i).data, true
+		}
+	}
+
+	return nil, false
+}
+
+func (q *sendQueue) Close() {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *sendQueue) Stats() QueueStats {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	return QueueStats{
+		Size:      q.size,
+		Queued:    q.len,
+		Dropped:   q.dropped,
+		Coalesced: q.coalesced,
+	}
+}
+
+// MsgPriority returns send priority of message and coalescing key for position reports.
+func MsgPriority(msg *cotproto.TakMessage) (Priority, string) {
+	t := msg.GetCotEvent().GetType()
+
+	switch {
+	case strings.HasPrefix(t, "b-t-f"), strings.HasPrefix(t, "b-a-"), strings.HasPrefix(t, "b-f-t-"),
+		t == "t-x-d-d", strings.Contains(msg.GetCotEvent().GetDetail().GetXmlDetail(), "<emergency"):
+		return PriorityHigh, ""
+	case strings.HasPrefix(t, "a-"):
+		return PriorityLow, "pli:" + msg.GetCotEvent().GetUid()
+	default:
+		return PriorityNormal, ""
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+func TestQueuePriority(t *testing.T) {
+	q := newSendQueue(10)
+
+	require.True(t, q.Push([]byte("pli1"), PriorityLow, "u1"))
+	require.True(t, q.Push([]byte("point"), PriorityNormal, ""))
+	require.True(t, q.Push([]byte("chat"), PriorityHigh, ""))
+	require.True(t, q.Push([]byte("pli2"), PriorityLow, "u1"))
+
+	st := q.Stats()
+	require.Equal(t, 3, st.Queued)
+	require.Equal(t, uint64(1), st.Coalesced)
+
+	for _, s := range []string{"chat", "point", "pli2"} {
+		b, ok := q.Pop()
+		require.True(t, ok)
+		require.Equal(t, s, string(b))
+	}
+
+	// key is free after pop
+	require.True(t, q.Push([]byte("pli3"), PriorityLow, "u1"))
+	require.Equal(t, 1, q.Stats().Queued)
+}
+
+func TestQueueOverflow(t *testing.T) {
+	q := newSendQueue(2)
+
+	require.True(t, q.Push([]byte("pli1"), PriorityLow, "u1"))
+	require.True(t, q.Push([]byte("pli2"), PriorityLow, "u2"))
+	require.False(t, q.Push([]byte("pli3"), PriorityLow, "u3"))
+
+	// chat pushes out the oldest pli
+	require.True(t, q.Push([]byte("chat"), PriorityHigh, ""))
+	require.True(t, q.Push([]byte("delete"), PriorityHigh, ""))
+	require.False(t, q.Push([]byte("chat2"), PriorityHigh, ""))
+
+	st := q.Stats()
+	require.Equal(t, 2, st.Queued)
+	require.Equal(t, uint64(4), st.Dropped)
+
+	b, _ := q.Pop()
+	require.Equal(t, "chat", string(b))
+	b, _ = q.Pop()
+	require.Equal(t, "delete", string(b))
+}
+
+func TestQueueClose(t *testing.T) {
+	q := newSendQueue(2)
+
+	done := make(chan bool)
+
+	go func() {
+		_, ok := q.Pop()
+		done <- ok
+	}()
+
+	time.Sleep(time.Millisecond * 10)
+	q.Close()
+
+	require.False(t, <-done)
+	require.False(t, q.Push([]byte("a"), PriorityHigh, ""))
+}
+
+func TestMsgPriority(t *testing.T) {
+	p, key := MsgPriority(cot.BasicMsg("a-f-G-U-C", "uid1", time.Minute))
+	require.Equal(t, PriorityLow, p)
+	require.Equal(t, "pli:uid1", key)
+
+	p, key = MsgPriority(cot.BasicMsg("b-t-f", "chat1", time.Minute))
+	require.Equal(t, PriorityHigh, p)
+	require.Empty(t, key)
+
+	p, _ = MsgPriority(cot.MakeOfflineMsg("uid1", ""))
+	require.Equal(t, PriorityHigh, p)
+
+	p, _ = MsgPriority(cot.BasicMsg("b-m-p-s-p-i", "p1", time.Minute))
+	require.Equal(t, PriorityNormal, p)
+}
@@ -6,14 +6,23 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
 
+	"github.com/kdudkov/goatak/internal/federation"
+	"github.com/kdudkov/goatak/internal/filter"
 	"github.com/kdudkov/goatak/internal/layers"
+	"github.com/kdudkov/goatak/internal/mesh"
+	"github.com/kdudkov/goatak/internal/oidc"
+	"github.com/kdudkov/goatak/internal/ratelimit"
+	"github.com/kdudkov/goatak/internal/webhook"
+	"github.com/kdudkov/goatak/pkg/model"
 	"github.com/kdudkov/goatak/pkg/tlsutil"
 )
 
@@ -94,6 +103,15 @@ func (c *AppConfig) DataDir() string {
 	return c.k.String("data_dir")
 }
 
+// AuditHeadFile returns file to store the last audit event hash, it is kept out of the database.
+func (c *AppConfig) AuditHeadFile() string {
+	if f := c.k.String("audit_head_file"); f != "" {
+		return f
+	}
+
+	return filepath.Join(c.DataDir(), "audit_head")
+}
+
 func (c *AppConfig) UsersFile() string {
 	return c.k.String("users_file")
 }
@@ -122,6 +140,11 @@ func (c *AppConfig) EnrollSSL() bool {
 	return c.k.Bool("ssl.enroll")
 }
 
+// EnrollHost returns server host name for enrollment invitations.
+func (c *AppConfig) EnrollHost() string {
+	return c.k.String("ssl.enroll_host")
+}
+
 func (c *AppConfig) CertTTLDays() int {
 	return c.k.Int("ssl.cert_ttl_days")
 }
@@ -151,6 +174,243 @@ func (c *AppConfig) Layers() ([]*layers.LayerDescription, error) {
 	return res, nil
 }
 
+func (c *AppConfig) Federates() ([]*federation.PeerConfig, error) {
+	res := make([]*federation.PeerConfig, 0)
+
+	if !c.k.Exists("federation.peers") {
+		return res, nil
+	}
+
+	if err := c.k.Unmarshal("federation.peers", &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *AppConfig) Filters() ([]*filter.RuleConfig, error) {
+	res := make([]*filter.RuleConfig, 0)
+
+	if !c.k.Exists("filters") {
+		return res, nil
+	}
+
+	if err := c.k.Unmarshal("filters", &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *AppConfig) Webhooks() ([]*webhook.Config, error) {
+	res := make([]*webhook.Config, 0)
+
+	if !c.k.Exists("webhooks") {
+		return res, nil
+	}
+
+	if err := c.k.Unmarshal("webhooks", &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *AppConfig) Meshes() ([]*mesh.Config, error) {
+	res := make([]*mesh.Config, 0)
+
+	if !c.k.Exists("mesh") {
+		return res, nil
+	}
+
+	if err := c.k.Unmarshal("mesh", &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *AppConfig) RateLimits() (*ratelimit.Config, error) {
+	if !c.k.Exists("rate_limit") {
+		return nil, nil
+	}
+
+	res := new(ratelimit.Config)
+
+	if err := c.k.Unmarshal("rate_limit", res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+type LdapGroup struct {
+	// group dn or cn
+	Group     string   `yaml:"group" json:"group" koanf:"group"`
+	Scope     string   `yaml:"scope" json:"scope,omitempty" koanf:"scope"`
+	ReadScope []string `yaml:"read_scope" json:"read_scope,omitempty" koanf:"read_scope"`
+	// admin role for group members, empty - group doesn't make admins
+	Role string `yaml:"role" json:"role,omitempty" koanf:"role"`
+}
+
+type LdapConfig struct {
+	// ldap://host:389 or ldaps://host:636
+	URL          string `yaml:"url" json:"url" koanf:"url"`
+	StartTLS     bool   `yaml:"start_tls" json:"start_tls" koanf:"start_tls"`
+	Insecure     bool   `yaml:"insecure" json:"insecure" koanf:"insecure"`
+	BindDN       string `yaml:"bind_dn" json:"bind_dn" koanf:"bind_dn"`
+	BindPassword string `yaml:"bind_password" json:"-" koanf:"bind_password"`
+	BaseDN       string `yaml:"base_dn" json:"base_dn" koanf:"base_dn"`
+	// %s is replaced with login, (sAMAccountName=%s) for Active Directory
+	UserFilter string `yaml:"user_filter" json:"user_filter" koanf:"user_filter"`
+	GroupAttr  string `yaml:"group_attr" json:"group_attr" koanf:"group_attr"`
+	// first group with scope sets the device scope, read scopes of all groups are merged
+	Groups       []*LdapGroup `yaml:"groups" json:"groups" koanf:"groups"`
+	AdminGroups  []string     `yaml:"admin_groups" json:"admin_groups" koanf:"admin_groups"`
+	DefaultScope string       `yaml:"default_scope" json:"default_scope" koanf:"default_scope"`
+	// role of admin_groups members, scope_admin if empty
+	AdminRole string `yaml:"admin_role" json:"admin_role" koanf:"admin_role"`
+	// users not found in ldap and all users when ldap is unavailable are checked against local db
+	Fallback bool `yaml:"fallback" json:"fallback" koanf:"fallback"`
+	// seconds
+	CacheTTL int `yaml:"cache_ttl" json:"cache_ttl" koanf:"cache_ttl"`
+	Timeout  int `yaml:"timeout" json:"timeout" koanf:"timeout"`
+}
+
+func (c *LdapConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("empty ldap url")
+	}
+
+	if c.BaseDN == "" {
+		return fmt.Errorf("empty ldap base_dn")
+	}
+
+	if c.UserFilter == "" {
+		c.UserFilter = "(uid=%s)"
+	}
+
+	if !strings.Contains(c.UserFilter, "%s") {
+		return fmt.Errorf("ldap user_filter must contain %%s")
+	}
+
+	if c.GroupAttr == "" {
+		c.GroupAttr = "memberOf"
+	}
+
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = 60
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = 5
+	}
+
+	if c.AdminRole == "" {
+		c.AdminRole = model.RoleScopeAdmin
+	}
+
+	if !model.IsValidRole(c.AdminRole) {
+		return fmt.Errorf("invalid ldap admin_role %s", c.AdminRole)
+	}
+
+	for _, g := range c.Groups {
+		if !model.IsValidRole(g.Role) {
+			return fmt.Errorf("ldap group %s: invalid role %s", g.Group, g.Role)
+		}
+	}
+
+	return nil
+}
+
+// Ldap returns ldap config or nil if ldap is not used.
+func (c *AppConfig) Ldap() (*LdapConfig, error) {
+	if c.k.String("ldap.url") == "" {
+		return nil, nil
+	}
+
+	res := new(LdapConfig)
+
+	if err := c.k.Unmarshal("ldap", res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Oidc returns admin sso config or nil if sso is not used.
+func (c *AppConfig) Oidc() (*oidc.Config, error) {
+	if c.k.String("oidc.issuer") == "" {
+		return nil, nil
+	}
+
+	res := new(oidc.Config)
+
+	if err := c.k.Unmarshal("oidc", res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *AppConfig) SnapshotEnabled() bool {
+	return c.k.Bool("snapshot.enabled")
+}
+
+// SnapshotDistance returns max distance from client in meters, 0 - no limit.
+func (c *AppConfig) SnapshotDistance() float64 {
+	return c.k.Float64("snapshot.distance") * 1000
+}
+
+func (c *AppConfig) SnapshotRate() int {
+	return c.k.Int("snapshot.rate")
+}
+
+// EmergencyScopes returns scopes that get alerts from all scopes.
+func (c *AppConfig) EmergencyScopes() []string {
+	return c.k.Strings("emergency.scopes")
+}
+
+func (c *AppConfig) FederationLoopWindow() time.Duration {
+	return time.Second * time.Duration(c.k.Int("federation.loop_window"))
+}
+
+func (c *AppConfig) PersistItems() bool {
+	return c.k.Bool("items.persist")
+}
+
+func (c *AppConfig) ItemsTrackPoints() int {
+	return c.k.Int("items.track_points")
+}
+
+func (c *AppConfig) ItemsFlushInterval() time.Duration {
+	return time.Second * time.Duration(c.k.Int("items.flush_interval"))
+}
+
+func (c *AppConfig) TracksEnabled() bool {
+	return c.k.Bool("tracks.enabled")
+}
+
+func (c *AppConfig) TracksFlushInterval() time.Duration {
+	return time.Second * time.Duration(c.k.Int("tracks.flush_interval"))
+}
+
+// TracksRetention returns how long positions are kept, 0 - forever.
+func (c *AppConfig) TracksRetention() time.Duration {
+	return time.Hour * 24 * time.Duration(c.k.Int("tracks.retention"))
+}
+
+// TracksScopeRetention returns retention overrides for scopes.
+func (c *AppConfig) TracksScopeRetention() map[string]time.Duration {
+	res := make(map[string]time.Duration)
+
+	for _, scope := range c.k.MapKeys("tracks.scope_retention") {
+		res[scope] = time.Hour * 24 * time.Duration(c.k.Int("tracks.scope_retention."+scope))
+	}
+
+	return res
+}
+
 func (c *AppConfig) ProcessCerts() error {
 	for _, name := range []string{"ssl.ca", "ssl.cert", "ssl.key"} {
 		if c.k.String(name) == "" {
@@ -222,4 +482,19 @@ func setDefaults(k *koanf.Koanf) {
 
 	k.Set("me.zoom", 10)
 	k.Set("ssl.cert_ttl_days", 365)
+
+	k.Set("federation.loop_window", 60)
+
+	k.Set("queue_size", 50)
+
+	k.Set("snapshot.rate", 50)
+
+	k.Set("pipeline.workers", 0)
+	k.Set("pipeline.queue_size", 128)
+
+	k.Set("items.track_points", 100)
+	k.Set("items.flush_interval", 5)
+
+	k.Set("tracks.flush_interval", 5)
+	k.Set("tracks.retention", 30)
 }
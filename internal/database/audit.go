@@ -0,0 +1,330 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	auditBatch     = 1000
+	auditQueueSize = 1000
+	auditWriteMax  = 100
+)
+
+// auditWriter stores events in background, so slow database doesn't block connections and logins.
+type auditWriter struct {
+	ch      chan *model.AuditEvent
+	flushCh chan chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	running atomic.Bool
+}
+
+// StartAudit starts background writer of audit events.
+// Hash of the last event is stored to headFile, if set, to find deleted events at the end of the chain.
+func (mm *DatabaseManager) StartAudit(headFile string) error {
+	mm.auditHead = headFile
+
+	if headFile != "" {
+		if err := os.MkdirAll(filepath.Dir(headFile), 0o755); err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(headFile); errors.Is(err, os.ErrNotExist) {
+			// first start or old database - the head is the last event
+			var last model.AuditEvent
+
+			if err := mm.db.Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+				return err
+			}
+
+			if err := mm.saveAuditHead(&last); err != nil {
+				return err
+			}
+		}
+	}
+
+	mm.audit = &auditWriter{
+		ch:      make(chan *model.AuditEvent, auditQueueSize),
+		flushCh: make(chan chan struct{}),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+
+	mm.audit.running.Store(true)
+
+	go mm.auditWriter(mm.audit)
+
+	return nil
+}
+
+// StopAudit stores queued events and stops the writer. Events after stop are stored synchronously.
+func (mm *DatabaseManager) StopAudit() {
+	if mm.audit == nil || !mm.audit.running.CompareAndSwap(true, false) {
+		return
+	}
+
+	close(mm.audit.stopCh)
+	<-mm.audit.doneCh
+}
+
+// FlushAudit waits until queued events are stored.
+func (mm *DatabaseManager) FlushAudit() {
+	if mm.audit == nil || !mm.audit.running.Load() {
+		return
+	}
+
+	done := make(chan struct{})
+
+	select {
+	case mm.audit.flushCh <- done:
+		<-done
+	case <-mm.audit.doneCh:
+	}
+}
+
+func (mm *DatabaseManager) auditWriter(w *auditWriter) {
+	defer close(w.doneCh)
+
+	for {
+		select {
+		case e := <-w.ch:
+			mm.writeAudit(w, e)
+		case done := <-w.flushCh:
+			mm.writeAudit(w, nil)
+			close(done)
+		case <-w.stopCh:
+			mm.writeAudit(w, nil)
+
+			return
+		}
+	}
+}
+
+// writeAudit stores the event and all queued events.
+func (mm *DatabaseManager) writeAudit(w *auditWriter, e *model.AuditEvent) {
+	events := make([]*model.AuditEvent, 0, auditWriteMax)
+
+	if e != nil {
+		events = append(events, e)
+	}
+
+	for {
+		if len(events) == auditWriteMax {
+			mm.saveAuditEvents(events)
+			events = events[:0]
+		}
+
+		select {
+		case e1 := <-w.ch:
+			events = append(events, e1)
+		default:
+			if len(events) > 0 {
+				mm.saveAuditEvents(events)
+			}
+
+			return
+		}
+	}
+}
+
+func (mm *DatabaseManager) saveAuditEvents(events []*model.AuditEvent) {
+	if err := mm.AddAuditEvents(events...); err != nil {
+		mm.logger.Error("audit event save error", slog.Int("events", len(events)), slog.Any("error", err))
+	}
+}
+
+// AddAuditEvents links events to the last one and stores them.
+func (mm *DatabaseManager) AddAuditEvents(events ...*model.AuditEvent) error {
+	if mm == nil || mm.db == nil || len(events) == 0 {
+		return nil
+	}
+
+	mm.auditMx.Lock()
+	defer mm.auditMx.Unlock()
+
+	err := mm.db.Transaction(func(tx *gorm.DB) error {
+		var last model.AuditEvent
+
+		err := tx.Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+
+		prev := last.Hash
+
+		for _, e := range events {
+			if e.CreatedAt.IsZero() {
+				e.CreatedAt = time.Now()
+			}
+
+			e.CreatedAt = e.CreatedAt.Truncate(time.Second)
+			e.PrevHash = prev
+			e.Hash = e.MakeHash()
+
+			if err := tx.Create(e).Error; err != nil {
+				return err
+			}
+
+			prev = e.Hash
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return mm.saveAuditHead(events[len(events)-1])
+}
+
+// AddAuditEvent links event to the last one and stores it.
+func (mm *DatabaseManager) AddAuditEvent(e *model.AuditEvent) error {
+	return mm.AddAuditEvents(e)
+}
+
+// Audit stores the event, before and after are stored as json.
+// Event is queued when writer is started, it is dropped if the queue is full.
+func (mm *DatabaseManager) Audit(actor, action, object, ip string, before, after any) {
+	e := &model.AuditEvent{
+		CreatedAt: time.Now(),
+		Actor:     actor,
+		Action:    action,
+		Object:    object,
+		Before:    toJSON(before),
+		After:     toJSON(after),
+		IP:        ip,
+	}
+
+	if w := mm.audit; w != nil && w.running.Load() {
+		select {
+		case w.ch <- e:
+		default:
+			mm.logger.Error("audit queue is full, event is dropped", slog.String("action", action), slog.String("actor", actor))
+		}
+
+		return
+	}
+
+	if err := mm.AddAuditEvent(e); err != nil {
+		mm.logger.Error("audit event save error", slog.String("action", action), slog.Any("error", err))
+	}
+}
+
+// saveAuditHead stores id and hash of the last event to the head file.
+func (mm *DatabaseManager) saveAuditHead(e *model.AuditEvent) error {
+	if mm.auditHead == "" {
+		return nil
+	}
+
+	tmp := mm.auditHead + ".tmp"
+
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %s\n", e.ID, e.Hash)), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, mm.auditHead)
+}
+
+// loadAuditHead returns id and hash of the last event from the head file.
+func (mm *DatabaseManager) loadAuditHead() (uint, string, error) {
+	b, err := os.ReadFile(mm.auditHead)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var id uint
+	var hash string
+
+	if _, err := fmt.Sscanf(string(b), "%d %s", &id, &hash); err != nil && id != 0 {
+		return 0, "", fmt.Errorf("bad audit head file: %w", err)
+	}
+
+	return id, hash, nil
+}
+
+// VerifyAudit checks the hash chain and the stored head of it.
+// Returns number of checked events and error for the first bad one.
+func (mm *DatabaseManager) VerifyAudit() (int, error) {
+	if mm == nil || mm.db == nil {
+		return 0, nil
+	}
+
+	var headID uint
+	var headHash string
+
+	if mm.auditHead != "" {
+		var err error
+
+		if headID, headHash, err = mm.loadAuditHead(); err != nil {
+			return 0, err
+		}
+	}
+
+	var events []*model.AuditEvent
+
+	prev := ""
+	n := 0
+	headFound := headID == 0
+
+	var res error
+
+	err := mm.db.Order("id").FindInBatches(&events, auditBatch, func(tx *gorm.DB, batch int) error {
+		for _, e := range events {
+			if e.PrevHash != prev {
+				res = fmt.Errorf("audit event %d: previous event is changed or deleted", e.ID)
+			} else if e.MakeHash() != e.Hash {
+				res = fmt.Errorf("audit event %d is changed", e.ID)
+			} else if e.ID == headID {
+				if e.Hash != headHash {
+					res = fmt.Errorf("audit event %d is not the stored head", e.ID)
+				}
+
+				headFound = true
+			}
+
+			if res != nil {
+				return res
+			}
+
+			prev = e.Hash
+			n++
+		}
+
+		return nil
+	}).Error
+
+	if res != nil {
+		return n, res
+	}
+
+	if err == nil && !headFound {
+		return n, fmt.Errorf("audit event %d and the next ones are deleted", headID)
+	}
+
+	return n, err
+}
+
+func toJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
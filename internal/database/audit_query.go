@@ -0,0 +1,118 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type AuditQuery struct {
+	Query[model.AuditEvent]
+	actor  string
+	action string
+	object string
+	ip     string
+	after  time.Time
+	before time.Time
+}
+
+func NewAuditQuery(db *gorm.DB) *AuditQuery {
+	return &AuditQuery{
+		Query: Query[model.AuditEvent]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "id DESC",
+		},
+	}
+}
+
+func (q *AuditQuery) Order(s string) *AuditQuery {
+	q.order = s
+	return q
+}
+
+func (q *AuditQuery) Limit(n int) *AuditQuery {
+	q.limit = n
+	return q
+}
+
+func (q *AuditQuery) Offset(n int) *AuditQuery {
+	q.offset = n
+	return q
+}
+
+func (q *AuditQuery) Actor(actor string) *AuditQuery {
+	q.actor = actor
+	return q
+}
+
+// Action filters by action, "device." selects all device actions.
+func (q *AuditQuery) Action(action string) *AuditQuery {
+	q.action = action
+	return q
+}
+
+func (q *AuditQuery) Object(object string) *AuditQuery {
+	q.object = object
+	return q
+}
+
+func (q *AuditQuery) IP(ip string) *AuditQuery {
+	q.ip = ip
+	return q
+}
+
+func (q *AuditQuery) After(t time.Time) *AuditQuery {
+	q.after = t
+	return q
+}
+
+func (q *AuditQuery) Before(t time.Time) *AuditQuery {
+	q.before = t
+	return q
+}
+
+func (q *AuditQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.actor != "" {
+		tx = tx.Where("actor = ?", q.actor)
+	}
+
+	if q.action != "" {
+		if q.action[len(q.action)-1] == '.' {
+			tx = tx.Where("action LIKE ?", q.action+"%")
+		} else {
+			tx = tx.Where("action = ?", q.action)
+		}
+	}
+
+	if q.object != "" {
+		tx = tx.Where("object = ?", q.object)
+	}
+
+	if q.ip != "" {
+		tx = tx.Where("ip = ?", q.ip)
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("created_at > ?", q.after)
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("created_at < ?", q.before)
+	}
+
+	return tx
+}
+
+func (q *AuditQuery) Get() []*model.AuditEvent {
+	return q.get(q.where().Model(&model.AuditEvent{}))
+}
+
+func (q *AuditQuery) Count() int64 {
+	return q.count(q.where().Model(&model.AuditEvent{}))
+}
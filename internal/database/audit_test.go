@@ -0,0 +1,94 @@
+package database
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestAuditChain(t *testing.T) {
+	db := getTestDatabase()
+	require.NoError(t, db.AutoMigrate(&model.AuditEvent{}))
+
+	mm := New(db)
+
+	mm.Audit("admin", model.AUDIT_DEVICE_CREATE, "user1", "127.0.0.1", nil, map[string]any{"scope": "blue"})
+	mm.Audit("admin", model.AUDIT_DEVICE_UPDATE, "user1", "127.0.0.1", map[string]any{"scope": "blue"}, map[string]any{"scope": "red"})
+	mm.Audit("admin", model.AUDIT_FILE_DELETE, "1", "127.0.0.1", nil, nil)
+
+	n, err := mm.VerifyAudit()
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Len(t, mm.AuditQuery().Action("device.").Get(), 2)
+	assert.Len(t, mm.AuditQuery().Object("1").Get(), 1)
+
+	ev := mm.AuditQuery().Order("id").Get()
+	require.Len(t, ev, 3)
+	assert.Empty(t, ev[0].PrevHash)
+	assert.Equal(t, ev[0].Hash, ev[1].PrevHash)
+	assert.JSONEq(t, `{"scope":"red"}`, string(ev[1].DTO().After))
+
+	// changed record
+	require.NoError(t, db.Model(&model.AuditEvent{}).Where("id = ?", ev[1].ID).Update("after", `{"scope":"green"}`).Error)
+
+	n, err = mm.VerifyAudit()
+	require.Error(t, err)
+	assert.Equal(t, 1, n)
+
+	require.NoError(t, db.Model(&model.AuditEvent{}).Where("id = ?", ev[1].ID).Update("after", ev[1].After).Error)
+	_, err = mm.VerifyAudit()
+	require.NoError(t, err)
+
+	// deleted record
+	require.NoError(t, db.Delete(&model.AuditEvent{}, ev[1].ID).Error)
+
+	_, err = mm.VerifyAudit()
+	require.Error(t, err)
+}
+
+func TestAuditQueue(t *testing.T) {
+	db := getTestDatabase()
+	require.NoError(t, db.AutoMigrate(&model.AuditEvent{}))
+
+	mm := New(db)
+
+	// event stored before the head file is used
+	mm.Audit("admin", model.AUDIT_LOGIN, "admin", "127.0.0.1", nil, nil)
+
+	head := filepath.Join(t.TempDir(), "audit_head")
+	require.NoError(t, mm.StartAudit(head))
+
+	for i := 0; i < 250; i++ {
+		mm.Audit("admin", model.AUDIT_FILE_DELETE, strconv.Itoa(i), "127.0.0.1", nil, nil)
+	}
+
+	mm.FlushAudit()
+
+	n, err := mm.VerifyAudit()
+	require.NoError(t, err)
+	assert.Equal(t, 251, n)
+
+	mm.StopAudit()
+
+	// stopped writer stores events synchronously
+	mm.Audit("admin", model.AUDIT_FILE_DELETE, "last", "127.0.0.1", nil, nil)
+	assert.EqualValues(t, 1, mm.AuditQuery().Object("last").Count())
+
+	n, err = mm.VerifyAudit()
+	require.NoError(t, err)
+	assert.Equal(t, 252, n)
+
+	// deleted tail keeps the chain, but not the head
+	last := mm.AuditQuery().Order("id DESC").Limit(1).Get()
+	require.Len(t, last, 1)
+	require.NoError(t, db.Delete(&model.AuditEvent{}, last[0].ID).Error)
+
+	_, err = mm.VerifyAudit()
+	require.Error(t, err)
+}
@@ -14,6 +14,8 @@ type CertQuery struct {
 	uid   string
 	login string
 	sn    string
+	// nil - all, true - only revoked, false - only not revoked
+	revoked *bool
 }
 
 func NewCertQuery(db *gorm.DB) *CertQuery {
@@ -58,6 +60,11 @@ func (q *CertQuery) SN(sn string) *CertQuery {
 	return q
 }
 
+func (q *CertQuery) Revoked(revoked bool) *CertQuery {
+	q.revoked = &revoked
+	return q
+}
+
 func (q *CertQuery) where() *gorm.DB {
 	tx := q.db
 
@@ -73,6 +80,14 @@ func (q *CertQuery) where() *gorm.DB {
 		tx = tx.Where("serial = ?", q.sn)
 	}
 
+	if q.revoked != nil {
+		if *q.revoked {
+			tx = tx.Where("revoked_at IS NOT NULL")
+		} else {
+			tx = tx.Where("revoked_at IS NULL")
+		}
+	}
+
 	return tx
 }
 
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type ChatQuery struct {
+	Query[model.ChatRecord]
+	uid       string
+	chatroom  string
+	fromUID   string
+	toUID     string
+	anyUID    string
+	scope     string
+	readScope []string
+	direct    *bool
+	after     time.Time
+	before    time.Time
+}
+
+func NewChatQuery(db *gorm.DB) *ChatQuery {
+	return &ChatQuery{
+		Query: Query[model.ChatRecord]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+	}
+}
+
+func (q *ChatQuery) Order(s string) *ChatQuery {
+	q.order = s
+	return q
+}
+
+func (q *ChatQuery) Limit(n int) *ChatQuery {
+	q.limit = n
+	return q
+}
+
+func (q *ChatQuery) Offset(n int) *ChatQuery {
+	q.offset = n
+	return q
+}
+
+func (q *ChatQuery) UID(uid string) *ChatQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *ChatQuery) Chatroom(chatroom string) *ChatQuery {
+	q.chatroom = chatroom
+	return q
+}
+
+func (q *ChatQuery) From(uid string) *ChatQuery {
+	q.fromUID = uid
+	return q
+}
+
+func (q *ChatQuery) To(uid string) *ChatQuery {
+	q.toUID = uid
+	return q
+}
+
+// Participant filters messages sent from or to uid.
+func (q *ChatQuery) Participant(uid string) *ChatQuery {
+	q.anyUID = uid
+	return q
+}
+
+func (q *ChatQuery) Scope(scope string) *ChatQuery {
+	q.scope = scope
+	return q
+}
+
+// ReadScope limits result to scopes, nil means all scopes.
+func (q *ChatQuery) ReadScope(scope []string) *ChatQuery {
+	q.readScope = scope
+	return q
+}
+
+func (q *ChatQuery) Direct(b bool) *ChatQuery {
+	q.direct = &b
+	return q
+}
+
+func (q *ChatQuery) After(t time.Time) *ChatQuery {
+	q.after = t
+	return q
+}
+
+func (q *ChatQuery) Before(t time.Time) *ChatQuery {
+	q.before = t
+	return q
+}
+
+func (q *ChatQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if q.chatroom != "" {
+		tx = tx.Where("chatroom = ?", q.chatroom)
+	}
+
+	if q.fromUID != "" {
+		tx = tx.Where("from_uid = ?", q.fromUID)
+	}
+
+	if q.toUID != "" {
+		tx = tx.Where("to_uid = ?", q.toUID)
+	}
+
+	if q.anyUID != "" {
+		tx = tx.Where("from_uid = ? OR to_uid = ?", q.anyUID, q.anyUID)
+	}
+
+	if q.scope != "" {
+		tx = tx.Where("scope = ?", q.scope)
+	}
+
+	if q.readScope != nil {
+		tx = tx.Where("scope in (?)", q.readScope)
+	}
+
+	if q.direct != nil {
+		tx = tx.Where("direct = ?", *q.direct)
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("created_at > ?", q.after)
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("created_at < ?", q.before)
+	}
+
+	return tx
+}
+
+func (q *ChatQuery) Get() []*model.ChatRecord {
+	return q.get(q.where().Model(&model.ChatRecord{}))
+}
+
+func (q *ChatQuery) One() *model.ChatRecord {
+	return q.one(q.where().Model(&model.ChatRecord{}))
+}
+
+func (q *ChatQuery) Count() int64 {
+	return q.count(q.where().Model(&model.ChatRecord{}))
+}
+
+func (q *ChatQuery) Delete() error {
+	return q.where().Delete(&model.ChatRecord{}).Error
+}
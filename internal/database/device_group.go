@@ -0,0 +1,104 @@
+package database
+
+import (
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// SetDeviceGroups replaces device groups. Active flag of existing groups is kept.
+func (mm *DatabaseManager) SetDeviceGroups(login string, groups []*model.DeviceGroup) error {
+	return mm.db.Transaction(func(tx *gorm.DB) error {
+		var old []*model.DeviceGroup
+
+		if err := tx.Where("login = ?", login).Find(&old).Error; err != nil {
+			return err
+		}
+
+		active := make(map[string]bool, len(old))
+		for _, g := range old {
+			active[g.Name] = g.Active
+		}
+
+		if err := tx.Where("login = ?", login).Delete(&model.DeviceGroup{}).Error; err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool, len(groups))
+
+		for _, g := range groups {
+			if g.Name == "" || seen[g.Name] {
+				continue
+			}
+
+			seen[g.Name] = true
+
+			ng := &model.DeviceGroup{Login: login, Name: g.Name, In: g.In, Out: g.Out, Active: g.Active}
+
+			if a, ok := active[g.Name]; ok {
+				ng.Active = a
+			}
+
+			if err := tx.Create(ng).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// SetGroupsActive switches groups on and off for the device.
+func (mm *DatabaseManager) SetGroupsActive(login string, active map[string]bool) error {
+	return mm.db.Transaction(func(tx *gorm.DB) error {
+		for name, a := range active {
+			res := tx.Model(&model.DeviceGroup{}).Where("login = ? AND name = ?", login, name).Update("active", a)
+
+			if res.Error != nil {
+				return res.Error
+			}
+
+			if res.RowsAffected == 0 {
+				return fmt.Errorf("no group %s", name)
+			}
+		}
+
+		return nil
+	})
+}
+
+// GroupNames returns all known group names.
+func (mm *DatabaseManager) GroupNames() []string {
+	var res []string
+
+	if err := mm.db.Model(&model.DeviceGroup{}).Distinct("name").Order("name").Pluck("name", &res).Error; err != nil {
+		mm.logger.Error("groups get error", slog.Any("error", err))
+	}
+
+	return res
+}
+
+// MigrateScopes makes groups from scope and read scopes for devices without groups.
+func (mm *DatabaseManager) MigrateScopes() error {
+	var devices []*model.Device
+
+	err := mm.db.Where("NOT EXISTS (SELECT 1 FROM device_groups g WHERE g.login = devices.login)").Find(&devices).Error
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		if err := mm.SetDeviceGroups(d.Login, model.ScopeGroups(d.Login, d.Scope, d.ReadScope)); err != nil {
+			return err
+		}
+	}
+
+	if len(devices) > 0 {
+		mm.logger.Info(fmt.Sprintf("groups are made from scopes for %d devices", len(devices)))
+	}
+
+	return nil
+}
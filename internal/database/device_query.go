@@ -8,9 +8,11 @@ import (
 
 type DeviceQuery struct {
 	Query[model.Device]
-	login string
-	scope string
-	full  bool
+	login      string
+	scope      string
+	ssoIssuer  string
+	ssoSubject string
+	full       bool
 }
 
 func NewDeviceQuery(db *gorm.DB) *DeviceQuery {
@@ -50,6 +52,12 @@ func (q *DeviceQuery) Scope(scope string) *DeviceQuery {
 	return q
 }
 
+// Sso selects device provisioned for sso user.
+func (q *DeviceQuery) Sso(issuer, subject string) *DeviceQuery {
+	q.ssoIssuer, q.ssoSubject = issuer, subject
+	return q
+}
+
 func (q *DeviceQuery) Full() *DeviceQuery {
 	q.full = true
 	return q
@@ -66,6 +74,14 @@ func (q *DeviceQuery) where() *gorm.DB {
 		tx = tx.Where("scope = ?", q.scope)
 	}
 
+	if q.ssoSubject != "" {
+		tx = tx.Where("sso_issuer = ? AND sso_subject = ?", q.ssoIssuer, q.ssoSubject)
+	}
+
+	tx = tx.Preload("Groups", func(db *gorm.DB) *gorm.DB {
+		return db.Order("device_groups.name")
+	})
+
 	if q.full {
 		tx = tx.Preload("Certs", func(db *gorm.DB) *gorm.DB {
 			return db.Order("certificates.last_connect desc")
@@ -97,6 +113,18 @@ func (q *DeviceQuery) Delete(login string) error {
 			return err
 		}
 
+		if err := tx.Where("login = ?", login).Delete(&model.DeviceGroup{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("login = ?", login).Delete(&model.ApiToken{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("login = ?", login).Delete(&model.Enrollment{}).Error; err != nil {
+			return err
+		}
+
 		return tx.Where("login = ?", login).Delete(&model.Certificate{}).Error
 	})
 }
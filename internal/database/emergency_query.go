@@ -0,0 +1,193 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type EmergencyQuery struct {
+	Query[model.Emergency]
+	uid        string
+	contactUID string
+	scope      string
+	readScope  []string
+	status     string
+	active     bool
+}
+
+func NewEmergencyQuery(db *gorm.DB) *EmergencyQuery {
+	return &EmergencyQuery{
+		Query: Query[model.Emergency]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+	}
+}
+
+func (q *EmergencyQuery) Order(s string) *EmergencyQuery {
+	q.order = s
+	return q
+}
+
+func (q *EmergencyQuery) Limit(n int) *EmergencyQuery {
+	q.limit = n
+	return q
+}
+
+func (q *EmergencyQuery) Offset(n int) *EmergencyQuery {
+	q.offset = n
+	return q
+}
+
+func (q *EmergencyQuery) UID(uid string) *EmergencyQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *EmergencyQuery) Contact(uid string) *EmergencyQuery {
+	q.contactUID = uid
+	return q
+}
+
+func (q *EmergencyQuery) Scope(scope string) *EmergencyQuery {
+	q.scope = scope
+	return q
+}
+
+// ReadScope limits result to scopes, nil means all scopes.
+func (q *EmergencyQuery) ReadScope(scope []string) *EmergencyQuery {
+	q.readScope = scope
+	return q
+}
+
+func (q *EmergencyQuery) Status(status string) *EmergencyQuery {
+	q.status = status
+	return q
+}
+
+// Active selects not cancelled emergencies.
+func (q *EmergencyQuery) Active(active bool) *EmergencyQuery {
+	q.active = active
+	return q
+}
+
+func (q *EmergencyQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if q.contactUID != "" {
+		tx = tx.Where("contact_uid = ?", q.contactUID)
+	}
+
+	if q.scope != "" {
+		tx = tx.Where("scope = ?", q.scope)
+	}
+
+	if q.readScope != nil {
+		tx = tx.Where("scope in (?)", q.readScope)
+	}
+
+	if q.status != "" {
+		tx = tx.Where("status = ?", q.status)
+	}
+
+	if q.active {
+		tx = tx.Where("status <> ?", model.EMERGENCY_CANCELLED)
+	}
+
+	return tx
+}
+
+func (q *EmergencyQuery) Get() []*model.Emergency {
+	return q.get(q.where().Model(&model.Emergency{}))
+}
+
+func (q *EmergencyQuery) One() *model.Emergency {
+	return q.one(q.where().Model(&model.Emergency{}))
+}
+
+func (q *EmergencyQuery) Count() int64 {
+	return q.count(q.where().Model(&model.Emergency{}))
+}
+
+type EmergencyLogQuery struct {
+	Query[model.EmergencyLog]
+	emergencyUID string
+	after        time.Time
+	before       time.Time
+}
+
+func NewEmergencyLogQuery(db *gorm.DB) *EmergencyLogQuery {
+	return &EmergencyLogQuery{
+		Query: Query[model.EmergencyLog]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+	}
+}
+
+func (q *EmergencyLogQuery) Order(s string) *EmergencyLogQuery {
+	q.order = s
+	return q
+}
+
+func (q *EmergencyLogQuery) Limit(n int) *EmergencyLogQuery {
+	q.limit = n
+	return q
+}
+
+func (q *EmergencyLogQuery) Offset(n int) *EmergencyLogQuery {
+	q.offset = n
+	return q
+}
+
+func (q *EmergencyLogQuery) Emergency(uid string) *EmergencyLogQuery {
+	q.emergencyUID = uid
+	return q
+}
+
+func (q *EmergencyLogQuery) After(t time.Time) *EmergencyLogQuery {
+	q.after = t
+	return q
+}
+
+func (q *EmergencyLogQuery) Before(t time.Time) *EmergencyLogQuery {
+	q.before = t
+	return q
+}
+
+func (q *EmergencyLogQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.emergencyUID != "" {
+		tx = tx.Where("emergency_uid = ?", q.emergencyUID)
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("created_at > ?", q.after)
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("created_at < ?", q.before)
+	}
+
+	return tx
+}
+
+func (q *EmergencyLogQuery) Get() []*model.EmergencyLog {
+	return q.get(q.where().Model(&model.EmergencyLog{}))
+}
+
+func (q *EmergencyLogQuery) Count() int64 {
+	return q.count(q.where().Model(&model.EmergencyLog{}))
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+var (
+	ErrEnrollmentUsed = errors.New("enrollment invitation is expired or used")
+	ErrDeviceDisabled = errors.New("device is disabled")
+)
+
+// UseEnrollment counts use of the invitation. Device with groups from the scope and profile are created
+// if there are no such yet, existing device is returned as is.
+func (mm *DatabaseManager) UseEnrollment(e *model.Enrollment) (*model.Device, bool, error) {
+	var created bool
+
+	d := new(model.Device)
+
+	err := mm.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		res := tx.Model(&model.Enrollment{}).
+			Where("id = ? AND uses < max_uses AND expires_at > ?", e.ID, now).
+			Updates(map[string]any{"uses": gorm.Expr("uses + 1"), "last_used": now})
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrEnrollmentUsed
+		}
+
+		if err := tx.Where("login = ?", e.Login).Limit(1).Find(d).Error; err != nil {
+			return err
+		}
+
+		if d.Login != "" {
+			if d.Disabled {
+				return ErrDeviceDisabled
+			}
+
+			return nil
+		}
+
+		created = true
+		d = &model.Device{Login: e.Login, Scope: e.Scope}
+
+		if err := tx.Create(d).Error; err != nil {
+			return err
+		}
+
+		for _, g := range model.ScopeGroups(d.Login, d.Scope, d.ReadScope) {
+			if err := tx.Create(g).Error; err != nil {
+				return err
+			}
+		}
+
+		if e.Profile == nil {
+			return nil
+		}
+
+		p := &model.Profile{
+			Login:    e.Login,
+			UID:      "*",
+			Callsign: e.Profile.Callsign,
+			Team:     e.Profile.Team,
+			Role:     e.Profile.Role,
+			CotType:  e.Profile.CotType,
+			Options:  e.Profile.Options,
+		}
+
+		return tx.Where("login = ? AND uid = ?", p.Login, p.UID).FirstOrCreate(p).Error
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return d, created, nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type EnrollmentQuery struct {
+	Query[model.Enrollment]
+	id     uint
+	login  string
+	hash   string
+	scopes []string
+}
+
+func NewEnrollmentQuery(db *gorm.DB) *EnrollmentQuery {
+	return &EnrollmentQuery{
+		Query: Query[model.Enrollment]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+	}
+}
+
+func (q *EnrollmentQuery) Order(s string) *EnrollmentQuery {
+	q.order = s
+	return q
+}
+
+func (q *EnrollmentQuery) Limit(n int) *EnrollmentQuery {
+	q.limit = n
+	return q
+}
+
+func (q *EnrollmentQuery) Offset(n int) *EnrollmentQuery {
+	q.offset = n
+	return q
+}
+
+func (q *EnrollmentQuery) Id(id uint) *EnrollmentQuery {
+	q.id = id
+	return q
+}
+
+func (q *EnrollmentQuery) Login(login string) *EnrollmentQuery {
+	q.login = login
+	return q
+}
+
+// Token selects invitation by the token string.
+func (q *EnrollmentQuery) Token(token string) *EnrollmentQuery {
+	q.hash = model.TokenHash(token)
+	return q
+}
+
+// Scopes selects invitations for the scopes, nil means all scopes.
+func (q *EnrollmentQuery) Scopes(scopes []string) *EnrollmentQuery {
+	q.scopes = scopes
+	return q
+}
+
+func (q *EnrollmentQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != 0 {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if q.login != "" {
+		tx = tx.Where("login = ?", q.login)
+	}
+
+	if q.hash != "" {
+		tx = tx.Where("hash = ?", q.hash)
+	}
+
+	if q.scopes != nil {
+		tx = tx.Where("scope IN ?", q.scopes)
+	}
+
+	return tx
+}
+
+func (q *EnrollmentQuery) Get() []*model.Enrollment {
+	return q.get(q.where().Model(&model.Enrollment{}))
+}
+
+func (q *EnrollmentQuery) One() *model.Enrollment {
+	return q.one(q.where().Model(&model.Enrollment{}))
+}
+
+func (q *EnrollmentQuery) Count() int64 {
+	return q.count(q.where().Model(&model.Enrollment{}))
+}
+
+func (q *EnrollmentQuery) Delete() error {
+	return q.where().Delete(&model.Enrollment{}).Error
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type GeofenceQuery struct {
+	Query[model.Geofence]
+	uid      string
+	scope    string
+	shapeUID string
+}
+
+func NewGeofenceQuery(db *gorm.DB) *GeofenceQuery {
+	return &GeofenceQuery{
+		Query: Query[model.Geofence]{
+			db:     db,
+			limit:  0,
+			offset: 0,
+			order:  "name",
+		},
+	}
+}
+
+func (q *GeofenceQuery) Order(s string) *GeofenceQuery {
+	q.order = s
+	return q
+}
+
+func (q *GeofenceQuery) Limit(n int) *GeofenceQuery {
+	q.limit = n
+	return q
+}
+
+func (q *GeofenceQuery) Offset(n int) *GeofenceQuery {
+	q.offset = n
+	return q
+}
+
+func (q *GeofenceQuery) UID(uid string) *GeofenceQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *GeofenceQuery) Scope(scope string) *GeofenceQuery {
+	q.scope = scope
+	return q
+}
+
+func (q *GeofenceQuery) ShapeUID(uid string) *GeofenceQuery {
+	q.shapeUID = uid
+	return q
+}
+
+func (q *GeofenceQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if q.scope != "" {
+		tx = tx.Where("scope = ?", q.scope)
+	}
+
+	if q.shapeUID != "" {
+		tx = tx.Where("shape_uid = ?", q.shapeUID)
+	}
+
+	return tx
+}
+
+func (q *GeofenceQuery) Get() []*model.Geofence {
+	return q.get(q.where().Model(&model.Geofence{}))
+}
+
+func (q *GeofenceQuery) One() *model.Geofence {
+	return q.one(q.where().Model(&model.Geofence{}))
+}
+
+func (q *GeofenceQuery) Count() int64 {
+	return q.count(q.where().Model(&model.Geofence{}))
+}
+
+func (q *GeofenceQuery) Delete() error {
+	return q.where().Delete(&model.Geofence{}).Error
+}
+
+type GeofenceEventQuery struct {
+	Query[model.GeofenceEvent]
+	fenceUID string
+	uid      string
+	after    time.Time
+	before   time.Time
+}
+
+func NewGeofenceEventQuery(db *gorm.DB) *GeofenceEventQuery {
+	return &GeofenceEventQuery{
+		Query: Query[model.GeofenceEvent]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+	}
+}
+
+func (q *GeofenceEventQuery) Order(s string) *GeofenceEventQuery {
+	q.order = s
+	return q
+}
+
+func (q *GeofenceEventQuery) Limit(n int) *GeofenceEventQuery {
+	q.limit = n
+	return q
+}
+
+func (q *GeofenceEventQuery) Offset(n int) *GeofenceEventQuery {
+	q.offset = n
+	return q
+}
+
+func (q *GeofenceEventQuery) Fence(uid string) *GeofenceEventQuery {
+	q.fenceUID = uid
+	return q
+}
+
+func (q *GeofenceEventQuery) UID(uid string) *GeofenceEventQuery {
+	q.uid = uid
+	return q
+}
+
+func (q *GeofenceEventQuery) After(t time.Time) *GeofenceEventQuery {
+	q.after = t
+	return q
+}
+
+func (q *GeofenceEventQuery) Before(t time.Time) *GeofenceEventQuery {
+	q.before = t
+	return q
+}
+
+func (q *GeofenceEventQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.fenceUID != "" {
+		tx = tx.Where("fence_uid = ?", q.fenceUID)
+	}
+
+	if q.uid != "" {
+		tx = tx.Where("uid = ?", q.uid)
+	}
+
+	if !q.after.IsZero() {
+		tx = tx.Where("created_at > ?", q.after)
+	}
+
+	if !q.before.IsZero() {
+		tx = tx.Where("created_at < ?", q.before)
+	}
+
+	return tx
+}
+
+func (q *GeofenceEventQuery) Get() []*model.GeofenceEvent {
+	return q.get(q.where().Model(&model.GeofenceEvent{}))
+}
+
+func (q *GeofenceEventQuery) Count() int64 {
+	return q.count(q.where().Model(&model.GeofenceEvent{}))
+}
+
+func (q *GeofenceEventQuery) Delete() error {
+	return q.where().Delete(&model.GeofenceEvent{}).Error
+}
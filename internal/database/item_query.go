@@ -0,0 +1,89 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type ItemQuery struct {
+	Query[model.ItemRecord]
+	uids  []string
+	scope string
+	class string
+}
+
+func NewItemQuery(db *gorm.DB) *ItemQuery {
+	return &ItemQuery{
+		Query: Query[model.ItemRecord]{
+			db:     db,
+			limit:  0,
+			offset: 0,
+			order:  "uid",
+		},
+	}
+}
+
+func (q *ItemQuery) Order(s string) *ItemQuery {
+	q.order = s
+	return q
+}
+
+func (q *ItemQuery) Limit(n int) *ItemQuery {
+	q.limit = n
+	return q
+}
+
+func (q *ItemQuery) Offset(n int) *ItemQuery {
+	q.offset = n
+	return q
+}
+
+func (q *ItemQuery) UID(uid ...string) *ItemQuery {
+	q.uids = append(q.uids, uid...)
+	return q
+}
+
+func (q *ItemQuery) Scope(scope string) *ItemQuery {
+	q.scope = scope
+	return q
+}
+
+func (q *ItemQuery) Class(class string) *ItemQuery {
+	q.class = class
+	return q
+}
+
+func (q *ItemQuery) where() *gorm.DB {
+	tx := q.db
+
+	if len(q.uids) > 0 {
+		tx = tx.Where("uid IN ?", q.uids)
+	}
+
+	if q.scope != "" {
+		tx = tx.Where("scope = ?", q.scope)
+	}
+
+	if q.class != "" {
+		tx = tx.Where("class = ?", q.class)
+	}
+
+	return tx
+}
+
+func (q *ItemQuery) Get() []*model.ItemRecord {
+	return q.get(q.where().Model(&model.ItemRecord{}))
+}
+
+func (q *ItemQuery) One() *model.ItemRecord {
+	return q.one(q.where().Model(&model.ItemRecord{}))
+}
+
+func (q *ItemQuery) Count() int64 {
+	return q.count(q.where().Model(&model.ItemRecord{}))
+}
+
+func (q *ItemQuery) Delete() error {
+	return q.where().Delete(&model.ItemRecord{}).Error
+}
@@ -4,6 +4,7 @@ import (
 	"cmp"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,8 +16,11 @@ import (
 )
 
 type DatabaseManager struct {
-	db     *gorm.DB
-	logger *slog.Logger
+	db        *gorm.DB
+	logger    *slog.Logger
+	auditMx   sync.Mutex
+	audit     *auditWriter
+	auditHead string
 }
 
 func New(db *gorm.DB) *DatabaseManager {
@@ -133,6 +137,46 @@ func (mm *DatabaseManager) FeedQuery() *FeedQuery {
 	return NewFeedQuery(mm.db)
 }
 
+func (mm *DatabaseManager) ItemQuery() *ItemQuery {
+	return NewItemQuery(mm.db)
+}
+
+func (mm *DatabaseManager) ChatQuery() *ChatQuery {
+	return NewChatQuery(mm.db)
+}
+
+func (mm *DatabaseManager) GeofenceQuery() *GeofenceQuery {
+	return NewGeofenceQuery(mm.db)
+}
+
+func (mm *DatabaseManager) GeofenceEventQuery() *GeofenceEventQuery {
+	return NewGeofenceEventQuery(mm.db)
+}
+
+func (mm *DatabaseManager) EmergencyQuery() *EmergencyQuery {
+	return NewEmergencyQuery(mm.db)
+}
+
+func (mm *DatabaseManager) EmergencyLogQuery() *EmergencyLogQuery {
+	return NewEmergencyLogQuery(mm.db)
+}
+
+func (mm *DatabaseManager) AuditQuery() *AuditQuery {
+	return NewAuditQuery(mm.db)
+}
+
+func (mm *DatabaseManager) ApiTokenQuery() *ApiTokenQuery {
+	return NewApiTokenQuery(mm.db)
+}
+
+func (mm *DatabaseManager) EnrollmentQuery() *EnrollmentQuery {
+	return NewEnrollmentQuery(mm.db)
+}
+
+func (mm *DatabaseManager) PositionQuery() *PositionQuery {
+	return NewPositionQuery(mm.db)
+}
+
 func (mm *DatabaseManager) Migrate() error {
 	if mm == nil || mm.db == nil {
 		return fmt.Errorf("no database")
@@ -150,11 +194,24 @@ func (mm *DatabaseManager) Migrate() error {
 		&model.Certificate{},
 		&model.Profile{},
 		&model.Feed2{},
+		&model.ItemRecord{},
+		&model.ChatRecord{},
+		&model.Geofence{},
+		&model.GeofenceEvent{},
+		&model.Emergency{},
+		&model.EmergencyLog{},
+		&model.DeviceGroup{},
+		&model.AuditEvent{},
+		&model.ApiToken{},
+		&model.Enrollment{},
+		&model.PositionRecord{},
+		&model.FilterRecord{},
+		&model.Setting{},
 	); err != nil {
 		return err
 	}
 
-	return nil
+	return mm.MigrateScopes()
 }
 
 func (mm *DatabaseManager) UpdateMissionChanged(id uint) error {
@@ -342,3 +399,83 @@ func (mm *DatabaseManager) GetChanges(missionId uint, after time.Time, squashed
 
 	return ch1
 }
+
+// SaveChat stores chat message, message with already stored uid is skipped.
+func (mm *DatabaseManager) SaveChat(rec *model.ChatRecord) error {
+	if mm == nil || mm.db == nil {
+		return nil
+	}
+
+	return mm.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "uid"}}, DoNothing: true}).Create(rec).Error
+}
+
+// SaveItems stores and removes items in one transaction.
+func (mm *DatabaseManager) SaveItems(items []*model.ItemRecord, removed []string) error {
+	if mm == nil || mm.db == nil {
+		return nil
+	}
+
+	return mm.db.Transaction(func(tx *gorm.DB) error {
+		if len(removed) > 0 {
+			if err := NewItemQuery(tx).UID(removed...).Delete(); err != nil {
+				return err
+			}
+		}
+
+		if len(items) > 0 {
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(items, 100).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// SavePositions appends position records to the track history.
+func (mm *DatabaseManager) SavePositions(positions []*model.PositionRecord) error {
+	if mm == nil || mm.db == nil || len(positions) == 0 {
+		return nil
+	}
+
+	return mm.db.CreateInBatches(positions, 100).Error
+}
+
+// filterRulesSetting marks that filter rules are saved, so empty rules set is not replaced with config rules.
+const filterRulesSetting = "filter_rules"
+
+// FilterRules returns stored filter rules in order, false if rules were never saved.
+func (mm *DatabaseManager) FilterRules() ([]*model.FilterRecord, bool, error) {
+	var n int64
+
+	if err := mm.db.Model(&model.Setting{}).Where("name = ?", filterRulesSetting).Count(&n).Error; err != nil {
+		return nil, false, err
+	}
+
+	var res []*model.FilterRecord
+
+	if err := mm.db.Order("position").Find(&res).Error; err != nil {
+		return nil, false, err
+	}
+
+	return res, n > 0, nil
+}
+
+// SaveFilterRules replaces all stored filter rules, empty set is stored too.
+func (mm *DatabaseManager) SaveFilterRules(rules []*model.FilterRecord) error {
+	return mm.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&model.FilterRecord{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Save(&model.Setting{Name: filterRulesSetting, Value: time.Now().UTC().Format(time.RFC3339)}).Error; err != nil {
+			return err
+		}
+
+		if len(rules) == 0 {
+			return nil
+		}
+
+		return tx.Create(rules).Error
+	})
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type PositionQuery struct {
+	Query[model.PositionRecord]
+	uids      []string
+	callsign  string
+	scopes    []string
+	notScopes []string
+	from      time.Time
+	to        time.Time
+	bbox      []float64
+}
+
+func NewPositionQuery(db *gorm.DB) *PositionQuery {
+	return &PositionQuery{
+		Query: Query[model.PositionRecord]{
+			db:     db,
+			limit:  0,
+			offset: 0,
+			order:  "uid, time",
+		},
+	}
+}
+
+func (q *PositionQuery) Order(s string) *PositionQuery {
+	q.order = s
+	return q
+}
+
+func (q *PositionQuery) Limit(n int) *PositionQuery {
+	q.limit = n
+	return q
+}
+
+func (q *PositionQuery) Offset(n int) *PositionQuery {
+	q.offset = n
+	return q
+}
+
+func (q *PositionQuery) UID(uid ...string) *PositionQuery {
+	q.uids = append(q.uids, uid...)
+	return q
+}
+
+func (q *PositionQuery) Callsign(callsign string) *PositionQuery {
+	q.callsign = callsign
+	return q
+}
+
+// Scope filters by scopes, nil means all scopes.
+func (q *PositionQuery) Scope(scopes ...string) *PositionQuery {
+	q.scopes = scopes
+	return q
+}
+
+func (q *PositionQuery) NotScope(scopes ...string) *PositionQuery {
+	q.notScopes = scopes
+	return q
+}
+
+// From filters positions with time >= t.
+func (q *PositionQuery) From(t time.Time) *PositionQuery {
+	q.from = t
+	return q
+}
+
+// To filters positions with time <= t.
+func (q *PositionQuery) To(t time.Time) *PositionQuery {
+	q.to = t
+	return q
+}
+
+func (q *PositionQuery) BBox(minLat, minLon, maxLat, maxLon float64) *PositionQuery {
+	q.bbox = []float64{minLat, minLon, maxLat, maxLon}
+	return q
+}
+
+func (q *PositionQuery) where() *gorm.DB {
+	tx := q.db
+
+	if len(q.uids) > 0 {
+		tx = tx.Where("uid IN ?", q.uids)
+	}
+
+	if q.callsign != "" {
+		tx = tx.Where("callsign = ?", q.callsign)
+	}
+
+	if q.scopes != nil {
+		tx = tx.Where("scope IN ?", q.scopes)
+	}
+
+	if len(q.notScopes) > 0 {
+		tx = tx.Where("scope NOT IN ?", q.notScopes)
+	}
+
+	if !q.from.IsZero() {
+		tx = tx.Where("time >= ?", q.from)
+	}
+
+	if !q.to.IsZero() {
+		tx = tx.Where("time <= ?", q.to)
+	}
+
+	if len(q.bbox) == 4 {
+		tx = tx.Where("lat BETWEEN ? AND ? AND lon BETWEEN ? AND ?", q.bbox[0], q.bbox[2], q.bbox[1], q.bbox[3])
+	}
+
+	return tx
+}
+
+func (q *PositionQuery) Get() []*model.PositionRecord {
+	return q.get(q.where().Model(&model.PositionRecord{}))
+}
+
+func (q *PositionQuery) One() *model.PositionRecord {
+	return q.one(q.where().Model(&model.PositionRecord{}))
+}
+
+func (q *PositionQuery) Count() int64 {
+	return q.count(q.where().Model(&model.PositionRecord{}))
+}
+
+// UIDs returns distinct uids of found positions.
+func (q *PositionQuery) UIDs() []string {
+	var res []string
+
+	if err := q.where().Model(&model.PositionRecord{}).Distinct().Pluck("uid", &res).Error; err != nil {
+		slog.Error("db get uids error", slog.Any("error", err))
+	}
+
+	return res
+}
+
+func (q *PositionQuery) Delete() (int64, error) {
+	res := q.where().Delete(&model.PositionRecord{})
+
+	return res.RowsAffected, res.Error
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"testing"
+	"time"
 
 	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/require"
@@ -17,7 +18,7 @@ func getTestDatabase() *gorm.DB {
 		panic("failed to connect database")
 	}
 
-	db.AutoMigrate(&model.Device{}, &model.Certificate{})
+	db.AutoMigrate(&model.Device{}, &model.Certificate{}, &model.ChatRecord{})
 
 	return db
 }
@@ -39,3 +40,36 @@ func TestDeviceQuery_Count(t *testing.T) {
 	require.True(t, len(res[0].Certs) > 0)
 	require.True(t, len(res[1].Certs) > 0)
 }
+
+func TestChatQuery(t *testing.T) {
+	db := getTestDatabase()
+	dbm := New(db)
+
+	t0 := time.Now().Add(-time.Hour)
+
+	for _, r := range []*model.ChatRecord{
+		{UID: "m1", CreatedAt: t0, Scope: "blue", Chatroom: "All Chat Rooms", FromUID: "u1", ToUID: "All Chat Rooms"},
+		{UID: "m2", CreatedAt: t0.Add(time.Minute), Scope: "blue", Chatroom: "u2", FromUID: "u1", ToUID: "u2", Direct: true},
+		{UID: "m3", CreatedAt: t0.Add(time.Minute * 2), Scope: "blue", Chatroom: "u1", FromUID: "u2", ToUID: "u1", Direct: true},
+		{UID: "m4", CreatedAt: t0.Add(time.Minute * 3), Scope: "red", Chatroom: "u3", FromUID: "u4", ToUID: "u3", Direct: true},
+	} {
+		require.NoError(t, dbm.SaveChat(r))
+	}
+
+	// duplicate is skipped
+	require.NoError(t, dbm.SaveChat(&model.ChatRecord{UID: "m1", Text: "again"}))
+	require.Equal(t, int64(4), dbm.ChatQuery().Count())
+	require.Equal(t, "", dbm.ChatQuery().UID("m1").One().Text)
+
+	require.Equal(t, int64(1), dbm.ChatQuery().To("u2").Count())
+	require.Equal(t, int64(3), dbm.ChatQuery().Direct(true).Count())
+	require.Equal(t, int64(1), dbm.ChatQuery().Direct(false).Count())
+	require.Equal(t, int64(2), dbm.ChatQuery().After(t0.Add(time.Minute)).Count())
+	require.Equal(t, int64(1), dbm.ChatQuery().Before(t0.Add(time.Minute)).Count())
+	require.Equal(t, int64(2), dbm.ChatQuery().Participant("u2").Count())
+	require.Equal(t, int64(2), dbm.ChatQuery().Direct(true).ReadScope([]string{"blue"}).Count())
+
+	res := dbm.ChatQuery().Scope("blue").Get()
+	require.Len(t, res, 3)
+	require.Equal(t, "m3", res[0].UID)
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type ApiTokenQuery struct {
+	Query[model.ApiToken]
+	id    uint
+	login string
+	hash  string
+}
+
+func NewApiTokenQuery(db *gorm.DB) *ApiTokenQuery {
+	return &ApiTokenQuery{
+		Query: Query[model.ApiToken]{
+			db:     db,
+			limit:  100,
+			offset: 0,
+			order:  "created_at DESC",
+		},
+	}
+}
+
+func (q *ApiTokenQuery) Order(s string) *ApiTokenQuery {
+	q.order = s
+	return q
+}
+
+func (q *ApiTokenQuery) Limit(n int) *ApiTokenQuery {
+	q.limit = n
+	return q
+}
+
+func (q *ApiTokenQuery) Offset(n int) *ApiTokenQuery {
+	q.offset = n
+	return q
+}
+
+func (q *ApiTokenQuery) Id(id uint) *ApiTokenQuery {
+	q.id = id
+	return q
+}
+
+func (q *ApiTokenQuery) Login(login string) *ApiTokenQuery {
+	q.login = login
+	return q
+}
+
+// Token selects token by the token string.
+func (q *ApiTokenQuery) Token(token string) *ApiTokenQuery {
+	q.hash = model.TokenHash(token)
+	return q
+}
+
+func (q *ApiTokenQuery) where() *gorm.DB {
+	tx := q.db
+
+	if q.id != 0 {
+		tx = tx.Where("id = ?", q.id)
+	}
+
+	if q.login != "" {
+		tx = tx.Where("login = ?", q.login)
+	}
+
+	if q.hash != "" {
+		tx = tx.Where("hash = ?", q.hash)
+	}
+
+	return tx
+}
+
+func (q *ApiTokenQuery) Get() []*model.ApiToken {
+	return q.get(q.where().Model(&model.ApiToken{}))
+}
+
+func (q *ApiTokenQuery) One() *model.ApiToken {
+	return q.one(q.where().Model(&model.ApiToken{}))
+}
+
+func (q *ApiTokenQuery) Count() int64 {
+	return q.count(q.where().Model(&model.ApiToken{}))
+}
+
+func (q *ApiTokenQuery) Update(updates map[string]any) error {
+	return q.updateOrError(q.where().Model(&model.ApiToken{}), updates)
+}
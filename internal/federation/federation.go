@@ -0,0 +1,187 @@
+package federation
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/internal/client"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+const (
+	groupTag    = "__federation"
+	flowTag     = "_flow-tags_"
+	flowTagName = "goatak-"
+)
+
+type Federation struct {
+	logger *slog.Logger
+	uid    string
+	peers  []*Peer
+	loop   *LoopFilter
+}
+
+func New(serverUID string, window time.Duration, peers []*PeerConfig) *Federation {
+	f := &Federation{
+		logger: slog.With("logger", "federation"),
+		uid:    serverUID,
+		loop:   NewLoopFilter(window),
+	}
+
+	for _, p := range peers {
+		if p == nil || p.Name == "" {
+			continue
+		}
+
+		f.peers = append(f.peers, NewPeer(p))
+	}
+
+	return f
+}
+
+func (f *Federation) Peers() []*Peer {
+	if f == nil {
+		return nil
+	}
+
+	return f.peers
+}
+
+func (f *Federation) PeerByCN(cn string) *Peer {
+	if f == nil || cn == "" {
+		return nil
+	}
+
+	for _, p := range f.peers {
+		if p.CN() == cn {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Inbound checks message got from federate peer and maps remote group to local scope.
+// Returns false if message must be dropped.
+func (f *Federation) Inbound(p *Peer, msg *cot.CotMessage) bool {
+	if msg == nil {
+		return false
+	}
+
+	if hasFlowTag(msg.GetDetail(), f.flowTagName()) || f.loop.Seen(MessageKey(msg)) {
+		p.looped.Add(1)
+
+		return false
+	}
+
+	group := msg.GetDetail().GetFirst(groupTag).GetAttr("group")
+	scope, ok := p.ScopeForGroup(group)
+
+	if !ok {
+		f.logger.Debug(fmt.Sprintf("drop msg %s from %s: unknown group %s", msg.GetUID(), p.Name(), group))
+		p.filtered.Add(1)
+
+		return false
+	}
+
+	msg.Detail.RemoveTags(groupTag)
+	msg.TakMessage = msg.GetUpdatedTakMessage()
+	msg.Scope = scope
+
+	p.received.Add(1)
+
+	return true
+}
+
+// Outbound makes a copy of message for federate peer with group and flow tags added.
+// Returns nil if message must not be sent to this peer.
+func (f *Federation) Outbound(p *Peer, msg *cot.CotMessage) *cotproto.TakMessage {
+	if msg == nil || msg.IsLocal() || msg.IsPing() || msg.IsControl() {
+		return nil
+	}
+
+	group, ok := p.groupForMsg(msg)
+	if !ok {
+		p.filtered.Add(1)
+
+		return nil
+	}
+
+	f.loop.Seen(MessageKey(msg))
+
+	detail, err := cot.DetailsFromString(msg.GetTakMessage().GetCotEvent().GetDetail().GetXmlDetail())
+	if err != nil {
+		f.logger.Warn("bad detail", slog.Any("error", err))
+
+		return nil
+	}
+
+	detail.RemoveTags(groupTag)
+	detail.AddChild(groupTag, map[string]string{"group": group}, "")
+	detail.AddOrChangeChild(flowTag, map[string]string{f.flowTagName(): time.Now().UTC().Format(time.RFC3339)})
+
+	m := proto.Clone(msg.GetTakMessage()).(*cotproto.TakMessage)
+
+	if m.GetCotEvent().GetDetail() == nil {
+		m.CotEvent.Detail = &cotproto.Detail{}
+	}
+
+	m.CotEvent.Detail.XmlDetail = detail.AsXMLString()
+
+	return m
+}
+
+func (f *Federation) flowTagName() string {
+	return flowTagName + f.uid
+}
+
+func hasFlowTag(n *cot.Node, name string) bool {
+	return n.GetFirst(flowTag).GetAttr(name) != ""
+}
+
+// Handler is a client handler for federate connection, it rewrites scopes on the way in and out.
+type Handler struct {
+	*client.ConnClientHandler
+	fed  *Federation
+	peer *Peer
+}
+
+func (f *Federation) NewHandler(p *Peer, name string, conn net.Conn, config *client.HandlerConfig) *Handler {
+	cb := config.MessageCb
+
+	config.MessageCb = func(msg *cot.CotMessage) {
+		if f.Inbound(p, msg) && cb != nil {
+			cb(msg)
+		}
+	}
+
+	return &Handler{
+		ConnClientHandler: client.NewConnClientHandler(name, conn, config),
+		fed:               f,
+		peer:              p,
+	}
+}
+
+func (h *Handler) Peer() *Peer {
+	return h.peer
+}
+
+func (h *Handler) SendMsg(msg *cot.CotMessage) error {
+	m := h.fed.Outbound(h.peer, msg)
+	if m == nil {
+		return nil
+	}
+
+	if err := h.SendCot(m); err != nil {
+		return err
+	}
+
+	h.peer.sent.Add(1)
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package federation
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+func testMsg(t *testing.T, scope string) *cot.CotMessage {
+	msg := cot.BasicMsg("a-f-G", "uid1", time.Minute)
+	msg.CotEvent.Lat = 10
+	msg.CotEvent.Lon = 20
+
+	c, err := cot.CotFromProto(msg, "tcp:1", scope)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestLoopFilter(t *testing.T) {
+	l := NewLoopFilter(time.Millisecond * 50)
+
+	require.False(t, l.Seen("a"))
+	require.True(t, l.Seen("a"))
+	require.False(t, l.Seen("b"))
+
+	time.Sleep(time.Millisecond * 60)
+
+	require.False(t, l.Seen("a"))
+	require.Equal(t, 1, l.Size())
+}
+
+func TestOutboundInbound(t *testing.T) {
+	peers := []*PeerConfig{{Name: "remote", Scopes: map[string]string{"blue": "shared"}}}
+
+	local := New("local-uid", time.Minute, peers)
+	remote := New("remote-uid", time.Minute, peers)
+
+	p := local.Peers()[0]
+
+	require.Nil(t, local.Outbound(p, testMsg(t, "red")))
+	require.Equal(t, int64(1), p.DTO().Filtered)
+
+	out := local.Outbound(p, testMsg(t, "blue"))
+	require.NotNil(t, out)
+
+	in, err := cot.CotFromProto(out, "fed:local", "")
+	require.NoError(t, err)
+	require.Equal(t, "shared", in.GetDetail().GetFirst(groupTag).GetAttr("group"))
+
+	rp := remote.Peers()[0]
+	require.True(t, remote.Inbound(rp, in))
+	require.Equal(t, "blue", in.Scope)
+	require.False(t, in.GetDetail().Has(groupTag))
+
+	// the same event returns to the origin server
+	back := remote.Outbound(rp, in)
+	require.NotNil(t, back)
+
+	in2, err := cot.CotFromProto(back, "fed:remote", "")
+	require.NoError(t, err)
+	require.False(t, local.Inbound(p, in2))
+	require.Equal(t, int64(1), p.DTO().Looped)
+}
+
+func TestOutboundGroups(t *testing.T) {
+	f := New("local-uid", time.Minute, []*PeerConfig{{Name: "remote", Scopes: map[string]string{"blue": "shared"}}})
+	p := f.Peers()[0]
+
+	msg := testMsg(t, "blue")
+	msg.Groups, msg.HasGroups = []string{"red"}, true
+	require.Nil(t, f.Outbound(p, msg))
+
+	msg = testMsg(t, "blue")
+	msg.HasGroups = true
+	require.Nil(t, f.Outbound(p, msg))
+
+	msg = testMsg(t, "red")
+	msg.Groups, msg.HasGroups = []string{"red", "blue"}, true
+	out := f.Outbound(p, msg)
+	require.NotNil(t, out)
+
+	in, err := cot.CotFromProto(out, "", "")
+	require.NoError(t, err)
+	require.Equal(t, "shared", in.GetDetail().GetFirst(groupTag).GetAttr("group"))
+	require.Equal(t, int64(2), p.DTO().Filtered)
+}
+
+func TestPeerCheckCert(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("cert")}
+	fp := tlsutil.Fingerprint(cert)
+
+	p := NewPeer(&PeerConfig{Name: "remote"})
+	require.Error(t, p.CheckCert(cert))
+
+	p = NewPeer(&PeerConfig{Name: "remote", Fingerprint: strings.ToUpper(fp[:2] + ":" + fp[2:])})
+	require.NoError(t, p.CheckCert(cert))
+	require.Error(t, p.CheckCert(&x509.Certificate{Raw: []byte("other")}))
+	require.Error(t, p.CheckCert(nil))
+}
@@ -0,0 +1,87 @@
+package federation
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+// LoopFilter remembers message hashes for a time window, so the same event
+// coming back through another federate is dropped.
+type LoopFilter struct {
+	mx     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+	last   time.Time
+}
+
+func NewLoopFilter(window time.Duration) *LoopFilter {
+	return &LoopFilter{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// Seen returns true if the key was already seen in the window, otherwise records it.
+func (l *LoopFilter) Seen(key string) bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(l.last) > l.window {
+		l.clean(now)
+	}
+
+	if t, ok := l.seen[key]; ok && now.Sub(t) < l.window {
+		return true
+	}
+
+	l.seen[key] = now
+
+	return false
+}
+
+func (l *LoopFilter) Size() int {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	return len(l.seen)
+}
+
+func (l *LoopFilter) clean(now time.Time) {
+	for k, t := range l.seen {
+		if now.Sub(t) >= l.window {
+			delete(l.seen, k)
+		}
+	}
+
+	l.last = now
+}
+
+// MessageKey is a hash of event fields that are not changed by federation hops.
+func MessageKey(msg *cot.CotMessage) string {
+	evt := msg.GetTakMessage().GetCotEvent()
+
+	h := sha1.New()
+	h.Write([]byte(evt.GetUid()))
+	h.Write([]byte{0})
+	h.Write([]byte(evt.GetType()))
+	h.Write([]byte{0})
+	h.Write([]byte(evt.GetHow()))
+
+	b := make([]byte, 8)
+
+	for _, n := range []uint64{evt.GetSendTime(), evt.GetStartTime(), evt.GetStaleTime(),
+		math.Float64bits(evt.GetLat()), math.Float64bits(evt.GetLon())} {
+		binary.BigEndian.PutUint64(b, n)
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,185 @@
+package federation
+
+import (
+	"cmp"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/tlsutil"
+)
+
+// PeerConfig is the federate config. Fingerprint is SHA-256 of the peer certificate,
+// it is required for incoming connections and checked for outgoing ones if set.
+type PeerConfig struct {
+	Name        string            `yaml:"name" json:"name" koanf:"name"`
+	Addr        string            `yaml:"addr" json:"addr,omitempty" koanf:"addr"`
+	CN          string            `yaml:"cn" json:"cn,omitempty" koanf:"cn"`
+	Cert        string            `yaml:"cert" json:"-" koanf:"cert"`
+	Password    string            `yaml:"password" json:"-" koanf:"password"`
+	CA          string            `yaml:"ca" json:"-" koanf:"ca"`
+	Fingerprint string            `yaml:"fingerprint" json:"fingerprint,omitempty" koanf:"fingerprint"`
+	Scopes      map[string]string `yaml:"scopes" json:"scopes" koanf:"scopes"`
+}
+
+// Peer is a remote goatak (or TAK) server we exchange CoT with.
+// Scopes maps local scope to the group name used on the wire.
+type Peer struct {
+	conf *PeerConfig
+
+	connected   atomic.Bool
+	received    atomic.Int64
+	sent        atomic.Int64
+	looped      atomic.Int64
+	filtered    atomic.Int64
+	mx          sync.RWMutex
+	lastConnect time.Time
+	lastError   string
+}
+
+type PeerDTO struct {
+	Name        string            `json:"name"`
+	Addr        string            `json:"addr,omitempty"`
+	CN          string            `json:"cn"`
+	Outgoing    bool              `json:"outgoing"`
+	Connected   bool              `json:"connected"`
+	LastConnect *time.Time        `json:"last_connect,omitempty"`
+	LastError   string            `json:"last_error,omitempty"`
+	Scopes      map[string]string `json:"scopes"`
+	Received    int64             `json:"received"`
+	Sent        int64             `json:"sent"`
+	Looped      int64             `json:"looped"`
+	Filtered    int64             `json:"filtered"`
+}
+
+func NewPeer(conf *PeerConfig) *Peer {
+	return &Peer{conf: conf}
+}
+
+func (p *Peer) Name() string {
+	return p.conf.Name
+}
+
+func (p *Peer) Addr() string {
+	return p.conf.Addr
+}
+
+func (p *Peer) Config() *PeerConfig {
+	return p.conf
+}
+
+// CN is the certificate common name expected from the incoming federate connection.
+func (p *Peer) CN() string {
+	return cmp.Or(p.conf.CN, p.conf.Name)
+}
+
+// CheckCert checks the certificate presented by the peer against the pinned fingerprint.
+func (p *Peer) CheckCert(cert *x509.Certificate) error {
+	if p.conf.Fingerprint == "" {
+		return fmt.Errorf("no fingerprint is set for federate %s", p.Name())
+	}
+
+	if cert == nil {
+		return fmt.Errorf("no certificate from federate %s", p.Name())
+	}
+
+	fp := strings.ToLower(strings.ReplaceAll(p.conf.Fingerprint, ":", ""))
+
+	if tlsutil.Fingerprint(cert) != fp {
+		return fmt.Errorf("certificate fingerprint mismatch for federate %s", p.Name())
+	}
+
+	return nil
+}
+
+func (p *Peer) IsOutgoing() bool {
+	return p.conf.Addr != ""
+}
+
+func (p *Peer) GroupForScope(scope string) (string, bool) {
+	g, ok := p.conf.Scopes[scope]
+
+	return g, ok
+}
+
+// groupForMsg maps message scope to remote group. If the sender uses groups, the first mapped one is used,
+// message without groups goes nowhere.
+func (p *Peer) groupForMsg(msg *cot.CotMessage) (string, bool) {
+	if !msg.HasGroups && len(msg.Groups) == 0 {
+		return p.GroupForScope(msg.Scope)
+	}
+
+	for _, g := range msg.Groups {
+		if group, ok := p.GroupForScope(g); ok {
+			return group, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *Peer) ScopeForGroup(group string) (string, bool) {
+	for s, g := range p.conf.Scopes {
+		if g == group {
+			return s, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *Peer) SetConnected(connected bool) {
+	p.connected.Store(connected)
+
+	if connected {
+		p.mx.Lock()
+		p.lastConnect = time.Now()
+		p.lastError = ""
+		p.mx.Unlock()
+	}
+}
+
+func (p *Peer) IsConnected() bool {
+	return p.connected.Load()
+}
+
+func (p *Peer) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.lastError = err.Error()
+}
+
+func (p *Peer) DTO() *PeerDTO {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	d := &PeerDTO{
+		Name:      p.conf.Name,
+		Addr:      p.conf.Addr,
+		CN:        p.CN(),
+		Outgoing:  p.IsOutgoing(),
+		Connected: p.IsConnected(),
+		LastError: p.lastError,
+		Scopes:    p.conf.Scopes,
+		Received:  p.received.Load(),
+		Sent:      p.sent.Load(),
+		Looped:    p.looped.Load(),
+		Filtered:  p.filtered.Load(),
+	}
+
+	if !p.lastConnect.IsZero() {
+		t := p.lastConnect
+		d.LastConnect = &t
+	}
+
+	return d
+}
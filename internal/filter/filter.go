@@ -0,0 +1,193 @@
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// Engine applies rules to messages. Rules are checked in order, allow and drop rules stop the check,
+// rewrite rules change the message and the check goes on. Message is allowed if no rule matched.
+type Engine struct {
+	mx    sync.RWMutex
+	rules []*Rule
+}
+
+func New(rules []*RuleConfig) (*Engine, error) {
+	e := &Engine{}
+
+	for _, c := range rules {
+		if err := e.Add(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+func (e *Engine) Rules() []*Rule {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+
+	return slices.Clone(e.rules)
+}
+
+func (e *Engine) Len() int {
+	if e == nil {
+		return 0
+	}
+
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+
+	return len(e.rules)
+}
+
+func (e *Engine) Add(c *RuleConfig) error {
+	r, err := NewRule(c)
+	if err != nil {
+		return err
+	}
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	if e.find(c.Name) != -1 {
+		return fmt.Errorf("rule %s already exists", c.Name)
+	}
+
+	e.rules = append(e.rules, r)
+
+	return nil
+}
+
+// Update replaces rule keeping its position and counters.
+func (e *Engine) Update(name string, c *RuleConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	n := e.find(name)
+	if n == -1 {
+		return fmt.Errorf("rule %s not found", name)
+	}
+
+	if c.Name != name && e.find(c.Name) != -1 {
+		return fmt.Errorf("rule %s already exists", c.Name)
+	}
+
+	r := &Rule{conf: c}
+	r.matched.Store(e.rules[n].matched.Load())
+	r.dropped.Store(e.rules[n].dropped.Load())
+	e.rules[n] = r
+
+	return nil
+}
+
+func (e *Engine) Remove(name string) bool {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	n := e.find(name)
+	if n == -1 {
+		return false
+	}
+
+	e.rules = slices.Delete(e.rules, n, n+1)
+
+	return true
+}
+
+func (e *Engine) find(name string) int {
+	return slices.IndexFunc(e.rules, func(r *Rule) bool { return r.conf.Name == name })
+}
+
+// Ingress checks message got from device. Message can be changed in place. Returns false if message must be dropped.
+func (e *Engine) Ingress(msg *cot.CotMessage, from *model.Device) bool {
+	if e == nil || msg == nil {
+		return true
+	}
+
+	_, ok := e.apply(DirectionIn, msg, from, nil, false)
+
+	return ok
+}
+
+// Egress checks message for recipient device. Returns message to send (original or rewritten copy) or nil.
+func (e *Engine) Egress(msg *cot.CotMessage, from, to *model.Device) *cot.CotMessage {
+	if e == nil || msg == nil {
+		return msg
+	}
+
+	res, ok := e.apply(DirectionOut, msg, from, to, true)
+	if !ok {
+		return nil
+	}
+
+	return res
+}
+
+func (e *Engine) apply(direction string, msg *cot.CotMessage, from, to *model.Device, cp bool) (*cot.CotMessage, bool) {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+
+	for _, r := range e.rules {
+		if !r.appliesTo(direction) || !r.match(msg, from, to) {
+			continue
+		}
+
+		r.matched.Add(1)
+
+		switch r.conf.Action {
+		case ActionAllow:
+			return msg, true
+		case ActionDrop:
+			r.dropped.Add(1)
+
+			return nil, false
+		case ActionRewrite:
+			if cp {
+				msg = clone(msg)
+				cp = false
+			}
+
+			rewrite(r.conf, msg, direction)
+		}
+	}
+
+	return msg, true
+}
+
+func rewrite(c *RuleConfig, msg *cot.CotMessage, direction string) {
+	if len(c.RemoveTags) > 0 && msg.Detail != nil {
+		msg.Detail.RemoveTags(c.RemoveTags...)
+		msg.TakMessage = msg.GetUpdatedTakMessage()
+	}
+
+	if c.SetScope != "" && direction == DirectionIn {
+		// message goes to the new scope only
+		msg.Scope, msg.Groups, msg.HasGroups = c.SetScope, nil, false
+	}
+}
+
+func clone(msg *cot.CotMessage) *cot.CotMessage {
+	m := proto.Clone(msg.GetTakMessage()).(*cotproto.TakMessage)
+
+	res, err := cot.CotFromProto(m, msg.From, msg.Scope)
+	if err != nil || res == nil {
+		return &cot.CotMessage{From: msg.From, Scope: msg.Scope, Groups: msg.Groups, HasGroups: msg.HasGroups, TakMessage: m, Detail: msg.Detail}
+	}
+
+	res.Groups, res.HasGroups = msg.Groups, msg.HasGroups
+
+	return res
+}
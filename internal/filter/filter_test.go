@@ -0,0 +1,81 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func makeMsg(typ string, lat, lon float64, detail string) *cot.CotMessage {
+	m := cot.BasicMsg(typ, "uid1", time.Minute)
+	m.CotEvent.Lat = lat
+	m.CotEvent.Lon = lon
+	m.CotEvent.Detail = &cotproto.Detail{XmlDetail: detail}
+
+	msg, _ := cot.CotFromProto(m, "h1", "test")
+
+	return msg
+}
+
+func TestIngress(t *testing.T) {
+	e, err := New([]*RuleConfig{
+		{Name: "allow-admin", Direction: DirectionIn, Action: ActionAllow, Logins: []string{"admin"}},
+		{Name: "drop-bbox", Direction: DirectionIn, Action: ActionDrop, Types: []string{"a-f-"}, BBox: []float64{10, 10, 11, 11}},
+		{Name: "strip", Direction: DirectionIn, Action: ActionRewrite, Tags: []string{"__video"}, RemoveTags: []string{"__video"}, SetScope: "other"},
+	})
+	require.NoError(t, err)
+
+	user := &model.Device{Login: "user", Scope: "test"}
+	admin := &model.Device{Login: "admin", Scope: "test"}
+
+	require.False(t, e.Ingress(makeMsg("a-f-G", 10.5, 10.5, ""), user))
+	require.True(t, e.Ingress(makeMsg("a-f-G", 10.5, 10.5, ""), admin))
+	require.True(t, e.Ingress(makeMsg("a-f-G", 12, 10.5, ""), user))
+	require.True(t, e.Ingress(makeMsg("b-m-p", 10.5, 10.5, ""), user))
+
+	msg := makeMsg("b-m-p", 0, 0, "<contact callsign=\"a\"/><__video url=\"rtsp://x\"/>")
+	require.True(t, e.Ingress(msg, user))
+	require.False(t, msg.GetDetail().Has("__video"))
+	require.True(t, msg.GetDetail().Has("contact"))
+	require.NotContains(t, msg.GetTakMessage().GetCotEvent().GetDetail().GetXmlDetail(), "__video")
+	require.Equal(t, "other", msg.Scope)
+
+	rules := e.Rules()
+	require.Equal(t, int64(1), rules[0].DTO().Matched)
+	require.Equal(t, int64(1), rules[1].DTO().Dropped)
+	require.Equal(t, int64(1), rules[2].DTO().Matched)
+}
+
+func TestEgress(t *testing.T) {
+	e, err := New([]*RuleConfig{
+		{Name: "drop-guest", Direction: DirectionOut, Action: ActionDrop, Types: []string{"b-"}, ToScopes: []string{"guest"}},
+		{Name: "strip", Direction: DirectionOut, Action: ActionRewrite, ToLogins: []string{"u2"}, RemoveTags: []string{"__video"}},
+	})
+	require.NoError(t, err)
+
+	guest := &model.Device{Login: "g", Scope: "guest"}
+	u2 := &model.Device{Login: "u2", Scope: "test"}
+
+	msg := makeMsg("b-m-p", 0, 0, "<__video url=\"rtsp://x\"/>")
+
+	require.Nil(t, e.Egress(msg, nil, guest))
+	require.NotNil(t, e.Egress(makeMsg("a-f-G", 0, 0, ""), nil, guest))
+
+	m := e.Egress(msg, nil, u2)
+	require.NotNil(t, m)
+	require.False(t, m.GetDetail().Has("__video"))
+	// original is not changed
+	require.True(t, msg.GetDetail().Has("__video"))
+
+	require.Error(t, e.Add(&RuleConfig{Name: "strip", Action: ActionDrop}))
+	require.Error(t, e.Add(&RuleConfig{Name: "bad", Action: "aaa"}))
+	require.NoError(t, e.Update("strip", &RuleConfig{Name: "strip2", Action: ActionAllow}))
+	require.Equal(t, int64(1), e.Rules()[1].DTO().Matched)
+	require.True(t, e.Remove("strip2"))
+	require.Len(t, e.Rules(), 1)
+}
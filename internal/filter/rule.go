@@ -0,0 +1,150 @@
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	ActionAllow   = "allow"
+	ActionDrop    = "drop"
+	ActionRewrite = "rewrite"
+
+	DirectionIn   = "in"
+	DirectionOut  = "out"
+	DirectionBoth = "both"
+)
+
+type RuleConfig struct {
+	Name      string `yaml:"name" json:"name" koanf:"name"`
+	Direction string `yaml:"direction" json:"direction" koanf:"direction"`
+	Action    string `yaml:"action" json:"action" koanf:"action"`
+	Disabled  bool   `yaml:"disabled" json:"disabled" koanf:"disabled"`
+	// match conditions, empty condition matches everything
+	Types    []string  `yaml:"types" json:"types,omitempty" koanf:"types"`
+	Logins   []string  `yaml:"logins" json:"logins,omitempty" koanf:"logins"`
+	Scopes   []string  `yaml:"scopes" json:"scopes,omitempty" koanf:"scopes"`
+	ToLogins []string  `yaml:"to_logins" json:"to_logins,omitempty" koanf:"to_logins"`
+	ToScopes []string  `yaml:"to_scopes" json:"to_scopes,omitempty" koanf:"to_scopes"`
+	BBox     []float64 `yaml:"bbox" json:"bbox,omitempty" koanf:"bbox"`
+	Tags     []string  `yaml:"tags" json:"tags,omitempty" koanf:"tags"`
+	// rewrite
+	RemoveTags []string `yaml:"remove_tags" json:"remove_tags,omitempty" koanf:"remove_tags"`
+	SetScope   string   `yaml:"set_scope" json:"set_scope,omitempty" koanf:"set_scope"`
+}
+
+type Rule struct {
+	conf    *RuleConfig
+	matched atomic.Int64
+	dropped atomic.Int64
+}
+
+type RuleDTO struct {
+	*RuleConfig
+	Matched int64 `json:"matched"`
+	Dropped int64 `json:"dropped"`
+}
+
+func NewRule(conf *RuleConfig) (*Rule, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Rule{conf: conf}, nil
+}
+
+func (c *RuleConfig) Validate() error {
+	if c == nil {
+		return fmt.Errorf("empty rule")
+	}
+
+	if c.Name == "" {
+		return fmt.Errorf("empty rule name")
+	}
+
+	if c.Direction == "" {
+		c.Direction = DirectionBoth
+	}
+
+	if !slices.Contains([]string{DirectionIn, DirectionOut, DirectionBoth}, c.Direction) {
+		return fmt.Errorf("rule %s: invalid direction %s", c.Name, c.Direction)
+	}
+
+	if !slices.Contains([]string{ActionAllow, ActionDrop, ActionRewrite}, c.Action) {
+		return fmt.Errorf("rule %s: invalid action %s", c.Name, c.Action)
+	}
+
+	if len(c.BBox) != 0 && len(c.BBox) != 4 {
+		return fmt.Errorf("rule %s: bbox must be [lat1, lon1, lat2, lon2]", c.Name)
+	}
+
+	if c.Action == ActionRewrite && len(c.RemoveTags) == 0 && c.SetScope == "" {
+		return fmt.Errorf("rule %s: nothing to rewrite", c.Name)
+	}
+
+	return nil
+}
+
+func (r *Rule) Name() string {
+	return r.conf.Name
+}
+
+func (r *Rule) Config() *RuleConfig {
+	return r.conf
+}
+
+func (r *Rule) DTO() *RuleDTO {
+	return &RuleDTO{
+		RuleConfig: r.conf,
+		Matched:    r.matched.Load(),
+		Dropped:    r.dropped.Load(),
+	}
+}
+
+func (r *Rule) appliesTo(direction string) bool {
+	return !r.conf.Disabled && (r.conf.Direction == DirectionBoth || r.conf.Direction == direction)
+}
+
+// match checks message against rule conditions. from is the sender device, to is nil for ingress.
+func (r *Rule) match(msg *cot.CotMessage, from, to *model.Device) bool {
+	c := r.conf
+
+	if len(c.Types) > 0 && !cot.MatchAnyPattern(msg.GetType(), c.Types...) {
+		return false
+	}
+
+	if len(c.Logins) > 0 && !slices.Contains(c.Logins, from.GetLogin()) {
+		return false
+	}
+
+	if len(c.Scopes) > 0 && !slices.Contains(c.Scopes, msg.Scope) {
+		return false
+	}
+
+	if len(c.ToLogins) > 0 && (to == nil || !slices.Contains(c.ToLogins, to.GetLogin())) {
+		return false
+	}
+
+	if len(c.ToScopes) > 0 && (to == nil || !slices.Contains(c.ToScopes, to.GetScope())) {
+		return false
+	}
+
+	if len(c.BBox) == 4 && !inBBox(c.BBox, msg.GetLat(), msg.GetLon()) {
+		return false
+	}
+
+	if len(c.Tags) > 0 && !slices.ContainsFunc(c.Tags, msg.GetDetail().Has) {
+		return false
+	}
+
+	return true
+}
+
+func inBBox(b []float64, lat, lon float64) bool {
+	return lat >= min(b[0], b[2]) && lat <= max(b[0], b[2]) &&
+		lon >= min(b[1], b[3]) && lon <= max(b[1], b[3])
+}
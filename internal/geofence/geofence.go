@@ -0,0 +1,167 @@
+package geofence
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const alertStale = time.Minute * 5
+
+type Transition struct {
+	Fence *model.Geofence
+	Event string
+}
+
+// Engine keeps geofences and the last known inside/outside state of every item for every fence.
+type Engine struct {
+	mx     sync.RWMutex
+	fences map[string]*model.Geofence
+	inside map[string]map[string]bool
+}
+
+func NewEngine() *Engine {
+	return &Engine{
+		fences: make(map[string]*model.Geofence),
+		inside: make(map[string]map[string]bool),
+	}
+}
+
+// Set adds or replaces fence. State of the fence is reset.
+func (e *Engine) Set(f *model.Geofence) {
+	if f == nil || f.UID == "" {
+		return
+	}
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	e.fences[f.UID] = f
+	e.inside[f.UID] = make(map[string]bool)
+}
+
+// Update replaces fence keeping the inside state of items, so changed fence does not produce false alerts.
+func (e *Engine) Update(f *model.Geofence) {
+	if f == nil || f.UID == "" {
+		return
+	}
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	e.fences[f.UID] = f
+
+	if e.inside[f.UID] == nil {
+		e.inside[f.UID] = make(map[string]bool)
+	}
+}
+
+func (e *Engine) Remove(uid string) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	delete(e.fences, uid)
+	delete(e.inside, uid)
+}
+
+func (e *Engine) Get(uid string) *model.Geofence {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+
+	return e.fences[uid]
+}
+
+func (e *Engine) ByShape(shapeUID string) []*model.Geofence {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+
+	var res []*model.Geofence
+
+	for _, f := range e.fences {
+		if shapeUID != "" && f.ShapeUID == shapeUID {
+			res = append(res, f)
+		}
+	}
+
+	return res
+}
+
+// Forget removes item state from all fences.
+func (e *Engine) Forget(itemUID string) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	for _, m := range e.inside {
+		delete(m, itemUID)
+	}
+}
+
+// Check updates item position and returns fence transitions.
+// The first position of an item only records its state, so server restart does not produce false alerts.
+func (e *Engine) Check(itemUID, scope string, lat, lon float64) []*Transition {
+	if lat == 0 && lon == 0 {
+		return nil
+	}
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	var res []*Transition
+
+	for uid, f := range e.fences {
+		if f.Disabled || (f.Scope != "" && f.Scope != scope) {
+			continue
+		}
+
+		in := f.Contains(lat, lon)
+		was, known := e.inside[uid][itemUID]
+
+		e.inside[uid][itemUID] = in
+
+		if !known || was == in {
+			continue
+		}
+
+		if in {
+			res = append(res, &Transition{Fence: f, Event: model.FENCE_ENTER})
+		} else {
+			res = append(res, &Transition{Fence: f, Event: model.FENCE_EXIT})
+		}
+	}
+
+	return res
+}
+
+func (t *Transition) Text(callsign string) string {
+	if t.Event == model.FENCE_ENTER {
+		return fmt.Sprintf("%s entered geofence %s", callsign, t.Fence.Name)
+	}
+
+	return fmt.Sprintf("%s left geofence %s", callsign, t.Fence.Name)
+}
+
+// AlertMsg makes b-a-g alert event for transition of item.
+func (t *Transition) AlertMsg(item *model.Item) *cotproto.TakMessage {
+	msg := cot.BasicMsg("b-a-g", "geofence-"+uuid.NewString(), alertStale)
+	msg.CotEvent.Lat, msg.CotEvent.Lon = item.GetLanLon()
+
+	xd := cot.NewXMLDetails()
+	xd.AddPpLink(item.GetUID(), item.GetType(), item.GetCallsign())
+	xd.AddChild("contact", map[string]string{"callsign": "Geofence " + t.Fence.Name}, "")
+	xd.AddChild("__geofence", map[string]string{
+		"uid":     t.Fence.UID,
+		"name":    t.Fence.Name,
+		"trigger": t.Event,
+	}, "")
+	xd.AddChild("remarks", nil, t.Text(item.GetCallsign()))
+
+	msg.CotEvent.Detail = &cotproto.Detail{XmlDetail: xd.AsXMLString()}
+
+	return msg
+}
@@ -0,0 +1,102 @@
+package geofence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func square() *model.Geofence {
+	return &model.Geofence{
+		UID:   "f1",
+		Name:  "square",
+		Shape: model.FENCE_POLYGON,
+		Points: []*model.GeoPoint{
+			{Lat: 10, Lon: 10},
+			{Lat: 10, Lon: 11},
+			{Lat: 11, Lon: 11},
+			{Lat: 11, Lon: 10},
+		},
+	}
+}
+
+func TestContains(t *testing.T) {
+	f := square()
+
+	require.True(t, f.Contains(10.5, 10.5))
+	require.False(t, f.Contains(11.5, 10.5))
+	require.False(t, f.Contains(10.5, 9.5))
+
+	c := &model.Geofence{
+		Shape:  model.FENCE_CIRCLE,
+		Points: []*model.GeoPoint{{Lat: 60, Lon: 30}},
+		Radius: 1000,
+	}
+
+	require.True(t, c.Contains(60.005, 30))
+	require.False(t, c.Contains(60.01, 30))
+}
+
+func TestCheck(t *testing.T) {
+	e := NewEngine()
+	e.Set(square())
+
+	// first position only sets the state
+	require.Empty(t, e.Check("u1", "test", 9, 9))
+
+	tr := e.Check("u1", "test", 10.5, 10.5)
+	require.Len(t, tr, 1)
+	require.Equal(t, model.FENCE_ENTER, tr[0].Event)
+
+	require.Empty(t, e.Check("u1", "test", 10.6, 10.6))
+
+	tr = e.Check("u1", "test", 12, 10.6)
+	require.Len(t, tr, 1)
+	require.Equal(t, model.FENCE_EXIT, tr[0].Event)
+
+	f := square()
+	f.Scope = "other"
+	e.Set(f)
+
+	require.Empty(t, e.Check("u1", "test", 9, 9))
+	require.Empty(t, e.Check("u1", "test", 10.5, 10.5))
+}
+
+func TestShapeFromMsg(t *testing.T) {
+	m := cot.BasicMsg("u-d-r", "shape1", time.Hour)
+	xd, _ := cot.DetailsFromString("<link point=\"10.0,10.0,0\"/><link point=\"10.0,11.0\"/><link point=\"11.0,11.0\"/><link point=\"11.0,10.0\"/>")
+	m.CotEvent.Detail = &cotproto.Detail{XmlDetail: xd.AsXMLString()}
+
+	msg, err := cot.CotFromProto(m, "", "test")
+	require.NoError(t, err)
+
+	shape, points, _ := model.ShapeFromMsg(msg)
+	require.Equal(t, model.FENCE_POLYGON, shape)
+	require.Len(t, points, 4)
+	require.Equal(t, 11., points[2].Lat)
+}
+
+func TestUpdate(t *testing.T) {
+	e := NewEngine()
+	e.Set(square())
+
+	require.Empty(t, e.Check("u1", "test", 10.5, 10.5))
+
+	// bigger fence, item is still inside
+	f := square()
+	f.Points[2].Lat, f.Points[3].Lat = 12, 12
+	require.False(t, square().SameGeometry(f.Shape, f.Points, f.Radius))
+	require.True(t, square().SameGeometry(f.Shape, square().Points, f.Radius))
+
+	e.Update(f)
+	require.Empty(t, e.Check("u1", "test", 11.5, 10.5))
+
+	tr := e.Check("u1", "test", 12.5, 10.5)
+	require.Len(t, tr, 1)
+	require.Equal(t, model.FENCE_EXIT, tr[0].Event)
+}
@@ -0,0 +1,61 @@
+package mesh
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+const (
+	magicByte = 0xbf
+
+	ProtoXML = "xml"
+	ProtoV1  = "proto"
+)
+
+// Decode parses datagram: plain xml event, or TAK protocol header (0xbf, version, 0xbf) with xml or protobuf payload.
+func Decode(buf []byte, from, scope string) (*cot.CotMessage, error) {
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("too short datagram")
+	}
+
+	if buf[0] == magicByte && buf[2] == magicByte {
+		if buf[1] == 1 {
+			msg := new(cotproto.TakMessage)
+
+			if err := proto.Unmarshal(buf[3:], msg); err != nil {
+				return nil, fmt.Errorf("protobuf decode error: %w", err)
+			}
+
+			return cot.CotFromProto(msg, from, scope)
+		}
+
+		buf = buf[3:]
+	}
+
+	ev := new(cot.Event)
+
+	if err := xml.Unmarshal(buf, ev); err != nil {
+		return nil, fmt.Errorf("xml decode error: %w", err)
+	}
+
+	return cot.EventToProtoExt(ev, from, scope)
+}
+
+// Encode makes datagram with xml event or TAK protocol v1 message.
+func Encode(msg *cotproto.TakMessage, protocol string) ([]byte, error) {
+	if protocol == ProtoXML {
+		return xml.Marshal(cot.ProtoToEvent(msg))
+	}
+
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{magicByte, 1, magicByte}, b...), nil
+}
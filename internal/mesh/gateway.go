@@ -0,0 +1,295 @@
+package mesh
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/federation"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const (
+	DefaultGroup = "239.2.3.1:6969"
+
+	loopWindow = time.Second * 30
+)
+
+type Config struct {
+	Name  string `yaml:"name" json:"name" koanf:"name"`
+	Group string `yaml:"group" json:"group" koanf:"group"`
+	// network interface to join group on, empty - system default
+	Interface string `yaml:"interface" json:"interface" koanf:"interface"`
+	// scope for messages from mesh
+	Scope string `yaml:"scope" json:"scope" koanf:"scope"`
+	// scopes sent to mesh
+	Scopes []string `yaml:"scopes" json:"scopes" koanf:"scopes"`
+	// type masks allowed to mesh and from mesh, empty - all
+	Types   []string `yaml:"types" json:"types" koanf:"types"`
+	InTypes []string `yaml:"in_types" json:"in_types" koanf:"in_types"`
+	// xml or proto
+	Protocol string `yaml:"protocol" json:"protocol" koanf:"protocol"`
+}
+
+// Gateway is the client handler for multicast SA mesh. Messages from the mesh are passed to messageCb,
+// messages sent to the handler are re-emitted to the group if scope and type are allowed.
+type Gateway struct {
+	conf      *Config
+	logger    *slog.Logger
+	device    *model.Device
+	messageCb func(msg *cot.CotMessage)
+	loop      *federation.LoopFilter
+	uids      sync.Map
+	addr      *net.UDPAddr
+	conn      *net.UDPConn
+	write     func(b []byte) error
+	active    atomic.Bool
+	lastSeen  atomic.Pointer[time.Time]
+	received  atomic.Int64
+	sent      atomic.Int64
+	looped    atomic.Int64
+}
+
+func (c *Config) Validate() error {
+	if c == nil || c.Name == "" {
+		return fmt.Errorf("empty mesh name")
+	}
+
+	c.Group = cmp.Or(c.Group, DefaultGroup)
+	c.Scope = cmp.Or(c.Scope, cot.BroadcastScope)
+	c.Protocol = cmp.Or(c.Protocol, ProtoV1)
+
+	if c.Protocol != ProtoXML && c.Protocol != ProtoV1 {
+		return fmt.Errorf("mesh %s: invalid protocol %s", c.Name, c.Protocol)
+	}
+
+	return nil
+}
+
+func New(conf *Config, messageCb func(msg *cot.CotMessage)) (*Gateway, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	addr, err := net.ResolveUDPAddr("udp4", conf.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	if !addr.IP.IsMulticast() {
+		return nil, fmt.Errorf("mesh %s: %s is not a multicast address", conf.Name, conf.Group)
+	}
+
+	g := &Gateway{
+		conf:      conf,
+		logger:    slog.With("logger", "mesh", "name", conf.Name),
+		device:    &model.Device{Login: "mesh:" + conf.Name, Scope: conf.Scope, ReadScope: conf.Scopes},
+		messageCb: messageCb,
+		loop:      federation.NewLoopFilter(loopWindow),
+		addr:      addr,
+	}
+
+	return g, nil
+}
+
+// Start joins the group and reads datagrams until ctx is done.
+func (g *Gateway) Start(ctx context.Context) error {
+	var iface *net.Interface
+
+	if g.conf.Interface != "" {
+		var err error
+
+		if iface, err = net.InterfaceByName(g.conf.Interface); err != nil {
+			return err
+		}
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", iface, g.addr)
+	if err != nil {
+		return err
+	}
+
+	g.conn = conn
+	g.write = func(b []byte) error {
+		_, err := conn.WriteToUDP(b, g.addr)
+
+		return err
+	}
+
+	g.active.Store(true)
+	g.logger.Info("joined " + g.addr.String())
+
+	go func() {
+		<-ctx.Done()
+		g.Stop()
+	}()
+
+	buf := make([]byte, 65535)
+
+	for ctx.Err() == nil {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if !g.active.Load() {
+				return nil
+			}
+
+			return err
+		}
+
+		g.process(buf[:n], src)
+	}
+
+	return nil
+}
+
+func (g *Gateway) process(buf []byte, src *net.UDPAddr) {
+	msg, err := Decode(buf, g.GetName(), g.conf.Scope)
+	if err != nil {
+		g.logger.Debug(fmt.Sprintf("bad datagram from %s: %s", src, err.Error()))
+
+		return
+	}
+
+	if g.loop.Seen(federation.MessageKey(msg)) {
+		g.looped.Add(1)
+
+		return
+	}
+
+	if len(g.conf.InTypes) > 0 && !cot.MatchAnyPattern(msg.GetType(), g.conf.InTypes...) {
+		return
+	}
+
+	now := time.Now()
+	g.lastSeen.Store(&now)
+	g.received.Add(1)
+
+	if msg.IsContact() {
+		g.uids.Store(strings.TrimSuffix(msg.GetUID(), "-ping"), msg.GetCallsign())
+	}
+
+	if msg.GetType() == "t-x-d-d" {
+		if uid := msg.GetFirstLink("p-p").GetAttr("uid"); uid != "" {
+			g.uids.Delete(uid)
+		}
+	}
+
+	g.messageCb(msg)
+}
+
+func (g *Gateway) GetName() string {
+	return "mesh:" + g.conf.Name
+}
+
+func (g *Gateway) HasUID(uid string) bool {
+	_, ok := g.uids.Load(uid)
+
+	return ok
+}
+
+func (g *Gateway) HasCallsign(callsign string) bool {
+	var found bool
+
+	g.uids.Range(func(_, value any) bool {
+		if value.(string) == callsign {
+			found = true
+
+			return false
+		}
+
+		return true
+	})
+
+	return found
+}
+
+func (g *Gateway) GetUids() map[string]string {
+	res := make(map[string]string)
+
+	g.uids.Range(func(key, value any) bool {
+		res[key.(string)] = value.(string)
+
+		return true
+	})
+
+	return res
+}
+
+func (g *Gateway) GetDevice() *model.Device {
+	return g.device
+}
+
+func (g *Gateway) GetSerial() string {
+	return ""
+}
+
+func (g *Gateway) GetVersion() int32 {
+	if g.conf.Protocol == ProtoXML {
+		return 0
+	}
+
+	return 1
+}
+
+func (g *Gateway) GetLastSeen() *time.Time {
+	return g.lastSeen.Load()
+}
+
+// SendMsg re-emits message to the mesh.
+func (g *Gateway) SendMsg(msg *cot.CotMessage) error {
+	if !g.active.Load() || msg.IsControl() {
+		return nil
+	}
+
+	if !msg.IsLocal() && !g.canSend(msg) {
+		return nil
+	}
+
+	if len(g.conf.Types) > 0 && !cot.MatchAnyPattern(msg.GetType(), g.conf.Types...) {
+		return nil
+	}
+
+	b, err := Encode(msg.GetTakMessage(), g.conf.Protocol)
+	if err != nil {
+		return err
+	}
+
+	// remember the message, so we drop it when it comes back from the group
+	g.loop.Seen(federation.MessageKey(msg))
+
+	if err := g.write(b); err != nil {
+		return err
+	}
+
+	g.sent.Add(1)
+
+	return nil
+}
+
+// canSend checks message scope, or groups if the sender uses groups, against scopes sent to mesh.
+func (g *Gateway) canSend(msg *cot.CotMessage) bool {
+	if msg.HasGroups || len(msg.Groups) > 0 {
+		return slices.ContainsFunc(msg.Groups, func(s string) bool { return slices.Contains(g.conf.Scopes, s) })
+	}
+
+	return slices.Contains(g.conf.Scopes, msg.Scope)
+}
+
+func (g *Gateway) Stop() {
+	if g.active.CompareAndSwap(true, false) && g.conn != nil {
+		_ = g.conn.Close()
+	}
+}
+
+// Stats returns received, sent and looped messages count.
+func (g *Gateway) Stats() (int64, int64, int64) {
+	return g.received.Load(), g.sent.Load(), g.looped.Load()
+}
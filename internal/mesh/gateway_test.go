@@ -0,0 +1,144 @@
+package mesh
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+func TestCodec(t *testing.T) {
+	msg := cot.BasicMsg("a-f-G-U-C", "uid1", time.Minute)
+	msg.CotEvent.Lat = 10
+
+	for _, p := range []string{ProtoXML, ProtoV1} {
+		b, err := Encode(msg, p)
+		require.NoError(t, err)
+
+		m, err := Decode(b, "from", "scope")
+		require.NoError(t, err, p)
+
+		assert.Equal(t, "uid1", m.GetUID())
+		assert.Equal(t, "a-f-G-U-C", m.GetType())
+		assert.InDelta(t, 10, m.GetLat(), 0.0001)
+		assert.Equal(t, "from", m.From)
+		assert.Equal(t, "scope", m.Scope)
+	}
+
+	// xml with tak protocol header
+	b, err := xml.Marshal(cot.ProtoToEvent(msg))
+	require.NoError(t, err)
+
+	m, err := Decode(append([]byte{magicByte, 0, magicByte}, b...), "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "uid1", m.GetUID())
+
+	_, err = Decode([]byte{1, 2}, "", "")
+	require.Error(t, err)
+}
+
+func testGateway(t *testing.T, conf *Config) (*Gateway, *[][]byte, *[]*cot.CotMessage) {
+	var sent [][]byte
+
+	var got []*cot.CotMessage
+
+	g, err := New(conf, func(msg *cot.CotMessage) { got = append(got, msg) })
+	require.NoError(t, err)
+
+	g.write = func(b []byte) error {
+		sent = append(sent, b)
+
+		return nil
+	}
+
+	g.active.Store(true)
+
+	return g, &sent, &got
+}
+
+func TestGateway(t *testing.T) {
+	g, sent, got := testGateway(t, &Config{Name: "sa", Scopes: []string{"blue"}, Types: []string{"a-", "b-t-f"}})
+
+	assert.Equal(t, "mesh:sa", g.GetName())
+	assert.True(t, g.GetDevice().CanSeeScope("blue"))
+
+	send := func(typ, uid, scope string) {
+		m, _ := cot.CotFromProto(cot.BasicMsg(typ, uid, time.Minute), "", scope)
+		require.NoError(t, g.SendMsg(m))
+	}
+
+	send("a-f-G-U-C", "uid1", "blue")
+	send("a-f-G-U-C", "uid2", "red")
+	send("b-m-p-s-m", "uid3", "blue")
+	send("t-x-c-t", "uid4", "blue")
+
+	require.Len(t, *sent, 1)
+
+	// own message comes back from the group
+	g.process((*sent)[0], nil)
+	assert.Empty(t, *got)
+
+	// message from mesh
+	b, err := Encode(cot.BasicMsg("a-f-G-U-C", "mesh1", time.Minute), ProtoV1)
+	require.NoError(t, err)
+
+	g.process(b, nil)
+	require.Len(t, *got, 1)
+	assert.Equal(t, "mesh:sa", (*got)[0].From)
+	assert.Equal(t, cot.BroadcastScope, (*got)[0].Scope)
+
+	received, out, looped := g.Stats()
+	assert.Equal(t, int64(1), received)
+	assert.Equal(t, int64(1), out)
+	assert.Equal(t, int64(1), looped)
+}
+
+func TestGatewayGroups(t *testing.T) {
+	g, sent, _ := testGateway(t, &Config{Name: "sa", Scopes: []string{"blue"}})
+
+	send := func(uid, scope string, groups ...string) {
+		m, _ := cot.CotFromProto(cot.BasicMsg("a-f-G-U-C", uid, time.Minute), "", scope)
+		m.Groups, m.HasGroups = groups, true
+		require.NoError(t, g.SendMsg(m))
+	}
+
+	send("uid1", "blue", "red")
+	send("uid2", "blue")
+	send("uid3", "red", "red", "blue")
+
+	require.Len(t, *sent, 1)
+
+	m, err := Decode((*sent)[0], "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "uid3", m.GetUID())
+}
+
+func TestGatewayInTypes(t *testing.T) {
+	g, _, got := testGateway(t, &Config{Name: "sa", Scope: "mesh", InTypes: []string{"a-f-"}})
+
+	for _, typ := range []string{"a-f-G-U-C", "a-h-G", "b-t-f"} {
+		b, err := Encode(cot.BasicMsg(typ, "uid_"+typ, time.Minute), ProtoXML)
+		require.NoError(t, err)
+		g.process(b, nil)
+	}
+
+	require.Len(t, *got, 1)
+	assert.Equal(t, "mesh", (*got)[0].Scope)
+}
+
+func TestConfig(t *testing.T) {
+	_, err := New(&Config{Name: "sa", Group: "10.0.0.1:6969"}, nil)
+	require.Error(t, err)
+
+	_, err = New(&Config{Name: "sa", Protocol: "json"}, nil)
+	require.Error(t, err)
+
+	g, err := New(&Config{Name: "sa"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultGroup, g.conf.Group)
+	assert.Equal(t, int32(1), g.GetVersion())
+}
@@ -0,0 +1,285 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+// Role maps provider role to admin flag and scopes. AdminRole is the role of admins, scope_admin if empty.
+type Role struct {
+	Role      string   `yaml:"role" json:"role" koanf:"role"`
+	Admin     bool     `yaml:"admin" json:"admin" koanf:"admin"`
+	AdminRole string   `yaml:"admin_role" json:"admin_role,omitempty" koanf:"admin_role"`
+	Scope     string   `yaml:"scope" json:"scope,omitempty" koanf:"scope"`
+	ReadScope []string `yaml:"read_scope" json:"read_scope,omitempty" koanf:"read_scope"`
+}
+
+type Config struct {
+	Issuer       string `yaml:"issuer" json:"issuer" koanf:"issuer"`
+	ClientID     string `yaml:"client_id" json:"client_id" koanf:"client_id"`
+	ClientSecret string `yaml:"client_secret" json:"-" koanf:"client_secret"`
+	// https://goatak.example.com/oidc/callback
+	RedirectURL string `yaml:"redirect_url" json:"redirect_url" koanf:"redirect_url"`
+	// where provider redirects after logout, empty - don't logout from provider
+	LogoutURL string   `yaml:"logout_url" json:"logout_url" koanf:"logout_url"`
+	Scopes    []string `yaml:"scopes" json:"scopes" koanf:"scopes"`
+	// claim with login, default is preferred_username
+	LoginClaim string `yaml:"login_claim" json:"login_claim" koanf:"login_claim"`
+	// claim with list of roles or groups, nested claims are separated by dot (realm_access.roles)
+	RolesClaim   string  `yaml:"roles_claim" json:"roles_claim" koanf:"roles_claim"`
+	Roles        []*Role `yaml:"roles" json:"roles" koanf:"roles"`
+	DefaultScope string  `yaml:"default_scope" json:"default_scope" koanf:"default_scope"`
+}
+
+// Identity is the user got from id token.
+type Identity struct {
+	Issuer    string
+	Subject   string
+	Login     string
+	Roles     []string
+	Admin     bool
+	AdminRole string
+	Scope     string
+	ReadScope []string
+}
+
+func (c *Config) Validate() error {
+	if c.Issuer == "" || c.ClientID == "" {
+		return fmt.Errorf("oidc issuer and client_id are required")
+	}
+
+	if c.RedirectURL == "" {
+		return fmt.Errorf("oidc redirect_url is required")
+	}
+
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+
+	if !slices.Contains(c.Scopes, oidc.ScopeOpenID) {
+		c.Scopes = append([]string{oidc.ScopeOpenID}, c.Scopes...)
+	}
+
+	if c.LoginClaim == "" {
+		c.LoginClaim = "preferred_username"
+	}
+
+	if c.RolesClaim == "" {
+		c.RolesClaim = "groups"
+	}
+
+	if c.DefaultScope == "" {
+		c.DefaultScope = "admin"
+	}
+
+	for _, r := range c.Roles {
+		if r.AdminRole == "" {
+			r.AdminRole = model.RoleScopeAdmin
+		}
+
+		if !model.IsValidRole(r.AdminRole) {
+			return fmt.Errorf("oidc role %s: invalid admin_role %s", r.Role, r.AdminRole)
+		}
+	}
+
+	return nil
+}
+
+// Provider makes authorization code flow with PKCE. Provider discovery is made on first use.
+type Provider struct {
+	logger     *slog.Logger
+	conf       *Config
+	mx         sync.Mutex
+	verifier   *oidc.IDTokenVerifier
+	oauth      *oauth2.Config
+	endSession string
+}
+
+func New(conf *Config) (*Provider, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		logger: slog.With("logger", "oidc"),
+		conf:   conf,
+	}, nil
+}
+
+func (p *Provider) init(ctx context.Context) (*oauth2.Config, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.oauth != nil {
+		return p.oauth, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.conf.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery error: %w", err)
+	}
+
+	var claims struct {
+		EndSession string `json:"end_session_endpoint"`
+	}
+
+	if err := provider.Claims(&claims); err != nil {
+		p.logger.Warn("bad provider metadata", slog.Any("error", err))
+	}
+
+	p.endSession = claims.EndSession
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.conf.ClientID})
+	p.oauth = &oauth2.Config{
+		ClientID:     p.conf.ClientID,
+		ClientSecret: p.conf.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.conf.RedirectURL,
+		Scopes:       p.conf.Scopes,
+	}
+
+	p.logger.Info("oidc provider " + p.conf.Issuer)
+
+	return p.oauth, nil
+}
+
+// AuthURL returns url to redirect user to. state, nonce and verifier must be kept till callback.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	conf, err := p.init(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return conf.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange gets tokens for code, verifies id token and maps its claims.
+func (p *Provider) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	conf, err := p.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange error: %w", err)
+	}
+
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in response")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("id_token verify error: %w", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("bad nonce")
+	}
+
+	claims := make(map[string]any)
+
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	id, err := p.conf.Identity(idToken.Subject, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	id.Issuer = idToken.Issuer
+
+	return id, nil
+}
+
+// LogoutURL returns provider end session url or empty string.
+func (p *Provider) LogoutURL() string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.endSession == "" || p.conf.LogoutURL == "" {
+		return ""
+	}
+
+	v := url.Values{}
+	v.Set("client_id", p.conf.ClientID)
+	v.Set("post_logout_redirect_uri", p.conf.LogoutURL)
+
+	return p.endSession + "?" + v.Encode()
+}
+
+// Identity maps token claims to login, admin flag and scopes.
+func (c *Config) Identity(subject string, claims map[string]any) (*Identity, error) {
+	login, _ := claim(claims, c.LoginClaim).(string)
+	if login == "" {
+		return nil, fmt.Errorf("no %s claim in token", c.LoginClaim)
+	}
+
+	id := &Identity{Subject: subject, Login: login}
+
+	switch v := claim(claims, c.RolesClaim).(type) {
+	case string:
+		id.Roles = []string{v}
+	case []any:
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				id.Roles = append(id.Roles, s)
+			}
+		}
+	}
+
+	for _, r := range c.Roles {
+		if !slices.Contains(id.Roles, r.Role) {
+			continue
+		}
+
+		if r.Admin {
+			id.Admin = true
+			id.AdminRole = model.HigherRole(id.AdminRole, r.AdminRole)
+		}
+
+		if id.Scope == "" {
+			id.Scope = r.Scope
+		}
+
+		for _, s := range r.ReadScope {
+			if !slices.Contains(id.ReadScope, s) {
+				id.ReadScope = append(id.ReadScope, s)
+			}
+		}
+	}
+
+	if id.Scope == "" {
+		id.Scope = c.DefaultScope
+	}
+
+	return id, nil
+}
+
+func claim(claims map[string]any, name string) any {
+	var v any = claims
+
+	for _, n := range strings.Split(name, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		v = m[n]
+	}
+
+	return v
+}
@@ -0,0 +1,223 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// mockProvider is a minimal local oidc provider.
+type mockProvider struct {
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	mx     sync.Mutex
+	codes  map[string]url.Values
+	claims map[string]any
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := &mockProvider{key: key, codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+
+	return m
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, _ *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                m.srv.URL,
+		"authorization_endpoint":                m.srv.URL + "/auth",
+		"token_endpoint":                        m.srv.URL + "/token",
+		"jwks_uri":                              m.srv.URL + "/jwks",
+		"end_session_endpoint":                  m.srv.URL + "/logout",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, _ *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": "k1",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize emulates user login, it returns code for the auth url.
+func (m *mockProvider) authorize(t *testing.T, authURL string) (string, string) {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	code := oauth2.GenerateVerifier()
+	m.codes[code] = u.Query()
+
+	return code, u.Query().Get("state")
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+
+	m.mx.Lock()
+	q, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mx.Unlock()
+
+	if !ok {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+
+		return
+	}
+
+	// PKCE check
+	h := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if q.Get("code_challenge_method") != "S256" || base64.RawURLEncoding.EncodeToString(h[:]) != q.Get("code_challenge") {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   m.srv.URL,
+		"aud":   q.Get("client_id"),
+		"sub":   "user-1",
+		"nonce": q.Get("nonce"),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = "k1"
+
+	idToken, err := tok.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "at",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func testConfig(issuer string) *Config {
+	return &Config{
+		Issuer:      issuer,
+		ClientID:    "goatak",
+		RedirectURL: "http://localhost/oidc/callback",
+		LogoutURL:   "http://localhost/",
+		RolesClaim:  "realm_access.roles",
+		Roles: []*Role{
+			{Role: "viewer", ReadScope: []string{"public"}},
+			{Role: "tak-admin", Admin: true, Scope: "ops", ReadScope: []string{"blue"}},
+			{Role: "tak-operator", Admin: true, AdminRole: "operator"},
+		},
+	}
+}
+
+func TestFlow(t *testing.T) {
+	m := newMockProvider(t)
+	m.claims = map[string]any{
+		"preferred_username": "john",
+		"realm_access":       map[string]any{"roles": []string{"viewer", "tak-admin"}},
+	}
+
+	p, err := New(testConfig(m.srv.URL))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := p.AuthURL(ctx, "state1", "nonce1", verifier)
+	require.NoError(t, err)
+
+	code, state := m.authorize(t, authURL)
+	assert.Equal(t, "state1", state)
+
+	id, err := p.Exchange(ctx, code, "nonce1", verifier)
+	require.NoError(t, err)
+
+	assert.Equal(t, "john", id.Login)
+	assert.Equal(t, "user-1", id.Subject)
+	assert.True(t, id.Admin)
+	assert.Equal(t, "scope_admin", id.AdminRole)
+	assert.Equal(t, "ops", id.Scope)
+	assert.Equal(t, []string{"public", "blue"}, id.ReadScope)
+
+	assert.Contains(t, p.LogoutURL(), m.srv.URL+"/logout?")
+
+	// bad verifier
+	code, _ = m.authorize(t, authURL)
+	_, err = p.Exchange(ctx, code, "nonce1", oauth2.GenerateVerifier())
+	require.Error(t, err)
+
+	// bad nonce
+	code, _ = m.authorize(t, authURL)
+	_, err = p.Exchange(ctx, code, "nonce2", verifier)
+	require.Error(t, err)
+}
+
+func TestIdentity(t *testing.T) {
+	c := testConfig("http://localhost")
+	require.NoError(t, c.Validate())
+
+	id, err := c.Identity("s", map[string]any{"preferred_username": "bob", "realm_access": map[string]any{"roles": []any{"viewer"}}})
+	require.NoError(t, err)
+	assert.False(t, id.Admin)
+	assert.Equal(t, "admin", id.Scope)
+	assert.Equal(t, []string{"public"}, id.ReadScope)
+
+	id, err = c.Identity("s", map[string]any{"preferred_username": "bob", "realm_access": map[string]any{"roles": []any{"tak-operator"}}})
+	require.NoError(t, err)
+	assert.True(t, id.Admin)
+	assert.Equal(t, "operator", id.AdminRole)
+
+	id, err = c.Identity("s", map[string]any{"preferred_username": "bob", "realm_access": map[string]any{"roles": []any{"tak-operator", "tak-admin"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "scope_admin", id.AdminRole)
+
+	_, err = c.Identity("s", map[string]any{"name": "bob"})
+	require.Error(t, err)
+
+	c.Roles[0].AdminRole = "root"
+	require.Error(t, c.Validate())
+}
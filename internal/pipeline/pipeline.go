@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"hash/fnv"
+	"runtime"
+	"sync"
+)
+
+const DefaultQueueSize = 128
+
+// Pipeline processes items with a pool of workers. Items with the same key always go
+// to the same worker, so they are processed in order they were pushed.
+type Pipeline[T any] struct {
+	mx      sync.RWMutex
+	shards  []chan T
+	keyFn   func(T) string
+	handler func(T)
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// New creates pipeline with the given number of workers (0 - number of CPUs) and queue size per worker.
+func New[T any](workers, queueSize int, keyFn func(T) string, handler func(T)) *Pipeline[T] {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	p := &Pipeline[T]{
+		shards:  make([]chan T, workers),
+		keyFn:   keyFn,
+		handler: handler,
+	}
+
+	for i := range p.shards {
+		p.shards[i] = make(chan T, queueSize)
+	}
+
+	return p
+}
+
+func (p *Pipeline[T]) Start() {
+	for _, ch := range p.shards {
+		p.wg.Add(1)
+
+		go p.worker(ch)
+	}
+}
+
+func (p *Pipeline[T]) worker(ch chan T) {
+	defer p.wg.Done()
+
+	for item := range ch {
+		p.handler(item)
+	}
+}
+
+// Push adds item to the queue of its shard. Returns false if the queue is full or pipeline is stopped.
+func (p *Pipeline[T]) Push(item T) bool {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.shards[p.shard(p.keyFn(item))] <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pipeline[T]) shard(key string) int {
+	if len(p.shards) == 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+// Len returns number of queued items.
+func (p *Pipeline[T]) Len() int {
+	var n int
+
+	for _, ch := range p.shards {
+		n += len(ch)
+	}
+
+	return n
+}
+
+func (p *Pipeline[T]) Workers() int {
+	return len(p.shards)
+}
+
+// Stop closes queues and waits for all queued items to be processed.
+func (p *Pipeline[T]) Stop() {
+	p.mx.Lock()
+
+	if p.closed {
+		p.mx.Unlock()
+
+		return
+	}
+
+	p.closed = true
+
+	for _, ch := range p.shards {
+		close(ch)
+	}
+
+	p.mx.Unlock()
+	p.wg.Wait()
+}
+
+// Parallel calls f for every item using up to workers goroutines.
+// Items are split into chunks of at least minChunk items, small slices are processed in place.
+func Parallel[T any](items []T, workers, minChunk int, f func(T)) {
+	minChunk = max(minChunk, 1)
+	n := min(workers, (len(items)+minChunk-1)/minChunk)
+
+	if n <= 1 {
+		for _, item := range items {
+			f(item)
+		}
+
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	chunk := (len(items) + n - 1) / n
+
+	for start := 0; start < len(items); start += chunk {
+		wg.Add(1)
+
+		go func(part []T) {
+			defer wg.Done()
+
+			for _, item := range part {
+				f(item)
+			}
+		}(items[start:min(start+chunk, len(items))])
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	key string
+	n   int
+}
+
+func TestOrder(t *testing.T) {
+	var mx sync.Mutex
+
+	res := make(map[string][]int)
+
+	p := New(4, 1000, func(i item) string { return i.key }, func(i item) {
+		mx.Lock()
+		res[i.key] = append(res[i.key], i.n)
+		mx.Unlock()
+	})
+
+	p.Start()
+
+	for n := range 100 {
+		for k := range 5 {
+			require.True(t, p.Push(item{key: fmt.Sprintf("key%d", k), n: n}))
+		}
+	}
+
+	p.Stop()
+
+	require.Len(t, res, 5)
+
+	for k, v := range res {
+		require.Len(t, v, 100, k)
+
+		for n := range 100 {
+			assert.Equal(t, n, v[n])
+		}
+	}
+
+	assert.False(t, p.Push(item{key: "key1"}))
+}
+
+func TestFull(t *testing.T) {
+	block := make(chan struct{})
+
+	p := New(1, 1, func(i item) string { return i.key }, func(item) { <-block })
+	p.Start()
+
+	require.True(t, p.Push(item{key: "a"}))
+
+	var dropped int
+
+	for range 3 {
+		if !p.Push(item{key: "a"}) {
+			dropped++
+		}
+	}
+
+	assert.GreaterOrEqual(t, dropped, 2)
+
+	close(block)
+	p.Stop()
+	assert.Equal(t, 0, p.Len())
+}
+
+func TestParallel(t *testing.T) {
+	for _, size := range []int{0, 1, 5, 100, 1001} {
+		items := make([]int, size)
+		for i := range items {
+			items[i] = i
+		}
+
+		var sum atomic.Int64
+
+		Parallel(items, 8, 10, func(i int) { sum.Add(int64(i)) })
+
+		assert.Equal(t, int64(size*(size-1)/2), sum.Load(), size)
+	}
+}
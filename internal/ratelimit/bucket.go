@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bucket is a token bucket, it is refilled with rate tokens per second up to burst.
+type Bucket struct {
+	mx     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// removed is set when bucket is removed from manager after idle time
+	removed atomic.Bool
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	b := max(float64(burst), 1)
+
+	return &Bucket{
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+		last:   time.Now(),
+	}
+}
+
+func (b *Bucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Allow takes a token if there is one.
+func (b *Bucket) Allow() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.refill(time.Now())
+
+	if b.tokens >= 1 {
+		b.tokens--
+
+		return true
+	}
+
+	return false
+}
+
+// idle returns time since the last token was taken.
+func (b *Bucket) idle(now time.Time) time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	return now.Sub(b.last)
+}
+
+// allowAll takes a token from every bucket only if all of them have one, nil buckets are skipped.
+func allowAll(buckets ...*Bucket) bool {
+	now := time.Now()
+
+	for _, b := range buckets {
+		if b != nil {
+			b.mx.Lock()
+			defer b.mx.Unlock()
+
+			b.refill(now)
+
+			if b.tokens < 1 {
+				return false
+			}
+		}
+	}
+
+	for _, b := range buckets {
+		if b != nil {
+			b.tokens--
+		}
+	}
+
+	return true
+}
+
+// Reserve takes a token and returns time to wait before it is available.
+func (b *Bucket) Reserve() time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.refill(time.Now())
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
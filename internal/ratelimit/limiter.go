@@ -0,0 +1,385 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ActionDrop     = "drop"
+	ActionThrottle = "throttle"
+	ActionBan      = "ban"
+)
+
+const (
+	// login bucket is removed after this time without messages
+	loginTTL        = time.Minute * 10
+	cleanupInterval = time.Minute
+)
+
+var ErrBanned = errors.New("rate limit exceeded, banned")
+
+type Limit struct {
+	// messages per second for connection, 0 - no limit
+	Rate  float64 `yaml:"rate" json:"rate" koanf:"rate"`
+	Burst int     `yaml:"burst" json:"burst" koanf:"burst"`
+	// messages per second for all connections of one login, 0 - no limit
+	LoginRate  float64 `yaml:"login_rate" json:"login_rate" koanf:"login_rate"`
+	LoginBurst int     `yaml:"login_burst" json:"login_burst" koanf:"login_burst"`
+	Action     string  `yaml:"action" json:"action" koanf:"action"`
+}
+
+type Config struct {
+	Default *Limit            `yaml:"default" json:"default" koanf:"default"`
+	Scopes  map[string]*Limit `yaml:"scopes" json:"scopes" koanf:"scopes"`
+	// ban time in seconds
+	BanTime int `yaml:"ban_time" json:"ban_time" koanf:"ban_time"`
+}
+
+type Ban struct {
+	Key    string    `json:"key"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+	Till   time.Time `json:"till"`
+}
+
+type Manager struct {
+	logger  *slog.Logger
+	conf    *Config
+	mx      sync.Mutex
+	logins  map[string]*Bucket
+	bans    map[string]*Ban
+	banTime time.Duration
+	stopCh  chan struct{}
+}
+
+func NewManager(conf *Config) (*Manager, error) {
+	if conf == nil {
+		conf = new(Config)
+	}
+
+	for name, l := range conf.Scopes {
+		if err := l.validate(); err != nil {
+			return nil, fmt.Errorf("scope %s: %w", name, err)
+		}
+	}
+
+	if err := conf.Default.validate(); err != nil {
+		return nil, err
+	}
+
+	banTime := time.Second * time.Duration(conf.BanTime)
+	if banTime <= 0 {
+		banTime = time.Minute * 10
+	}
+
+	return &Manager{
+		logger:  slog.With("logger", "ratelimit"),
+		conf:    conf,
+		logins:  make(map[string]*Bucket),
+		bans:    make(map[string]*Ban),
+		banTime: banTime,
+		stopCh:  make(chan struct{}),
+	}, nil
+}
+
+// Start runs removal of idle login buckets and expired bans.
+func (m *Manager) Start() {
+	if m == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.cleanup(time.Now())
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (m *Manager) Stop() {
+	if m == nil {
+		return
+	}
+
+	close(m.stopCh)
+}
+
+func (m *Manager) cleanup(now time.Time) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for login, b := range m.logins {
+		if b.idle(now) > loginTTL {
+			b.removed.Store(true)
+			delete(m.logins, login)
+		}
+	}
+
+	for k, b := range m.bans {
+		if now.After(b.Till) {
+			delete(m.bans, k)
+		}
+	}
+}
+
+func (l *Limit) validate() error {
+	if l == nil {
+		return nil
+	}
+
+	if l.Action == "" {
+		l.Action = ActionDrop
+	}
+
+	if !slices.Contains([]string{ActionDrop, ActionThrottle, ActionBan}, l.Action) {
+		return fmt.Errorf("invalid action %s", l.Action)
+	}
+
+	if l.Rate < 0 || l.LoginRate < 0 {
+		return fmt.Errorf("invalid rate")
+	}
+
+	return nil
+}
+
+func (m *Manager) limitFor(scope string) *Limit {
+	if l, ok := m.conf.Scopes[scope]; ok {
+		return l
+	}
+
+	return m.conf.Default
+}
+
+// NewConn returns limiter for the connection or nil if there are no limits for scope.
+// keys are used to ban the connection source (ip, cert serial).
+func (m *Manager) NewConn(login, scope string, keys ...string) *ConnLimiter {
+	if m == nil {
+		return nil
+	}
+
+	lim := m.limitFor(scope)
+
+	if lim == nil || (lim.Rate == 0 && lim.LoginRate == 0) {
+		return nil
+	}
+
+	c := &ConnLimiter{
+		m:      m,
+		lim:    lim,
+		action: lim.Action,
+		login:  login,
+		keys:   keys,
+	}
+
+	if lim.Rate > 0 {
+		c.bucket = NewBucket(lim.Rate, lim.Burst)
+	}
+
+	if lim.LoginRate > 0 && login != "" {
+		c.loginBucket = m.loginBucket(login, lim)
+	}
+
+	return c
+}
+
+func (m *Manager) loginBucket(login string, lim *Limit) *Bucket {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if b, ok := m.logins[login]; ok {
+		return b
+	}
+
+	b := NewBucket(lim.LoginRate, lim.LoginBurst)
+	m.logins[login] = b
+
+	return b
+}
+
+func (m *Manager) Ban(reason string, keys ...string) {
+	if m == nil {
+		return
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	now := time.Now()
+
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+
+		m.logger.Warn(fmt.Sprintf("ban %s for %s: %s", k, m.banTime, reason))
+		m.bans[k] = &Ban{Key: k, Reason: reason, Since: now, Till: now.Add(m.banTime)}
+	}
+}
+
+// IsBanned checks if any of keys is banned.
+func (m *Manager) IsBanned(keys ...string) bool {
+	if m == nil {
+		return false
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	now := time.Now()
+
+	for _, k := range keys {
+		if b, ok := m.bans[k]; ok {
+			if now.Before(b.Till) {
+				return true
+			}
+
+			delete(m.bans, k)
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) Bans() []*Ban {
+	res := make([]*Ban, 0)
+
+	if m == nil {
+		return res
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	now := time.Now()
+
+	for k, b := range m.bans {
+		if now.After(b.Till) {
+			delete(m.bans, k)
+
+			continue
+		}
+
+		res = append(res, b)
+	}
+
+	slices.SortFunc(res, func(a, b *Ban) int { return strings.Compare(a.Key, b.Key) })
+
+	return res
+}
+
+// Unban removes ban by key.
+func (m *Manager) Unban(key string) bool {
+	if m == nil {
+		return false
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if _, ok := m.bans[key]; ok {
+		delete(m.bans, key)
+
+		return true
+	}
+
+	return false
+}
+
+// UnbanAll removes all bans.
+func (m *Manager) UnbanAll() {
+	if m == nil {
+		return
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	clear(m.bans)
+}
+
+func IPKey(ip string) string {
+	if ip == "" {
+		return ""
+	}
+
+	return "ip:" + ip
+}
+
+func CertKey(sn string) string {
+	if sn == "" {
+		return ""
+	}
+
+	return "cert:" + sn
+}
+
+// ConnLimiter checks message rate for one connection.
+type ConnLimiter struct {
+	m           *Manager
+	lim         *Limit
+	action      string
+	login       string
+	keys        []string
+	bucket      *Bucket
+	loginBucket *Bucket
+}
+
+// Take is called for every message got from connection.
+// Returns false if message must be dropped, error if connection must be closed.
+func (c *ConnLimiter) Take(ctx context.Context) (bool, error) {
+	if c == nil {
+		return true, nil
+	}
+
+	// bucket was removed after idle time, all connections of login must share the new one
+	if c.loginBucket != nil && c.loginBucket.removed.Load() {
+		c.loginBucket = c.m.loginBucket(c.login, c.lim)
+	}
+
+	switch c.action {
+	case ActionThrottle:
+		var d time.Duration
+
+		for _, b := range []*Bucket{c.bucket, c.loginBucket} {
+			if b != nil {
+				d = max(d, b.Reserve())
+			}
+		}
+
+		if d > 0 {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+		}
+
+		return true, nil
+	default:
+		if allowAll(c.bucket, c.loginBucket) {
+			return true, nil
+		}
+
+		if c.action == ActionBan {
+			c.m.Ban("rate limit exceeded by "+c.login, c.keys...)
+
+			return false, ErrBanned
+		}
+
+		return false, nil
+	}
+}
@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucket(t *testing.T) {
+	b := NewBucket(1, 3)
+
+	for range 3 {
+		assert.True(t, b.Allow())
+	}
+
+	assert.False(t, b.Allow())
+
+	d := b.Reserve()
+	assert.Greater(t, d, time.Duration(0))
+	assert.LessOrEqual(t, d, time.Second)
+}
+
+func TestNoLimits(t *testing.T) {
+	m, err := NewManager(nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, m.NewConn("user", "scope", IPKey("1.2.3.4")))
+
+	var c *ConnLimiter
+	ok, err := c.Take(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestDrop(t *testing.T) {
+	m, err := NewManager(&Config{Default: &Limit{Rate: 1, Burst: 2}})
+	require.NoError(t, err)
+
+	c := m.NewConn("user", "", IPKey("1.2.3.4"))
+	require.NotNil(t, c)
+
+	for range 2 {
+		ok, err := c.Take(context.Background())
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	ok, err := c.Take(context.Background())
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, m.IsBanned(IPKey("1.2.3.4")))
+}
+
+func TestLoginLimit(t *testing.T) {
+	m, err := NewManager(&Config{Default: &Limit{LoginRate: 1, LoginBurst: 2}})
+	require.NoError(t, err)
+
+	c1 := m.NewConn("user", "")
+	c2 := m.NewConn("user", "")
+	c3 := m.NewConn("user2", "")
+
+	for _, c := range []*ConnLimiter{c1, c2} {
+		ok, _ := c.Take(context.Background())
+		assert.True(t, ok)
+	}
+
+	ok, _ := c1.Take(context.Background())
+	assert.False(t, ok)
+
+	ok, _ = c3.Take(context.Background())
+	assert.True(t, ok)
+}
+
+func TestBan(t *testing.T) {
+	m, err := NewManager(&Config{
+		Scopes: map[string]*Limit{"guest": {Rate: 1, Burst: 1, Action: ActionBan}},
+	})
+	require.NoError(t, err)
+
+	assert.Nil(t, m.NewConn("user", "blue"))
+
+	c := m.NewConn("user", "guest", IPKey("1.2.3.4"), CertKey("123"), "")
+	require.NotNil(t, c)
+
+	ok, err := c.Take(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = c.Take(context.Background())
+	require.ErrorIs(t, err, ErrBanned)
+
+	assert.True(t, m.IsBanned(IPKey("1.2.3.4")))
+	assert.True(t, m.IsBanned(IPKey("5.6.7.8"), CertKey("123")))
+	assert.Len(t, m.Bans(), 2)
+
+	assert.True(t, m.Unban(IPKey("1.2.3.4")))
+	assert.False(t, m.Unban(IPKey("1.2.3.4")))
+	assert.False(t, m.IsBanned(IPKey("1.2.3.4")))
+
+	assert.False(t, m.Unban(""))
+	assert.Len(t, m.Bans(), 1)
+
+	m.UnbanAll()
+	assert.Empty(t, m.Bans())
+}
+
+func TestConnTokenNotTaken(t *testing.T) {
+	m, err := NewManager(&Config{Default: &Limit{Rate: 1, Burst: 2, LoginRate: 1, LoginBurst: 1}})
+	require.NoError(t, err)
+
+	c1 := m.NewConn("user", "", IPKey("1.2.3.4"))
+	c2 := m.NewConn("user", "", IPKey("1.2.3.5"))
+
+	ok, _ := c1.Take(context.Background())
+	assert.True(t, ok)
+
+	// login bucket is empty, connection token must not be taken
+	ok, _ = c2.Take(context.Background())
+	assert.False(t, ok)
+	assert.InDelta(t, 2, c2.bucket.tokens, 0.1)
+}
+
+func TestCleanup(t *testing.T) {
+	m, err := NewManager(&Config{Default: &Limit{LoginRate: 1, LoginBurst: 1}, BanTime: 1})
+	require.NoError(t, err)
+
+	c := m.NewConn("user", "", IPKey("1.2.3.4"))
+	old := c.loginBucket
+
+	for i := range 100 {
+		m.NewConn(fmt.Sprintf("user%d", i), "")
+	}
+
+	m.Ban("test", IPKey("1.2.3.4"))
+	require.Len(t, m.logins, 101)
+
+	m.cleanup(time.Now().Add(loginTTL + time.Second))
+	assert.Empty(t, m.logins)
+	assert.Empty(t, m.bans)
+
+	// connection gets the new bucket shared with new connections
+	ok, _ := c.Take(context.Background())
+	assert.True(t, ok)
+	assert.NotSame(t, old, c.loginBucket)
+	assert.Same(t, c.loginBucket, m.NewConn("user", "").loginBucket)
+}
+
+func TestThrottle(t *testing.T) {
+	m, err := NewManager(&Config{Default: &Limit{Rate: 20, Burst: 1, Action: ActionThrottle}})
+	require.NoError(t, err)
+
+	c := m.NewConn("", "")
+
+	ok, err := c.Take(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	start := time.Now()
+	ok, err = c.Take(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*30)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c.Take(ctx)
+	_, err = c.Take(ctx)
+	require.Error(t, err)
+}
+
+func TestInvalidAction(t *testing.T) {
+	_, err := NewManager(&Config{Default: &Limit{Rate: 1, Action: "foo"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+var _ ItemsRepository = &ItemsDbRepo{}
+
+// ItemsDbRepo keeps items in memory and writes changes to database in background batches.
+type ItemsDbRepo struct {
+	*ItemsMemoryRepo
+	logger      *slog.Logger
+	dbm         *database.DatabaseManager
+	trackPoints int
+	interval    time.Duration
+	batchSize   int
+
+	mx      sync.Mutex
+	changed map[string]*model.Item
+	removed map[string]bool
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+func NewItemsDbRepo(dbm *database.DatabaseManager, trackPoints int, interval time.Duration, tm ...time.Duration) *ItemsDbRepo {
+	if interval <= 0 {
+		interval = time.Second * 5
+	}
+
+	return &ItemsDbRepo{
+		ItemsMemoryRepo: NewItemsMemoryRepo(tm...),
+		logger:          slog.With(slog.String("logger", "items_repo")),
+		dbm:             dbm,
+		trackPoints:     trackPoints,
+		interval:        interval,
+		batchSize:       500,
+		changed:         make(map[string]*model.Item),
+		removed:         make(map[string]bool),
+		flushCh:         make(chan struct{}, 1),
+		stopCh:          make(chan struct{}),
+		doneCh:          make(chan struct{}),
+	}
+}
+
+func (r *ItemsDbRepo) Start() error {
+	if err := r.load(); err != nil {
+		return err
+	}
+
+	r.changeCb.SubscribeNamed("db", r.onChange)
+	r.deleteCb.SubscribeNamed("db", r.onDelete)
+
+	go r.writer()
+
+	return r.ItemsMemoryRepo.Start()
+}
+
+func (r *ItemsDbRepo) Stop() {
+	r.changeCb.Unsubscribe("db")
+	r.deleteCb.Unsubscribe("db")
+
+	close(r.stopCh)
+	<-r.doneCh
+}
+
+func (r *ItemsDbRepo) load() error {
+	n := 0
+
+	for _, rec := range r.dbm.ItemQuery().Get() {
+		item, err := model.FromRecord(rec)
+		if err != nil {
+			r.logger.Warn("bad item "+rec.UID, slog.Any("error", err))
+
+			continue
+		}
+
+		if item.IsOld() {
+			r.removed[rec.UID] = true
+
+			continue
+		}
+
+		r.items.Store(item.GetUID(), item)
+		n++
+	}
+
+	r.logger.Info(fmt.Sprintf("loaded %d items", n))
+
+	return nil
+}
+
+func (r *ItemsDbRepo) onChange(item *model.Item) bool {
+	if item == nil {
+		return true
+	}
+
+	uid := item.GetUID()
+
+	// callbacks are async, item can be already removed
+	if r.Get(uid) == nil {
+		return true
+	}
+
+	r.mx.Lock()
+	r.changed[uid] = item
+	delete(r.removed, uid)
+	n := len(r.changed)
+	r.mx.Unlock()
+
+	if n >= r.batchSize {
+		r.kick()
+	}
+
+	return true
+}
+
+func (r *ItemsDbRepo) onDelete(uid string) bool {
+	r.mx.Lock()
+	delete(r.changed, uid)
+	r.removed[uid] = true
+	r.mx.Unlock()
+
+	return true
+}
+
+func (r *ItemsDbRepo) kick() {
+	select {
+	case r.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+func (r *ItemsDbRepo) writer() {
+	defer close(r.doneCh)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-r.flushCh:
+			r.flush()
+		case <-r.stopCh:
+			r.flush()
+
+			return
+		}
+	}
+}
+
+func (r *ItemsDbRepo) flush() {
+	r.mx.Lock()
+	changed, removed := r.changed, r.removed
+	r.changed = make(map[string]*model.Item)
+	r.removed = make(map[string]bool)
+	r.mx.Unlock()
+
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+
+	records := make([]*model.ItemRecord, 0, len(changed))
+
+	for _, item := range changed {
+		rec, err := item.Record(r.trackPoints)
+		if err != nil {
+			r.logger.Warn("can't save item "+item.GetUID(), slog.Any("error", err))
+
+			continue
+		}
+
+		records = append(records, rec)
+	}
+
+	uids := make([]string, 0, len(removed))
+
+	for uid := range removed {
+		uids = append(uids, uid)
+	}
+
+	if err := r.dbm.SaveItems(records, uids); err != nil {
+		r.logger.Error("items save error", slog.Any("error", err))
+
+		// return unsaved items back to queue
+		r.mx.Lock()
+		for uid, item := range changed {
+			if _, ok := r.changed[uid]; !ok && !r.removed[uid] {
+				r.changed[uid] = item
+			}
+		}
+
+		for uid := range removed {
+			if _, ok := r.changed[uid]; !ok {
+				r.removed[uid] = true
+			}
+		}
+		r.mx.Unlock()
+
+		return
+	}
+
+	r.logger.Debug(fmt.Sprintf("saved %d items, removed %d", len(records), len(uids)))
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func getTestDbm() *database.DatabaseManager {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&model.ItemRecord{})
+
+	return database.New(db)
+}
+
+func makeItem(uid string, lat, lon float64) *model.Item {
+	m := cot.BasicMsg("a-f-G", uid, time.Hour)
+	m.CotEvent.Lat = lat
+	m.CotEvent.Lon = lon
+
+	msg, _ := cot.CotFromProto(m, "", "test")
+
+	return model.FromMsg(msg)
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	t.Helper()
+
+	for range 100 {
+		if f() {
+			return
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatal("timeout")
+}
+
+func TestItemsDbRepo(t *testing.T) {
+	dbm := getTestDbm()
+
+	r := NewItemsDbRepo(dbm, 2, time.Millisecond*20)
+	require.NoError(t, r.Start())
+
+	item := makeItem("u1", 10, 20)
+	r.Store(item)
+
+	for i := range 3 {
+		m := cot.BasicMsg("a-f-G", "u1", time.Hour)
+		m.CotEvent.Lat = 11 + float64(i)
+		m.CotEvent.Lon = 20
+		msg, _ := cot.CotFromProto(m, "", "test")
+		item.Update(msg)
+	}
+
+	item.SetOffline()
+	r.Store(item)
+	r.Store(makeItem("u2", 1, 2))
+
+	waitFor(t, func() bool { return dbm.ItemQuery().Count() == 2 })
+
+	r.Remove("u2")
+	waitFor(t, func() bool { return dbm.ItemQuery().Count() == 1 })
+
+	r.Stop()
+
+	r2 := NewItemsDbRepo(dbm, 2, time.Second)
+	require.NoError(t, r2.Start())
+
+	defer r2.Stop()
+
+	i := r2.Get("u1")
+	require.NotNil(t, i)
+	require.Nil(t, r2.Get("u2"))
+
+	require.Equal(t, "test", i.GetScope())
+	require.Equal(t, model.UNIT, i.GetClass())
+	require.False(t, i.IsOnline())
+	require.WithinDuration(t, item.GetLastSeen(), i.GetLastSeen(), time.Millisecond)
+
+	lat, _ := i.GetLanLon()
+	require.Equal(t, 13., lat)
+
+	require.Len(t, i.GetTrack(), 2)
+	require.Equal(t, 12., i.GetTrack()[0].Lat)
+}
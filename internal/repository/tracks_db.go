@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kdudkov/goatak/internal/database"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+const tracksCleanupInterval = time.Hour
+
+// TrackHistory writes positions of units and contacts to database in background batches
+// and removes positions older than retention time.
+type TrackHistory struct {
+	logger         *slog.Logger
+	dbm            *database.DatabaseManager
+	interval       time.Duration
+	retention      time.Duration
+	scopeRetention map[string]time.Duration
+	batchSize      int
+	maxQueue       int
+
+	mx      sync.Mutex
+	queue   []*model.PositionRecord
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// NewTrackHistory creates track history, retention 0 means positions are kept forever.
+// scopeRetention overrides retention for listed scopes.
+func NewTrackHistory(dbm *database.DatabaseManager, interval, retention time.Duration, scopeRetention map[string]time.Duration) *TrackHistory {
+	if interval <= 0 {
+		interval = time.Second * 5
+	}
+
+	return &TrackHistory{
+		logger:         slog.With(slog.String("logger", "tracks")),
+		dbm:            dbm,
+		interval:       interval,
+		retention:      retention,
+		scopeRetention: scopeRetention,
+		batchSize:      500,
+		maxQueue:       100000,
+		flushCh:        make(chan struct{}, 1),
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+}
+
+func (h *TrackHistory) Start() error {
+	go h.writer()
+
+	return nil
+}
+
+func (h *TrackHistory) Stop() {
+	close(h.stopCh)
+	<-h.doneCh
+}
+
+func (h *TrackHistory) Add(rec *model.PositionRecord) {
+	if rec == nil {
+		return
+	}
+
+	h.mx.Lock()
+	h.queue = append(h.queue, rec)
+	n := len(h.queue)
+	h.mx.Unlock()
+
+	if n >= h.batchSize {
+		select {
+		case h.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *TrackHistory) writer() {
+	defer close(h.doneCh)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	cleanup := time.NewTicker(tracksCleanupInterval)
+	defer cleanup.Stop()
+
+	h.Cleanup()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.flush()
+		case <-h.flushCh:
+			h.flush()
+		case <-cleanup.C:
+			h.Cleanup()
+		case <-h.stopCh:
+			h.flush()
+
+			return
+		}
+	}
+}
+
+func (h *TrackHistory) flush() {
+	h.mx.Lock()
+	queue := h.queue
+	h.queue = nil
+	h.mx.Unlock()
+
+	if len(queue) == 0 {
+		return
+	}
+
+	if err := h.dbm.SavePositions(queue); err != nil {
+		h.logger.Error("positions save error", slog.Any("error", err))
+
+		// return unsaved positions back to queue, the oldest ones are dropped when queue is full
+		h.mx.Lock()
+		h.queue = append(queue, h.queue...)
+
+		if n := len(h.queue) - h.maxQueue; n > 0 {
+			h.queue = h.queue[n:]
+			h.logger.Warn(fmt.Sprintf("dropped %d unsaved positions", n))
+		}
+		h.mx.Unlock()
+
+		return
+	}
+
+	h.logger.Debug(fmt.Sprintf("saved %d positions", len(queue)))
+}
+
+// Cleanup removes positions older than retention time.
+func (h *TrackHistory) Cleanup() {
+	now := time.Now()
+	scopes := make([]string, 0, len(h.scopeRetention))
+
+	for scope, d := range h.scopeRetention {
+		scopes = append(scopes, scope)
+
+		if d > 0 {
+			h.delete(h.dbm.PositionQuery().Scope(scope).To(now.Add(-d)))
+		}
+	}
+
+	if h.retention > 0 {
+		h.delete(h.dbm.PositionQuery().NotScope(scopes...).To(now.Add(-h.retention)))
+	}
+}
+
+func (h *TrackHistory) delete(q *database.PositionQuery) {
+	n, err := q.Delete()
+	if err != nil {
+		h.logger.Error("positions cleanup error", slog.Any("error", err))
+
+		return
+	}
+
+	if n > 0 {
+		h.logger.Info(fmt.Sprintf("removed %d old positions", n))
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+func TestTrackHistory(t *testing.T) {
+	dbm := getTestDbm()
+	require.NoError(t, dbm.Migrate())
+
+	h := NewTrackHistory(dbm, time.Millisecond*20, 0, nil)
+	require.NoError(t, h.Start())
+
+	t0 := time.Now().Add(-time.Minute)
+
+	for i := range 5 {
+		h.Add(&model.PositionRecord{UID: "u1", Callsign: "c1", Scope: "blue", Time: t0.Add(time.Second * time.Duration(i)), Lat: float64(i), Lon: 10})
+	}
+
+	h.Add(nil)
+
+	waitFor(t, func() bool { return dbm.PositionQuery().Count() == 5 })
+
+	h.Add(&model.PositionRecord{UID: "u2", Callsign: "c2", Scope: "red", Time: t0, Lat: 20, Lon: 20})
+	h.Stop()
+
+	assert.Equal(t, int64(6), dbm.PositionQuery().Count())
+	assert.Len(t, dbm.PositionQuery().UID("u1").From(t0.Add(time.Second)).To(t0.Add(time.Second*3)).Get(), 3)
+	assert.Len(t, dbm.PositionQuery().BBox(1.5, 9, 3.5, 11).Get(), 2)
+	assert.Len(t, dbm.PositionQuery().Scope("red").Get(), 1)
+	assert.Equal(t, []string{"u2"}, dbm.PositionQuery().Callsign("c2").UIDs())
+}
+
+func TestTrackHistoryQueueLimit(t *testing.T) {
+	// no positions table, so every save fails
+	h := NewTrackHistory(getTestDbm(), time.Second, 0, nil)
+	h.maxQueue = 3
+
+	for i := range 5 {
+		h.Add(&model.PositionRecord{UID: "u1", Lat: float64(i)})
+	}
+
+	h.flush()
+
+	require.Len(t, h.queue, 3)
+	assert.Equal(t, 2.0, h.queue[0].Lat)
+	assert.Equal(t, 4.0, h.queue[2].Lat)
+}
+
+func TestTrackHistoryRetention(t *testing.T) {
+	dbm := getTestDbm()
+	require.NoError(t, dbm.Migrate())
+
+	now := time.Now()
+
+	for _, scope := range []string{"blue", "red", "green"} {
+		require.NoError(t, dbm.SavePositions([]*model.PositionRecord{
+			{UID: scope + "1", Scope: scope, Time: now.Add(-time.Hour * 24 * 10), Lat: 1, Lon: 1},
+			{UID: scope + "1", Scope: scope, Time: now.Add(-time.Hour * 24 * 3), Lat: 1, Lon: 1},
+			{UID: scope + "1", Scope: scope, Time: now, Lat: 1, Lon: 1},
+		}))
+	}
+
+	h := NewTrackHistory(dbm, time.Second, time.Hour*24*5, map[string]time.Duration{"red": time.Hour * 24, "green": 0})
+	h.Cleanup()
+
+	assert.Equal(t, int64(2), dbm.PositionQuery().Scope("blue").Count())
+	assert.Equal(t, int64(1), dbm.PositionQuery().Scope("red").Count())
+	assert.Equal(t, int64(3), dbm.PositionQuery().Scope("green").Count())
+}
@@ -62,7 +62,7 @@ func (u UserDbRepository) Start() error {
 		}
 	}
 
-	return nil
+	return u.dbm.MigrateScopes()
 }
 
 func (u UserDbRepository) Stop() {
@@ -114,7 +114,7 @@ func (u UserDbRepository) loadUsersFile() error {
 
 func (u UserDbRepository) SaveSignInfo(username, uid, sn string, till time.Time) {
 	if uid != "" && uid != "taktracker" {
-		_ = u.dbm.CertsQuery().Login(username).UID(uid).Delete()
+		_ = u.dbm.CertsQuery().Login(username).UID(uid).Revoked(false).Delete()
 	}
 
 	cert := &model.Certificate{
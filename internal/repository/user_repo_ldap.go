@@ -0,0 +1,427 @@
+package repository
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/kdudkov/goatak/internal/cache"
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+var _ DeviceRepository = &UserLdapRepository{}
+
+var errLdapNotFound = errors.New("user not found in ldap")
+
+// LdapConn is the part of ldap connection we use.
+type LdapConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+type ldapUser struct {
+	dn     string
+	device *model.Device
+	// user is taken from local db
+	local bool
+}
+
+type authEntry struct {
+	hash [sha256.Size]byte
+	ts   time.Time
+}
+
+// UserLdapRepository checks passwords with ldap bind and maps ldap groups to scopes.
+// Devices are stored in local db too, to keep certificates and connect info.
+type UserLdapRepository struct {
+	logger *slog.Logger
+	conf   *config.LdapConfig
+	local  *UserDbRepository
+	cache  *cache.Cache[*ldapUser]
+	ttl    time.Duration
+	dial   func() (LdapConn, error)
+	salt   []byte
+	authMx sync.Mutex
+	auth   map[string]authEntry
+	stopCh chan struct{}
+}
+
+func NewUserLdapRepository(conf *config.LdapConfig, local *UserDbRepository) (*UserLdapRepository, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	u := &UserLdapRepository{
+		logger: slog.With(slog.String("logger", "user_repo_ldap")),
+		conf:   conf,
+		local:  local,
+		ttl:    time.Second * time.Duration(conf.CacheTTL),
+		salt:   make([]byte, 16),
+		auth:   make(map[string]authEntry),
+		stopCh: make(chan struct{}),
+	}
+
+	_, _ = rand.Read(u.salt)
+
+	u.dial = u.dialLdap
+	u.cache = cache.NewWithTTL(u.ttl, u.loadUser)
+
+	return u, nil
+}
+
+// SetDialer changes the way to connect ldap server, used in tests.
+func (u *UserLdapRepository) SetDialer(dial func() (LdapConn, error)) {
+	u.dial = dial
+}
+
+func (u *UserLdapRepository) dialLdap() (LdapConn, error) {
+	timeout := time.Second * time.Duration(u.conf.Timeout)
+	tlsConf := &tls.Config{InsecureSkipVerify: u.conf.Insecure} //nolint:gosec
+
+	conn, err := ldap.DialURL(u.conf.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConf))
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetTimeout(timeout)
+
+	if u.conf.StartTLS {
+		if err := conn.StartTLS(tlsConf); err != nil {
+			_ = conn.Close()
+
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// connect returns connection bound with service account.
+func (u *UserLdapRepository) connect() (LdapConn, error) {
+	conn, err := u.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if u.conf.BindDN != "" {
+		if err := conn.Bind(u.conf.BindDN, u.conf.BindPassword); err != nil {
+			_ = conn.Close()
+
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (u *UserLdapRepository) Start() error {
+	if err := u.local.Start(); err != nil {
+		return err
+	}
+
+	go u.cleaner()
+
+	conn, err := u.connect()
+	if err != nil {
+		u.logger.Warn("ldap server is unavailable", slog.Any("error", err))
+
+		return nil
+	}
+
+	_ = conn.Close()
+	u.logger.Info("connected to ldap " + u.conf.URL)
+
+	return nil
+}
+
+func (u *UserLdapRepository) Stop() {
+	close(u.stopCh)
+	u.local.Stop()
+}
+
+// cleaner removes expired users and passwords, so every tried login doesn't stay in memory forever.
+func (u *UserLdapRepository) cleaner() {
+	ticker := time.NewTicker(u.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.stopCh:
+			return
+		case <-ticker.C:
+			u.cache.Clean()
+			u.cleanAuthCache(time.Now())
+		}
+	}
+}
+
+func (u *UserLdapRepository) cleanAuthCache(now time.Time) {
+	u.authMx.Lock()
+	defer u.authMx.Unlock()
+
+	for k, e := range u.auth {
+		if now.Sub(e.ts) > u.ttl {
+			delete(u.auth, k)
+		}
+	}
+}
+
+func (u *UserLdapRepository) loadUser(username string) *ldapUser {
+	dn, groups, err := u.search(username)
+
+	if err != nil {
+		if !errors.Is(err, errLdapNotFound) {
+			u.logger.Error("ldap search error", slog.String("user", username), slog.Any("error", err))
+		}
+
+		if u.conf.Fallback {
+			// devices synced from ldap have no password, they are not used when the user is removed from ldap
+			if d := u.local.Get(username); d != nil && (d.Password != "" || !errors.Is(err, errLdapNotFound)) {
+				return &ldapUser{device: d, local: true}
+			}
+		}
+
+		return nil
+	}
+
+	d := u.syncDevice(username, groups)
+	if d == nil {
+		u.logger.Warn(fmt.Sprintf("ldap user %s has no scope", username))
+
+		return nil
+	}
+
+	return &ldapUser{dn: dn, device: d}
+}
+
+func (u *UserLdapRepository) search(username string) (string, []string, error) {
+	if username == "" {
+		return "", nil, errLdapNotFound
+	}
+
+	conn, err := u.connect()
+	if err != nil {
+		return "", nil, err
+	}
+
+	defer conn.Close()
+
+	req := ldap.NewSearchRequest(u.conf.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, u.conf.Timeout, false,
+		fmt.Sprintf(u.conf.UserFilter, ldap.EscapeFilter(username)), []string{"dn", u.conf.GroupAttr}, nil)
+
+	res, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return "", nil, errLdapNotFound
+		}
+
+		return "", nil, err
+	}
+
+	if len(res.Entries) != 1 {
+		return "", nil, errLdapNotFound
+	}
+
+	e := res.Entries[0]
+
+	return e.DN, e.GetAttributeValues(u.conf.GroupAttr), nil
+}
+
+// syncDevice makes device from ldap groups and saves it to local db.
+func (u *UserLdapRepository) syncDevice(username string, groups []string) *model.Device {
+	scope, readScope, role := u.mapGroups(groups)
+	admin := role != ""
+
+	if scope == "" {
+		return nil
+	}
+
+	d := u.local.dbm.DeviceQuery().Login(username).One()
+
+	if d == nil {
+		d = &model.Device{Login: username}
+	} else if d.Scope == scope && d.Admin == admin && d.Role == role && slices.Equal(d.ReadScope, readScope) {
+		return d
+	}
+
+	d.Scope, d.ReadScope, d.Admin, d.Role = scope, readScope, admin, role
+
+	if err := u.local.dbm.Save(d); err != nil {
+		u.logger.Error("save device error", slog.Any("error", err))
+
+		return d
+	}
+
+	if err := u.local.dbm.SetDeviceGroups(username, model.ScopeGroups(username, scope, readScope)); err != nil {
+		u.logger.Error("save device groups error", slog.Any("error", err))
+	}
+
+	if d1 := u.local.dbm.DeviceQuery().Login(username).One(); d1 != nil {
+		return d1
+	}
+
+	return d
+}
+
+// mapGroups returns scope, read scopes and admin role of the user, empty role for not admin.
+func (u *UserLdapRepository) mapGroups(groups []string) (string, []string, string) {
+	var scope, role string
+	var readScope []string
+
+	for _, g := range u.conf.Groups {
+		if !slices.ContainsFunc(groups, func(s string) bool { return groupMatch(s, g.Group) }) {
+			continue
+		}
+
+		if scope == "" {
+			scope = g.Scope
+		}
+
+		role = model.HigherRole(role, g.Role)
+
+		for _, s := range g.ReadScope {
+			if !slices.Contains(readScope, s) {
+				readScope = append(readScope, s)
+			}
+		}
+	}
+
+	if scope == "" {
+		scope = u.conf.DefaultScope
+	}
+
+	admin := slices.ContainsFunc(groups, func(s string) bool {
+		return slices.ContainsFunc(u.conf.AdminGroups, func(g string) bool { return groupMatch(s, g) })
+	})
+
+	if admin {
+		role = model.HigherRole(role, u.conf.AdminRole)
+	}
+
+	return scope, readScope, role
+}
+
+// groupMatch compares group dn with configured group, given as dn or cn.
+func groupMatch(dn, group string) bool {
+	if strings.EqualFold(dn, group) {
+		return true
+	}
+
+	if strings.Contains(group, "=") {
+		return false
+	}
+
+	if d, err := ldap.ParseDN(dn); err == nil && len(d.RDNs) > 0 {
+		for _, a := range d.RDNs[0].Attributes {
+			if strings.EqualFold(a.Type, "cn") && strings.EqualFold(a.Value, group) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (u *UserLdapRepository) CheckAuth(username, password string) bool {
+	user := u.cache.Load(username)
+
+	if user == nil || !user.device.IsGood() {
+		return false
+	}
+
+	if user.local {
+		return u.local.CheckAuth(username, password)
+	}
+
+	// empty password makes unauthenticated bind, that always succeeds
+	if password == "" {
+		return false
+	}
+
+	if u.checkAuthCache(username, password) {
+		return true
+	}
+
+	conn, err := u.dial()
+	if err != nil {
+		u.logger.Error("ldap connect error", slog.Any("error", err))
+
+		return false
+	}
+
+	defer conn.Close()
+
+	if err := conn.Bind(user.dn, password); err != nil {
+		return false
+	}
+
+	u.saveAuthCache(username, password)
+
+	return true
+}
+
+func (u *UserLdapRepository) passwordHash(password string) [sha256.Size]byte {
+	return sha256.Sum256(append(slices.Clone(u.salt), password...))
+}
+
+func (u *UserLdapRepository) checkAuthCache(username, password string) bool {
+	u.authMx.Lock()
+	defer u.authMx.Unlock()
+
+	e, ok := u.auth[username]
+	if !ok {
+		return false
+	}
+
+	if time.Since(e.ts) > u.ttl {
+		delete(u.auth, username)
+
+		return false
+	}
+
+	h := u.passwordHash(password)
+
+	return subtle.ConstantTimeCompare(e.hash[:], h[:]) == 1
+}
+
+func (u *UserLdapRepository) saveAuthCache(username, password string) {
+	u.authMx.Lock()
+	defer u.authMx.Unlock()
+
+	u.auth[username] = authEntry{hash: u.passwordHash(password), ts: time.Now()}
+}
+
+func (u *UserLdapRepository) IsValid(username, _ string) bool {
+	return u.Get(username).IsGood()
+}
+
+func (u *UserLdapRepository) Get(username string) *model.Device {
+	if user := u.cache.Load(username); user != nil {
+		return user.device
+	}
+
+	return nil
+}
+
+func (u *UserLdapRepository) SaveSignInfo(username, uid, sn string, till time.Time) {
+	u.local.SaveSignInfo(username, uid, sn, till)
+}
+
+func (u *UserLdapRepository) SaveConnectInfo(username, uid, sn string) {
+	u.local.SaveConnectInfo(username, uid, sn)
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/internal/cache"
+	"github.com/kdudkov/goatak/internal/config"
+	"github.com/kdudkov/goatak/pkg/model"
+)
+
+type fakeEntry struct {
+	uid      string
+	password string
+	groups   []string
+}
+
+// fakeLdap is an in-process ldap server stand-in.
+type fakeLdap struct {
+	down    atomic.Bool
+	binds   atomic.Int32
+	entries map[string]*fakeEntry
+}
+
+type fakeConn struct {
+	l *fakeLdap
+}
+
+func (l *fakeLdap) dial() (LdapConn, error) {
+	if l.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+
+	return &fakeConn{l: l}, nil
+}
+
+func (c *fakeConn) Bind(dn, password string) error {
+	c.l.binds.Add(1)
+
+	// unauthenticated bind
+	if password == "" {
+		return nil
+	}
+
+	if dn == "cn=svc" && password == "svc" {
+		return nil
+	}
+
+	if e, ok := c.l.entries[dn]; ok && e.password == password {
+		return nil
+	}
+
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (c *fakeConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	res := new(ldap.SearchResult)
+
+	for dn, e := range c.l.entries {
+		if req.Filter == fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(e.uid)) {
+			res.Entries = append(res.Entries, ldap.NewEntry(dn, map[string][]string{"memberOf": e.groups}))
+		}
+	}
+
+	return res, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func newLdapRepo(t *testing.T, fallback bool) (*UserLdapRepository, *fakeLdap) {
+	dbm := getTestDbm()
+	require.NoError(t, dbm.Migrate())
+
+	local := &model.Device{Login: "local", Scope: "test", Admin: true}
+	require.NoError(t, local.SetPassword("local"))
+	require.NoError(t, dbm.Create(local))
+
+	srv := &fakeLdap{entries: map[string]*fakeEntry{
+		"uid=john,ou=people,dc=example": {
+			uid:      "john",
+			password: "secret",
+			groups:   []string{"cn=blue,ou=groups,dc=example", "cn=admins,ou=groups,dc=example", "cn=intel,ou=groups,dc=example"},
+		},
+		"uid=ann,ou=people,dc=example": {
+			uid:      "ann",
+			password: "ann",
+			groups:   []string{"cn=red,ou=groups,dc=example"},
+		},
+		"uid=bob,ou=people,dc=example": {
+			uid:      "bob",
+			password: "bob",
+			groups:   []string{"cn=other,ou=groups,dc=example"},
+		},
+	}}
+
+	conf := &config.LdapConfig{
+		URL:          "ldap://localhost",
+		BindDN:       "cn=svc",
+		BindPassword: "svc",
+		BaseDN:       "dc=example",
+		Groups: []*config.LdapGroup{
+			{Group: "intel", ReadScope: []string{"public"}},
+			{Group: "cn=blue,ou=groups,dc=example", Scope: "blue", ReadScope: []string{"public", "red"}},
+			{Group: "red", Scope: "red", Role: model.RoleOperator},
+		},
+		AdminGroups: []string{"admins"},
+		Fallback:    fallback,
+	}
+
+	repo, err := NewUserLdapRepository(conf, NewUserDbRepository("", dbm))
+	require.NoError(t, err)
+
+	repo.SetDialer(srv.dial)
+
+	return repo, srv
+}
+
+func TestLdapAuth(t *testing.T) {
+	repo, _ := newLdapRepo(t, true)
+
+	assert.True(t, repo.CheckAuth("john", "secret"))
+	assert.False(t, repo.CheckAuth("john", "bad"))
+	assert.False(t, repo.CheckAuth("john", ""))
+
+	d := repo.Get("john")
+	require.NotNil(t, d)
+	assert.Equal(t, "blue", d.Scope)
+	assert.Equal(t, []string{"public", "red"}, d.ReadScope)
+	assert.True(t, d.Admin)
+	assert.Equal(t, model.RoleScopeAdmin, d.AdminRole())
+	assert.True(t, repo.IsValid("john", ""))
+
+	// device is saved to local db
+	d1 := repo.local.dbm.DeviceQuery().Login("john").One()
+	require.NotNil(t, d1)
+	assert.Equal(t, "blue", d1.Scope)
+
+	// no group with scope and no default scope
+	assert.Nil(t, repo.Get("bob"))
+	assert.False(t, repo.CheckAuth("bob", "bob"))
+
+	// local fallback
+	assert.True(t, repo.CheckAuth("local", "local"))
+	assert.False(t, repo.CheckAuth("local", "bad"))
+	assert.Nil(t, repo.Get("nobody"))
+}
+
+func TestLdapRole(t *testing.T) {
+	repo, _ := newLdapRepo(t, false)
+
+	assert.True(t, repo.CheckAuth("ann", "ann"))
+
+	d := repo.Get("ann")
+	require.NotNil(t, d)
+	assert.Equal(t, "red", d.Scope)
+	assert.Equal(t, model.RoleOperator, d.AdminRole())
+	assert.False(t, d.CanWrite())
+
+	repo.conf.Groups[2].Role = "root"
+	require.Error(t, repo.conf.Validate())
+}
+
+func TestLdapAuthCache(t *testing.T) {
+	repo, srv := newLdapRepo(t, true)
+
+	require.True(t, repo.CheckAuth("john", "secret"))
+	n := srv.binds.Load()
+
+	require.True(t, repo.CheckAuth("john", "secret"))
+	assert.Equal(t, n, srv.binds.Load())
+
+	// wrong password is checked in ldap
+	require.False(t, repo.CheckAuth("john", "secret1"))
+	assert.Equal(t, n+1, srv.binds.Load())
+}
+
+func TestLdapAuthCacheClean(t *testing.T) {
+	repo, _ := newLdapRepo(t, true)
+
+	require.True(t, repo.CheckAuth("john", "secret"))
+	assert.Len(t, repo.auth, 1)
+
+	repo.cleanAuthCache(time.Now())
+	assert.Len(t, repo.auth, 1)
+
+	repo.cleanAuthCache(time.Now().Add(repo.ttl * 2))
+	assert.Empty(t, repo.auth)
+}
+
+func TestLdapFallback(t *testing.T) {
+	repo, srv := newLdapRepo(t, true)
+
+	require.NotNil(t, repo.Get("john"))
+
+	srv.down.Store(true)
+	repo.cache = cache.NewWithTTL(repo.ttl, repo.loadUser)
+
+	// synced ldap user can connect with certificate, but can't log in with password
+	assert.True(t, repo.IsValid("john", ""))
+	assert.False(t, repo.CheckAuth("john", "secret"))
+	assert.True(t, repo.CheckAuth("local", "local"))
+
+	srv.down.Store(false)
+	delete(srv.entries, "uid=john,ou=people,dc=example")
+	repo.cache = cache.NewWithTTL(repo.ttl, repo.loadUser)
+
+	// removed from ldap
+	assert.False(t, repo.IsValid("john", ""))
+}
+
+func TestLdapNoFallback(t *testing.T) {
+	repo, _ := newLdapRepo(t, false)
+
+	assert.False(t, repo.CheckAuth("local", "local"))
+	assert.True(t, repo.CheckAuth("john", "secret"))
+}
+
+func TestGroupMatch(t *testing.T) {
+	assert.True(t, groupMatch("cn=Blue,ou=groups,dc=example", "blue"))
+	assert.True(t, groupMatch("CN=Blue,OU=groups,DC=example", "cn=blue,ou=groups,dc=example"))
+	assert.False(t, groupMatch("cn=blue,ou=groups,dc=example", "groups"))
+	assert.False(t, groupMatch("cn=blue,ou=groups,dc=example", "cn=blue"))
+}
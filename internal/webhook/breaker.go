@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Breaker is a circuit breaker. After threshold failures in a row it opens and rejects calls for cooldown,
+// then lets one call through; success closes it, failure opens it again.
+type Breaker struct {
+	mx        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     string
+	openedAt  time.Time
+	trial     bool
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+		state:     StateClosed,
+	}
+}
+
+// Allow checks if call can be made now.
+func (b *Breaker) Allow() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+
+		b.state = StateHalfOpen
+		b.trial = true
+
+		return true
+	case StateHalfOpen:
+		if b.trial {
+			return false
+		}
+
+		b.trial = true
+
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) Success() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.failures = 0
+	b.trial = false
+	b.state = StateClosed
+}
+
+func (b *Breaker) Failure() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.failures++
+	b.trial = false
+
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *Breaker) State() string {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+
+	return b.state
+}
@@ -0,0 +1,363 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+const (
+	VerdictAllow  = "allow"
+	VerdictDrop   = "drop"
+	VerdictModify = "modify"
+
+	HeaderHook      = "X-Goatak-Hook"
+	HeaderSignature = "X-Goatak-Signature"
+
+	defaultTimeout   = 2
+	defaultQueueSize = 1000
+	defaultRetries   = 3
+	defaultThreshold = 5
+	defaultCooldown  = 30
+)
+
+var ErrCircuitOpen = errors.New("circuit is open")
+
+type Config struct {
+	Name string `yaml:"name" json:"name" koanf:"name"`
+	URL  string `yaml:"url" json:"url" koanf:"url"`
+	// cot type masks, empty - all messages
+	Types []string `yaml:"types" json:"types,omitempty" koanf:"types"`
+	// server events (emergency), async hook with events and without types gets only events
+	Events []string `yaml:"events" json:"events,omitempty" koanf:"events"`
+	// sync hook is called before message is processed and can drop or modify it
+	Sync     bool `yaml:"sync" json:"sync" koanf:"sync"`
+	Disabled bool `yaml:"disabled" json:"disabled" koanf:"disabled"`
+	// drop message if sync hook fails, by default message is allowed
+	DropOnError bool `yaml:"drop_on_error" json:"drop_on_error" koanf:"drop_on_error"`
+	// request timeout in seconds
+	Timeout int `yaml:"timeout" json:"timeout" koanf:"timeout"`
+	// retries for async hook
+	Retries int `yaml:"retries" json:"retries" koanf:"retries"`
+	// async hook queue size
+	QueueSize int `yaml:"queue_size" json:"queue_size" koanf:"queue_size"`
+	// number of failures in a row to open circuit and seconds to wait before the next try
+	FailThreshold int               `yaml:"fail_threshold" json:"fail_threshold" koanf:"fail_threshold"`
+	Cooldown      int               `yaml:"cooldown" json:"cooldown" koanf:"cooldown"`
+	Headers       map[string]string `yaml:"headers" json:"-" koanf:"headers"`
+	// if set, body is signed with HMAC-SHA256, signature is in X-Goatak-Signature header
+	Secret string `yaml:"secret" json:"-" koanf:"secret"`
+}
+
+// Verdict is the sync hook response. Empty response means allow.
+type Verdict struct {
+	Action  string          `json:"action"`
+	Message *cot.CotMessage `json:"message,omitempty"`
+}
+
+type Hook struct {
+	conf    *Config
+	client  *http.Client
+	breaker *Breaker
+	queue   chan []byte
+	wg      sync.WaitGroup
+
+	sent     atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+	modified atomic.Int64
+	skipped  atomic.Int64
+
+	mx        sync.RWMutex
+	lastError string
+	lastTime  time.Time
+}
+
+type HookDTO struct {
+	*Config
+	State     string     `json:"state"`
+	Queued    int        `json:"queued"`
+	Sent      int64      `json:"sent"`
+	Failed    int64      `json:"failed"`
+	Dropped   int64      `json:"dropped"`
+	Modified  int64      `json:"modified"`
+	Skipped   int64      `json:"skipped"`
+	LastError string     `json:"last_error,omitempty"`
+	LastTime  *time.Time `json:"last_error_time,omitempty"`
+}
+
+func (c *Config) Validate() error {
+	if c == nil {
+		return fmt.Errorf("empty webhook")
+	}
+
+	if c.Name == "" {
+		return fmt.Errorf("empty webhook name")
+	}
+
+	if c.URL == "" {
+		return fmt.Errorf("webhook %s: empty url", c.Name)
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+
+	if c.Retries <= 0 {
+		c.Retries = defaultRetries
+	}
+
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultQueueSize
+	}
+
+	if c.FailThreshold <= 0 {
+		c.FailThreshold = defaultThreshold
+	}
+
+	if c.Cooldown <= 0 {
+		c.Cooldown = defaultCooldown
+	}
+
+	return nil
+}
+
+func NewHook(conf *Config) (*Hook, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	h := &Hook{
+		conf:    conf,
+		client:  &http.Client{Timeout: time.Second * time.Duration(conf.Timeout)},
+		breaker: NewBreaker(conf.FailThreshold, time.Second*time.Duration(conf.Cooldown)),
+	}
+
+	if !conf.Sync {
+		h.queue = make(chan []byte, conf.QueueSize)
+	}
+
+	return h, nil
+}
+
+func (h *Hook) Name() string {
+	return h.conf.Name
+}
+
+func (h *Hook) DTO() *HookDTO {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+
+	d := &HookDTO{
+		Config:    h.conf,
+		State:     h.breaker.State(),
+		Queued:    len(h.queue),
+		Sent:      h.sent.Load(),
+		Failed:    h.failed.Load(),
+		Dropped:   h.dropped.Load(),
+		Modified:  h.modified.Load(),
+		Skipped:   h.skipped.Load(),
+		LastError: h.lastError,
+	}
+
+	if !h.lastTime.IsZero() {
+		t := h.lastTime
+		d.LastTime = &t
+	}
+
+	return d
+}
+
+func (h *Hook) match(msg *cot.CotMessage) bool {
+	if h.conf.Disabled {
+		return false
+	}
+
+	if len(h.conf.Types) == 0 {
+		return len(h.conf.Events) == 0
+	}
+
+	return cot.MatchAnyPattern(msg.GetType(), h.conf.Types...)
+}
+
+func (h *Hook) matchEvent(name string) bool {
+	return !h.conf.Disabled && !h.conf.Sync && slices.Contains(h.conf.Events, name)
+}
+
+func (h *Hook) setError(err error) {
+	h.failed.Add(1)
+	h.breaker.Failure()
+
+	h.mx.Lock()
+	h.lastError = err.Error()
+	h.lastTime = time.Now()
+	h.mx.Unlock()
+}
+
+// post sends body to the hook url and returns response body.
+func (h *Hook) post(ctx context.Context, body []byte) ([]byte, error) {
+	if !h.breaker.Allow() {
+		h.skipped.Add(1)
+
+		return nil, ErrCircuitOpen
+	}
+
+	res, err := h.doPost(ctx, body)
+	if err != nil {
+		h.setError(err)
+
+		return nil, err
+	}
+
+	h.sent.Add(1)
+	h.breaker.Success()
+
+	return res, nil
+}
+
+func (h *Hook) doPost(ctx context.Context, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderHook, h.conf.Name)
+
+	for k, v := range h.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if h.conf.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(h.conf.Secret, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return data, nil
+}
+
+// verdict calls sync hook. Message is changed in place if hook modifies it.
+func (h *Hook) verdict(ctx context.Context, msg *cot.CotMessage, body []byte) (bool, error) {
+	data, err := h.post(ctx, body)
+	if err != nil {
+		return !h.conf.DropOnError, err
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return true, nil
+	}
+
+	v := new(Verdict)
+	if err := json.Unmarshal(data, v); err != nil {
+		return !h.conf.DropOnError, fmt.Errorf("invalid verdict: %w", err)
+	}
+
+	switch v.Action {
+	case "", VerdictAllow:
+		return true, nil
+	case VerdictDrop:
+		h.dropped.Add(1)
+
+		return false, nil
+	case VerdictModify:
+		if v.Message.GetTakMessage().GetCotEvent() == nil {
+			return !h.conf.DropOnError, fmt.Errorf("modify verdict without message")
+		}
+
+		m, err := cot.CotFromProto(v.Message.GetTakMessage(), msg.From, msg.Scope)
+		if err != nil {
+			return !h.conf.DropOnError, err
+		}
+
+		h.modified.Add(1)
+		msg.TakMessage, msg.Detail = m.TakMessage, m.Detail
+
+		return true, nil
+	default:
+		return !h.conf.DropOnError, fmt.Errorf("invalid verdict action %s", v.Action)
+	}
+}
+
+func (h *Hook) enqueue(body []byte) {
+	select {
+	case h.queue <- body:
+	default:
+		h.skipped.Add(1)
+	}
+}
+
+func (h *Hook) start(ctx context.Context) {
+	h.wg.Add(1)
+
+	go func() {
+		defer h.wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case body := <-h.queue:
+				h.deliver(ctx, body)
+			}
+		}
+	}()
+}
+
+// deliver sends async event with retries and exponential backoff.
+func (h *Hook) deliver(ctx context.Context, body []byte) {
+	delay := time.Millisecond * 500
+
+	for i := range h.conf.Retries {
+		_, err := h.post(ctx, body)
+		if err == nil || errors.Is(err, ErrCircuitOpen) || i == h.conf.Retries-1 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func (h *Hook) isSync() bool {
+	return h.conf.Sync
+}
+
+func Sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+// Manager calls external http hooks for messages.
+// Sync hooks are called in order before message is processed and can drop or modify it,
+// async hooks get processed messages in background.
+type Manager struct {
+	logger *slog.Logger
+	hooks  []*Hook
+	cancel context.CancelFunc
+}
+
+func New(confs []*Config) (*Manager, error) {
+	m := &Manager{logger: slog.With("logger", "webhook")}
+
+	for _, c := range confs {
+		h, err := NewHook(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if slices.ContainsFunc(m.hooks, func(h1 *Hook) bool { return h1.Name() == c.Name }) {
+			return nil, fmt.Errorf("webhook %s already exists", c.Name)
+		}
+
+		m.hooks = append(m.hooks, h)
+	}
+
+	return m, nil
+}
+
+func (m *Manager) Start() {
+	if m == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	for _, h := range m.hooks {
+		if !h.isSync() {
+			h.start(ctx)
+		}
+	}
+}
+
+func (m *Manager) Stop() {
+	if m == nil || m.cancel == nil {
+		return
+	}
+
+	m.cancel()
+
+	for _, h := range m.hooks {
+		h.wg.Wait()
+	}
+}
+
+func (m *Manager) Hooks() []*Hook {
+	if m == nil {
+		return nil
+	}
+
+	return m.hooks
+}
+
+// Verdict calls sync hooks. Message can be changed in place. Returns false if message must be dropped.
+func (m *Manager) Verdict(msg *cot.CotMessage) bool {
+	if m == nil || !slices.ContainsFunc(m.hooks, (*Hook).isSync) {
+		return true
+	}
+
+	var body []byte
+
+	for _, h := range m.hooks {
+		if !h.isSync() || !h.match(msg) {
+			continue
+		}
+
+		if body == nil {
+			var err error
+
+			if body, err = json.Marshal(msg); err != nil {
+				m.logger.Error("marshal error", slog.Any("error", err))
+
+				return true
+			}
+		}
+
+		tm := msg.TakMessage
+
+		ok, err := h.verdict(context.Background(), msg, body)
+		if err != nil {
+			m.logger.Warn(fmt.Sprintf("webhook %s error: %s", h.Name(), err.Error()))
+		}
+
+		if !ok {
+			return false
+		}
+
+		if msg.TakMessage != tm {
+			// next hooks must get the modified message
+			body = nil
+		}
+	}
+
+	return true
+}
+
+// Event is the server event sent to async hooks.
+type Event struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data"`
+}
+
+// PublishEvent queues server event for async hooks subscribed to it.
+func (m *Manager) PublishEvent(name string, data any) {
+	if m == nil {
+		return
+	}
+
+	var body []byte
+
+	for _, h := range m.hooks {
+		if !h.matchEvent(name) {
+			continue
+		}
+
+		if body == nil {
+			var err error
+
+			if body, err = json.Marshal(&Event{Event: name, Time: time.Now(), Data: data}); err != nil {
+				m.logger.Error("marshal error", slog.Any("error", err))
+
+				return
+			}
+		}
+
+		h.enqueue(body)
+	}
+}
+
+// Publish queues message for async hooks.
+func (m *Manager) Publish(msg *cot.CotMessage) {
+	if m == nil {
+		return
+	}
+
+	var body []byte
+
+	for _, h := range m.hooks {
+		if h.isSync() || !h.match(msg) {
+			continue
+		}
+
+		if body == nil {
+			var err error
+
+			if body, err = json.Marshal(msg); err != nil {
+				m.logger.Error("marshal error", slog.Any("error", err))
+
+				return
+			}
+		}
+
+		h.enqueue(body)
+	}
+}
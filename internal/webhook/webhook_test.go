@@ -0,0 +1,215 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+func testMsg(typ, uid string) *cot.CotMessage {
+	return &cot.CotMessage{From: "test", Scope: "scope", TakMessage: cot.BasicMsg(typ, uid, time.Minute)}
+}
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(2, time.Millisecond*50)
+
+	assert.True(t, b.Allow())
+	b.Failure()
+	assert.True(t, b.Allow())
+	b.Failure()
+
+	assert.Equal(t, StateOpen, b.State())
+	assert.False(t, b.Allow())
+
+	time.Sleep(time.Millisecond * 60)
+
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+	b.Failure()
+	assert.False(t, b.Allow())
+
+	time.Sleep(time.Millisecond * 60)
+
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.Equal(t, StateClosed, b.State())
+	assert.True(t, b.Allow())
+}
+
+func TestSyncVerdict(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "sync", r.Header.Get(HeaderHook))
+
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, Sign("secret", body), r.Header.Get(HeaderSignature))
+
+		msg := new(cot.CotMessage)
+		require.NoError(t, json.Unmarshal(body, msg))
+
+		switch msg.GetUID() {
+		case "drop":
+			_ = json.NewEncoder(w).Encode(&Verdict{Action: VerdictDrop})
+		case "modify":
+			msg.TakMessage.CotEvent.Uid = "modified"
+			_ = json.NewEncoder(w).Encode(&Verdict{Action: VerdictModify, Message: msg})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	m, err := New([]*Config{{Name: "sync", URL: srv.URL, Sync: true, Secret: "secret", Types: []string{"a-"}}})
+	require.NoError(t, err)
+
+	assert.True(t, m.Verdict(testMsg("a-f-G", "allow")))
+	assert.False(t, m.Verdict(testMsg("a-f-G", "drop")))
+	assert.True(t, m.Verdict(testMsg("b-t-f", "drop")))
+
+	msg := testMsg("a-f-G", "modify")
+	assert.True(t, m.Verdict(msg))
+	assert.Equal(t, "modified", msg.GetUID())
+	assert.Equal(t, "test", msg.From)
+	assert.Equal(t, "scope", msg.Scope)
+
+	d := m.Hooks()[0].DTO()
+	assert.Equal(t, int64(3), d.Sent)
+	assert.Equal(t, int64(1), d.Dropped)
+	assert.Equal(t, int64(1), d.Modified)
+}
+
+func TestSyncError(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	m, err := New([]*Config{
+		{Name: "open", URL: srv.URL, Sync: true, FailThreshold: 2},
+		{Name: "close", URL: srv.URL, Sync: true, DropOnError: true, Types: []string{"b-"}},
+	})
+	require.NoError(t, err)
+
+	for range 5 {
+		assert.True(t, m.Verdict(testMsg("a-f-G", "uid")))
+	}
+
+	// circuit is open after 2 failures
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, StateOpen, m.Hooks()[0].DTO().State)
+	assert.Equal(t, int64(3), m.Hooks()[0].DTO().Skipped)
+
+	assert.False(t, m.Verdict(testMsg("b-t-f", "uid")))
+}
+
+func TestAsync(t *testing.T) {
+	var calls atomic.Int32
+
+	got := make(chan string, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// first call fails, retry must succeed
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		msg := new(cot.CotMessage)
+		_ = json.NewDecoder(r.Body).Decode(msg)
+		got <- msg.GetUID()
+	}))
+	defer srv.Close()
+
+	m, err := New([]*Config{{Name: "async", URL: srv.URL}})
+	require.NoError(t, err)
+
+	m.Start()
+	defer m.Stop()
+
+	assert.True(t, m.Verdict(testMsg("a-f-G", "uid1")))
+	m.Publish(testMsg("a-f-G", "uid1"))
+
+	select {
+	case uid := <-got:
+		assert.Equal(t, "uid1", uid)
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, int64(1), m.Hooks()[0].DTO().Failed)
+}
+
+func TestConfig(t *testing.T) {
+	_, err := New([]*Config{{Name: "a"}})
+	require.Error(t, err)
+
+	_, err = New([]*Config{{Name: "a", URL: "http://localhost"}, {Name: "a", URL: "http://localhost"}})
+	require.Error(t, err)
+}
+
+func TestEvents(t *testing.T) {
+	got := make(chan *Event, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		ev := new(Event)
+		_ = json.NewDecoder(r.Body).Decode(ev)
+		got <- ev
+	}))
+	defer srv.Close()
+
+	m, err := New([]*Config{{Name: "events", URL: srv.URL, Events: []string{"emergency"}}})
+	require.NoError(t, err)
+
+	m.Start()
+	defer m.Stop()
+
+	// hook with events only does not get messages
+	m.Publish(testMsg("a-f-G", "uid1"))
+	m.PublishEvent("other", "data")
+	m.PublishEvent("emergency", map[string]string{"uid": "uid1"})
+
+	select {
+	case ev := <-got:
+		assert.Equal(t, "emergency", ev.Event)
+		assert.Equal(t, map[string]any{"uid": "uid1"}, ev.Data)
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+
+	select {
+	case ev := <-got:
+		t.Fatalf("unexpected event %s", ev.Event)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestDTOLastTime(t *testing.T) {
+	m, err := New([]*Config{{Name: "h1", URL: "http://localhost:1", Sync: true}})
+	require.NoError(t, err)
+
+	h := m.Hooks()[0]
+	h.setError(io.EOF)
+
+	d := h.DTO()
+	require.NotNil(t, d.LastTime)
+	t1 := *d.LastTime
+
+	time.Sleep(time.Millisecond)
+	h.setError(io.EOF)
+
+	// dto has a copy of time, not the pointer to hook field
+	assert.Equal(t, t1, *d.LastTime)
+}
@@ -11,10 +11,11 @@ import (
 )
 
 type WebMessage struct {
-	Typ         string             `json:"type"`
-	Unit        *model.WebUnit     `json:"unit,omitempty"`
-	UID         string             `json:"uid,omitempty"`
-	ChatMessage *model.ChatMessage `json:"chat_msg,omitempty"`
+	Typ         string              `json:"type"`
+	Unit        *model.WebUnit      `json:"unit,omitempty"`
+	UID         string              `json:"uid,omitempty"`
+	ChatMessage *model.ChatMessage  `json:"chat_msg,omitempty"`
+	Emergency   *model.EmergencyDTO `json:"emergency,omitempty"`
 }
 
 type JSONWsHandler struct {
@@ -113,6 +114,19 @@ func (w *JSONWsHandler) NewChatMessage(msg *model.ChatMessage) bool {
 	return true
 }
 
+func (w *JSONWsHandler) SendEmergency(e *model.EmergencyDTO) bool {
+	if w == nil || !w.IsActive() {
+		return false
+	}
+
+	select {
+	case w.ch <- &WebMessage{Typ: "emergency", Emergency: e}:
+	default:
+	}
+
+	return true
+}
+
 func (w *JSONWsHandler) closehandler(code int, text string) error {
 	w.log.Info(fmt.Sprintf("closed with code %d, msg %s", code, text))
 	w.stop()
@@ -6,9 +6,11 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/kdudkov/goatak/pkg/cot"
 	"github.com/kdudkov/goatak/pkg/cotproto"
+	"github.com/kdudkov/goatak/pkg/model"
 )
 
 type ChatMessage struct {
@@ -23,6 +25,64 @@ func FromCot(c *cot.CotMessage) *ChatMessage {
 	}
 }
 
+// FromRecord restores chat message from database record.
+func FromRecord(r *model.ChatRecord) (*ChatMessage, error) {
+	m := new(cotproto.TakMessage)
+
+	if err := proto.Unmarshal(r.MsgData, m); err != nil {
+		return nil, err
+	}
+
+	msg, err := cot.CotFromProto(m, "", r.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatMessage{msg: msg, received: r.CreatedAt}, nil
+}
+
+func (c *ChatMessage) GetMsg() *cot.CotMessage {
+	if c == nil {
+		return nil
+	}
+
+	return c.msg
+}
+
+// Record makes database record for chat message.
+func (c *ChatMessage) Record() (*model.ChatRecord, error) {
+	dat, err := proto.Marshal(c.msg.GetTakMessage())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &model.ChatRecord{
+		UID:          c.msg.GetUID(),
+		MessageID:    c.GetMessageID(),
+		CreatedAt:    c.received,
+		Scope:        c.msg.Scope,
+		Chatroom:     c.GetChatroom(),
+		FromUID:      c.GetUIDFrom(),
+		FromCallsign: c.GetCallsignFrom(),
+		ToUID:        c.GetUIDTo(),
+		File:         c.msg.IsFileTransfer(),
+		Text:         c.GetText(),
+		MsgData:      dat,
+	}
+
+	if dest := c.msg.GetDetail().GetDestUid(); r.ToUID == "" && len(dest) > 0 {
+		r.ToUID = dest[0]
+	}
+
+	if dest := c.msg.GetDetail().GetDestCallsign(); r.Chatroom == "" && len(dest) > 0 {
+		r.Chatroom = dest[0]
+	}
+
+	r.Direct = r.ToUID != "" && r.Chatroom != r.ToUID
+
+	return r, nil
+}
+
 func (c *ChatMessage) GetMessageID() string {
 	if c == nil || c.msg == nil {
 		return ""
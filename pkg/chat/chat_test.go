@@ -105,3 +105,26 @@ func TestMsgRed(t *testing.T) {
 	assert.Equal(t, "Red", cm.GetChatroom())
 	assert.Equal(t, "Roger", cm.GetText())
 }
+
+func TestChatRecord(t *testing.T) {
+	msg := getChatMsg("4de0262c-633f-46eb-b8e5-5ef1eb1e5e22", "uid1", "user1", "uid2", "user2", "at breach")
+	msg.Scope = "test"
+
+	rec, err := FromCot(msg).Record()
+	assert.NoError(t, err)
+
+	assert.Equal(t, msg.GetUID(), rec.UID)
+	assert.Equal(t, "uid1", rec.FromUID)
+	assert.Equal(t, "user1", rec.FromCallsign)
+	assert.Equal(t, "uid2", rec.ToUID)
+	assert.Equal(t, "user2", rec.Chatroom)
+	assert.Equal(t, "test", rec.Scope)
+	assert.Equal(t, "at breach", rec.Text)
+	assert.True(t, rec.Direct)
+
+	cm, err := FromRecord(rec)
+	assert.NoError(t, err)
+	assert.Equal(t, "uid1", cm.GetUIDFrom())
+	assert.Equal(t, "at breach", cm.GetText())
+	assert.Equal(t, "test", cm.GetMsg().Scope)
+}
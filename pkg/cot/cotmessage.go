@@ -14,9 +14,13 @@ const (
 	BroadcastScope = "broadcast"
 )
 
+// CotMessage is the message with its sender scope and groups.
+// HasGroups is set when the sender uses groups, then empty Groups means the message goes to nobody.
 type CotMessage struct {
 	From       string               `json:"from,omitempty"`
 	Scope      string               `json:"scope"`
+	Groups     []string             `json:"groups,omitempty"`
+	HasGroups  bool                 `json:"-"`
 	TakMessage *cotproto.TakMessage `json:"tak_message"`
 	Detail     *Node                `json:"-"`
 }
@@ -0,0 +1,416 @@
+package cot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+const (
+	GeoPoint      = "Point"
+	GeoLineString = "LineString"
+	GeoPolygon    = "Polygon"
+
+	featureStale = time.Hour * 24
+
+	defaultPointType = "b-m-p-s-m"
+	defaultShapeType = "u-d-f"
+)
+
+// Feature is GeoJSON feature, id is the uid of cot event.
+type Feature struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id,omitempty"`
+	Geometry   *Geometry      `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+// Geometry is point, line or polygon, positions are lon,lat[,alt]. Only outer ring of polygon is used.
+type Geometry struct {
+	Type      string
+	Positions [][]float64
+}
+
+type geometryJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func NewFeatureCollection(features []*Feature) *FeatureCollection {
+	if features == nil {
+		features = make([]*Feature, 0)
+	}
+
+	return &FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+func (g *Geometry) MarshalJSON() ([]byte, error) {
+	var coords any
+
+	switch g.Type {
+	case GeoPoint:
+		if len(g.Positions) != 1 {
+			return nil, fmt.Errorf("point must have one position")
+		}
+
+		coords = g.Positions[0]
+	case GeoLineString:
+		coords = g.Positions
+	case GeoPolygon:
+		coords = [][][]float64{g.Positions}
+	default:
+		return nil, fmt.Errorf("unsupported geometry %s", g.Type)
+	}
+
+	return json.Marshal(map[string]any{"type": g.Type, "coordinates": coords})
+}
+
+func (g *Geometry) UnmarshalJSON(b []byte) error {
+	var gj geometryJSON
+
+	if err := json.Unmarshal(b, &gj); err != nil {
+		return err
+	}
+
+	g.Type = gj.Type
+
+	switch gj.Type {
+	case GeoPoint:
+		var p []float64
+		if err := json.Unmarshal(gj.Coordinates, &p); err != nil {
+			return err
+		}
+
+		g.Positions = [][]float64{p}
+	case GeoLineString:
+		if err := json.Unmarshal(gj.Coordinates, &g.Positions); err != nil {
+			return err
+		}
+	case GeoPolygon:
+		var rings [][][]float64
+		if err := json.Unmarshal(gj.Coordinates, &rings); err != nil {
+			return err
+		}
+
+		if len(rings) > 0 {
+			g.Positions = rings[0]
+		}
+	default:
+		return fmt.Errorf("unsupported geometry %s", gj.Type)
+	}
+
+	for _, p := range g.Positions {
+		if len(p) < 2 {
+			return fmt.Errorf("bad position %v", p)
+		}
+	}
+
+	return nil
+}
+
+// Position returns lat, lon and hae of the first point of geometry.
+func (g *Geometry) Position() (float64, float64, float64) {
+	if g == nil || len(g.Positions) == 0 {
+		return 0, 0, NotNum
+	}
+
+	p := g.Positions[0]
+
+	if len(p) > 2 {
+		return p[1], p[0], p[2]
+	}
+
+	return p[1], p[0], NotNum
+}
+
+// CotToFeature converts cot message to GeoJSON feature. Shapes with link or polyline points become lines or polygons,
+// ellipse is the point with ellipse property.
+func CotToFeature(msg *CotMessage) *Feature {
+	evt := msg.GetTakMessage().GetCotEvent()
+
+	props := map[string]any{
+		"type":  evt.GetType(),
+		"how":   evt.GetHow(),
+		"time":  TimeFromMillis(evt.GetSendTime()).UTC(),
+		"start": TimeFromMillis(evt.GetStartTime()).UTC(),
+		"stale": TimeFromMillis(evt.GetStaleTime()).UTC(),
+	}
+
+	d := msg.GetDetail()
+
+	for k, v := range map[string]string{
+		"callsign":      msg.GetCallsign(),
+		"endpoint":      msg.GetEndpoint(),
+		"team":          msg.GetTeam(),
+		"role":          msg.GetRole(),
+		"remarks":       d.GetFirst("remarks").GetText(),
+		"color":         msg.GetColor(),
+		"iconsetpath":   msg.GetIconsetPath(),
+		"stroke_color":  d.GetFirst("strokeColor").GetAttr("value"),
+		"stroke_weight": d.GetFirst("strokeWeight").GetAttr("value"),
+		"fill_color":    d.GetFirst("fillColor").GetAttr("value"),
+	} {
+		if v != "" {
+			props[k] = v
+		}
+	}
+
+	if tr := evt.GetDetail().GetTrack(); tr != nil {
+		props["course"] = tr.GetCourse()
+		props["speed"] = tr.GetSpeed()
+	} else if tr := d.GetFirst("track"); tr != nil {
+		props["course"] = getFloat(tr.GetAttr("course"))
+		props["speed"] = getFloat(tr.GetAttr("speed"))
+	}
+
+	pos := []float64{evt.GetLon(), evt.GetLat()}
+	if evt.GetHae() < NotNum {
+		pos = append(pos, evt.GetHae())
+	}
+
+	f := &Feature{Type: "Feature", ID: evt.GetUid(), Geometry: &Geometry{Type: GeoPoint, Positions: [][]float64{pos}}, Properties: props}
+
+	if e := d.GetFirst("shape").GetFirst("ellipse"); e != nil {
+		props["ellipse"] = map[string]any{
+			"major": getFloat(e.GetAttr("major")),
+			"minor": getFloat(e.GetAttr("minor")),
+			"angle": getFloat(e.GetAttr("angle")),
+		}
+
+		return f
+	}
+
+	points, closed := shapePoints(msg)
+
+	switch {
+	case len(points) < 2:
+	case closed || MatchPattern(evt.GetType(), "u-d-r"):
+		if !samePosition(points[0], points[len(points)-1]) {
+			points = append(points, points[0])
+		}
+
+		f.Geometry = &Geometry{Type: GeoPolygon, Positions: points}
+	default:
+		f.Geometry = &Geometry{Type: GeoLineString, Positions: points}
+	}
+
+	return f
+}
+
+// shapePoints returns points of link elements or shape polyline vertexes and if shape is closed.
+func shapePoints(msg *CotMessage) ([][]float64, bool) {
+	var points [][]float64
+
+	if pl := msg.GetDetail().GetFirst("shape").GetFirst("polyline"); pl != nil {
+		for _, v := range pl.GetAll("vertex") {
+			points = append(points, []float64{getFloat(v.GetAttr("lon")), getFloat(v.GetAttr("lat"))})
+		}
+
+		return points, pl.GetAttr("closed") == "true"
+	}
+
+	for _, l := range msg.GetDetail().GetAll("link") {
+		if p := parseLinkPoint(l.GetAttr("point")); p != nil {
+			points = append(points, p)
+		}
+	}
+
+	return points, len(points) > 3 && samePosition(points[0], points[len(points)-1])
+}
+
+// parseLinkPoint parses lat,lon[,hae] point attribute to lon,lat[,hae] position.
+func parseLinkPoint(s string) []float64 {
+	parts := strings.Split(s, ",")
+
+	if len(parts) < 2 {
+		return nil
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil
+	}
+
+	if len(parts) > 2 {
+		if hae, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64); err == nil {
+			return []float64{lon, lat, hae}
+		}
+	}
+
+	return []float64{lon, lat}
+}
+
+func formatLinkPoint(p []float64) string {
+	s := strconv.FormatFloat(p[1], 'f', -1, 64) + "," + strconv.FormatFloat(p[0], 'f', -1, 64)
+
+	if len(p) > 2 {
+		s += "," + strconv.FormatFloat(p[2], 'f', -1, 64)
+	}
+
+	return s
+}
+
+func samePosition(a, b []float64) bool {
+	return a[0] == b[0] && a[1] == b[1]
+}
+
+// FeatureToCot converts GeoJSON feature to cot message. Uid is generated if feature has no id,
+// type is b-m-p-s-m for points and u-d-f for lines and polygons if it is not in properties.
+func FeatureToCot(f *Feature, from, scope string) (*CotMessage, error) {
+	if f == nil || f.Geometry == nil || len(f.Geometry.Positions) == 0 {
+		return nil, fmt.Errorf("feature without geometry")
+	}
+
+	props := f.Properties
+
+	uid := f.ID
+	if uid == "" {
+		uid = uuid.New().String()
+	}
+
+	typ := propString(props, "type")
+	if typ == "" {
+		if f.Geometry.Type == GeoPoint {
+			typ = defaultPointType
+		} else {
+			typ = defaultShapeType
+		}
+	}
+
+	msg := BasicMsg(typ, uid, featureStale)
+	evt := msg.GetCotEvent()
+	evt.How = propString(props, "how")
+
+	if evt.How == "" {
+		evt.How = "h-g-i-g-o"
+	}
+
+	for k, v := range map[string]*uint64{"time": &evt.SendTime, "start": &evt.StartTime, "stale": &evt.StaleTime} {
+		if s := propString(props, k); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s: %w", k, err)
+			}
+
+			*v = TimeToMillis(t)
+		}
+	}
+
+	evt.Lat, evt.Lon, evt.Hae = f.Geometry.Position()
+
+	evt.Detail = &cotproto.Detail{}
+
+	if cs := propString(props, "callsign"); cs != "" {
+		evt.Detail.Contact = &cotproto.Contact{Callsign: cs, Endpoint: propString(props, "endpoint")}
+	}
+
+	if team, role := propString(props, "team"), propString(props, "role"); team != "" || role != "" {
+		evt.Detail.Group = &cotproto.Group{Name: team, Role: role}
+	}
+
+	if _, ok := props["course"]; ok {
+		evt.Detail.Track = &cotproto.Track{Course: propFloat(props, "course"), Speed: propFloat(props, "speed")}
+	}
+
+	xd := NewXMLDetails()
+
+	if f.Geometry.Type != GeoPoint {
+		points := f.Geometry.Positions
+
+		// rectangle has four corners without closing point
+		if MatchPattern(typ, "u-d-r") && len(points) > 1 && samePosition(points[0], points[len(points)-1]) {
+			points = points[:len(points)-1]
+		}
+
+		for i, p := range points {
+			if MatchPattern(typ, "b-m-r") {
+				xd.AddChild("link", map[string]string{
+					"uid":      fmt.Sprintf("%s-%d", uid, i),
+					"type":     "b-m-p-w",
+					"point":    formatLinkPoint(p),
+					"relation": "c",
+				}, "")
+			} else {
+				xd.AddChild("link", map[string]string{"point": formatLinkPoint(p)}, "")
+			}
+		}
+	}
+
+	if e, ok := props["ellipse"].(map[string]any); ok {
+		xd.AddChild("shape", nil, "").AddChild("ellipse", map[string]string{
+			"major": formatFloat(e["major"]),
+			"minor": formatFloat(e["minor"]),
+			"angle": formatFloat(e["angle"]),
+		}, "")
+	}
+
+	for k, tag := range map[string]string{"stroke_color": "strokeColor", "stroke_weight": "strokeWeight", "fill_color": "fillColor"} {
+		if v := propString(props, k); v != "" {
+			xd.AddChild(tag, map[string]string{"value": v}, "")
+		}
+	}
+
+	if v := propString(props, "color"); v != "" {
+		xd.AddChild("color", map[string]string{"argb": v}, "")
+	}
+
+	if v := propString(props, "iconsetpath"); v != "" {
+		xd.AddChild("usericon", map[string]string{"iconsetpath": v}, "")
+	}
+
+	if v := propString(props, "remarks"); v != "" {
+		xd.AddChild("remarks", nil, v)
+	}
+
+	evt.Detail.XmlDetail = xd.AsXMLString()
+
+	return CotFromProto(msg, from, scope)
+}
+
+func propString(props map[string]any, name string) string {
+	switch v := props[name].(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func propFloat(props map[string]any, name string) float64 {
+	switch v := props[name].(type) {
+	case float64:
+		return v
+	case string:
+		return getFloat(v)
+	default:
+		return 0
+	}
+}
+
+func formatFloat(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	return ""
+}
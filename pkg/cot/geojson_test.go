@@ -0,0 +1,157 @@
+package cot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+func geoMsg(t *testing.T, typ string, xmlDetail string) *CotMessage {
+	msg := BasicMsg(typ, "uid1", time.Hour)
+	msg.CotEvent.Lat = 60.5
+	msg.CotEvent.Lon = 30.25
+	msg.CotEvent.Detail = &cotproto.Detail{
+		XmlDetail: xmlDetail,
+		Contact:   &cotproto.Contact{Callsign: "name1"},
+	}
+
+	m, err := CotFromProto(msg, "", "scope1")
+	require.NoError(t, err)
+
+	return m
+}
+
+// roundTrip converts message to GeoJSON text and back.
+func roundTrip(t *testing.T, m *CotMessage) (*Feature, *CotMessage) {
+	b, err := json.Marshal(CotToFeature(m))
+	require.NoError(t, err)
+
+	f := new(Feature)
+	require.NoError(t, json.Unmarshal(b, f))
+
+	m2, err := FeatureToCot(f, "", "scope1")
+	require.NoError(t, err)
+
+	return f, m2
+}
+
+func TestGeoJSONPoint(t *testing.T) {
+	msg := BasicMsg("a-f-G-U-C", "uid1", time.Hour)
+	msg.CotEvent.Lat = 60.5
+	msg.CotEvent.Lon = 30.25
+	msg.CotEvent.Hae = 100
+	msg.CotEvent.Detail = &cotproto.Detail{
+		XmlDetail: "<remarks>remark text</remarks><color argb=\"-65536\"></color>",
+		Contact:   &cotproto.Contact{Callsign: "callsign", Endpoint: "*:-1:stcp"},
+		Group:     &cotproto.Group{Name: "Red", Role: "Medic"},
+		Track:     &cotproto.Track{Course: 90, Speed: 5.5},
+	}
+
+	m, err := CotFromProto(msg, "", "scope1")
+	require.NoError(t, err)
+
+	f, m2 := roundTrip(t, m)
+
+	assert.Equal(t, "uid1", f.ID)
+	assert.Equal(t, GeoPoint, f.Geometry.Type)
+	assert.Equal(t, [][]float64{{30.25, 60.5, 100}}, f.Geometry.Positions)
+	assert.Equal(t, "callsign", f.Properties["callsign"])
+	assert.Equal(t, "remark text", f.Properties["remarks"])
+	assert.Equal(t, 5.5, f.Properties["speed"])
+
+	evt, evt2 := m.GetTakMessage().GetCotEvent(), m2.GetTakMessage().GetCotEvent()
+
+	assert.Equal(t, evt.GetUid(), evt2.GetUid())
+	assert.Equal(t, evt.GetType(), evt2.GetType())
+	assert.Equal(t, evt.GetHow(), evt2.GetHow())
+	assert.Equal(t, evt.GetSendTime(), evt2.GetSendTime())
+	assert.Equal(t, evt.GetStaleTime(), evt2.GetStaleTime())
+	assert.Equal(t, evt.GetLat(), evt2.GetLat())
+	assert.Equal(t, evt.GetLon(), evt2.GetLon())
+	assert.Equal(t, evt.GetHae(), evt2.GetHae())
+	assert.Equal(t, "callsign", m2.GetCallsign())
+	assert.Equal(t, "*:-1:stcp", m2.GetEndpoint())
+	assert.Equal(t, "Red", m2.GetTeam())
+	assert.Equal(t, "Medic", m2.GetRole())
+	assert.Equal(t, "-65536", m2.GetColor())
+	assert.Equal(t, "remark text", m2.GetDetail().GetFirst("remarks").GetText())
+	assert.Equal(t, 90., evt2.GetDetail().GetTrack().GetCourse())
+	assert.Equal(t, 5.5, evt2.GetDetail().GetTrack().GetSpeed())
+}
+
+func TestGeoJSONShapes(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		typ    string
+		detail string
+		geom   string
+		points int
+		links  int
+	}{
+		{"line", "u-d-f", "<link point=\"60,30\"/><link point=\"60.1,30.1\"/><link point=\"60.2,30.2\"/><strokeColor value=\"-1\"/>", GeoLineString, 3, 3},
+		{"closed", "u-d-f", "<link point=\"60,30\"/><link point=\"60.1,30.1\"/><link point=\"60.2,30\"/><link point=\"60,30\"/>", GeoPolygon, 4, 4},
+		{"rectangle", "u-d-r", "<link point=\"60,30\"/><link point=\"60,31\"/><link point=\"61,31\"/><link point=\"61,30\"/>", GeoPolygon, 5, 4},
+		{"route", "b-m-r", "<link uid=\"w1\" point=\"60,30\" relation=\"c\"/><link uid=\"w2\" point=\"60.1,30.1\" relation=\"c\"/>", GeoLineString, 2, 2},
+		{"polyline", "u-d-p", "<shape><polyline closed=\"true\"><vertex lat=\"60\" lon=\"30\"/><vertex lat=\"60.1\" lon=\"30.1\"/><vertex lat=\"60.2\" lon=\"30\"/></polyline></shape>", GeoPolygon, 4, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, m2 := roundTrip(t, geoMsg(t, tc.typ, tc.detail))
+
+			assert.Equal(t, tc.geom, f.Geometry.Type)
+			assert.Len(t, f.Geometry.Positions, tc.points)
+			assert.Equal(t, tc.typ, m2.GetType())
+			assert.Len(t, m2.GetDetail().GetAll("link"), tc.links)
+			assert.Equal(t, "name1", m2.GetCallsign())
+
+			// second conversion gives the same geometry
+			assert.Equal(t, f.Geometry, CotToFeature(m2).Geometry)
+		})
+	}
+}
+
+func TestGeoJSONEllipse(t *testing.T) {
+	f, m2 := roundTrip(t, geoMsg(t, "u-d-c-c", "<shape><ellipse major=\"500\" minor=\"300\" angle=\"45\"/></shape>"))
+
+	assert.Equal(t, GeoPoint, f.Geometry.Type)
+	assert.Equal(t, map[string]any{"major": 500., "minor": 300., "angle": 45.}, f.Properties["ellipse"])
+
+	e := m2.GetDetail().GetFirst("shape").GetFirst("ellipse")
+	assert.Equal(t, "500", e.GetAttr("major"))
+	assert.Equal(t, "300", e.GetAttr("minor"))
+	assert.Equal(t, "45", e.GetAttr("angle"))
+	assert.Equal(t, 60.5, m2.GetLat())
+}
+
+func TestFeatureToCot(t *testing.T) {
+	f := new(Feature)
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[30,60],[31,60],[31,61],[30,60]],[[30.1,60.1],[30.2,60.1],[30.1,60.2],[30.1,60.1]]]},"properties":{"callsign":"area","stroke_weight":3}}`), f))
+
+	m, err := FeatureToCot(f, "", "scope1")
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, m.GetUID())
+	assert.Equal(t, "u-d-f", m.GetType())
+	assert.Equal(t, "area", m.GetCallsign())
+	assert.Equal(t, "scope1", m.Scope)
+	assert.Equal(t, 60., m.GetLat())
+	assert.Equal(t, 30., m.GetLon())
+	assert.Equal(t, float64(NotNum), m.GetTakMessage().GetCotEvent().GetHae())
+	assert.Len(t, m.GetDetail().GetAll("link"), 4)
+	assert.Equal(t, "3", m.GetDetail().GetFirst("strokeWeight").GetAttr("value"))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[30,60]},"properties":{}}`), f))
+	m, err = FeatureToCot(f, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "b-m-p-s-m", m.GetType())
+
+	_, err = FeatureToCot(&Feature{Type: "Feature"}, "", "")
+	assert.Error(t, err)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"type":"Feature","geometry":{"type":"Point","coordinates":[30]}}`), f))
+	assert.Error(t, json.Unmarshal([]byte(`{"type":"Feature","geometry":{"type":"MultiPoint","coordinates":[[30,60]]}}`), f))
+}
@@ -186,6 +186,19 @@ func (n *Node) GetAttr(name string) string {
 	return ""
 }
 
+// setAttr changes the value of attribute or adds a new one.
+func (n *Node) setAttr(name, value string) {
+	for i, a := range n.Attrs {
+		if a.Name.Local == name {
+			n.Attrs[i].Value = value
+
+			return
+		}
+	}
+
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
 func (n *Node) GetAttrs() map[string]string {
 	res := make(map[string]string)
 	if n == nil {
@@ -262,7 +275,7 @@ func (n *Node) AddChild(name string, params map[string]string, text string) *Nod
 func (n *Node) AddOrChangeChild(name string, params map[string]string) *Node {
 	if c := n.GetFirst(name); c != nil {
 		for k, v := range params {
-			c.Attrs = append(c.Attrs, xml.Attr{Name: xml.Name{Local: k}, Value: v})
+			c.setAttr(k, v)
 		}
 
 		return c
@@ -19,3 +19,14 @@ func Test1(t *testing.T) {
 	assert.Len(t, details.GetAll("link"), 12)
 	assert.Len(t, details.GetAll("link_attr"), 1)
 }
+
+func TestAddOrChangeChild(t *testing.T) {
+	xd := NewXMLDetails()
+	xd.AddOrChangeChild("flow", map[string]string{"a": "1"})
+	xd.AddOrChangeChild("flow", map[string]string{"a": "2", "b": "3"})
+
+	require.Len(t, xd.GetAll("flow"), 1)
+	assert.Len(t, xd.GetFirst("flow").Attrs, 2)
+	assert.Equal(t, "2", xd.GetFirst("flow").GetAttr("a"))
+	assert.Equal(t, "3", xd.GetFirst("flow").GetAttr("b"))
+}
@@ -0,0 +1,62 @@
+// Package gpx reads waypoints, routes and tracks from GPX 1.0 and 1.1 files.
+package gpx
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type GPX struct {
+	XMLName   xml.Name `xml:"gpx"`
+	Waypoints []*Point `xml:"wpt"`
+	Routes    []*Route `xml:"rte"`
+	Tracks    []*Track `xml:"trk"`
+}
+
+type Point struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Ele  float64 `xml:"ele"`
+	Name string  `xml:"name"`
+	Desc string  `xml:"desc"`
+	Cmt  string  `xml:"cmt"`
+	Sym  string  `xml:"sym"`
+}
+
+type Route struct {
+	Name   string   `xml:"name"`
+	Desc   string   `xml:"desc"`
+	Points []*Point `xml:"rtept"`
+}
+
+type Track struct {
+	Name     string     `xml:"name"`
+	Desc     string     `xml:"desc"`
+	Segments []*Segment `xml:"trkseg"`
+}
+
+type Segment struct {
+	Points []*Point `xml:"trkpt"`
+}
+
+func Read(r io.Reader) (*GPX, error) {
+	g := new(GPX)
+
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+
+	if err := dec.Decode(g); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Description returns description or comment of the point.
+func (p *Point) Description() string {
+	if p.Desc != "" {
+		return p.Desc
+	}
+
+	return p.Cmt
+}
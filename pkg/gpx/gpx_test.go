@@ -0,0 +1,46 @@
+package gpx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+ <wpt lat="60.25" lon="30.5"><ele>12.5</ele><name>wp1</name><cmt>comment</cmt></wpt>
+ <rte>
+  <name>route1</name>
+  <rtept lat="60" lon="30"/>
+  <rtept lat="60.1" lon="30.1"/>
+ </rte>
+ <trk>
+  <name>track1</name>
+  <trkseg><trkpt lat="60" lon="30"/><trkpt lat="60.2" lon="30.2"/></trkseg>
+  <trkseg><trkpt lat="61" lon="31"/></trkseg>
+ </trk>
+</gpx>`
+
+func TestRead(t *testing.T) {
+	g, err := Read(strings.NewReader(testGpx))
+	require.NoError(t, err)
+
+	require.Len(t, g.Waypoints, 1)
+	assert.Equal(t, 60.25, g.Waypoints[0].Lat)
+	assert.Equal(t, 30.5, g.Waypoints[0].Lon)
+	assert.Equal(t, 12.5, g.Waypoints[0].Ele)
+	assert.Equal(t, "comment", g.Waypoints[0].Description())
+
+	require.Len(t, g.Routes, 1)
+	assert.Equal(t, "route1", g.Routes[0].Name)
+	assert.Len(t, g.Routes[0].Points, 2)
+
+	require.Len(t, g.Tracks, 1)
+	require.Len(t, g.Tracks[0].Segments, 2)
+	assert.Len(t, g.Tracks[0].Segments[0].Points, 2)
+
+	_, err = Read(strings.NewReader("<kml/>"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,297 @@
+// Package kml has minimal KML 2.2 document model to export and import placemarks, tracks and polygons.
+package kml
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Namespace = "http://www.opengis.net/kml/2.2"
+
+	ContentTypeKML = "application/vnd.google-earth.kml+xml"
+	ContentTypeKMZ = "application/vnd.google-earth.kmz"
+
+	// kmzDoc is the name of the main document in kmz archive.
+	kmzDoc = "doc.kml"
+)
+
+type KML struct {
+	XMLName  xml.Name  `xml:"kml"`
+	Xmlns    string    `xml:"xmlns,attr,omitempty"`
+	Document *Document `xml:"Document"`
+	// some files have folder or placemarks without document
+	Folder     *Folder      `xml:"Folder"`
+	Placemarks []*Placemark `xml:"Placemark"`
+}
+
+type Document struct {
+	Name        string       `xml:"name,omitempty"`
+	Description string       `xml:"description,omitempty"`
+	Styles      []*Style     `xml:"Style"`
+	StyleMaps   []*StyleMap  `xml:"StyleMap"`
+	Documents   []*Document  `xml:"Document"`
+	Folders     []*Folder    `xml:"Folder"`
+	Placemarks  []*Placemark `xml:"Placemark"`
+}
+
+type Folder struct {
+	Name        string       `xml:"name,omitempty"`
+	Description string       `xml:"description,omitempty"`
+	Folders     []*Folder    `xml:"Folder"`
+	Placemarks  []*Placemark `xml:"Placemark"`
+}
+
+type StyleMap struct {
+	ID    string  `xml:"id,attr,omitempty"`
+	Pairs []*Pair `xml:"Pair"`
+}
+
+type Pair struct {
+	Key      string `xml:"key"`
+	StyleURL string `xml:"styleUrl"`
+}
+
+type Style struct {
+	ID        string     `xml:"id,attr,omitempty"`
+	IconStyle *IconStyle `xml:"IconStyle"`
+	LineStyle *LineStyle `xml:"LineStyle"`
+	PolyStyle *PolyStyle `xml:"PolyStyle"`
+}
+
+type IconStyle struct {
+	Color string  `xml:"color,omitempty"`
+	Scale float64 `xml:"scale,omitempty"`
+	Icon  *Icon   `xml:"Icon"`
+}
+
+type Icon struct {
+	Href string `xml:"href"`
+}
+
+type LineStyle struct {
+	Color string  `xml:"color,omitempty"`
+	Width float64 `xml:"width,omitempty"`
+}
+
+type PolyStyle struct {
+	Color string `xml:"color,omitempty"`
+}
+
+type Placemark struct {
+	ID           string        `xml:"id,attr,omitempty"`
+	Name         string        `xml:"name,omitempty"`
+	Description  string        `xml:"description,omitempty"`
+	TimeStamp    *TimeStamp    `xml:"TimeStamp"`
+	TimeSpan     *TimeSpan     `xml:"TimeSpan"`
+	StyleURL     string        `xml:"styleUrl,omitempty"`
+	Style        *Style        `xml:"Style"`
+	ExtendedData *ExtendedData `xml:"ExtendedData"`
+
+	Point         *Point         `xml:"Point"`
+	LineString    *LineString    `xml:"LineString"`
+	Polygon       *Polygon       `xml:"Polygon"`
+	MultiGeometry *MultiGeometry `xml:"MultiGeometry"`
+}
+
+type TimeStamp struct {
+	When string `xml:"when"`
+}
+
+type TimeSpan struct {
+	Begin string `xml:"begin,omitempty"`
+	End   string `xml:"end,omitempty"`
+}
+
+type ExtendedData struct {
+	Data []*Data `xml:"Data"`
+}
+
+type Data struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type Point struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type LineString struct {
+	Tessellate  int    `xml:"tessellate,omitempty"`
+	Coordinates string `xml:"coordinates"`
+}
+
+type Polygon struct {
+	OuterBoundaryIs *Boundary   `xml:"outerBoundaryIs"`
+	InnerBoundaryIs []*Boundary `xml:"innerBoundaryIs"`
+}
+
+type Boundary struct {
+	LinearRing *LinearRing `xml:"LinearRing"`
+}
+
+type LinearRing struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type MultiGeometry struct {
+	Points         []*Point         `xml:"Point"`
+	LineStrings    []*LineString    `xml:"LineString"`
+	Polygons       []*Polygon       `xml:"Polygon"`
+	MultiGeometrys []*MultiGeometry `xml:"MultiGeometry"`
+}
+
+// Coord is the point of geometry, alt is in meters.
+type Coord struct {
+	Lat float64
+	Lon float64
+	Alt float64
+}
+
+func NewDocument(name string) *Document {
+	return &Document{Name: name}
+}
+
+// AddStyle adds style if there is no style with the same id and returns style url.
+func (d *Document) AddStyle(s *Style) string {
+	for _, s1 := range d.Styles {
+		if s1.ID == s.ID {
+			return "#" + s.ID
+		}
+	}
+
+	d.Styles = append(d.Styles, s)
+
+	return "#" + s.ID
+}
+
+// Write writes kml document.
+func Write(w io.Writer, doc *Document) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+
+	if err := enc.Encode(&KML{Xmlns: Namespace, Document: doc}); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// KMZFile opens content of the file to put in kmz archive.
+type KMZFile func() (io.ReadCloser, error)
+
+// WriteKMZ writes kmz archive with the document and files, file names are relative to the document.
+// Files are opened one by one and copied to the archive.
+func WriteKMZ(w io.Writer, doc *Document, files map[string]KMZFile) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create(kmzDoc)
+	if err != nil {
+		return err
+	}
+
+	if err := Write(f, doc); err != nil {
+		return err
+	}
+
+	for name, open := range files {
+		if err := writeKMZFile(zw, name, open); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeKMZFile(zw *zip.Writer, name string, open KMZFile) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+
+	return err
+}
+
+func NewPoint(c Coord) *Point {
+	return &Point{Coordinates: FormatCoords(c)}
+}
+
+func NewLineString(coords ...Coord) *LineString {
+	return &LineString{Tessellate: 1, Coordinates: FormatCoords(coords...)}
+}
+
+func NewPolygon(coords ...Coord) *Polygon {
+	return &Polygon{OuterBoundaryIs: &Boundary{LinearRing: &LinearRing{Coordinates: FormatCoords(coords...)}}}
+}
+
+func NewTimeStamp(t time.Time) *TimeStamp {
+	return &TimeStamp{When: t.UTC().Format(time.RFC3339)}
+}
+
+func NewTimeSpan(begin, end time.Time) *TimeSpan {
+	return &TimeSpan{Begin: begin.UTC().Format(time.RFC3339), End: end.UTC().Format(time.RFC3339)}
+}
+
+func (p *Placemark) AddData(name, value string) {
+	if value == "" {
+		return
+	}
+
+	if p.ExtendedData == nil {
+		p.ExtendedData = new(ExtendedData)
+	}
+
+	p.ExtendedData.Data = append(p.ExtendedData.Data, &Data{Name: name, Value: value})
+}
+
+// FormatCoords makes kml coordinates string, kml uses lon,lat[,alt] order.
+func FormatCoords(coords ...Coord) string {
+	sb := strings.Builder{}
+
+	for i, c := range coords {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+
+		sb.WriteString(strconv.FormatFloat(c.Lon, 'f', -1, 64))
+		sb.WriteByte(',')
+		sb.WriteString(strconv.FormatFloat(c.Lat, 'f', -1, 64))
+
+		if c.Alt != 0 {
+			sb.WriteByte(',')
+			sb.WriteString(strconv.FormatFloat(c.Alt, 'f', -1, 64))
+		}
+	}
+
+	return sb.String()
+}
+
+// ArgbToColor converts ATAK color (signed int argb) to kml aabbggrr hex color.
+func ArgbToColor(argb string) (string, error) {
+	n, err := strconv.ParseInt(argb, 10, 64)
+	if err != nil {
+		return "", err
+	}
+
+	v := uint32(n)
+
+	return fmt.Sprintf("%02x%02x%02x%02x", v>>24, v&0xff, (v>>8)&0xff, (v>>16)&0xff), nil
+}
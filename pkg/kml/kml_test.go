@@ -0,0 +1,72 @@
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgbToColor(t *testing.T) {
+	for argb, color := range map[string]string{
+		"-65536":     "ff0000ff",
+		"-16711936":  "ff00ff00",
+		"-16776961":  "ffff0000",
+		"-1":         "ffffffff",
+		"2130706432": "7f000000",
+	} {
+		c, err := ArgbToColor(argb)
+		require.NoError(t, err)
+		assert.Equal(t, color, c, argb)
+	}
+
+	_, err := ArgbToColor("red")
+	assert.Error(t, err)
+}
+
+func TestWrite(t *testing.T) {
+	doc := NewDocument("test")
+	style := doc.AddStyle(&Style{ID: "s1", IconStyle: &IconStyle{Color: "ff0000ff"}})
+	assert.Equal(t, "#s1", doc.AddStyle(&Style{ID: "s1"}))
+	assert.Len(t, doc.Styles, 1)
+
+	p := &Placemark{Name: "p1", StyleURL: style, Point: NewPoint(Coord{Lat: 60.5, Lon: 30.25})}
+	p.AddData("uid", "uid1")
+	p.AddData("empty", "")
+
+	doc.Folders = append(doc.Folders, &Folder{
+		Name:       "f1",
+		Placemarks: []*Placemark{p, {Name: "line", LineString: NewLineString(Coord{Lat: 1, Lon: 2, Alt: 3}, Coord{Lat: 4, Lon: 5})}},
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, doc))
+
+	s := buf.String()
+	assert.Contains(t, s, `<kml xmlns="http://www.opengis.net/kml/2.2">`)
+	assert.Contains(t, s, "<coordinates>30.25,60.5</coordinates>")
+	assert.Contains(t, s, "<coordinates>2,1,3 5,4</coordinates>")
+	assert.Contains(t, s, `<Data name="uid">`)
+	assert.NotContains(t, s, "empty")
+
+	k := new(KML)
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), k))
+	require.Len(t, k.Document.Folders, 1)
+	assert.Equal(t, "p1", k.Document.Folders[0].Placemarks[0].Name)
+
+	buf.Reset()
+	require.NoError(t, WriteKMZ(&buf, doc, map[string]KMZFile{"files/a.txt": func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("aaa")), nil
+	}}))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, "doc.kml", zr.File[0].Name)
+	assert.Equal(t, "files/a.txt", zr.File[1].Name)
+}
@@ -0,0 +1,209 @@
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MaxSize is the max size of kml document to read.
+var MaxSize int64 = 50 << 20
+
+var ErrTooBig = errors.New("kml document is too big")
+
+// Read parses kml document, document bigger than MaxSize is not read.
+func Read(r io.Reader) (*KML, error) {
+	k := new(KML)
+
+	lr := &io.LimitedReader{R: r, N: MaxSize + 1}
+
+	dec := xml.NewDecoder(lr)
+	// kml is utf-8 in most cases, other charsets are read as is
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+
+	if err := dec.Decode(k); err != nil {
+		if lr.N <= 0 {
+			return nil, ErrTooBig
+		}
+
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// ReadKMZ parses doc.kml or the first kml file from kmz archive.
+func ReadKMZ(data []byte) (*KML, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var doc *zip.File
+
+	for _, f := range zr.File {
+		if f.Name == kmzDoc {
+			doc = f
+
+			break
+		}
+
+		if doc == nil && strings.EqualFold(path.Ext(f.Name), ".kml") {
+			doc = f
+		}
+	}
+
+	if doc == nil {
+		return nil, fmt.Errorf("no kml file in kmz")
+	}
+
+	if doc.UncompressedSize64 > uint64(MaxSize) {
+		return nil, ErrTooBig
+	}
+
+	r, err := doc.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	return Read(r)
+}
+
+// AllPlacemarks returns placemarks from all documents and folders.
+func (k *KML) AllPlacemarks() []*Placemark {
+	res := append([]*Placemark{}, k.Placemarks...)
+
+	if k.Folder != nil {
+		res = append(res, k.Folder.allPlacemarks()...)
+	}
+
+	if k.Document != nil {
+		res = append(res, k.Document.allPlacemarks()...)
+	}
+
+	return res
+}
+
+func (d *Document) allPlacemarks() []*Placemark {
+	res := append([]*Placemark{}, d.Placemarks...)
+
+	for _, f := range d.Folders {
+		res = append(res, f.allPlacemarks()...)
+	}
+
+	for _, d1 := range d.Documents {
+		res = append(res, d1.allPlacemarks()...)
+	}
+
+	return res
+}
+
+func (f *Folder) allPlacemarks() []*Placemark {
+	res := append([]*Placemark{}, f.Placemarks...)
+
+	for _, f1 := range f.Folders {
+		res = append(res, f1.allPlacemarks()...)
+	}
+
+	return res
+}
+
+// PlacemarkStyle returns inline style of the placemark or shared style by style url. Normal style of style map is used.
+func (k *KML) PlacemarkStyle(p *Placemark) *Style {
+	if p.Style != nil {
+		return p.Style
+	}
+
+	if k.Document == nil || !strings.HasPrefix(p.StyleURL, "#") {
+		return nil
+	}
+
+	return k.Document.findStyle(p.StyleURL[1:], 0)
+}
+
+func (d *Document) findStyle(id string, depth int) *Style {
+	for _, s := range d.Styles {
+		if s.ID == id {
+			return s
+		}
+	}
+
+	// style map can point to another style map, depth prevents loops
+	if depth > 2 {
+		return nil
+	}
+
+	for _, m := range d.StyleMaps {
+		if m.ID != id {
+			continue
+		}
+
+		for _, p := range m.Pairs {
+			if p.Key == "normal" && strings.HasPrefix(p.StyleURL, "#") {
+				return d.findStyle(p.StyleURL[1:], depth+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Coords parses kml coordinates string.
+func Coords(s string) ([]Coord, error) {
+	fields := strings.Fields(s)
+	res := make([]Coord, 0, len(fields))
+
+	for _, f := range fields {
+		parts := strings.Split(f, ",")
+
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("bad coordinates %s", f)
+		}
+
+		lon, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		lat, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		c := Coord{Lat: lat, Lon: lon}
+
+		if len(parts) > 2 {
+			c.Alt, _ = strconv.ParseFloat(parts[2], 64)
+		}
+
+		res = append(res, c)
+	}
+
+	return res, nil
+}
+
+// ColorToArgb converts kml aabbggrr hex color to ATAK color (signed int argb).
+func ColorToArgb(color string) (string, error) {
+	color = strings.TrimPrefix(strings.TrimSpace(color), "#")
+
+	v, err := strconv.ParseUint(color, 16, 32)
+	if err != nil {
+		return "", err
+	}
+
+	if len(color) == 6 {
+		v |= 0xff000000
+	}
+
+	a, b, g, r := v>>24, (v>>16)&0xff, (v>>8)&0xff, v&0xff
+
+	return strconv.Itoa(int(int32(uint32(a<<24 | r<<16 | g<<8 | b)))), nil
+}
@@ -0,0 +1,123 @@
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKml = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+ <Style id="red"><IconStyle><color>ff0000ff</color></IconStyle><LineStyle><color>ff0000ff</color></LineStyle></Style>
+ <StyleMap id="red_map">
+  <Pair><key>normal</key><styleUrl>#red</styleUrl></Pair>
+  <Pair><key>highlight</key><styleUrl>#blue</styleUrl></Pair>
+ </StyleMap>
+ <Placemark id="p1"><name>point</name><styleUrl>#red_map</styleUrl><Point><coordinates>30.5,60.25,10</coordinates></Point></Placemark>
+ <Folder>
+  <name>f1</name>
+  <Folder>
+   <Placemark><name>line</name><LineString><coordinates>30,60 30.1,60.1
+    30.2,60.2</coordinates></LineString></Placemark>
+  </Folder>
+ </Folder>
+</Document>
+</kml>`
+
+func TestRead(t *testing.T) {
+	k, err := Read(strings.NewReader(testKml))
+	require.NoError(t, err)
+
+	pms := k.AllPlacemarks()
+	require.Len(t, pms, 2)
+
+	assert.Equal(t, "p1", pms[0].ID)
+	assert.Equal(t, "ff0000ff", k.PlacemarkStyle(pms[0]).IconStyle.Color)
+	assert.Nil(t, k.PlacemarkStyle(pms[1]))
+
+	c, err := Coords(pms[1].LineString.Coordinates)
+	require.NoError(t, err)
+	assert.Equal(t, []Coord{{Lat: 60, Lon: 30}, {Lat: 60.1, Lon: 30.1}, {Lat: 60.2, Lon: 30.2}}, c)
+}
+
+func TestReadKMZ(t *testing.T) {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("files/model.kml")
+	require.NoError(t, err)
+	_, err = f.Write([]byte(testKml))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	k, err := ReadKMZ(buf.Bytes())
+	require.NoError(t, err)
+	assert.Len(t, k.AllPlacemarks(), 2)
+
+	_, err = ReadKMZ([]byte("not a zip"))
+	assert.Error(t, err)
+}
+
+func TestReadMaxSize(t *testing.T) {
+	old := MaxSize
+	MaxSize = int64(len(testKml)) - 10
+
+	defer func() { MaxSize = old }()
+
+	_, err := Read(strings.NewReader(testKml))
+	require.ErrorIs(t, err, ErrTooBig)
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("doc.kml")
+	require.NoError(t, err)
+	_, err = f.Write([]byte(testKml))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	_, err = ReadKMZ(buf.Bytes())
+	require.ErrorIs(t, err, ErrTooBig)
+}
+
+func TestCoords(t *testing.T) {
+	c, err := Coords(" 30.5,60.25,10\n\t31,61 ")
+	require.NoError(t, err)
+	assert.Equal(t, []Coord{{Lat: 60.25, Lon: 30.5, Alt: 10}, {Lat: 61, Lon: 31}}, c)
+
+	_, err = Coords("30.5")
+	assert.Error(t, err)
+
+	_, err = Coords("a,b")
+	assert.Error(t, err)
+}
+
+func TestColorToArgb(t *testing.T) {
+	for color, argb := range map[string]string{
+		"ff0000ff": "-65536",
+		"ff00ff00": "-16711936",
+		"ffff0000": "-16776961",
+		"ffffffff": "-1",
+		"7f000000": "2130706432",
+		"0000ff":   "-65536",
+	} {
+		c, err := ColorToArgb(color)
+		require.NoError(t, err)
+		assert.Equal(t, argb, c, color)
+
+		back, err := ArgbToColor(c)
+		require.NoError(t, err)
+
+		if len(color) == 8 {
+			assert.Equal(t, color, back)
+		}
+	}
+
+	_, err := ColorToArgb("red")
+	assert.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	AUDIT_LOGIN        = "login"
+	AUDIT_LOGIN_FAILED = "login_failed"
+	AUDIT_TLS_REJECTED = "tls_rejected"
+
+	AUDIT_DEVICE_CREATE = "device.create"
+	AUDIT_DEVICE_UPDATE = "device.update"
+	AUDIT_CERT_SIGN     = "cert.sign"
+	AUDIT_CERT_REVOKE   = "cert.revoke"
+	AUDIT_TOKEN_CREATE  = "token.create"
+	AUDIT_TOKEN_REVOKE  = "token.revoke"
+	AUDIT_ENROLL_CREATE = "enrollment.create"
+	AUDIT_ENROLL_DELETE = "enrollment.delete"
+	AUDIT_ENROLL_USE    = "enrollment.use"
+
+	AUDIT_FILE_DELETE    = "file.delete"
+	AUDIT_UNIT_DELETE    = "unit.delete"
+	AUDIT_PROFILE_CREATE = "profile.create"
+	AUDIT_PROFILE_UPDATE = "profile.update"
+	AUDIT_PROFILE_DELETE = "profile.delete"
+	AUDIT_FEED_CREATE    = "feed.create"
+	AUDIT_FEED_UPDATE    = "feed.update"
+	AUDIT_FEED_DELETE    = "feed.delete"
+	AUDIT_FENCE_CREATE   = "geofence.create"
+	AUDIT_FENCE_UPDATE   = "geofence.update"
+	AUDIT_FENCE_DELETE   = "geofence.delete"
+	AUDIT_FILTER_CREATE  = "filter.create"
+	AUDIT_FILTER_UPDATE  = "filter.update"
+	AUDIT_FILTER_DELETE  = "filter.delete"
+	AUDIT_UNBAN          = "unban"
+	AUDIT_IMPORT         = "import"
+)
+
+// AuditEvent is the record of administrative or security event.
+// Every event has hash of the previous one, so changed or deleted records break the chain.
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index;type:timestamp"`
+	Actor     string    `gorm:"index;size:255"`
+	Action    string    `gorm:"index;size:64"`
+	Object    string    `gorm:"index;size:255"`
+	Before    string    `gorm:"type:text"`
+	After     string    `gorm:"type:text"`
+	IP        string    `gorm:"size:64"`
+	PrevHash  string    `gorm:"size:64"`
+	Hash      string    `gorm:"size:64"`
+}
+
+type AuditEventDTO struct {
+	ID       uint            `json:"id"`
+	Time     time.Time       `json:"time"`
+	Actor    string          `json:"actor"`
+	Action   string          `json:"action"`
+	Object   string          `json:"object,omitempty"`
+	Before   json.RawMessage `json:"before,omitempty"`
+	After    json.RawMessage `json:"after,omitempty"`
+	IP       string          `json:"ip,omitempty"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+}
+
+// MakeHash returns hash of the event fields and hash of the previous event.
+// Time is taken with seconds precision, as some databases don't store more.
+func (e *AuditEvent) MakeHash() string {
+	h := sha256.New()
+
+	for _, s := range []string{e.PrevHash, strconv.FormatInt(e.CreatedAt.Unix(), 10), e.Actor, e.Action, e.Object, e.Before, e.After, e.IP} {
+		// length prefix makes field boundaries unambiguous
+		h.Write([]byte(strconv.Itoa(len(s)) + ":" + s))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (e *AuditEvent) DTO() *AuditEventDTO {
+	return &AuditEventDTO{
+		ID:       e.ID,
+		Time:     e.CreatedAt,
+		Actor:    e.Actor,
+		Action:   e.Action,
+		Object:   e.Object,
+		Before:   rawJSON(e.Before),
+		After:    rawJSON(e.After),
+		IP:       e.IP,
+		PrevHash: e.PrevHash,
+		Hash:     e.Hash,
+	}
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+
+	return json.RawMessage(s)
+}
@@ -12,6 +12,9 @@ type Certificate struct {
 	UID         string     `gorm:"index;size:255"`
 	LastConnect *time.Time `gorm:"type:timestamp"`
 	ValidTill   *time.Time `gorm:"type:timestamp"`
+	RevokedAt   *time.Time `gorm:"index;type:timestamp"`
+	RevokedBy   string     `gorm:"size:255"`
+	Reason      string     `gorm:"size:255"`
 }
 
 type CertificateDTO struct {
@@ -21,6 +24,14 @@ type CertificateDTO struct {
 	Login       string     `json:"login"`
 	Serial      string     `json:"serial"`
 	LastConnect *time.Time `json:"last_connect"`
+	ValidTill   *time.Time `json:"valid_till,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy   string     `json:"revoked_by,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+func (c *Certificate) IsRevoked() bool {
+	return c != nil && c.RevokedAt != nil
 }
 
 func (c *Certificate) DTO() *CertificateDTO {
@@ -35,5 +46,9 @@ func (c *Certificate) DTO() *CertificateDTO {
 		Login:       c.Login,
 		Serial:      c.Serial,
 		LastConnect: c.LastConnect,
+		ValidTill:   c.ValidTill,
+		RevokedAt:   c.RevokedAt,
+		RevokedBy:   c.RevokedBy,
+		Reason:      c.Reason,
 	}
 }
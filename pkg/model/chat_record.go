@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+)
+
+// ChatRecord is a chat message stored in database.
+type ChatRecord struct {
+	ID           uint      `gorm:"primaryKey"`
+	UID          string    `gorm:"uniqueIndex;size:255"`
+	MessageID    string    `gorm:"size:255"`
+	CreatedAt    time.Time `gorm:"index;type:timestamp"`
+	Scope        string    `gorm:"index;size:255"`
+	Chatroom     string    `gorm:"index;size:255"`
+	FromUID      string    `gorm:"index;size:255"`
+	FromCallsign string    `gorm:"size:255"`
+	ToUID        string    `gorm:"index;size:255"`
+	Direct       bool
+	File         bool
+	Text         string `gorm:"type:text"`
+	MsgData      []byte
+}
+
+type ChatRecordDTO struct {
+	UID          string    `json:"uid"`
+	MessageID    string    `json:"message_id"`
+	Time         time.Time `json:"time"`
+	Scope        string    `json:"scope"`
+	Chatroom     string    `json:"chatroom"`
+	FromUID      string    `json:"from_uid"`
+	FromCallsign string    `json:"from"`
+	ToUID        string    `json:"to_uid"`
+	Direct       bool      `json:"direct"`
+	File         bool      `json:"file"`
+	Text         string    `json:"text"`
+}
+
+func (c *ChatRecord) DTO() *ChatRecordDTO {
+	if c == nil {
+		return nil
+	}
+
+	return &ChatRecordDTO{
+		UID:          c.UID,
+		MessageID:    c.MessageID,
+		Time:         c.CreatedAt,
+		Scope:        c.Scope,
+		Chatroom:     c.Chatroom,
+		FromUID:      c.FromUID,
+		FromCallsign: c.FromCallsign,
+		ToUID:        c.ToUID,
+		Direct:       c.Direct,
+		File:         c.File,
+		Text:         c.Text,
+	}
+}
@@ -15,9 +15,13 @@ type Device struct {
 	Scope       string         `gorm:"not null;size:255" yaml:"scope"`
 	Disabled    bool           `gorm:"not null;default:false"`
 	Admin       bool           `gorm:"not null;default:false"`
+	Role        string         `gorm:"not null;size:32;default:''" yaml:"role"`
 	ReadScope   []string       `gorm:"serializer:json" yaml:"read_scope"`
 	LastConnect *time.Time     `gorm:"type:timestamp"`
 	Certs       []*Certificate `gorm:"foreignKey:Login"`
+	Groups      []*DeviceGroup `gorm:"foreignKey:Login;references:Login" yaml:"-"`
+	SsoIssuer   string         `gorm:"not null;size:255;default:''" yaml:"-"`
+	SsoSubject  string         `gorm:"not null;size:255;default:'';index" yaml:"-"`
 	CreatedAt   time.Time      `gorm:"type:timestamp"`
 	UpdatedAt   time.Time      `gorm:"type:timestamp"`
 }
@@ -27,17 +31,22 @@ type DeviceDTO struct {
 	Scope       string            `json:"scope"`
 	Disabled    bool              `json:"disabled"`
 	Admin       bool              `json:"admin,omitempty"`
+	Role        string            `json:"role,omitempty"`
 	ReadScope   []string          `json:"read_scope,omitempty"`
 	LastConnect *time.Time        `json:"last_connect,omitempty"`
 	Certs       []*CertificateDTO `json:"certs,omitempty"`
+	Groups      []*DeviceGroupDTO `json:"groups,omitempty"`
 }
 
 type DevicePutDTO struct {
 	Admin     bool     `json:"admin,omitempty"`
+	Role      string   `json:"role,omitempty"`
 	Disabled  bool     `json:"disabled"`
 	Password  string   `json:"password,omitempty"`
 	Scope     string   `json:"scope,omitempty"`
 	ReadScope []string `json:"read_scope,omitempty"`
+	// replaces groups made from scope and read_scope, groups are not changed if nil
+	Groups *[]*DeviceGroupDTO `json:"groups,omitempty"`
 }
 
 type DevicePostDTO struct {
@@ -45,6 +54,15 @@ type DevicePostDTO struct {
 	DevicePutDTO
 }
 
+// GroupList returns groups from dto or nil if there are no groups in it.
+func (m *DevicePutDTO) GroupList() []*DeviceGroupDTO {
+	if m.Groups == nil {
+		return nil
+	}
+
+	return *m.Groups
+}
+
 func (u *Device) GetLogin() string {
 	if u == nil {
 		return ""
@@ -75,17 +93,7 @@ func (u *Device) CanSeeScope(scope string) bool {
 		return scope == ""
 	}
 
-	if u.GetScope() == scope {
-		return true
-	}
-
-	for _, s := range u.ReadScope {
-		if s == "*" || s == scope {
-			return true
-		}
-	}
-
-	return false
+	return u.CanSeeGroups([]string{scope})
 }
 
 func (u *Device) CheckPassword(password string) bool {
@@ -135,13 +143,20 @@ func (u *Device) DTO() *DeviceDTO {
 		certs[i] = c.DTO()
 	}
 
+	groups := make([]*DeviceGroupDTO, len(u.Groups))
+	for i, g := range u.Groups {
+		groups[i] = g.DTO()
+	}
+
 	return &DeviceDTO{
 		Login:       u.Login,
 		Scope:       u.Scope,
 		Disabled:    u.Disabled,
 		Admin:       u.Admin,
+		Role:        u.AdminRole(),
 		ReadScope:   u.ReadScope,
 		LastConnect: u.LastConnect,
 		Certs:       certs,
+		Groups:      groups,
 	}
 }
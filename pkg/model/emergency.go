@@ -0,0 +1,165 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+const (
+	EMERGENCY_ACTIVE       = "active"
+	EMERGENCY_ACKNOWLEDGED = "acknowledged"
+	EMERGENCY_CANCELLED    = "cancelled"
+
+	EMERGENCY_CANCEL_TYPE = "b-a-o-can"
+)
+
+// Emergency is the alert (911, ring the bell, troops in contact etc.) sent by device.
+type Emergency struct {
+	UID         string    `gorm:"primaryKey;size:255"`
+	CreatedAt   time.Time `gorm:"index;type:timestamp"`
+	UpdatedAt   time.Time `gorm:"type:timestamp"`
+	Type        string    `gorm:"size:64"`
+	Kind        string    `gorm:"size:255"`
+	ContactUID  string    `gorm:"index;size:255"`
+	Callsign    string    `gorm:"size:255"`
+	Scope       string    `gorm:"index;size:255"`
+	Status      string    `gorm:"index;size:32"`
+	Lat         float64
+	Lon         float64
+	AckBy       string     `gorm:"size:255"`
+	AckAt       *time.Time `gorm:"type:timestamp"`
+	CancelledBy string     `gorm:"size:255"`
+	CancelledAt *time.Time `gorm:"type:timestamp"`
+}
+
+type EmergencyDTO struct {
+	UID         string     `json:"uid"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Type        string     `json:"type"`
+	Kind        string     `json:"kind"`
+	ContactUID  string     `json:"contact_uid"`
+	Callsign    string     `json:"callsign"`
+	Scope       string     `json:"scope"`
+	Status      string     `json:"status"`
+	Lat         float64    `json:"lat"`
+	Lon         float64    `json:"lon"`
+	AckBy       string     `json:"ack_by,omitempty"`
+	AckAt       *time.Time `json:"ack_at,omitempty"`
+	CancelledBy string     `json:"cancelled_by,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+}
+
+// EmergencyLog is the audit record of emergency state change.
+type EmergencyLog struct {
+	ID           uint      `gorm:"primaryKey"`
+	CreatedAt    time.Time `gorm:"index;type:timestamp"`
+	EmergencyUID string    `gorm:"index;size:255"`
+	Action       string    `gorm:"size:32"`
+	User         string    `gorm:"size:255"`
+	Text         string    `gorm:"size:1024"`
+}
+
+type EmergencyLogDTO struct {
+	Time         time.Time `json:"time"`
+	EmergencyUID string    `json:"emergency_uid"`
+	Action       string    `json:"action"`
+	User         string    `json:"user"`
+	Text         string    `json:"text"`
+}
+
+func IsEmergency(msg *cot.CotMessage) bool {
+	return strings.HasPrefix(msg.GetType(), "b-a-o-")
+}
+
+// EmergencyFromMsg makes emergency from alert message.
+func EmergencyFromMsg(msg *cot.CotMessage) *Emergency {
+	e := &Emergency{
+		UID:        msg.GetUID(),
+		Type:       msg.GetType(),
+		Kind:       cot.GetMsgType(msg.GetType()),
+		ContactUID: msg.GetFirstLink("p-p").GetAttr("uid"),
+		Callsign:   msg.GetCallsign(),
+		Scope:      msg.Scope,
+		Status:     EMERGENCY_ACTIVE,
+		Lat:        msg.GetLat(),
+		Lon:        msg.GetLon(),
+	}
+
+	if em := msg.GetDetail().GetFirst("emergency"); em != nil {
+		if t := em.GetAttr("type"); t != "" {
+			e.Kind = t
+		}
+
+		if s := strings.TrimSpace(em.GetText()); s != "" {
+			e.Callsign = s
+		}
+	}
+
+	return e
+}
+
+// IsEmergencyCancel checks if message cancels the emergency.
+func IsEmergencyCancel(msg *cot.CotMessage) bool {
+	return msg.GetType() == EMERGENCY_CANCEL_TYPE || msg.GetDetail().GetFirst("emergency").GetAttr("cancel") == "true"
+}
+
+// CancelMsg makes message to remove the alert from devices.
+func (e *Emergency) CancelMsg() *cotproto.TakMessage {
+	msg := cot.BasicMsg(EMERGENCY_CANCEL_TYPE, e.UID, time.Second*20)
+	msg.CotEvent.How = "h-e"
+	msg.CotEvent.Lat = e.Lat
+	msg.CotEvent.Lon = e.Lon
+
+	xd := cot.NewXMLDetails()
+	xd.AddPpLink(e.ContactUID, "", "")
+	xd.AddChild("emergency", map[string]string{"cancel": "true"}, e.Callsign)
+	msg.CotEvent.Detail = &cotproto.Detail{XmlDetail: xd.AsXMLString()}
+
+	return msg
+}
+
+func (e *Emergency) IsActive() bool {
+	return e != nil && e.Status != EMERGENCY_CANCELLED
+}
+
+func (e *Emergency) DTO() *EmergencyDTO {
+	if e == nil {
+		return nil
+	}
+
+	return &EmergencyDTO{
+		UID:         e.UID,
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+		Type:        e.Type,
+		Kind:        e.Kind,
+		ContactUID:  e.ContactUID,
+		Callsign:    e.Callsign,
+		Scope:       e.Scope,
+		Status:      e.Status,
+		Lat:         e.Lat,
+		Lon:         e.Lon,
+		AckBy:       e.AckBy,
+		AckAt:       e.AckAt,
+		CancelledBy: e.CancelledBy,
+		CancelledAt: e.CancelledAt,
+	}
+}
+
+func (l *EmergencyLog) DTO() *EmergencyLogDTO {
+	if l == nil {
+		return nil
+	}
+
+	return &EmergencyLogDTO{
+		Time:         l.CreatedAt,
+		EmergencyUID: l.EmergencyUID,
+		Action:       l.Action,
+		User:         l.User,
+		Text:         l.Text,
+	}
+}
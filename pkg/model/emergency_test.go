@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+func TestEmergency(t *testing.T) {
+	msg := cot.BasicMsg("b-a-o-tbl", "ANDROID-123-9-1-1", time.Minute)
+	msg.CotEvent.Lat = 10
+	msg.CotEvent.Lon = 20
+
+	xd := cot.NewXMLDetails()
+	xd.AddPpLink("ANDROID-123", "a-f-G-U-C", "")
+	xd.AddChild("emergency", map[string]string{"type": "911 Alert"}, "Joe")
+	msg.CotEvent.Detail = &cotproto.Detail{XmlDetail: xd.AsXMLString(), Contact: &cotproto.Contact{Callsign: "Joe-Alert"}}
+
+	m, err := cot.CotFromProto(msg, "", "blue")
+	require.NoError(t, err)
+
+	assert.True(t, IsEmergency(m))
+	assert.False(t, IsEmergencyCancel(m))
+
+	e := EmergencyFromMsg(m)
+	assert.Equal(t, "ANDROID-123-9-1-1", e.UID)
+	assert.Equal(t, "ANDROID-123", e.ContactUID)
+	assert.Equal(t, "911 Alert", e.Kind)
+	assert.Equal(t, "Joe", e.Callsign)
+	assert.Equal(t, "blue", e.Scope)
+	assert.Equal(t, EMERGENCY_ACTIVE, e.Status)
+	assert.InDelta(t, 10, e.Lat, 0.0001)
+
+	c, err := cot.CotFromProto(e.CancelMsg(), "", "blue")
+	require.NoError(t, err)
+
+	assert.True(t, IsEmergencyCancel(c))
+	assert.Equal(t, e.UID, c.GetUID())
+	assert.Equal(t, "ANDROID-123", c.GetFirstLink("p-p").GetAttr("uid"))
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// EnrollmentGrace is the time after the last use when invitation is still accepted,
+// so client can finish enrollment (get the profile) after the certificate is signed.
+const EnrollmentGrace = time.Minute * 10
+
+// Enrollment is the invitation for the device enrollment. Token of the invitation is accepted by cert api
+// instead of the password. Device with the scope and profile of the invitation is created when the first certificate is signed.
+// Every signed certificate is counted as a use.
+type Enrollment struct {
+	ID        uint           `gorm:"primaryKey"`
+	CreatedAt time.Time      `gorm:"type:timestamp"`
+	Hash      string         `gorm:"uniqueIndex;size:64;not null"`
+	Login     string         `gorm:"index;size:255;not null"`
+	Scope     string         `gorm:"size:255;not null"`
+	Profile   *ProfilePutDTO `gorm:"serializer:json"`
+	CreatedBy string         `gorm:"size:255"`
+	ExpiresAt time.Time      `gorm:"type:timestamp;not null"`
+	MaxUses   int            `gorm:"not null"`
+	Uses      int            `gorm:"not null;default:0"`
+	LastUsed  *time.Time     `gorm:"type:timestamp"`
+}
+
+type EnrollmentDTO struct {
+	ID        uint           `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Login     string         `json:"login"`
+	Scope     string         `json:"scope"`
+	Profile   *ProfilePutDTO `json:"profile,omitempty"`
+	CreatedBy string         `json:"created_by,omitempty"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	MaxUses   int            `json:"max_uses"`
+	Uses      int            `json:"uses"`
+	LastUsed  *time.Time     `json:"last_used,omitempty"`
+	// token, deep link and qr code image are sent only once on creation
+	Token string `json:"token,omitempty"`
+	Link  string `json:"link,omitempty"`
+	QR    string `json:"qr,omitempty"`
+}
+
+type EnrollmentPostDTO struct {
+	Login   string         `json:"login"`
+	Scope   string         `json:"scope"`
+	Profile *ProfilePutDTO `json:"profile,omitempty"`
+	// invitation lifetime, default is 24 hours
+	Hours int `json:"hours,omitempty"`
+	// default is 1
+	MaxUses int `json:"max_uses,omitempty"`
+}
+
+// NewEnrollment makes invitation record and the token string.
+func NewEnrollment(login, scope string, ttl time.Duration, maxUses int) (*Enrollment, string, error) {
+	token, err := newSecret(20)
+	if err != nil {
+		return nil, "", err
+	}
+
+	e := &Enrollment{
+		Login:     login,
+		Scope:     scope,
+		Hash:      TokenHash(token),
+		ExpiresAt: time.Now().Add(ttl),
+		MaxUses:   maxUses,
+	}
+
+	return e, token, nil
+}
+
+// IsValid checks if invitation is not expired and has uses left or was used just now.
+func (e *Enrollment) IsValid(now time.Time) bool {
+	if e == nil || !now.Before(e.ExpiresAt) {
+		return false
+	}
+
+	return e.Uses < e.MaxUses || (e.LastUsed != nil && now.Sub(*e.LastUsed) < EnrollmentGrace)
+}
+
+func (e *Enrollment) DTO() *EnrollmentDTO {
+	return &EnrollmentDTO{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		Login:     e.Login,
+		Scope:     e.Scope,
+		Profile:   e.Profile,
+		CreatedBy: e.CreatedBy,
+		ExpiresAt: e.ExpiresAt,
+		MaxUses:   e.MaxUses,
+		Uses:      e.Uses,
+		LastUsed:  e.LastUsed,
+	}
+}
+
+// EnrollmentLink returns ATAK deep link for the enrollment with username and token.
+func EnrollmentLink(host, login, token string) string {
+	return fmt.Sprintf("tak://com.atakmap.app/enroll?host=%s&username=%s&token=%s",
+		url.QueryEscape(host), url.QueryEscape(login), url.QueryEscape(token))
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrollmentValid(t *testing.T) {
+	e, token, err := NewEnrollment("user", "blue", time.Hour, 1)
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	assert.Equal(t, TokenHash(token), e.Hash)
+	assert.True(t, e.IsValid(now))
+	assert.False(t, e.IsValid(now.Add(time.Hour*2)))
+
+	e.Uses = 1
+	assert.False(t, e.IsValid(now))
+
+	e.LastUsed = &now
+	assert.True(t, e.IsValid(now.Add(time.Minute)))
+	assert.False(t, e.IsValid(now.Add(EnrollmentGrace)))
+}
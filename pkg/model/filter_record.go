@@ -0,0 +1,8 @@
+package model
+
+// FilterRecord is the filter rule changed with admin api, rules are applied in order of position.
+type FilterRecord struct {
+	Name     string `gorm:"primaryKey;size:255"`
+	Position int
+	Rule     []byte
+}
@@ -115,3 +115,19 @@ func (p *Pos) GetCe() float64 {
 
 	return p.Ce
 }
+
+// DestPoint returns point at the distance (meters) and bearing (degrees) from the start point.
+func DestPoint(lat, lon, dist, bea float64) (float64, float64) {
+	toRadian := math.Pi / 180
+	R := 6371000. // meters
+
+	d := dist / R
+	f1 := lat * toRadian
+	l1 := lon * toRadian
+	b := bea * toRadian
+
+	f2 := math.Asin(math.Sin(f1)*math.Cos(d) + math.Cos(f1)*math.Sin(d)*math.Cos(b))
+	l2 := l1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(f1), math.Cos(d)-math.Sin(f1)*math.Sin(f2))
+
+	return f2 / toRadian, math.Mod(l2/toRadian+540, 360) - 180
+}
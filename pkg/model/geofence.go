@@ -0,0 +1,232 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+const (
+	FENCE_POLYGON = "polygon"
+	FENCE_CIRCLE  = "circle"
+
+	FENCE_ENTER = "enter"
+	FENCE_EXIT  = "exit"
+)
+
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type Geofence struct {
+	UID          string      `gorm:"primaryKey;size:255"`
+	CreatedAt    time.Time   `gorm:"type:timestamp"`
+	UpdatedAt    time.Time   `gorm:"type:timestamp"`
+	Name         string      `gorm:"size:255"`
+	Scope        string      `gorm:"index;size:255"`
+	Shape        string      `gorm:"size:32"`
+	Points       []*GeoPoint `gorm:"type:text;serializer:json"`
+	Radius       float64
+	ShapeUID     string   `gorm:"index;size:255"`
+	NotifyUIDs   []string `gorm:"serializer:json"`
+	NotifyScopes []string `gorm:"serializer:json"`
+	Disabled     bool
+}
+
+type GeofenceDTO struct {
+	UID          string      `json:"uid"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	Name         string      `json:"name"`
+	Scope        string      `json:"scope"`
+	Shape        string      `json:"shape"`
+	Points       []*GeoPoint `json:"points"`
+	Radius       float64     `json:"radius,omitempty"`
+	ShapeUID     string      `json:"shape_uid,omitempty"`
+	NotifyUIDs   []string    `json:"notify_uids"`
+	NotifyScopes []string    `json:"notify_scopes"`
+	Disabled     bool        `json:"disabled"`
+}
+
+type GeofencePostDTO struct {
+	Name         string      `json:"name"`
+	Scope        string      `json:"scope"`
+	Shape        string      `json:"shape"`
+	Points       []*GeoPoint `json:"points"`
+	Radius       float64     `json:"radius"`
+	ShapeUID     string      `json:"shape_uid"`
+	NotifyUIDs   []string    `json:"notify_uids"`
+	NotifyScopes []string    `json:"notify_scopes"`
+	Disabled     bool        `json:"disabled"`
+}
+
+type GeofenceEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index;type:timestamp"`
+	FenceUID  string    `gorm:"index;size:255"`
+	FenceName string    `gorm:"size:255"`
+	UID       string    `gorm:"index;size:255"`
+	Callsign  string    `gorm:"size:255"`
+	Event     string    `gorm:"size:32"`
+	Lat       float64
+	Lon       float64
+}
+
+type GeofenceEventDTO struct {
+	Time      time.Time `json:"time"`
+	FenceUID  string    `json:"fence_uid"`
+	FenceName string    `json:"fence_name"`
+	UID       string    `json:"uid"`
+	Callsign  string    `json:"callsign"`
+	Event     string    `json:"event"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+}
+
+func (f *Geofence) DTO() *GeofenceDTO {
+	if f == nil {
+		return nil
+	}
+
+	return &GeofenceDTO{
+		UID:          f.UID,
+		CreatedAt:    f.CreatedAt,
+		UpdatedAt:    f.UpdatedAt,
+		Name:         f.Name,
+		Scope:        f.Scope,
+		Shape:        f.Shape,
+		Points:       f.Points,
+		Radius:       f.Radius,
+		ShapeUID:     f.ShapeUID,
+		NotifyUIDs:   f.NotifyUIDs,
+		NotifyScopes: f.NotifyScopes,
+		Disabled:     f.Disabled,
+	}
+}
+
+func (f *Geofence) IsValid() bool {
+	if f == nil {
+		return false
+	}
+
+	switch f.Shape {
+	case FENCE_CIRCLE:
+		return len(f.Points) == 1 && f.Radius > 0
+	case FENCE_POLYGON:
+		return len(f.Points) >= 3
+	}
+
+	return false
+}
+
+// SameGeometry checks if fence already has the shape, points and radius.
+func (f *Geofence) SameGeometry(shape string, points []*GeoPoint, radius float64) bool {
+	if f.Shape != shape || f.Radius != radius || len(f.Points) != len(points) {
+		return false
+	}
+
+	for i, p := range points {
+		if p == nil || f.Points[i] == nil || *p != *f.Points[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Contains checks if point is inside the fence.
+func (f *Geofence) Contains(lat, lon float64) bool {
+	if !f.IsValid() {
+		return false
+	}
+
+	switch f.Shape {
+	case FENCE_CIRCLE:
+		d, _ := DistBea(f.Points[0].Lat, f.Points[0].Lon, lat, lon)
+
+		return d <= f.Radius
+	case FENCE_POLYGON:
+		return inPolygon(f.Points, lat, lon)
+	}
+
+	return false
+}
+
+// ray casting, good enough for fences not crossing 180 meridian
+func inPolygon(points []*GeoPoint, lat, lon float64) bool {
+	in := false
+
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		pi, pj := points[i], points[j]
+
+		if (pi.Lat > lat) != (pj.Lat > lat) &&
+			lon < (pj.Lon-pi.Lon)*(lat-pi.Lat)/(pj.Lat-pi.Lat)+pi.Lon {
+			in = !in
+		}
+	}
+
+	return in
+}
+
+func (e *GeofenceEvent) DTO() *GeofenceEventDTO {
+	if e == nil {
+		return nil
+	}
+
+	return &GeofenceEventDTO{
+		Time:      e.CreatedAt,
+		FenceUID:  e.FenceUID,
+		FenceName: e.FenceName,
+		UID:       e.UID,
+		Callsign:  e.Callsign,
+		Event:     e.Event,
+		Lat:       e.Lat,
+		Lon:       e.Lon,
+	}
+}
+
+// ShapeFromMsg gets fence geometry from drawn shape (u-d-f, u-d-r, u-d-c-c).
+func ShapeFromMsg(msg *cot.CotMessage) (string, []*GeoPoint, float64) {
+	if msg == nil {
+		return "", nil, 0
+	}
+
+	if cot.MatchAnyPattern(msg.GetType(), "u-d-c-c", "u-r-b-c-c") {
+		r, _ := strconv.ParseFloat(msg.GetDetail().GetFirst("shape").GetFirst("ellipse").GetAttr("major"), 64)
+
+		return FENCE_CIRCLE, []*GeoPoint{{Lat: msg.GetLat(), Lon: msg.GetLon()}}, r
+	}
+
+	points := make([]*GeoPoint, 0)
+
+	for _, l := range msg.GetDetail().GetAll("link") {
+		if p := parsePoint(l.GetAttr("point")); p != nil {
+			points = append(points, p)
+		}
+	}
+
+	return FENCE_POLYGON, points, 0
+}
+
+func parsePoint(s string) *GeoPoint {
+	parts := strings.Split(s, ",")
+
+	if len(parts) < 2 {
+		return nil
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil
+	}
+
+	return &GeoPoint{Lat: lat, Lon: lon}
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"slices"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+// AllGroups in read groups lets device see messages from all groups.
+const AllGroups = "*"
+
+// DeviceGroup is the TAK group membership. Device gets messages from IN groups and sends messages to OUT groups.
+// Inactive groups are switched off by the client.
+type DeviceGroup struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"type:timestamp"`
+	Login     string    `gorm:"uniqueIndex:idx_device_group;size:255;not null"`
+	Name      string    `gorm:"uniqueIndex:idx_device_group;size:255;not null"`
+	In        bool      `gorm:"not null;default:false"`
+	Out       bool      `gorm:"not null;default:false"`
+	Active    bool      `gorm:"not null"`
+}
+
+type DeviceGroupDTO struct {
+	Name   string `json:"name"`
+	In     bool   `json:"in"`
+	Out    bool   `json:"out"`
+	Active bool   `json:"active"`
+}
+
+func (g *DeviceGroup) DTO() *DeviceGroupDTO {
+	return &DeviceGroupDTO{
+		Name:   g.Name,
+		In:     g.In,
+		Out:    g.Out,
+		Active: g.Active,
+	}
+}
+
+func (d *DeviceGroupDTO) Group(login string) *DeviceGroup {
+	return &DeviceGroup{Login: login, Name: d.Name, In: d.In, Out: d.Out, Active: d.Active}
+}
+
+// ScopeGroups makes groups from the old style scope and read scopes.
+func ScopeGroups(login, scope string, readScope []string) []*DeviceGroup {
+	res := make([]*DeviceGroup, 0, len(readScope)+1)
+
+	if scope != "" {
+		res = append(res, &DeviceGroup{Login: login, Name: scope, In: true, Out: true, Active: true})
+	}
+
+	for _, s := range readScope {
+		if s == "" || s == scope {
+			continue
+		}
+
+		res = append(res, &DeviceGroup{Login: login, Name: s, In: true, Active: true})
+	}
+
+	return res
+}
+
+// HasGroups is true when device uses groups instead of scope and read scope, even if all groups are inactive.
+func (u *Device) HasGroups() bool {
+	return u != nil && len(u.Groups) > 0
+}
+
+// InGroups returns active groups device gets messages from.
+func (u *Device) InGroups() []string {
+	if u == nil {
+		return nil
+	}
+
+	if !u.HasGroups() {
+		return append([]string{u.Scope}, u.ReadScope...)
+	}
+
+	res := make([]string, 0, len(u.Groups))
+
+	for _, g := range u.Groups {
+		if g.In && g.Active {
+			res = append(res, g.Name)
+		}
+	}
+
+	return res
+}
+
+// OutGroups returns active groups device sends messages to.
+func (u *Device) OutGroups() []string {
+	if u == nil {
+		return nil
+	}
+
+	if !u.HasGroups() {
+		return []string{u.Scope}
+	}
+
+	res := make([]string, 0, len(u.Groups))
+
+	for _, g := range u.Groups {
+		if g.Out && g.Active {
+			res = append(res, g.Name)
+		}
+	}
+
+	return res
+}
+
+// CanSeeGroups checks if device gets messages sent to any of groups.
+func (u *Device) CanSeeGroups(groups []string) bool {
+	in := u.InGroups()
+
+	if slices.Contains(in, AllGroups) {
+		return true
+	}
+
+	for _, g := range groups {
+		if slices.Contains(in, g) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanSeeMsg checks message groups or scope if message sender has no groups.
+func (u *Device) CanSeeMsg(msg *cot.CotMessage) bool {
+	if u == nil {
+		return msg.Scope == ""
+	}
+
+	if msg.HasGroups || len(msg.Groups) > 0 {
+		return u.CanSeeGroups(msg.Groups)
+	}
+
+	return u.CanSeeScope(msg.Scope)
+}
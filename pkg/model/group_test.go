@@ -0,0 +1,57 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+func TestScopeGroups(t *testing.T) {
+	g := ScopeGroups("user", "blue", []string{"red", "blue", "*"})
+
+	assert.Len(t, g, 3)
+
+	d := &Device{Login: "user", Scope: "blue", Groups: g}
+	assert.Equal(t, []string{"blue", "red", "*"}, d.InGroups())
+	assert.Equal(t, []string{"blue"}, d.OutGroups())
+	assert.True(t, d.CanSeeScope("green"))
+}
+
+func TestOutGroupsInactive(t *testing.T) {
+	d := &Device{Login: "user", Scope: "blue", Groups: []*DeviceGroup{
+		{Name: "blue", In: true, Out: true, Active: false},
+	}}
+
+	assert.True(t, d.HasGroups())
+	assert.Empty(t, d.OutGroups())
+	assert.Empty(t, d.InGroups())
+}
+
+func TestCanSeeMsg(t *testing.T) {
+	d := &Device{Login: "user", Scope: "blue", Groups: []*DeviceGroup{
+		{Name: "blue", In: true, Out: true, Active: true},
+		{Name: "red", In: true, Active: false},
+		{Name: "green", Out: true, Active: true},
+	}}
+
+	assert.True(t, d.CanSeeMsg(&cot.CotMessage{Scope: "blue"}))
+	assert.False(t, d.CanSeeMsg(&cot.CotMessage{Scope: "red"}))
+	assert.False(t, d.CanSeeMsg(&cot.CotMessage{Scope: "green"}))
+	assert.True(t, d.CanSeeMsg(&cot.CotMessage{Scope: "green", Groups: []string{"green", "blue"}}))
+	assert.False(t, d.CanSeeMsg(&cot.CotMessage{Scope: "blue", Groups: []string{"red"}}))
+
+	// sender with all out groups disabled
+	assert.False(t, d.CanSeeMsg(&cot.CotMessage{Scope: "blue", HasGroups: true}))
+
+	// old style device without groups
+	d = &Device{Login: "user", Scope: "blue", ReadScope: []string{"red"}}
+	assert.True(t, d.CanSeeMsg(&cot.CotMessage{Scope: "red"}))
+	assert.True(t, d.CanSeeMsg(&cot.CotMessage{Scope: "x", Groups: []string{"red"}}))
+	assert.Equal(t, []string{"blue"}, d.OutGroups())
+
+	var nd *Device
+	assert.True(t, nd.CanSeeMsg(&cot.CotMessage{}))
+	assert.False(t, nd.CanSeeMsg(&cot.CotMessage{Scope: "blue"}))
+}
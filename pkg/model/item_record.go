@@ -0,0 +1,101 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+	"github.com/kdudkov/goatak/pkg/cotproto"
+)
+
+// ItemRecord is a stored state of Item.
+type ItemRecord struct {
+	UID       string `gorm:"primaryKey;size:255"`
+	Class     string `gorm:"index;size:32"`
+	Type      string `gorm:"size:255"`
+	Callsign  string `gorm:"size:255"`
+	Scope     string `gorm:"index;size:255"`
+	From      string `gorm:"size:255"`
+	Online    bool
+	Local     bool
+	Send      bool
+	LastSeen  time.Time `gorm:"type:timestamp"`
+	StaleTime time.Time `gorm:"index;type:timestamp"`
+	UpdatedAt time.Time `gorm:"type:timestamp"`
+	MsgData   []byte
+	Track     []*Pos `gorm:"type:text;serializer:json"`
+}
+
+// Record makes ItemRecord with up to trackPoints last track points.
+func (i *Item) Record(trackPoints int) (*ItemRecord, error) {
+	i.mx.RLock()
+	defer i.mx.RUnlock()
+
+	dat, err := proto.Marshal(i.msg.GetTakMessage())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ItemRecord{
+		UID:       i.uid,
+		Class:     i.class,
+		Type:      i.msg.GetType(),
+		Callsign:  i.msg.GetCallsign(),
+		Scope:     i.msg.Scope,
+		From:      i.msg.From,
+		Online:    i.online,
+		Local:     i.local,
+		Send:      i.send,
+		LastSeen:  i.lastSeen,
+		StaleTime: i.msg.GetStaleTime(),
+		MsgData:   dat,
+	}
+
+	if trackPoints > 0 && len(i.track) > 0 {
+		r.Track = i.track[max(len(i.track)-trackPoints, 0):]
+	}
+
+	return r, nil
+}
+
+// FromRecord restores Item from ItemRecord.
+func FromRecord(r *ItemRecord) (*Item, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	if r.UID == "" || len(r.MsgData) == 0 {
+		return nil, fmt.Errorf("empty item record")
+	}
+
+	m := new(cotproto.TakMessage)
+
+	if err := proto.Unmarshal(r.MsgData, m); err != nil {
+		return nil, err
+	}
+
+	msg, err := cot.CotFromProto(m, r.From, r.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	cls := r.Class
+	if cls == "" {
+		cls = GetClass(msg)
+	}
+
+	return &Item{
+		mx:       sync.RWMutex{},
+		uid:      r.UID,
+		class:    cls,
+		online:   r.Online,
+		lastSeen: r.LastSeen,
+		local:    r.Local,
+		send:     r.Send,
+		track:    r.Track,
+		msg:      msg,
+	}, nil
+}
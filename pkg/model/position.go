@@ -0,0 +1,189 @@
+package model
+
+import (
+	"math"
+	"time"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+// PositionRecord is a stored position report of contact or unit.
+type PositionRecord struct {
+	ID       uint      `gorm:"primaryKey"`
+	UID      string    `gorm:"index:idx_position_uid_time;size:255"`
+	Time     time.Time `gorm:"index:idx_position_uid_time;index;type:timestamp"`
+	Callsign string    `gorm:"index;size:255"`
+	Type     string    `gorm:"size:255"`
+	Scope    string    `gorm:"index;size:255"`
+	Lat      float64   `gorm:"index"`
+	Lon      float64
+	Alt      float64
+	Speed    float64
+	Course   float64
+}
+
+type PositionDTO struct {
+	UID      string    `json:"uid"`
+	Callsign string    `json:"callsign"`
+	Type     string    `json:"type"`
+	Scope    string    `json:"scope"`
+	Time     time.Time `json:"time"`
+	Lat      float64   `json:"lat"`
+	Lon      float64   `json:"lon"`
+	Alt      float64   `json:"alt"`
+	Speed    float64   `json:"speed"`
+	Course   float64   `json:"course"`
+}
+
+// TrackDTO is the track of one uid, callsign and type are from the last point.
+// TrackDTO is the stored track, Truncated is set when only the newest points are returned.
+type TrackDTO struct {
+	UID       string `json:"uid"`
+	Callsign  string `json:"callsign"`
+	Type      string `json:"type"`
+	Scope     string `json:"scope"`
+	Points    []*Pos `json:"points"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// PositionFromMsg makes position record from message, nil if message has no position.
+func PositionFromMsg(msg *cot.CotMessage) *PositionRecord {
+	if msg.GetLat() == 0 && msg.GetLon() == 0 {
+		return nil
+	}
+
+	p := msg2pos(msg)
+
+	return &PositionRecord{
+		UID:      msg.GetUID(),
+		Time:     p.Time,
+		Callsign: msg.GetCallsign(),
+		Type:     msg.GetType(),
+		Scope:    msg.Scope,
+		Lat:      p.Lat,
+		Lon:      p.Lon,
+		Alt:      p.Alt,
+		Speed:    p.Speed,
+		Course:   p.Track,
+	}
+}
+
+func (r *PositionRecord) Pos() *Pos {
+	return &Pos{Time: r.Time, Lat: r.Lat, Lon: r.Lon, Alt: r.Alt, Speed: r.Speed, Track: r.Course}
+}
+
+func (r *PositionRecord) DTO() *PositionDTO {
+	return &PositionDTO{
+		UID:      r.UID,
+		Callsign: r.Callsign,
+		Type:     r.Type,
+		Scope:    r.Scope,
+		Time:     r.Time,
+		Lat:      r.Lat,
+		Lon:      r.Lon,
+		Alt:      r.Alt,
+		Speed:    r.Speed,
+		Course:   r.Course,
+	}
+}
+
+// Tracks groups time ordered records by uid, tracks are in order of the first point.
+func Tracks(records []*PositionRecord) []*TrackDTO {
+	res := make([]*TrackDTO, 0)
+	tracks := make(map[string]*TrackDTO)
+
+	for _, r := range records {
+		t := tracks[r.UID]
+		if t == nil {
+			t = &TrackDTO{UID: r.UID}
+			tracks[r.UID] = t
+			res = append(res, t)
+		}
+
+		t.Callsign, t.Type, t.Scope = r.Callsign, r.Type, r.Scope
+		t.Points = append(t.Points, r.Pos())
+	}
+
+	return res
+}
+
+// BucketTrack leaves the last point of every time bucket.
+func BucketTrack(track []*Pos, bucket time.Duration) []*Pos {
+	if bucket <= 0 || len(track) < 2 {
+		return track
+	}
+
+	res := make([]*Pos, 0)
+
+	for i, p := range track {
+		if i == len(track)-1 || !p.Time.Truncate(bucket).Equal(track[i+1].Time.Truncate(bucket)) {
+			res = append(res, p)
+		}
+	}
+
+	return res
+}
+
+// SimplifyTrack removes points closer than tolerance meters to the line (Douglas-Peucker).
+// First and last points are always kept.
+func SimplifyTrack(track []*Pos, tolerance float64) []*Pos {
+	if tolerance <= 0 || len(track) < 3 {
+		return track
+	}
+
+	keep := make([]bool, len(track))
+	keep[0], keep[len(track)-1] = true, true
+
+	// stack of segments instead of recursion, long tracks can be deep
+	stack := [][2]int{{0, len(track) - 1}}
+
+	for len(stack) > 0 {
+		first, last := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+
+		idx, maxDist := 0, 0.
+
+		for i := first + 1; i < last; i++ {
+			if d := segmentDist(track[i], track[first], track[last]); d > maxDist {
+				idx, maxDist = i, d
+			}
+		}
+
+		if maxDist > tolerance {
+			keep[idx] = true
+			stack = append(stack, [2]int{first, idx}, [2]int{idx, last})
+		}
+	}
+
+	res := make([]*Pos, 0)
+
+	for i, p := range track {
+		if keep[i] {
+			res = append(res, p)
+		}
+	}
+
+	return res
+}
+
+// segmentDist returns distance in meters from p to segment a-b, equirectangular projection is used.
+func segmentDist(p, a, b *Pos) float64 {
+	const R = 6371000.
+
+	k := math.Cos(a.Lat * math.Pi / 180)
+	toXY := func(q *Pos) (float64, float64) {
+		return (q.Lon - a.Lon) * math.Pi / 180 * R * k, (q.Lat - a.Lat) * math.Pi / 180 * R
+	}
+
+	px, py := toXY(p)
+	bx, by := toXY(b)
+
+	l2 := bx*bx + by*by
+	if l2 == 0 {
+		return math.Hypot(px, py)
+	}
+
+	t := max(0, min(1, (px*bx+py*by)/l2))
+
+	return math.Hypot(px-t*bx, py-t*by)
+}
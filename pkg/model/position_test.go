@@ -0,0 +1,85 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kdudkov/goatak/pkg/cot"
+)
+
+func TestSimplifyTrack(t *testing.T) {
+	t0 := time.Now()
+
+	// almost straight line with one corner
+	track := []*Pos{
+		{Time: t0, Lat: 10, Lon: 10},
+		{Time: t0.Add(time.Second), Lat: 10.00001, Lon: 10.001},
+		{Time: t0.Add(time.Second * 2), Lat: 10, Lon: 10.002},
+		{Time: t0.Add(time.Second * 3), Lat: 10.002, Lon: 10.002},
+		{Time: t0.Add(time.Second * 4), Lat: 10.004, Lon: 10.002},
+	}
+
+	res := SimplifyTrack(track, 10)
+	require.Len(t, res, 3)
+	assert.Equal(t, track[0], res[0])
+	assert.Equal(t, track[2], res[1])
+	assert.Equal(t, track[4], res[2])
+
+	assert.Len(t, SimplifyTrack(track, 0.1), 4)
+	assert.Len(t, SimplifyTrack(track, 0), 5)
+	assert.Len(t, SimplifyTrack(track, 100000), 2)
+}
+
+func TestBucketTrack(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	var track []*Pos
+	for i := range 10 {
+		track = append(track, &Pos{Time: t0.Add(time.Second * 10 * time.Duration(i)), Lat: float64(i)})
+	}
+
+	res := BucketTrack(track, time.Minute)
+	require.Len(t, res, 2)
+	assert.Equal(t, 5., res[0].Lat)
+	assert.Equal(t, 9., res[1].Lat)
+
+	assert.Len(t, BucketTrack(track, 0), 10)
+}
+
+func TestTracks(t *testing.T) {
+	t0 := time.Now()
+
+	recs := []*PositionRecord{
+		{UID: "u1", Callsign: "a", Time: t0, Lat: 1},
+		{UID: "u2", Callsign: "b", Time: t0, Lat: 2},
+		{UID: "u1", Callsign: "a1", Time: t0.Add(time.Second), Lat: 3},
+	}
+
+	res := Tracks(recs)
+	require.Len(t, res, 2)
+	assert.Equal(t, "u1", res[0].UID)
+	assert.Equal(t, "a1", res[0].Callsign)
+	assert.Len(t, res[0].Points, 2)
+	assert.Len(t, res[1].Points, 1)
+}
+
+func TestPositionFromMsg(t *testing.T) {
+	m := cot.BasicMsg("a-f-G", "u1", time.Minute)
+	msg, err := cot.CotFromProto(m, "", "blue")
+	require.NoError(t, err)
+
+	assert.Nil(t, PositionFromMsg(msg))
+
+	m.CotEvent.Lat, m.CotEvent.Lon = 10, 20
+	msg, err = cot.CotFromProto(m, "", "blue")
+	require.NoError(t, err)
+
+	p := PositionFromMsg(msg)
+	require.NotNil(t, p)
+	assert.Equal(t, "u1", p.UID)
+	assert.Equal(t, "blue", p.Scope)
+	assert.Equal(t, 20., p.Lon)
+}
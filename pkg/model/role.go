@@ -0,0 +1,96 @@
+package model
+
+import (
+	"slices"
+)
+
+// Admin roles. Admin device without role is the super admin.
+const (
+	RoleSuperAdmin = "superadmin"
+	RoleScopeAdmin = "scope_admin"
+	RoleOperator   = "operator"
+)
+
+var roleRank = map[string]int{RoleOperator: 1, RoleScopeAdmin: 2, RoleSuperAdmin: 3}
+
+// HigherRole returns the role with more rights, empty role is no admin role here.
+func HigherRole(a, b string) string {
+	if roleRank[b] > roleRank[a] {
+		return b
+	}
+
+	return a
+}
+
+func IsValidRole(role string) bool {
+	switch role {
+	case "", RoleSuperAdmin, RoleScopeAdmin, RoleOperator:
+		return true
+	}
+
+	return false
+}
+
+// AdminRole returns effective admin role or empty string for non-admin device.
+func (u *Device) AdminRole() string {
+	if u == nil || !u.Admin {
+		return ""
+	}
+
+	if u.Role == "" {
+		return RoleSuperAdmin
+	}
+
+	return u.Role
+}
+
+func (u *Device) IsSuperAdmin() bool {
+	return u.AdminRole() == RoleSuperAdmin
+}
+
+// CanWrite checks if admin can change anything. Operators have read-only access.
+func (u *Device) CanWrite() bool {
+	r := u.AdminRole()
+
+	return r == RoleSuperAdmin || r == RoleScopeAdmin
+}
+
+// AdminScopes returns scopes admin can see and manage: scope and read scopes.
+// nil means all scopes.
+func (u *Device) AdminScopes() []string {
+	if u.IsSuperAdmin() || slices.Contains(u.GetReadScope(), AllGroups) {
+		return nil
+	}
+
+	if u.AdminRole() == "" {
+		return []string{}
+	}
+
+	res := []string{u.Scope}
+
+	for _, s := range u.ReadScope {
+		if s != "" && !slices.Contains(res, s) {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// CanManageScope checks if admin can see and manage objects of the scope.
+func (u *Device) CanManageScope(scope string) bool {
+	scopes := u.AdminScopes()
+
+	return scopes == nil || slices.Contains(scopes, scope)
+}
+
+// CanManageScopes checks all scopes, used to check new device scope and read scopes.
+func (u *Device) CanManageScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		if !u.CanManageScope(s) {
+			return false
+		}
+	}
+
+	return true
+}
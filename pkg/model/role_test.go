@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminRole(t *testing.T) {
+	var d *Device
+
+	assert.Equal(t, "", d.AdminRole())
+	assert.False(t, d.CanWrite())
+	assert.False(t, d.CanManageScope(""))
+
+	d = &Device{Login: "user", Scope: "blue"}
+	assert.Equal(t, "", d.AdminRole())
+	assert.False(t, d.CanManageScope("blue"))
+
+	// old style admin is the super admin
+	d.Admin = true
+	assert.Equal(t, RoleSuperAdmin, d.AdminRole())
+	assert.True(t, d.CanWrite())
+	assert.Nil(t, d.AdminScopes())
+	assert.True(t, d.CanManageScope("red"))
+
+	d.Role = RoleScopeAdmin
+	d.ReadScope = []string{"red", "blue"}
+	assert.True(t, d.CanWrite())
+	assert.Equal(t, []string{"blue", "red"}, d.AdminScopes())
+	assert.True(t, d.CanManageScopes("blue", "red"))
+	assert.False(t, d.CanManageScopes("blue", "green"))
+
+	d.Role = RoleOperator
+	assert.False(t, d.CanWrite())
+	assert.True(t, d.CanManageScope("red"))
+
+	d.ReadScope = []string{AllGroups}
+	assert.Nil(t, d.AdminScopes())
+	assert.False(t, d.IsSuperAdmin())
+
+	assert.True(t, IsValidRole(RoleOperator))
+	assert.False(t, IsValidRole("root"))
+
+	assert.Equal(t, RoleScopeAdmin, HigherRole(RoleOperator, RoleScopeAdmin))
+	assert.Equal(t, RoleSuperAdmin, HigherRole(RoleSuperAdmin, RoleOperator))
+	assert.Equal(t, RoleOperator, HigherRole("", RoleOperator))
+}
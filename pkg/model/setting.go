@@ -0,0 +1,7 @@
+package model
+
+// Setting is the server state value kept in database, like markers of one time initialization.
+type Setting struct {
+	Name  string `gorm:"primaryKey;size:255"`
+	Value string
+}
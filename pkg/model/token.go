@@ -0,0 +1,129 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ApiTokenPrefix marks personal api tokens, so they are not parsed as jwt.
+const ApiTokenPrefix = "gat_"
+
+// ApiToken is the long-lived token of the device for scripts and automation.
+// Only hash of the token is stored. Token works with device rights, limited by Write flag and Paths.
+type ApiToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	CreatedAt time.Time  `gorm:"type:timestamp"`
+	Login     string     `gorm:"index;size:255;not null"`
+	Name      string     `gorm:"size:255"`
+	Hash      string     `gorm:"uniqueIndex;size:64;not null"`
+	Prefix    string     `gorm:"size:16"`
+	Write     bool       `gorm:"not null;default:false"`
+	Paths     []string   `gorm:"serializer:json"`
+	CreatedBy string     `gorm:"size:255"`
+	ExpiresAt *time.Time `gorm:"type:timestamp"`
+	LastUsed  *time.Time `gorm:"type:timestamp"`
+	RevokedAt *time.Time `gorm:"type:timestamp"`
+}
+
+type ApiTokenDTO struct {
+	ID        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Login     string     `json:"login"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Write     bool       `json:"write"`
+	Paths     []string   `json:"paths,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// token itself, is sent only once on creation
+	Token string `json:"token,omitempty"`
+}
+
+type ApiTokenPostDTO struct {
+	Name  string   `json:"name"`
+	Write bool     `json:"write"`
+	Paths []string `json:"paths,omitempty"`
+	// token lifetime, 0 - no expiration
+	Days int `json:"days,omitempty"`
+}
+
+// NewApiToken makes token record and the token string.
+func NewApiToken(login string) (*ApiToken, string, error) {
+	s, err := newSecret(30)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := ApiTokenPrefix + s
+
+	return &ApiToken{Login: login, Hash: TokenHash(token), Prefix: token[:len(ApiTokenPrefix)+6]}, token, nil
+}
+
+// TokenHash returns hash of the secret token. Only hashes of tokens are stored.
+func TokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(h[:])
+}
+
+func newSecret(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IsActive checks if token is not revoked and not expired.
+func (t *ApiToken) IsActive(now time.Time) bool {
+	if t == nil || t.RevokedAt != nil {
+		return false
+	}
+
+	return t.ExpiresAt == nil || t.ExpiresAt.After(now)
+}
+
+// Allows checks request method and path. Read-only token can only make GET requests,
+// path must start with one of token paths if there are any.
+func (t *ApiToken) Allows(method, path string) bool {
+	if !t.Write && method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+
+	if len(t.Paths) == 0 {
+		return true
+	}
+
+	for _, p := range t.Paths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *ApiToken) DTO() *ApiTokenDTO {
+	return &ApiTokenDTO{
+		ID:        t.ID,
+		CreatedAt: t.CreatedAt,
+		Login:     t.Login,
+		Name:      t.Name,
+		Prefix:    t.Prefix,
+		Write:     t.Write,
+		Paths:     t.Paths,
+		CreatedBy: t.CreatedBy,
+		ExpiresAt: t.ExpiresAt,
+		LastUsed:  t.LastUsed,
+		RevokedAt: t.RevokedAt,
+	}
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiToken(t *testing.T) {
+	tok, s, err := NewApiToken("user")
+	require.NoError(t, err)
+
+	assert.True(t, len(s) > 40)
+	assert.Equal(t, TokenHash(s), tok.Hash)
+	assert.Equal(t, s[:10], tok.Prefix)
+	assert.True(t, tok.IsActive(time.Now()))
+
+	assert.True(t, tok.Allows("GET", "/api/device"))
+	assert.False(t, tok.Allows("POST", "/cot"))
+
+	tok.Write = true
+	tok.Paths = []string{"/cot", "/api/unit"}
+	assert.True(t, tok.Allows("POST", "/cot"))
+	assert.True(t, tok.Allows("GET", "/api/unit/123/track"))
+	assert.False(t, tok.Allows("GET", "/api/device"))
+
+	exp := time.Now().Add(-time.Minute)
+	tok.ExpiresAt = &exp
+	assert.False(t, tok.IsActive(time.Now()))
+}
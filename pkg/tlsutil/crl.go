@@ -0,0 +1,55 @@
+package tlsutil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+type Revoked struct {
+	// hex encoded serial, as it is stored in db
+	Serial string
+	Time   time.Time
+}
+
+// MakeCRL creates DER encoded certificate revocation list signed by issuer.
+func MakeCRL(issuer *x509.Certificate, key crypto.PrivateKey, revoked []Revoked, next time.Duration) ([]byte, error) {
+	if issuer == nil {
+		return nil, errors.New("no issuer certificate")
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("issuer key can't sign")
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+
+	for _, r := range revoked {
+		b, err := hex.DecodeString(r.Serial)
+		if err != nil {
+			return nil, fmt.Errorf("bad serial %s: %w", r.Serial, err)
+		}
+
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   new(big.Int).SetBytes(b),
+			RevocationTime: r.Time,
+		})
+	}
+
+	now := time.Now()
+
+	tpl := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(now.Unix()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(next),
+	}
+
+	return x509.CreateRevocationList(rand.Reader, tpl, issuer, signer)
+}
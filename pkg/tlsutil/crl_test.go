@@ -0,0 +1,53 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeCRL(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	require.NoError(t, err)
+
+	ca, err := x509.ParseCertificate(b)
+	require.NoError(t, err)
+
+	revoked := []Revoked{{Serial: "0102ff", Time: time.Now()}, {Serial: "10", Time: time.Now()}}
+
+	der, err := MakeCRL(ca, key, revoked, time.Hour)
+	require.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(der)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(ca))
+
+	require.Len(t, crl.RevokedCertificateEntries, 2)
+	assert.Equal(t, big.NewInt(0x0102ff), crl.RevokedCertificateEntries[0].SerialNumber)
+	assert.Equal(t, big.NewInt(0x10), crl.RevokedCertificateEntries[1].SerialNumber)
+
+	_, err = MakeCRL(ca, key, []Revoked{{Serial: "zz"}}, time.Hour)
+	require.Error(t, err)
+}
@@ -2,7 +2,9 @@ package tlsutil
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -97,6 +99,13 @@ func MakeCertPool(certs ...*x509.Certificate) *x509.CertPool {
 	return cp
 }
 
+// Fingerprint returns SHA-256 fingerprint of the certificate as lowercase hex.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
 func DecodeAllCerts(bytes []byte) ([]*x509.Certificate, error) {
 	return DecodeAllByType("CERTIFICATE", bytes)
 }
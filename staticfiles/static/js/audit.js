@@ -0,0 +1,62 @@
+const app = Vue.createApp({
+    data: function () {
+        return {
+            data: [],
+            filter: {actor: '', action: '', object: '', ip: ''},
+            check: null,
+            error: null,
+            ts: 0,
+        }
+    },
+
+    mounted() {
+        this.renew();
+    },
+    computed: {
+        all: function () {
+            return this.ts && this.data;
+        },
+    },
+    methods: {
+        query: function () {
+            let p = new URLSearchParams();
+
+            for (const [k, v] of Object.entries(this.filter)) {
+                if (v) p.set(k, v);
+            }
+
+            return p.toString();
+        },
+        renew: function () {
+            let vm = this;
+
+            fetch('/api/audit?limit=500&' + this.query(), {redirect: 'manual'})
+                .then(resp => {
+                    if (resp.status === 403) {
+                        vm.error = 'access denied';
+                        return [];
+                    }
+                    if (!resp.ok) {
+                        window.location.reload();
+                    }
+                    return resp.json();
+                })
+                .then(data => {
+                    vm.data = data;
+                    vm.ts += 1;
+                });
+        },
+        verify: function () {
+            let vm = this;
+
+            fetch('/api/audit/verify')
+                .then(resp => resp.json())
+                .then(data => {
+                    vm.check = data;
+                });
+        },
+        dt: dtShort,
+    },
+});
+
+app.mount('#app');
@@ -5,6 +5,12 @@ const app = Vue.createApp({
             login: "",
             current: null,
             form: {},
+            tokens: [],
+            token_form: {name: '', paths: '', days: 0, write: false},
+            new_token: null,
+            invites: [],
+            invite_form: {},
+            new_invite: null,
             scope1: "",
             error: null,
             ts: 0,
@@ -13,6 +19,19 @@ const app = Vue.createApp({
 
     mounted() {
         this.renew();
+        this.get_invites();
+    },
+    watch: {
+        current: function (n, o) {
+            if (!n) {
+                this.tokens = [];
+                return;
+            }
+            if (!o || n.login !== o.login) {
+                this.new_token = null;
+                this.get_tokens();
+            }
+        },
     },
     methods: {
         renew: function () {
@@ -27,6 +46,9 @@ const app = Vue.createApp({
                 })
                 .then(data => {
                     vm.devices = data.sort((a, b) => a.scope.localeCompare(b.scope) || a.login.toLowerCase().localeCompare(b.login.toLowerCase()));
+                    if (vm.current) {
+                        vm.current = vm.devices.find(d => d.login === vm.current.login) || null;
+                    }
                     vm.ts += 1;
                 });
         },
@@ -37,6 +59,7 @@ const app = Vue.createApp({
                 scope: '',
                 read_scope: ['admin', 'public'],
                 password: '',
+                role: '',
                 disabled: false,
             };
             bootstrap.Modal.getOrCreateInstance(document.getElementById('device_w')).show();
@@ -46,6 +69,7 @@ const app = Vue.createApp({
             this.form = {
                 scope: this.current.scope,
                 password: '',
+                role: '',
                 disabled: this.current.disabled || false,
             };
 
@@ -57,6 +81,124 @@ const app = Vue.createApp({
 
             bootstrap.Modal.getOrCreateInstance(document.getElementById('device_w')).show();
         },
+        revoke: function (c) {
+            let vm = this;
+            let reason = prompt("Revoke certificate " + c.serial + "?\nReason:");
+
+            if (reason === null) return;
+
+            fetch('/api/cert/' + c.serial + '/revoke', {
+                method: "POST",
+                headers: {"Content-Type": "application/json"},
+                body: JSON.stringify({reason: reason}),
+            })
+                .then(resp => resp.json())
+                .then(data => {
+                    if (data.error) {
+                        alert(data.error);
+                    }
+                    vm.renew();
+                });
+        },
+        get_tokens: function () {
+            let vm = this;
+
+            fetch('/api/device/' + this.current.login + '/token')
+                .then(resp => resp.ok ? resp.json() : [])
+                .then(data => {
+                    vm.tokens = data;
+                });
+        },
+        create_token: function () {
+            let vm = this;
+            let body = {
+                name: this.token_form.name,
+                write: this.token_form.write,
+                days: this.token_form.days || 0,
+                paths: this.token_form.paths.split(',').map(s => s.trim()).filter(s => s),
+            };
+
+            fetch('/api/device/' + this.current.login + '/token', {
+                method: "POST",
+                headers: {"Content-Type": "application/json"},
+                body: JSON.stringify(body),
+            })
+                .then(resp => resp.json())
+                .then(data => {
+                    if (data.error) {
+                        alert(data.error);
+                        return;
+                    }
+                    vm.new_token = data.token;
+                    vm.token_form = {name: '', paths: '', days: 0, write: false};
+                    vm.get_tokens();
+                });
+        },
+        revoke_token: function (t) {
+            let vm = this;
+
+            if (!confirm("Revoke token " + t.name + "?")) return;
+
+            fetch('/api/device/' + this.current.login + '/token/' + t.id, {method: "DELETE"})
+                .then(() => vm.get_tokens());
+        },
+        get_invites: function () {
+            let vm = this;
+
+            fetch('/api/enrollment')
+                .then(resp => resp.ok ? resp.json() : [])
+                .then(data => {
+                    vm.invites = data;
+                });
+        },
+        create_invite: function () {
+            this.error = null;
+            this.new_invite = null;
+            this.invite_form = {login: '', scope: '', callsign: '', team: '', role: '', hours: 24, max_uses: 1};
+            bootstrap.Modal.getOrCreateInstance(document.getElementById('enroll_w')).show();
+        },
+        send_invite: function () {
+            let vm = this;
+            let f = this.invite_form;
+            let body = {login: f.login, scope: f.scope, hours: f.hours || 0, max_uses: f.max_uses || 0};
+
+            if (f.callsign || f.team || f.role) {
+                body.profile = {callsign: f.callsign, team: f.team, role: f.role};
+            }
+
+            fetch('/api/enrollment', {
+                method: "POST",
+                headers: {"Content-Type": "application/json"},
+                body: JSON.stringify(body),
+            })
+                .then(resp => {
+                    if (resp.status > 299 && resp.status !== 406) {
+                        vm.error = 'error ' + resp.status;
+                        return null;
+                    }
+                    return resp.json();
+                })
+                .then(data => {
+                    if (!data) return;
+
+                    if (data.error) {
+                        vm.error = data.error;
+                        return;
+                    }
+
+                    vm.error = null;
+                    vm.new_invite = data;
+                    vm.get_invites();
+                });
+        },
+        delete_invite: function (e) {
+            let vm = this;
+
+            if (!confirm("Delete invitation for " + e.login + "?")) return;
+
+            fetch('/api/enrollment/' + e.id, {method: "DELETE"})
+                .then(() => vm.get_invites());
+        },
         form_del: function (s) {
             var idx = this.form.read_scope.indexOf(s);
             if (idx !== -1) {
@@ -87,7 +229,7 @@ const app = Vue.createApp({
                 requestOptions = {
                     method: "POST",
                     headers: {"Content-Type": "application/json"},
-                    body: JSON.stringify(this.form)
+                    body: JSON.stringify({...this.form, admin: this.form.role !== ''})
                 };
                 url = '/api/device';
             }
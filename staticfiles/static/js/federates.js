@@ -0,0 +1,38 @@
+const app = Vue.createApp({
+    data: function () {
+        return {
+            data: [],
+            ts: 0,
+        }
+    },
+
+    mounted() {
+        this.renew();
+        setInterval(this.renew, 5000);
+    },
+    computed: {
+        all: function () {
+            return this.ts && this.data;
+        },
+    },
+    methods: {
+        renew: function () {
+            let vm = this;
+
+            fetch('/api/federate', {redirect: 'manual'})
+                .then(resp => {
+                    if (!resp.ok) {
+                        window.location.reload();
+                    }
+                    return resp.json();
+                })
+                .then(data => {
+                    vm.data = data.sort((a, b) => a.name.toLowerCase().localeCompare(b.name.toLowerCase()));
+                    vm.ts += 1;
+                });
+        },
+        dt: dtShort,
+    },
+});
+
+app.mount('#app');
@@ -3,6 +3,9 @@ const app = Vue.createApp({
         return {
             units: [],
             connections: [],
+            import_scope: '',
+            import_mission: '',
+            import_result: '',
             ts: 0,
         }
     },
@@ -48,6 +51,30 @@ const app = Vue.createApp({
                     vm.ts += 1;
                 });
         },
+        importFile: function () {
+            let vm = this;
+            let files = this.$refs.importFile.files;
+
+            if (files.length === 0) {
+                return;
+            }
+
+            let fd = new FormData();
+            fd.append('file', files[0]);
+            fd.append('scope', this.import_scope);
+            fd.append('mission', this.import_mission);
+
+            fetch('/api/import', {method: 'POST', body: fd})
+                .then(resp => resp.json())
+                .then(data => {
+                    if (data.error) {
+                        vm.import_result = data.error;
+                    } else {
+                        vm.import_result = data.count + ' objects imported';
+                        vm.getData();
+                    }
+                });
+        },
         byCategory: function (s) {
             let arr = this.units.filter(function (u) {
                 return u.category === s